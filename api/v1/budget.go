@@ -0,0 +1,74 @@
+package v1
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// budget caps total number of bytes and images we pull, to prevent runaway jobs from filling the disk
+// NB! nil *budget is valid and does not limit anything.
+type budget struct {
+	maxBytes  int64
+	maxImages int
+	bytes     int64
+	images    int
+	exhausted bool
+	mux       sync.Mutex
+}
+
+// newBudget creates a new budget, or gives nil, if there is neither bytes, nor images limit set
+func newBudget(maxBytes int64, maxImages int) *budget {
+	if maxBytes <= 0 && maxImages <= 0 {
+		return nil
+	}
+
+	return &budget{maxBytes: maxBytes, maxImages: maxImages}
+}
+
+// Reserve tells us if we could pull one more image of the size passed and accounts it, if we could.
+// Once budget would be exceeded, it is exhausted and nothing could be reserved anymore.
+func (b *budget) Reserve(ref string, size int64) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.exhausted {
+		return false
+	}
+
+	if size == 0 && b.maxBytes > 0 {
+		log.Debugf("%s unknown image size, not accounted: %s", fn(), ref)
+	}
+
+	if (b.maxBytes > 0 && b.bytes+size > b.maxBytes) || (b.maxImages > 0 && b.images+1 > b.maxImages) {
+		b.exhausted = true
+
+		log.Warnf(
+			"BUDGET EXHAUSTED (%d images / %d bytes used), will not pull %s and anything after it",
+			b.images, b.bytes, ref,
+		)
+
+		return false
+	}
+
+	b.bytes += size
+	b.images++
+
+	return true
+}
+
+// Exhausted tells us if budget was hit
+func (b *budget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.exhausted
+}
@@ -0,0 +1,48 @@
+package v1
+
+import (
+	"sync"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+)
+
+// capabilities caches registry capabilities probed (See client.ProbeCapabilities), one probe per registry host per run,
+// unless we were probing catalog only and now need repository operations too.
+type capabilities struct {
+	mux     sync.Mutex
+	probed  map[string]*client.Capabilities
+	perRepo map[string]bool
+}
+
+func newCapabilities() *capabilities {
+	return &capabilities{probed: make(map[string]*client.Capabilities), perRepo: make(map[string]bool)}
+}
+
+// Get gives us cached capabilities of the registry, or probes them with the function passed
+func (c *capabilities) Get(registry, repoPath string, probe func() (*client.Capabilities, error)) (*client.Capabilities, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if cached, defined := c.probed[registry]; defined && (c.perRepo[registry] || repoPath == "") {
+		return cached, nil
+	}
+
+	probed, err := probe()
+	if err != nil {
+		return nil, err
+	}
+
+	c.probed[registry] = probed
+	c.perRepo[registry] = repoPath != ""
+
+	return probed, nil
+}
+
+// Reset forgets all capabilities probed, so they are probed again (e.g. on the next daemon cycle)
+func (c *capabilities) Reset() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.probed = make(map[string]*client.Capabilities)
+	c.perRepo = make(map[string]bool)
+}
@@ -0,0 +1,43 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+)
+
+func TestCapabilities_Get(t *testing.T) {
+	assert := assert.New(t)
+
+	probes := 0
+	probe := func() (*client.Capabilities, error) {
+		probes++
+
+		return &client.Capabilities{Catalog: true}, nil
+	}
+
+	c := newCapabilities()
+
+	c.Get("registry.company.io", "", probe)
+	c.Get("registry.company.io", "", probe)
+
+	assert.Equal(1, probes, "should probe catalog once per registry")
+
+	c.Get("registry.company.io", "team-a/app", probe)
+	c.Get("registry.company.io", "team-b/app", probe)
+
+	assert.Equal(2, probes, "should probe again only once we need repository operations")
+
+	caps, err := c.Get("registry.company.io", "", probe)
+
+	assert.Nil(err)
+	assert.True(caps.Catalog)
+	assert.Equal(2, probes, "should take repository probe for catalog too")
+
+	c.Reset()
+	c.Get("registry.company.io", "team-a/app", probe)
+
+	assert.Equal(3, probes, "should probe again after reset")
+}
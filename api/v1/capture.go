@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ivanilves/lstags/tag"
+)
+
+// capture captures parts of tag names by named groups of the regex (See Config.CapturePattern)
+// and keeps only tags matching the regex and having groups captured equal to the filters (See Config.CaptureFilters).
+// NB! nil *capture is valid and keeps all the tags (capturing nothing).
+type capture struct {
+	ex      *regexp.Regexp
+	filters map[string]string
+}
+
+// newCapture compiles capture pattern and parses "NAME=VALUE" filters passed, or gives nil, if there is no pattern
+func newCapture(pattern string, filters []string) (*capture, error) {
+	if pattern == "" {
+		if len(filters) != 0 {
+			return nil, fmt.Errorf("capture filters need a capture pattern: %s", strings.Join(filters, ", "))
+		}
+
+		return nil, nil
+	}
+
+	ex, err := tag.CompileCapturePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, name := range ex.SubexpNames() {
+		names[name] = name != ""
+	}
+
+	c := &capture{ex: ex, filters: make(map[string]string, len(filters))}
+
+	for _, filter := range filters {
+		fields := strings.SplitN(filter, "=", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid capture filter '%s' (should be NAME=VALUE)", filter)
+		}
+		if !names[fields[0]] {
+			return nil, fmt.Errorf("invalid capture filter '%s': no group '%s' in capture pattern '%s'", filter, fields[0], pattern)
+		}
+
+		c.filters[fields[0]] = fields[1]
+	}
+
+	return c, nil
+}
+
+// Match captures named groups from the tag name and tells us if tag should be kept
+func (c *capture) Match(tg *tag.Tag) bool {
+	if c == nil {
+		return true
+	}
+
+	if !tg.Capture(c.ex) {
+		return false
+	}
+
+	for name, value := range c.filters {
+		if captured, _ := tg.GetCapture(name); captured != value {
+			return false
+		}
+	}
+
+	return true
+}
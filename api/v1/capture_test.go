@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/tag"
+)
+
+func TestCapture(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := newCapture("", nil)
+	assert.Nil(err)
+	assert.Nil(c)
+
+	latest, _ := tag.New("latest", tag.Options{Digest: "sha256:aaa"})
+	assert.True(c.Match(latest), "nil capture should keep all the tags")
+
+	c, err = newCapture("^app-(?P<version>[^-]+)-(?P<env>.+)$", []string{"env=prod"})
+	assert.Nil(err)
+
+	prod, _ := tag.New("app-1.0.0-prod", tag.Options{Digest: "sha256:bbb"})
+	staging, _ := tag.New("app-1.0.0-staging", tag.Options{Digest: "sha256:ccc"})
+
+	assert.True(c.Match(prod))
+	assert.Equal(map[string]string{"version": "1.0.0", "env": "prod"}, prod.GetCaptures())
+	assert.False(c.Match(staging), "should not keep tag filtered out")
+	assert.False(c.Match(latest), "should not keep tag not matching the pattern")
+
+	for _, filters := range [][]string{{"env"}, {"arch=amd64"}} {
+		_, err = newCapture("^app-(?P<version>[^-]+)-(?P<env>.+)$", filters)
+		assert.NotNil(err, "should fail on invalid filters: %v", filters)
+	}
+
+	_, err = newCapture("", []string{"env=prod"})
+	assert.NotNil(err, "should fail on filters with no pattern")
+
+	_, err = New(Config{CapturePattern: "^app-(?P<version>[^-]+"})
+	assert.NotNil(err, "should fail fast on invalid capture pattern")
+}
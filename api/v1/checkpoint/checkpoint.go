@@ -0,0 +1,149 @@
+// Package checkpoint provides a persistent record of already completed [re]push operations,
+// so a long running job (e.g. registry mirror) could be restarted without starting from scratch.
+package checkpoint
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// Checkpoint holds a set of completed REFERENCE@DIGEST records backed by a file
+type Checkpoint struct {
+	path  string
+	items map[string]bool
+	mux   sync.Mutex
+}
+
+func key(ref, digest string) string {
+	return ref + "@" + digest
+}
+
+// Load loads checkpoint from the file specified (non-existing file gives us an empty checkpoint)
+// NB! Torn last record (i.e. one with no newline, e.g. if process got killed while adding it) is dropped.
+func Load(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: fix.Path(path), items: make(map[string]bool)}
+
+	data, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+
+		return nil, err
+	}
+
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete != len(data) {
+		// we truncate torn record, so records added after it are not glued to it
+		if err := os.Truncate(c.path, int64(complete)); err != nil {
+			return nil, err
+		}
+
+		data = data[:complete]
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+
+		if line != "" {
+			c.items[line] = true
+		}
+	}
+
+	return c, nil
+}
+
+// Path gets path of the file backing the checkpoint
+func (c *Checkpoint) Path() string {
+	return c.path
+}
+
+// Count counts records present in checkpoint
+func (c *Checkpoint) Count() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return len(c.items)
+}
+
+// Has tells us if passed reference with passed digest is already recorded as completed
+func (c *Checkpoint) Has(ref, digest string) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.items[key(ref, digest)]
+}
+
+// Digests gives us digests recorded for any tag of the repository ("REGISTRY/PATH") passed, sorted and without duplicates,
+// e.g. to know manifests we pushed there, even if tags are not pointing at them anymore
+func (c *Checkpoint) Digests(repository string) []string {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	seen := make(map[string]bool)
+	digests := make([]string, 0)
+	for item := range c.items {
+		i := strings.LastIndex(item, "@")
+		if i == -1 {
+			continue
+		}
+
+		ref, digest := item[:i], item[i+1:]
+		if j := strings.LastIndex(ref, ":"); j > strings.LastIndex(ref, "/") {
+			ref = ref[:j]
+		}
+
+		if ref == repository && !seen[digest] {
+			seen[digest] = true
+			digests = append(digests, digest)
+		}
+	}
+	sort.Strings(digests)
+
+	return digests
+}
+
+// Add records passed reference with passed digest as completed and appends it to the checkpoint file
+func (c *Checkpoint) Add(ref, digest string) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	item := key(ref, digest)
+	if c.items[item] {
+		return nil
+	}
+
+	if err := c.append(item); err != nil {
+		return err
+	}
+
+	c.items[item] = true
+
+	return nil
+}
+
+// append appends a single record to the checkpoint file and syncs it, so every record added is already on disk,
+// when we return, while cost of adding it does not grow with number of records (See Load on torn records)
+func (c *Checkpoint) append(item string) error {
+	f, err := os.OpenFile(c.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteString(item + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
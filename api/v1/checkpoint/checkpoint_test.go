@@ -0,0 +1,109 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_NonExisting(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := Load("/i/do/not/exist/sorry")
+
+	assert.Nil(err, "should NOT give an error for non-existing checkpoint file")
+	assert.Equal(0, c.Count())
+}
+
+func TestAddAndLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+
+	c, err := Load(path)
+	assert.Nil(err)
+
+	assert.False(c.Has("localhost:5000/alpine:3.7", "sha256:aaa"))
+
+	assert.Nil(c.Add("localhost:5000/alpine:3.7", "sha256:aaa"))
+	assert.Nil(c.Add("localhost:5000/busybox:latest", "sha256:bbb"))
+
+	assert.True(c.Has("localhost:5000/alpine:3.7", "sha256:aaa"))
+	assert.False(c.Has("localhost:5000/alpine:3.7", "sha256:bbb"), "same reference with a different digest is NOT completed")
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("localhost:5000/alpine:3.7@sha256:aaa\nlocalhost:5000/busybox:latest@sha256:bbb\n", string(data))
+
+	reloaded, err := Load(path)
+	assert.Nil(err)
+
+	assert.Equal(2, reloaded.Count())
+	assert.True(reloaded.Has("localhost:5000/busybox:latest", "sha256:bbb"))
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(1, len(files), "should leave no other files behind")
+}
+
+func TestLoad_TornRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+	ioutil.WriteFile(path, []byte("localhost:5000/alpine:3.7@sha256:aaa\nlocalhost:5000/busybox:latest@sha2"), 0644)
+
+	c, err := Load(path)
+	assert.Nil(err, "should tolerate torn last record")
+
+	assert.Equal(1, c.Count(), "should drop torn last record")
+	assert.True(c.Has("localhost:5000/alpine:3.7", "sha256:aaa"))
+
+	assert.Nil(c.Add("localhost:5000/busybox:latest", "sha256:bbb"))
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("localhost:5000/alpine:3.7@sha256:aaa\nlocalhost:5000/busybox:latest@sha256:bbb\n", string(data))
+}
+
+func TestAdd_Duplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint")
+
+	c, err := Load(path)
+	assert.Nil(err)
+
+	assert.Nil(c.Add("localhost:5000/alpine:3.7", "sha256:aaa"))
+	assert.Nil(c.Add("localhost:5000/alpine:3.7", "sha256:aaa"))
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("localhost:5000/alpine:3.7@sha256:aaa\n", string(data), "should record the same reference with the same digest once")
+}
+
+func TestDigests(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "checkpoint")
+	defer os.RemoveAll(dir)
+
+	c, err := Load(filepath.Join(dir, "checkpoint"))
+	assert.Nil(err)
+
+	assert.Nil(c.Add("localhost:5000/alpine:3.7", "sha256:bbb"))
+	assert.Nil(c.Add("localhost:5000/alpine:3.8", "sha256:aaa"))
+	assert.Nil(c.Add("localhost:5000/alpine:latest", "sha256:aaa"))
+	assert.Nil(c.Add("localhost:5000/alpine/edge:3.9", "sha256:ccc"))
+
+	assert.Equal([]string{"sha256:aaa", "sha256:bbb"}, c.Digests("localhost:5000/alpine"))
+	assert.Equal([]string{"sha256:ccc"}, c.Digests("localhost:5000/alpine/edge"))
+	assert.Equal([]string{}, c.Digests("localhost:5000/busybox"))
+}
@@ -4,6 +4,7 @@ package collection
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/ivanilves/lstags/repository"
 	"github.com/ivanilves/lstags/tag"
@@ -145,3 +146,150 @@ func (cn *Collection) TaggedRefs() []string {
 
 	return taggedRefs
 }
+
+// Aliases is a group of repository tags pointing at the same content, i.e. having the same digest
+type Aliases struct {
+	Digest string
+	Tags   []string
+}
+
+// Redundant gives us a number of tags we could drop keeping the content still tagged (all tags, but one)
+func (a Aliases) Redundant() int {
+	return len(a.Tags) - 1
+}
+
+// Aliases groups tags of the repository present in the registry by their digests and gives us groups of aliases only
+// (i.e. digests tagged more than once), the biggest groups first. It is a report only, nothing is changed.
+func (cn *Collection) Aliases(ref string) []Aliases {
+	groups := make(map[string]*Aliases)
+	digests := make([]string, 0)
+
+	for _, tg := range cn.Tags(ref) {
+		if tg.GetState() == "LOCAL_ONLY" || tg.GetDigest() == "" {
+			continue
+		}
+
+		group, defined := groups[tg.GetDigest()]
+		if !defined {
+			group = &Aliases{Digest: tg.GetDigest(), Tags: make([]string, 0)}
+			groups[tg.GetDigest()] = group
+			digests = append(digests, tg.GetDigest())
+		}
+
+		group.Tags = append(group.Tags, tg.Name())
+	}
+
+	aliases := make([]Aliases, 0)
+	for _, digest := range digests {
+		if len(groups[digest].Tags) > 1 {
+			sort.Strings(groups[digest].Tags)
+			aliases = append(aliases, *groups[digest])
+		}
+	}
+
+	sort.SliceStable(aliases, func(i, j int) bool {
+		if len(aliases[i].Tags) != len(aliases[j].Tags) {
+			return len(aliases[i].Tags) > len(aliases[j].Tags)
+		}
+
+		return aliases[i].Digest < aliases[j].Digest
+	})
+
+	return aliases
+}
+
+// Group is a group of repository tags having the same value of the named group captured from their names
+type Group struct {
+	Value string
+	Tags  []string
+}
+
+// Groups groups tags of the repository by the value of the named group captured from their names (See tag.Capture),
+// ordered by the value. Tags not having this group captured are not in any group. It is a report only, nothing is changed.
+func (cn *Collection) Groups(ref, name string) []Group {
+	groups := make(map[string]*Group)
+	values := make([]string, 0)
+
+	for _, tg := range cn.Tags(ref) {
+		value, captured := tg.GetCapture(name)
+		if !captured {
+			continue
+		}
+
+		group, defined := groups[value]
+		if !defined {
+			group = &Group{Value: value, Tags: make([]string, 0)}
+			groups[value] = group
+			values = append(values, value)
+		}
+
+		group.Tags = append(group.Tags, tg.Name())
+	}
+
+	sort.Strings(values)
+
+	result := make([]Group, len(values))
+	for i, value := range values {
+		result[i] = *groups[value]
+	}
+
+	return result
+}
+
+// Size is a total size of tags present in the registry
+type Size struct {
+	// Tags is a number of tags taken into account
+	Tags int
+	// Bytes is a naive sum of tag (image) sizes
+	Bytes int64
+	// UniqueBytes is a number of bytes we really store or transfer: blobs (layers) shared by images are counted once
+	UniqueBytes int64
+	// Unknown is a number of tags we do not know size of
+	Unknown int
+}
+
+// TotalSize sums sizes of tags present in the registry for all the repositories in the collection.
+// Blobs (config and layers) shared by images are counted once, for tags we do not know blobs of we take
+// their image sizes (still counting every image digest once).
+func (cn *Collection) TotalSize() Size {
+	var size Size
+
+	blobs := make(map[string]bool)
+	digests := make(map[string]bool)
+
+	for _, ref := range cn.Refs() {
+		for _, tg := range cn.Tags(ref) {
+			if tg.GetState() == "LOCAL_ONLY" {
+				continue
+			}
+
+			size.Tags++
+
+			if tg.GetSize() == 0 && tg.GetBlobs() == nil {
+				size.Unknown++
+				continue
+			}
+
+			size.Bytes += tg.GetSize()
+
+			if digests[tg.GetDigest()] {
+				continue
+			}
+			digests[tg.GetDigest()] = true
+
+			if tg.GetBlobs() == nil {
+				size.UniqueBytes += tg.GetSize()
+				continue
+			}
+
+			for digest, blobSize := range tg.GetBlobs() {
+				if !blobs[digest] {
+					blobs[digest] = true
+					size.UniqueBytes += blobSize
+				}
+			}
+		}
+	}
+
+	return size
+}
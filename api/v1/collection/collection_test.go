@@ -262,3 +262,106 @@ func TestTaggedRefs(t *testing.T) {
 
 	assert.Equal(t, taggedRefs, cn.TaggedRefs())
 }
+
+func TestAliases(t *testing.T) {
+	const ref = "registry.company.io/app"
+
+	newTag := func(name, digest string) *tag.Tag {
+		tg, _ := tag.New(name, tag.Options{Digest: digest})
+
+		return tg
+	}
+
+	tags := []*tag.Tag{
+		newTag("latest", "sha256:bbb"),
+		newTag("v1.0.0", "sha256:aaa"),
+		newTag("stable", "sha256:aaa"),
+		newTag("v1.1.0", "sha256:bbb"),
+		newTag("edge", "sha256:bbb"),
+		newTag("v0.9.0", "sha256:ccc"),
+	}
+
+	cn, _ := New([]string{ref}, map[string][]*tag.Tag{ref: tags})
+
+	assert := assert.New(t)
+
+	aliases := cn.Aliases(ref)
+
+	assert.Equal(
+		[]Aliases{
+			{Digest: "sha256:bbb", Tags: []string{"edge", "latest", "v1.1.0"}},
+			{Digest: "sha256:aaa", Tags: []string{"stable", "v1.0.0"}},
+		},
+		aliases,
+		"should give groups of aliases only, the biggest first",
+	)
+	assert.Equal(2, aliases[0].Redundant())
+	assert.Equal(1, aliases[1].Redundant())
+
+	assert.Equal(0, len(cn.Aliases("registry.company.io/nonexistent")))
+}
+
+func TestGroups(t *testing.T) {
+	const ref = "registry.company.io/app"
+
+	ex, _ := tag.CompileCapturePattern("^app-(?P<version>[^-]+)-(?P<env>.+)$")
+
+	newTag := func(name string) *tag.Tag {
+		tg, _ := tag.New(name, tag.Options{Digest: "sha256:" + name})
+		tg.Capture(ex)
+
+		return tg
+	}
+
+	tags := []*tag.Tag{
+		newTag("app-1.0.0-prod"),
+		newTag("app-1.1.0-staging"),
+		newTag("app-1.1.0-prod"),
+		newTag("latest"),
+	}
+
+	cn, _ := New([]string{ref}, map[string][]*tag.Tag{ref: tags})
+
+	assert := assert.New(t)
+
+	assert.Equal(
+		[]Group{
+			{Value: "prod", Tags: []string{"app-1.0.0-prod", "app-1.1.0-prod"}},
+			{Value: "staging", Tags: []string{"app-1.1.0-staging"}},
+		},
+		cn.Groups(ref, "env"),
+		"should group captured tags only, ordered by the value",
+	)
+
+	assert.Equal(0, len(cn.Groups(ref, "arch")))
+}
+
+func TestTotalSize(t *testing.T) {
+	newTag := func(name, digest string, size int64, blobs map[string]int64) *tag.Tag {
+		tg, _ := tag.New(name, tag.Options{Digest: digest, Size: size, Blobs: blobs})
+
+		return tg
+	}
+
+	refTags := map[string][]*tag.Tag{
+		"registry.company.io/app": {
+			newTag("v1.0.0", "sha256:aaa", 1100, map[string]int64{"sha256:config-a": 100, "sha256:base": 1000}),
+			newTag("v1.1.0", "sha256:bbb", 1600, map[string]int64{"sha256:config-b": 100, "sha256:base": 1000, "sha256:app": 500}),
+			newTag("latest", "sha256:bbb", 1600, map[string]int64{"sha256:config-b": 100, "sha256:base": 1000, "sha256:app": 500}),
+		},
+		"registry.company.io/tool": {
+			newTag("v2.0.0", "sha256:ccc", 3000, nil),
+			newTag("stable", "sha256:ccc", 3000, nil),
+			newTag("edge", "sha256:ddd", 0, nil),
+		},
+	}
+
+	cn, _ := New([]string{"registry.company.io/app", "registry.company.io/tool"}, refTags)
+
+	assert.Equal(
+		t,
+		Size{Tags: 6, Bytes: 10300, UniqueBytes: 4700, Unknown: 1},
+		cn.TotalSize(),
+		"should count shared blobs and images (of tags we know no blobs of) once",
+	)
+}
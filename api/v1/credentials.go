@@ -0,0 +1,51 @@
+package v1
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	dockerconfig "github.com/ivanilves/lstags/docker/config"
+)
+
+// Credentials are username and password (or token) we authenticate to the registry with
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// credentials gives us explicit credentials passed for the registry (e.g. ephemeral CI ones, See PushConfig),
+// bypassing Docker config and auth providers, or resolves them as usual (See getCredentials), if nothing was passed
+func (api *API) credentials(explicit *Credentials, registry, role string) (string, string) {
+	if explicit == nil {
+		return api.getCredentials(registry, role)
+	}
+
+	log.Debugf("%s %s registry %s: will use explicit credentials of '%s'", fn(), role, registry, explicit.Username)
+
+	return explicit.Username, explicit.Password
+}
+
+// explainCredentials tells us how we get credentials for the registry (See credentials): explicit ones passed, if any,
+// or the ones resolved as usual (See ExplainAuth). NB! Decision never carries secrets, so it could be reported.
+func (api *API) explainCredentials(explicit *Credentials, registry string) dockerconfig.AuthDecision {
+	if explicit == nil {
+		return api.ExplainAuth(registry)
+	}
+
+	return dockerconfig.AuthDecision{
+		Registry:  registry,
+		Identity:  registry,
+		Source:    dockerconfig.AuthSourceExplicit,
+		Username:  explicit.Username,
+		HasSecret: explicit.Password != "",
+	}
+}
+
+// registryAuth gives us base64 authentication string ("X-Registry-Auth") for Docker daemon from explicit credentials,
+// or "", if nothing was passed (Docker client will resolve it from Docker config on its own then)
+func (c *Credentials) registryAuth() string {
+	if c == nil {
+		return ""
+	}
+
+	return dockerconfig.EncodeRegistryAuth(c.Username, c.Password)
+}
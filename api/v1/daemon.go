@@ -0,0 +1,50 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	dockerclient "github.com/ivanilves/lstags/docker/client"
+)
+
+// DaemonError is returned by operations needing Docker daemon (pull, push, tar export and import), if it is not available
+// NB! Operations not needing daemon (listing tags, copying images registry to registry etc) work without it.
+type DaemonError struct {
+	Err error
+}
+
+// Error implements error interface
+func (e *DaemonError) Error() string {
+	return fmt.Sprintf("Docker daemon is not available: %s", e.Err.Error())
+}
+
+// docker gives us Docker client connected to the daemon, it is created on the first use (so we do not need daemon,
+// unless we really use it). If daemon is not available, we try again next time (e.g. on the next run in daemon mode).
+func (api *API) docker() (*dockerclient.DockerClient, error) {
+	api.daemonMux.Lock()
+	defer api.daemonMux.Unlock()
+
+	if api.dockerClient != nil {
+		return api.dockerClient, nil
+	}
+
+	dc, err := dockerclient.NewForContext(
+		api.dockerConfig,
+		dockerclient.ContextsDir(api.config.DockerJSONConfigFile),
+		api.config.DockerContext,
+	)
+	if err == nil {
+		err = dc.Ping(context.Background())
+	}
+	if err != nil {
+		log.Debugf("%s %s", fn(), err.Error())
+
+		return nil, &DaemonError{Err: err}
+	}
+
+	api.dockerClient = dc
+
+	return dc, nil
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoDaemon(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	dockerHost, defined := os.LookupEnv("DOCKER_HOST")
+	os.Setenv("DOCKER_HOST", "unix:///nonexistent/docker.sock")
+	defer func() {
+		if defined {
+			os.Setenv("DOCKER_HOST", dockerHost)
+		} else {
+			os.Unsetenv("DOCKER_HOST")
+		}
+	}()
+
+	server := runTagRegistry(digest)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err, "should be created without daemon")
+
+	_, err = api.docker()
+	assert.IsType(&DaemonError{}, err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err, "should list tags without daemon")
+	assert.Equal(1, cn.TagCount())
+	assert.Equal("ABSENT", cn.Tags(cn.Refs()[0])[0].GetState())
+
+	summary, err := api.PullTagsWithSummary(cn)
+	assert.NotNil(err, "should fail to pull without daemon")
+	assert.Equal(1, summary.Failed)
+
+	assert.IsType(&DaemonError{}, api.Export(context.Background(), []string{registry + "/foo:latest"}, ioutil.Discard))
+
+	_, err = api.ResolveDigest(registry + "/foo@sha256:1111")
+	assert.IsType(&DaemonError{}, err)
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ivanilves/lstags/repository"
+)
+
+// denylist matches references we never pull or push, whatever include filters (tags and tag filters) say.
+// Pattern is either a "/REGEX/" or a glob, where "*" matches any characters (incl. "/") and "?" matches a single one.
+// NB! nil *denylist is valid and does not deny anything.
+type denylist struct {
+	patterns []string
+	res      []*regexp.Regexp
+}
+
+// newDenylist compiles patterns passed, or gives nil, if there are no patterns
+func newDenylist(patterns []string) (*denylist, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	d := &denylist{patterns: patterns, res: make([]*regexp.Regexp, len(patterns))}
+
+	for i, pattern := range patterns {
+		expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+		if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = pattern[1 : len(pattern)-1]
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denylist pattern '%s': %s", pattern, err.Error())
+		}
+
+		d.res[i] = re
+	}
+
+	return d, nil
+}
+
+// Match gives us the pattern repository tag matches, if it matches any.
+// Tag is matched in all the forms we could refer to it: "REGISTRY/PATH:TAG", "REPOSITORY:TAG" (as in the source reference)
+// and "NAME:TAG" (with no registry and "library/" for Docker Hub images), e.g. "registry.hub.docker.com/library/alpine:3.7" and "alpine:3.7".
+func (d *denylist) Match(repo *repository.Repository, tagName string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	refs := []string{
+		repo.Registry() + "/" + repo.Path() + ":" + tagName,
+		repo.Full() + ":" + tagName,
+		repo.Name() + ":" + tagName,
+	}
+	if repo.IsDefaultRegistry() {
+		refs = append(refs, strings.TrimPrefix(repo.Name(), "library/")+":"+tagName)
+	}
+
+	for i, re := range d.res {
+		for _, ref := range refs {
+			if re.MatchString(ref) {
+				return d.patterns[i], true
+			}
+		}
+	}
+
+	return "", false
+}
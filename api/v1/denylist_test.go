@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/repository"
+)
+
+func TestDenylist(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := newDenylist([]string{"*:debug", "quay.io/coreos/awscli:edge", "alpine:3.?", `/^gcr\.io/.*:v1\.9\./`})
+	assert.Nil(err)
+
+	var testCases = []struct {
+		ref     string
+		tag     string
+		pattern string
+	}{
+		{"alpine", "debug", "*:debug"},
+		{"quay.io/coreos/awscli", "debug", "*:debug"},
+		{"quay.io/coreos/awscli", "edge", "quay.io/coreos/awscli:edge"},
+		{"quay.io/coreos/awscli", "latest", ""},
+		{"alpine", "3.7", "alpine:3.?"},
+		{"library/alpine", "3.8", "alpine:3.?"},
+		{"alpine", "3.10", ""},
+		{"gcr.io/google-containers/hyperkube", "v1.9.3", `/^gcr\.io/.*:v1\.9\./`},
+		{"gcr.io/google-containers/hyperkube", "v1.10.0", ""},
+	}
+
+	for _, testCase := range testCases {
+		repo, err := repository.ParseRef(testCase.ref)
+		assert.Nil(err)
+
+		pattern, denied := d.Match(repo, testCase.tag)
+
+		assert.Equal(testCase.pattern != "", denied, "unexpected match of %s:%s", testCase.ref, testCase.tag)
+		assert.Equal(testCase.pattern, pattern, "unexpected pattern matched by %s:%s", testCase.ref, testCase.tag)
+	}
+
+	_, err = newDenylist([]string{"/[/"})
+	assert.NotNil(err, "should be an error for invalid regex pattern")
+
+	d, err = newDenylist(nil)
+	assert.Nil(err)
+	assert.Nil(d, "should give nil denylist for no patterns")
+
+	repo, _ := repository.ParseRef("alpine")
+	_, denied := d.Match(repo, "debug")
+	assert.False(denied, "nil denylist should not deny anything")
+}
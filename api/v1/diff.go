@@ -0,0 +1,286 @@
+package v1
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag"
+	"github.com/ivanilves/lstags/tag/remote"
+	"github.com/ivanilves/lstags/util/wait"
+)
+
+// TagState is a state of the tag in the registry diff (See TagDiff)
+type TagState string
+
+const (
+	// TagStateInSync is a tag present in both registries with the same digest
+	TagStateInSync TagState = "IN_SYNC"
+	// TagStateMissing is a tag present in the source registry, but not in the destination one
+	TagStateMissing TagState = "MISSING"
+	// TagStateMismatch is a tag present in both registries, but having different digests
+	TagStateMismatch TagState = "MISMATCH"
+	// TagStateVanished is a tag present in the destination registry, but not in the source one (e.g. deleted from it)
+	TagStateVanished TagState = "VANISHED"
+	// TagStateExcluded is a tag missing in the destination registry, we never copy it, as it is denylisted (See Config.Denylist)
+	TagStateExcluded TagState = "EXCLUDED"
+	// TagStateProtected is a tag having different digest in the destination registry, we never overwrite it, as it is denylisted
+	TagStateProtected TagState = "PROTECTED"
+	// TagStateError is a tag (or the whole repository, if there is no tag) we failed to compare (See TagDiff.Err)
+	TagStateError TagState = "ERROR"
+)
+
+// TagDiff holds state of a single tag of repository present in both registries (e.g. to render a reconciliation table)
+type TagDiff struct {
+	// Path is a repository path (the same in both registries)
+	Path string
+	// Tag is a tag name (empty, if we failed to compare the whole repository)
+	Tag string
+	// State is a state of the tag (See TagState)
+	State TagState
+	// SrcDigest is a digest of the tag in the source registry (empty, if there is no such tag)
+	SrcDigest string
+	// DstDigest is a digest of the tag in the destination registry (empty, if there is no such tag)
+	DstDigest string
+	// Err is an error we got while comparing the tag, if its state is TagStateError
+	Err error
+}
+
+// RegistryDiff holds differences between repositories of the source and destination registries
+type RegistryDiff struct {
+	// MissingRepos are paths of repositories present in the source registry, but not in the destination one
+	MissingRepos []string
+	// ExtraRepos are paths of repositories present in the destination registry, but not in the source one
+	ExtraRepos []string
+	// MissingTags are tags ("PATH:TAG") present in the source repository, but not in the destination one
+	MissingTags []string
+	// ExtraTags are tags ("PATH:TAG") present in the destination repository, but not in the source one
+	ExtraTags []string
+	// Mismatches are tags present in both source and destination repositories, but having different digests
+	Mismatches []DigestMismatch
+	// Tags hold state of every tag of repositories present in both registries, sorted by path and tag
+	// NB! Unlike lists above, states take denylist into account (See TagStateExcluded and TagStateProtected).
+	Tags []TagDiff
+}
+
+// IsEmpty tells us if there is no difference between registries (and we failed to compare nothing)
+func (d RegistryDiff) IsEmpty() bool {
+	return len(d.MissingRepos) == 0 && len(d.ExtraRepos) == 0 &&
+		len(d.MissingTags) == 0 && len(d.ExtraTags) == 0 && len(d.Mismatches) == 0 && d.Count(TagStateError) == 0
+}
+
+// Count counts tags having the state passed
+func (d RegistryDiff) Count(state TagState) int {
+	count := 0
+
+	for _, td := range d.Tags {
+		if td.State == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+// getTagState gives state of the tag joined from the source and destination ones (See tag.Join)
+func (api *API) getTagState(repo *repository.Repository, tg *tag.Tag) TagState {
+	_, denied := api.denylist.Match(repo, tg.Name())
+
+	switch tg.GetState() {
+	case "ABSENT":
+		if denied {
+			return TagStateExcluded
+		}
+		return TagStateMissing
+	case "LOCAL_ONLY":
+		return TagStateVanished
+	case "ERROR":
+		return TagStateError
+	case "CHANGED":
+		if denied {
+			return TagStateProtected
+		}
+		return TagStateMismatch
+	default:
+		return TagStateInSync
+	}
+}
+
+// getRepoPaths takes repository paths from references collected from the registry catalog
+func getRepoPaths(registry string, refs []string) map[string]bool {
+	paths := make(map[string]bool, len(refs))
+
+	for _, ref := range refs {
+		paths[strings.TrimPrefix(ref, registry+"/")] = true
+	}
+
+	return paths
+}
+
+func (api *API) fetchRepoTags(ctx context.Context, registry, path string) (map[string]*tag.Tag, error) {
+	repo, err := repository.ParseRef(registry + "/" + path)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password := api.getCredentials(registry, "pull")
+
+	return remote.FetchTags(ctx, repo, username, password)
+}
+
+// DiffRegistries compares repositories (having paths matching the filter regexp) of the source and destination registries
+// NB! Tags are compared only for repositories present in both registries, in batches of "ConcurrentRequests" size.
+// Source registry could be passed as "REGISTRY/GLOB", then glob is applied to repository paths of both registries.
+// If we fail to compare some repositories, we give the diff of all the others along with *CollectError,
+// while failed repositories are in the diff as tags having TagStateError state.
+func (api *API) DiffRegistries(ctx context.Context, src, dst, filter string) (RegistryDiff, error) {
+	diff := RegistryDiff{
+		MissingRepos: make([]string, 0),
+		ExtraRepos:   make([]string, 0),
+		MissingTags:  make([]string, 0),
+		ExtraTags:    make([]string, 0),
+		Mismatches:   make([]DigestMismatch, 0),
+		Tags:         make([]TagDiff, 0),
+	}
+	errs := make(map[string]error)
+
+	src, glob := splitRegistryGlob(src)
+
+	srcRefs, err := api.collectRepositories(src, glob, filter)
+	if err != nil {
+		return RegistryDiff{}, err
+	}
+	dstRefs, err := api.collectRepositories(dst, glob, filter)
+	if err != nil {
+		return RegistryDiff{}, err
+	}
+
+	srcPaths := getRepoPaths(src, srcRefs)
+	dstPaths := getRepoPaths(dst, dstRefs)
+
+	commonPaths := make([]string, 0)
+	for path := range srcPaths {
+		if dstPaths[path] {
+			commonPaths = append(commonPaths, path)
+		} else {
+			diff.MissingRepos = append(diff.MissingRepos, path)
+		}
+	}
+	for path := range dstPaths {
+		if !srcPaths[path] {
+			diff.ExtraRepos = append(diff.ExtraRepos, path)
+		}
+	}
+	sort.Strings(commonPaths)
+
+	var mux sync.Mutex
+
+	batchedSlicesOfPaths := getBatchedSlices(api.config.ConcurrentRequests, commonPaths...)
+
+	for bindex, bpaths := range batchedSlicesOfPaths {
+		if err := ctx.Err(); err != nil {
+			return RegistryDiff{}, err
+		}
+
+		log.Infof("DIFF BATCH %d of %d", bindex+1, len(batchedSlicesOfPaths))
+
+		done := make(chan error, len(bpaths))
+
+		for _, path := range bpaths {
+			go func(path string, done chan error) {
+				fail := func(err error) {
+					log.Warnf("FAILED %s: %s", src+"/"+path, err.Error())
+
+					mux.Lock()
+					errs[path] = err
+					diff.Tags = append(diff.Tags, TagDiff{Path: path, State: TagStateError, Err: err})
+					mux.Unlock()
+
+					done <- nil
+				}
+
+				repo, err := repository.ParseRef(src + "/" + path)
+				if err != nil {
+					fail(err)
+					return
+				}
+				srcTags, err := api.fetchRepoTags(ctx, src, path)
+				if err != nil {
+					fail(err)
+					return
+				}
+				dstTags, err := api.fetchRepoTags(ctx, dst, path)
+				if err != nil {
+					fail(err)
+					return
+				}
+
+				_, _, joinedTags := tag.Join(srcTags, dstTags, nil)
+
+				mux.Lock()
+				for name, tg := range joinedTags {
+					td := TagDiff{Path: path, Tag: name, State: api.getTagState(repo, tg)}
+					if srcTag, defined := srcTags[name]; defined {
+						td.SrcDigest = srcTag.GetDigest()
+						td.Err = srcTag.GetError()
+					}
+					if dstTag, defined := dstTags[name]; defined {
+						td.DstDigest = dstTag.GetDigest()
+						if td.Err == nil {
+							td.Err = dstTag.GetError()
+						}
+					}
+					diff.Tags = append(diff.Tags, td)
+
+					switch tg.GetState() {
+					case "ABSENT":
+						diff.MissingTags = append(diff.MissingTags, path+":"+name)
+					case "LOCAL_ONLY":
+						diff.ExtraTags = append(diff.ExtraTags, path+":"+name)
+					case "CHANGED":
+						diff.Mismatches = append(diff.Mismatches, DigestMismatch{
+							SrcRef:    src + "/" + path + ":" + name,
+							SrcDigest: srcTags[name].GetDigest(),
+							DstRef:    dst + "/" + path + ":" + name,
+							DstDigest: dstTags[name].GetDigest(),
+						})
+					}
+				}
+				mux.Unlock()
+
+				log.Infof("COMPARED %s => %s", src+"/"+path, dst+"/"+path)
+
+				done <- nil
+			}(path, done)
+		}
+
+		if err := wait.Until(done); err != nil {
+			return RegistryDiff{}, err
+		}
+
+		time.Sleep(api.config.WaitBetween)
+	}
+
+	sort.Strings(diff.MissingRepos)
+	sort.Strings(diff.ExtraRepos)
+	sort.Strings(diff.MissingTags)
+	sort.Strings(diff.ExtraTags)
+	sort.Slice(diff.Mismatches, func(i, j int) bool { return diff.Mismatches[i].SrcRef < diff.Mismatches[j].SrcRef })
+	sort.Slice(diff.Tags, func(i, j int) bool {
+		if diff.Tags[i].Path != diff.Tags[j].Path {
+			return diff.Tags[i].Path < diff.Tags[j].Path
+		}
+		return diff.Tags[i].Tag < diff.Tags[j].Tag
+	})
+
+	if len(errs) != 0 {
+		return diff, &CollectError{Errors: errs}
+	}
+
+	return diff, nil
+}
@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// runCatalogRegistry serves catalog of repositories passed as a map of [path][tag]digest
+func runCatalogRegistry(repos map[string]map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		if r.URL.Path == "/v2/_catalog" {
+			paths := make([]string, 0)
+			for path := range repos {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+
+			json.NewEncoder(w).Encode(map[string][]string{"repositories": paths})
+			return
+		}
+
+		for path, tags := range repos {
+			if r.URL.Path == "/v2/"+path+"/tags/list" {
+				names := make([]string, 0)
+				for name := range tags {
+					names = append(names, name)
+				}
+
+				json.NewEncoder(w).Encode(map[string]interface{}{"name": path, "tags": names})
+				return
+			}
+
+			for name, digest := range tags {
+				if r.URL.Path == "/v2/"+path+"/manifests/"+name {
+					w.Header().Set("Docker-Content-Digest", digest)
+					w.Write([]byte(`{"schemaVersion":2}`))
+					return
+				}
+			}
+		}
+
+		http.NotFound(w, r)
+	}))
+}
+
+func TestDiffRegistries(t *testing.T) {
+	const d1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const d2 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	srcServer := runCatalogRegistry(map[string]map[string]string{
+		"team-a/app": {"v1": d1, "v2": d1, "v3": d1},
+		"team-a/db":  {"latest": d1},
+		"team-b/app": {"latest": d1},
+	})
+	defer srcServer.Close()
+	dstServer := runCatalogRegistry(map[string]map[string]string{
+		"team-a/app": {"v1": d1, "v2": d2, "v0": d1},
+		"team-a/old": {"latest": d1},
+		"team-b/app": {"latest": d1},
+	})
+	defer dstServer.Close()
+
+	src := strings.TrimPrefix(srcServer.URL, "http://")
+	dst := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{ConcurrentRequests: 1})
+	assert.Nil(err)
+
+	diff, err := api.DiffRegistries(context.Background(), src, dst, "^team-a/")
+
+	assert.Nil(err)
+	assert.False(diff.IsEmpty())
+	assert.Equal([]string{"team-a/db"}, diff.MissingRepos)
+	assert.Equal([]string{"team-a/old"}, diff.ExtraRepos)
+	assert.Equal([]string{"team-a/app:v3"}, diff.MissingTags)
+	assert.Equal([]string{"team-a/app:v0"}, diff.ExtraTags)
+	assert.Equal(
+		[]DigestMismatch{{SrcRef: src + "/team-a/app:v2", SrcDigest: d1, DstRef: dst + "/team-a/app:v2", DstDigest: d2}},
+		diff.Mismatches,
+	)
+
+	assert.Equal(
+		[]TagDiff{
+			{Path: "team-a/app", Tag: "v0", State: TagStateVanished, DstDigest: d1},
+			{Path: "team-a/app", Tag: "v1", State: TagStateInSync, SrcDigest: d1, DstDigest: d1},
+			{Path: "team-a/app", Tag: "v2", State: TagStateMismatch, SrcDigest: d1, DstDigest: d2},
+			{Path: "team-a/app", Tag: "v3", State: TagStateMissing, SrcDigest: d1},
+		},
+		diff.Tags,
+	)
+
+	diff, err = api.DiffRegistries(context.Background(), src, dst, "^team-b/")
+
+	assert.Nil(err)
+	assert.True(diff.IsEmpty(), "should be no difference: %+v", diff)
+
+	diff, err = api.DiffRegistries(context.Background(), src+"/team-b", dst, "")
+
+	assert.Nil(err)
+	assert.True(diff.IsEmpty(), "should apply source registry glob to both registries: %+v", diff)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = api.DiffRegistries(ctx, src, dst, "")
+
+	assert.Equal(context.Canceled, err, "should stop, if context is done")
+}
+
+func TestDiffRegistries_TagStates(t *testing.T) {
+	const d1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const d2 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	srcServer := runCatalogRegistry(map[string]map[string]string{
+		"app":    {"v1": d1, "v2": d1, "debug": d1, "debug-old": d1},
+		"broken": {"latest": d1},
+	})
+	defer srcServer.Close()
+	dstCatalog := runCatalogRegistry(map[string]map[string]string{
+		"app":    {"v1": d1, "v2": d1, "debug-old": d2},
+		"broken": {"latest": d1},
+	})
+	defer dstCatalog.Close()
+	dstServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v2/broken/") {
+			http.Error(w, "broken", http.StatusForbidden)
+			return
+		}
+
+		dstCatalog.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer dstServer.Close()
+
+	src := strings.TrimPrefix(srcServer.URL, "http://")
+	dst := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{Denylist: []string{"*:debug*"}})
+	assert.Nil(err)
+
+	diff, err := api.DiffRegistries(context.Background(), src, dst, "")
+
+	assert.IsType(&CollectError{}, err, "should tell us about repositories we failed to compare")
+	assert.False(diff.IsEmpty())
+	assert.Len(diff.Tags, 5, "should give diff of all the other repositories")
+
+	states := make(map[string]TagState)
+	for _, td := range diff.Tags {
+		states[td.Path+":"+td.Tag] = td.State
+	}
+
+	assert.Equal(
+		map[string]TagState{
+			"app:v1":        TagStateInSync,
+			"app:v2":        TagStateInSync,
+			"app:debug":     TagStateExcluded,
+			"app:debug-old": TagStateProtected,
+			"broken:":       TagStateError,
+		},
+		states,
+	)
+	assert.Equal(1, diff.Count(TagStateError))
+}
@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag"
+	"github.com/ivanilves/lstags/tag/remote"
+)
+
+// DriftError is returned, if tag was changed (e.g. re-pushed by CI) after we listed it and before we acted on it
+type DriftError struct {
+	Ref           string
+	ListedDigest  string
+	CurrentDigest string
+}
+
+// Error implements error interface
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("%s changed since it was listed: %s => %s", e.Ref, e.ListedDigest, e.CurrentDigest)
+}
+
+// checkDrift re-fetches digest of the tag from the registry and compares it with the one we got while listing tags
+// (See Config.CheckDrift). Drift is only logged, unless we fail on it. If digest could not be re-fetched, we go on.
+// NB! Explicit credentials (See PushConfig.SrcCredentials) are used, if passed.
+func (api *API) checkDrift(repo *repository.Repository, tg *tag.Tag, fail bool, auth *Credentials) error {
+	if !api.config.CheckDrift || tg.GetDigest() == "" {
+		return nil
+	}
+
+	ref := repo.Name() + ":" + tg.Name()
+
+	username, password := api.credentials(auth, repo.Registry(), "pull")
+
+	digest, err := remote.FetchDigest(context.Background(), repo, tg.Name(), username, password)
+	if err != nil {
+		log.Warnf("unable to re-check digest of %s: %s", ref, err.Error())
+
+		return nil
+	}
+
+	if digest == tg.GetDigest() {
+		return nil
+	}
+
+	err = &DriftError{Ref: ref, ListedDigest: tg.GetDigest(), CurrentDigest: digest}
+	if fail || api.config.FailOnDrift {
+		return err
+	}
+
+	log.Warnf("DRIFTED %s", err.Error())
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDrift(t *testing.T) {
+	const listedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const currentDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	digest := listedDigest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+		case "/v2/foo/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err)
+
+	repo, tg := cn.Repo(cn.Refs()[0]), cn.Tags(cn.Refs()[0])[0]
+
+	digest = currentDigest
+
+	assert.Nil(api.checkDrift(repo, tg, true, nil), "should check nothing, if drift check is disabled")
+
+	api.config.CheckDrift = true
+
+	assert.Nil(api.checkDrift(repo, tg, false, nil), "should only warn about changed tag")
+
+	err = api.checkDrift(repo, tg, true, nil)
+	if assert.IsType(&DriftError{}, err, "should fail on changed tag") {
+		assert.Equal(listedDigest, err.(*DriftError).ListedDigest)
+		assert.Equal(currentDigest, err.(*DriftError).CurrentDigest)
+	}
+
+	summary, err := api.PullTagsWithSummary(cn)
+	assert.Nil(err)
+	assert.Equal(1, summary.Done, "should pull changed tag, if we do not fail on drift")
+
+	api.config.FailOnDrift = true
+
+	summary, err = api.PullTagsWithSummary(cn)
+	assert.NotNil(err)
+	assert.Equal(1, summary.Failed, "should fail to pull changed tag")
+
+	digest = listedDigest
+
+	assert.Nil(api.checkDrift(repo, tg, true, nil), "should pass unchanged tag")
+}
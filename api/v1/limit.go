@@ -0,0 +1,32 @@
+package v1
+
+// limit caps number of operations (e.g. pulls or pushes) we run at once
+// NB! nil limit is valid and does not limit anything.
+type limit chan struct{}
+
+// newLimit creates a new limit of operations run at once, or gives nil, if there is no limit (0)
+func newLimit(n int) limit {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(limit, n)
+}
+
+// Acquire waits until we could run one more operation and accounts it
+func (l limit) Acquire() {
+	if l == nil {
+		return
+	}
+
+	l <- struct{}{}
+}
+
+// Release tells us operation is completed, so the next one could be run
+func (l limit) Release() {
+	if l == nil {
+		return
+	}
+
+	<-l
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(newLimit(0), "should not limit anything, if limit is zero")
+
+	var l limit
+	l.Acquire()
+	l.Release()
+
+	l = newLimit(2)
+
+	var running, maxRunning int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			l.Acquire()
+			defer l.Release()
+
+			n := atomic.AddInt32(&running, 1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			atomic.AddInt32(&running, -1)
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(int32(2), maxRunning, "should run no more than 2 operations at once")
+}
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/lockfile"
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag/remote"
+)
+
+// VerifyLockfile checks digests of all images locked (See lockfile.FromCollection) against ones registry gives us now.
+// We give state of every image reference locked, sorted by reference: TagStateInSync, TagStateMismatch (digest changed),
+// TagStateMissing (tag is gone) or TagStateError (we failed to check it, See TagDiff.Err).
+// NB! Path of TagDiff is a repository reference ("REGISTRY/PATH"), locked digest is SrcDigest, current one is DstDigest.
+func (api *API) VerifyLockfile(ctx context.Context, lf *lockfile.Lockfile) ([]TagDiff, error) {
+	refs := lf.Refs()
+
+	diffs := make([]TagDiff, len(refs))
+	done := make(chan struct{}, len(refs))
+	requests := newLimit(api.config.ConcurrentRequests)
+
+	for i, ref := range refs {
+		go func(i int, ref string) {
+			defer func() { done <- struct{}{} }()
+
+			requests.Acquire()
+			defer requests.Release()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			diffs[i] = api.verifyLocked(ctx, ref, lf)
+		}(i, ref)
+	}
+
+	for range refs {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-done:
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].Path+":"+diffs[i].Tag < diffs[j].Path+":"+diffs[j].Tag
+	})
+
+	return diffs, nil
+}
+
+// verifyLocked checks digest of a single image reference locked ("REPO:TAG") against the one registry gives us now
+func (api *API) verifyLocked(ctx context.Context, ref string, lf *lockfile.Lockfile) TagDiff {
+	locked, _ := lf.Digest(ref)
+
+	td := TagDiff{Path: ref, State: TagStateError, SrcDigest: locked}
+
+	repo, err := repository.ParseRef(ref)
+	if err == nil && !repo.IsSingle() {
+		err = fmt.Errorf("locked reference should be a single REPO:TAG one: %s", ref)
+	}
+	if err != nil {
+		td.Err = err
+
+		return td
+	}
+
+	td.Path = Ref{Registry: repo.Registry(), Path: repo.Path()}.Repository()
+	td.Tag = repo.Tags()[0]
+
+	// canonical DockerHub references (e.g. "docker.io/library/alpine:3.7") are fetched from "registry.hub.docker.com"
+	if repo.IsHubRegistry() && !repo.IsDefaultRegistry() {
+		if repo, err = repository.ParseRef(repository.HubRegistry + "/" + repo.Path() + ":" + td.Tag); err != nil {
+			td.Err = err
+
+			return td
+		}
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	digest, err := remote.FetchDigest(ctx, repo, td.Tag, username, password)
+	if err != nil {
+		var notFound *client.ManifestNotFoundError
+		if !errors.As(err, &notFound) {
+			td.Err = err
+
+			return td
+		}
+	}
+	td.DstDigest = digest
+
+	switch {
+	case digest == "":
+		td.State = TagStateMissing
+	case digest != locked:
+		td.State = TagStateMismatch
+	default:
+		td.State = TagStateInSync
+	}
+
+	log.Debugf("%s %s: %s (%s => %s)", fn(), ref, td.State, locked, digest)
+
+	return td
+}
@@ -0,0 +1,75 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/lockfile"
+)
+
+func TestVerifyLockfile(t *testing.T) {
+	const lockedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const currentDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	digests := map[string]string{
+		"/v2/foo/manifests/stable": lockedDigest,
+		"/v2/foo/manifests/moved":  currentDigest,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		digest, defined := digests[r.URL.Path]
+		if !defined {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	lf := lockfile.New()
+	lf.Set(registry+"/foo:stable", lockedDigest)
+	lf.Set(registry+"/foo:moved", lockedDigest)
+	lf.Set(registry+"/foo:gone", lockedDigest)
+	lf.Set(registry+"/foo", lockedDigest)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	diffs, err := api.VerifyLockfile(context.Background(), lf)
+	assert.Nil(err)
+	assert.Equal(4, len(diffs))
+
+	states := make(map[string]TagState)
+	for _, td := range diffs {
+		states[td.Path+":"+td.Tag] = td.State
+
+		assert.Equal(lockedDigest, td.SrcDigest)
+	}
+
+	assert.Equal(
+		map[string]TagState{
+			registry + "/foo:":       TagStateError,
+			registry + "/foo:gone":   TagStateMissing,
+			registry + "/foo:moved":  TagStateMismatch,
+			registry + "/foo:stable": TagStateInSync,
+		},
+		states,
+	)
+
+	assert.Equal(currentDigest, diffs[2].DstDigest)
+}
@@ -0,0 +1,176 @@
+// Package lockfile provides a lockfile: image references ("REPO:TAG") mapped to digests they resolved to,
+// so images of the whole environment could be pinned and checked for drift later on.
+// Lockfile is written either as "REPO:TAG DIGEST" lines, or as JSON (if its file name ends with ".json"),
+// references are always sorted, so the same tags and digests give us the same lockfile byte for byte.
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ivanilves/lstags/api/v1/collection"
+	"github.com/ivanilves/lstags/util/fix"
+	"github.com/ivanilves/lstags/util/output"
+)
+
+// Lockfile maps image references ("REPO:TAG") to their digests
+type Lockfile struct {
+	digests map[string]string
+}
+
+type jsonLockfile struct {
+	Images map[string]string `json:"images"`
+}
+
+// New creates a new (empty) Lockfile
+func New() *Lockfile {
+	return &Lockfile{digests: make(map[string]string)}
+}
+
+// FromCollection creates a Lockfile with all tags collected, referenced in their canonical form
+// (e.g. "docker.io/library/alpine:3.7"). Tags not present in registry (e.g. local-only ones) or failed to fetch are skipped.
+func FromCollection(cn *collection.Collection) *Lockfile {
+	lf := New()
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, tg := range cn.Tags(ref) {
+			if tg.GetError() != nil || tg.GetState() == "LOCAL_ONLY" || tg.GetState() == "NOT_FOUND" {
+				continue
+			}
+
+			lf.Set(repo.Canonical()+":"+tg.Name(), tg.GetDigest())
+		}
+	}
+
+	return lf
+}
+
+// Set sets digest of the image reference
+func (lf *Lockfile) Set(ref, digest string) {
+	lf.digests[ref] = digest
+}
+
+// Digest gets digest of the image reference, if it is locked
+func (lf *Lockfile) Digest(ref string) (string, bool) {
+	digest, defined := lf.digests[ref]
+
+	return digest, defined
+}
+
+// Refs gives us all image references locked, sorted
+func (lf *Lockfile) Refs() []string {
+	refs := make([]string, 0, len(lf.digests))
+	for ref := range lf.digests {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	return refs
+}
+
+// Len gives us number of image references locked
+func (lf *Lockfile) Len() int {
+	return len(lf.digests)
+}
+
+// isJSON tells us if lockfile is (to be) written as JSON, i.e. its file name ends with ".json"
+func isJSON(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".json")
+}
+
+// Encode writes lockfile out: as JSON (indented, keys sorted), if asked to, or as sorted "REPO:TAG DIGEST" lines otherwise
+func (lf *Lockfile) Encode(w io.Writer, asJSON bool) error {
+	if asJSON {
+		b, err := json.MarshalIndent(jsonLockfile{Images: lf.digests}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(b, '\n'))
+
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, ref := range lf.Refs() {
+		fmt.Fprintf(&b, "%s %s\n", ref, lf.digests[ref])
+	}
+
+	_, err := b.WriteTo(w)
+
+	return err
+}
+
+// Save writes lockfile into the file passed (replaced atomically), format is chosen by the file name (See Encode)
+func (lf *Lockfile) Save(path string) error {
+	o, err := output.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := lf.Encode(o, isJSON(path)); err != nil {
+		o.Discard()
+		return err
+	}
+
+	return o.Commit()
+}
+
+// Decode reads lockfile written by Encode (in "REPO:TAG DIGEST" lines empty ones and ones starting with "#" are ignored)
+func Decode(r io.Reader, asJSON bool) (*Lockfile, error) {
+	lf := New()
+
+	if asJSON {
+		var jlf jsonLockfile
+		if err := json.NewDecoder(r).Decode(&jlf); err != nil {
+			return nil, err
+		}
+
+		for ref, digest := range jlf.Images {
+			lf.Set(ref, digest)
+		}
+
+		return lf, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid lockfile line %d: '%s' (should be: REPO:TAG DIGEST)", n, line)
+		}
+
+		lf.Set(fields[0], fields[1])
+	}
+
+	return lf, scanner.Err()
+}
+
+// Load loads lockfile from the file passed, format is chosen by the file name (See Encode)
+func Load(path string) (*Lockfile, error) {
+	f, err := os.Open(fix.Path(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lf, err := Decode(f, isJSON(path))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load lockfile %s: %s", path, err.Error())
+	}
+
+	return lf, nil
+}
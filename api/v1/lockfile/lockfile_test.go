@@ -0,0 +1,104 @@
+package lockfile
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/collection"
+	"github.com/ivanilves/lstags/tag"
+)
+
+func TestFromCollection(t *testing.T) {
+	assert := assert.New(t)
+
+	latest, _ := tag.New("latest", tag.Options{Digest: "sha256:aaa"})
+	stable, _ := tag.New("3.7", tag.Options{Digest: "sha256:bbb"})
+	failed := tag.NewFailed("broken", tag.Options{}, errors.New("boom"))
+
+	cn, err := collection.New(
+		[]string{"alpine", "quay.io/coreos/etcd"},
+		map[string][]*tag.Tag{
+			"alpine":              {latest, stable, failed},
+			"quay.io/coreos/etcd": {latest},
+		},
+	)
+	assert.Nil(err)
+
+	lf := FromCollection(cn)
+
+	assert.Equal(
+		[]string{"docker.io/library/alpine:3.7", "docker.io/library/alpine:latest", "quay.io/coreos/etcd:latest"},
+		lf.Refs(),
+		"should lock canonical references of tags present in registry only",
+	)
+
+	digest, defined := lf.Digest("docker.io/library/alpine:3.7")
+	assert.True(defined)
+	assert.Equal("sha256:bbb", digest)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	lf := New()
+	lf.Set("quay.io/coreos/etcd:latest", "sha256:ccc")
+	lf.Set("docker.io/library/alpine:3.7", "sha256:bbb")
+
+	var b bytes.Buffer
+	assert.Nil(lf.Encode(&b, false))
+	assert.Equal("docker.io/library/alpine:3.7 sha256:bbb\nquay.io/coreos/etcd:latest sha256:ccc\n", b.String())
+
+	decoded, err := Decode(strings.NewReader("# pinned\n\n"+b.String()), false)
+	assert.Nil(err)
+	assert.Equal(lf, decoded)
+
+	b.Reset()
+	assert.Nil(lf.Encode(&b, true))
+	assert.Equal(`{
+  "images": {
+    "docker.io/library/alpine:3.7": "sha256:bbb",
+    "quay.io/coreos/etcd:latest": "sha256:ccc"
+  }
+}
+`, b.String())
+
+	decoded, err = Decode(&b, true)
+	assert.Nil(err)
+	assert.Equal(lf, decoded)
+
+	_, err = Decode(strings.NewReader("alpine:3.7\n"), false)
+	assert.NotNil(err, "should not decode line with no digest")
+}
+
+func TestSaveLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "lstags-lockfile")
+	defer os.RemoveAll(dir)
+
+	lf := New()
+	lf.Set("docker.io/library/alpine:3.7", "sha256:bbb")
+
+	for _, name := range []string{"images.lock", "images.lock.json"} {
+		path := filepath.Join(dir, name)
+
+		assert.Nil(lf.Save(path))
+
+		loaded, err := Load(path)
+		assert.Nil(err)
+		assert.Equal(lf, loaded, name)
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "images.lock.json"))
+	assert.True(strings.HasPrefix(string(data), "{"), "should save JSON lockfile for '.json' file name")
+
+	_, err := Load(filepath.Join(dir, "missing.lock"))
+	assert.NotNil(err)
+}
@@ -0,0 +1,285 @@
+// Package progress aggregates progress of images pulled and pushed concurrently by Docker daemon,
+// so a UI could render all in-flight operations at once (e.g. as a multi-line progress display).
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// Image is a progress of a single image pull (or push), as we know it at the moment
+type Image struct {
+	// Operation is either "pull" or "push"
+	Operation string
+	// Ref is a reference of the image pulled (or pushed)
+	Ref string
+	// Status is the last status Docker daemon reported, e.g. "Downloading"
+	Status string
+	// Layers is a number of image layers Docker daemon reported
+	Layers int
+	// Current is a number of bytes transferred so far (for all the layers)
+	Current int64
+	// Total is a number of bytes to transfer (known only for layers transfer started for)
+	Total int64
+	// Done tells us if operation is completed (successfully or not)
+	Done bool
+	// Error is set, if operation failed
+	Error string
+}
+
+type layer struct {
+	current int64
+	total   int64
+}
+
+type entry struct {
+	image  Image
+	layers map[string]*layer
+}
+
+// Overall is an aggregate progress of all the images tracked, as we know it at the moment (See Tracker.Overall)
+type Overall struct {
+	// Images is a number of images tracked: started or expected to be (See Tracker.Expect)
+	Images int
+	// Done is a number of images operation is completed for (successfully or not)
+	Done int
+	// Current is a number of bytes transferred so far (for all the images)
+	Current int64
+	// Total is a number of bytes to transfer: image size expected or (if unknown) sum of layer sizes known so far
+	Total int64
+}
+
+// Fraction gives us overall completion as a fraction between 0 and 1
+func (o Overall) Fraction() float64 {
+	if o.Total == 0 {
+		if o.Images != 0 && o.Done == o.Images {
+			return 1
+		}
+
+		return 0
+	}
+
+	return float64(o.Current) / float64(o.Total)
+}
+
+// Tracker keeps progress of all the images in order they were started
+// NB! nil *Tracker is valid and does not track anything.
+type Tracker struct {
+	entries  []*entry
+	index    map[string]*entry
+	expected map[string]int64
+	mux      sync.Mutex
+}
+
+// NewTracker creates a new (empty) tracker
+func NewTracker() *Tracker {
+	return &Tracker{entries: make([]*entry, 0), index: make(map[string]*entry), expected: make(map[string]int64)}
+}
+
+func key(operation, ref string) string {
+	return operation + " " + ref
+}
+
+// Track starts tracking the operation on the image and gives a reader, that should be read instead of the stream passed.
+// Stream is expected to be a JSON message stream Docker daemon gives us on image pull or push.
+// NB! Tracking the same operation on the same image again restarts it.
+func (t *Tracker) Track(operation, ref string, stream io.Reader) io.Reader {
+	if t == nil {
+		return stream
+	}
+
+	t.mux.Lock()
+	e, defined := t.index[key(operation, ref)]
+	if !defined {
+		e = &entry{}
+		t.entries = append(t.entries, e)
+		t.index[key(operation, ref)] = e
+	}
+	e.image = Image{Operation: operation, Ref: ref}
+	e.layers = make(map[string]*layer)
+	t.mux.Unlock()
+
+	return io.TeeReader(stream, &parser{handle: func(msg message) {
+		t.mux.Lock()
+		e.update(msg)
+		t.mux.Unlock()
+	}})
+}
+
+// Finish marks the operation on the image as completed (failed, if error passed is not nil)
+func (t *Tracker) Finish(operation, ref string, err error) {
+	if t == nil {
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	e, defined := t.index[key(operation, ref)]
+	if !defined {
+		return
+	}
+
+	e.image.Done = true
+	if err != nil {
+		e.image.Error = err.Error()
+	}
+}
+
+// Snapshot gives a copy of the current progress of all the images tracked, in order they were started
+func (t *Tracker) Snapshot() []Image {
+	if t == nil {
+		return nil
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	images := make([]Image, len(t.entries))
+	for i, e := range t.entries {
+		images[i] = e.image
+	}
+
+	return images
+}
+
+// Expect tells us the operation on the image is going to transfer this many bytes (e.g. image size registry gave us),
+// so overall progress is accounted against the real image size, not only against layers Docker daemon reported so far.
+// NB! Image expected is counted by Overall even before its operation is started.
+func (t *Tracker) Expect(operation, ref string, size int64) {
+	if t == nil || size <= 0 {
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.expected[key(operation, ref)] = size
+}
+
+// Overall gives a snapshot of aggregate progress of all the images tracked (in-flight, completed and expected ones)
+func (t *Tracker) Overall() Overall {
+	var o Overall
+
+	if t == nil {
+		return o
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	for _, e := range t.entries {
+		current, total := e.image.Current, e.image.Total
+		if size, defined := t.expected[key(e.image.Operation, e.image.Ref)]; defined {
+			total = size
+		}
+		if e.image.Done || current > total {
+			current = total
+		}
+
+		o.Images++
+		if e.image.Done {
+			o.Done++
+		}
+		o.Current += current
+		o.Total += total
+	}
+
+	for k, size := range t.expected {
+		if _, started := t.index[k]; started {
+			continue
+		}
+
+		o.Images++
+		o.Total += size
+	}
+
+	return o
+}
+
+// message is a (relevant part of) JSON message Docker daemon gives us on image pull or push
+type message struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+	Error string `json:"error"`
+}
+
+// update applies message to the entry (caller must hold the tracker lock)
+func (e *entry) update(msg message) {
+	if msg.Error != "" {
+		e.image.Error = msg.Error
+		return
+	}
+
+	e.image.Status = msg.Status
+
+	if msg.ID == "" {
+		return
+	}
+
+	l, defined := e.layers[msg.ID]
+
+	switch msg.Status {
+	case "Pulling fs layer", "Waiting", "Preparing", "Waiting for layer":
+		if !defined {
+			e.layers[msg.ID] = &layer{}
+		}
+	case "Downloading", "Pushing":
+		if !defined {
+			l = &layer{}
+			e.layers[msg.ID] = l
+		}
+		l.current = msg.ProgressDetail.Current
+		l.total = msg.ProgressDetail.Total
+	case "Download complete", "Pull complete", "Already exists", "Pushed", "Layer already exists":
+		if !defined {
+			l = &layer{}
+			e.layers[msg.ID] = l
+		}
+		l.current = l.total
+	default:
+		return
+	}
+
+	e.image.Layers = len(e.layers)
+	e.image.Current, e.image.Total = 0, 0
+	for _, l := range e.layers {
+		e.image.Current += l.current
+		e.image.Total += l.total
+	}
+}
+
+// parser gets stream data written, splits it into lines and passes every line (JSON message) to the handler
+type parser struct {
+	handle func(msg message)
+	buf    []byte
+}
+
+func (p *parser) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := p.buf[:i]
+		p.buf = p.buf[i+1:]
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue
+		}
+
+		p.handle(msg)
+	}
+
+	return len(data), nil
+}
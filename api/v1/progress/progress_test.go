@@ -0,0 +1,152 @@
+package progress
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pullStream = `{"status":"Pulling from library/alpine","id":"3.7"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"aaa"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"bbb"}
+{"status":"Downloading","progressDetail":{"current":100,"total":1000},"id":"aaa"}
+{"status":"Downloading","progressDetail":{"current":50,"total":500},"id":"bbb"}
+{"status":"Download complete","progressDetail":{},"id":"bbb"}
+`
+
+func TestTrack(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := NewTracker()
+
+	data, err := ioutil.ReadAll(tracker.Track("pull", "alpine:3.7", strings.NewReader(pullStream)))
+
+	assert.Nil(err)
+	assert.Equal(pullStream, string(data), "should pass stream data through as is")
+	assert.Equal(
+		[]Image{{Operation: "pull", Ref: "alpine:3.7", Status: "Download complete", Layers: 2, Current: 600, Total: 1500}},
+		tracker.Snapshot(),
+	)
+
+	tracker.Track("push", "localhost:5000/alpine:3.7", strings.NewReader(`{"error":"denied"}`+"\n"))
+	tracker.Finish("pull", "alpine:3.7", nil)
+	tracker.Finish("push", "localhost:5000/alpine:3.7", errors.New("denied"))
+
+	snapshot := tracker.Snapshot()
+
+	assert.Equal(2, len(snapshot))
+	assert.True(snapshot[0].Done)
+	assert.Equal("", snapshot[0].Error)
+	assert.Equal("push", snapshot[1].Operation, "should keep images in order they were started")
+	assert.True(snapshot[1].Done)
+	assert.Equal("denied", snapshot[1].Error)
+}
+
+func TestTrack_Concurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := NewTracker()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(ref string) {
+			defer wg.Done()
+
+			ioutil.ReadAll(tracker.Track("pull", ref, strings.NewReader(pullStream)))
+			tracker.Snapshot()
+			tracker.Finish("pull", ref, nil)
+		}(fmt.Sprintf("alpine:%d", i))
+	}
+	wg.Wait()
+
+	snapshot := tracker.Snapshot()
+
+	assert.Equal(16, len(snapshot))
+	for _, image := range snapshot {
+		assert.True(image.Done)
+		assert.Equal(int64(600), image.Current)
+	}
+}
+
+func TestTrack_Nil(t *testing.T) {
+	assert := assert.New(t)
+
+	var tracker *Tracker
+
+	data, err := ioutil.ReadAll(tracker.Track("pull", "alpine:3.7", strings.NewReader(pullStream)))
+
+	assert.Nil(err)
+	assert.Equal(pullStream, string(data))
+
+	tracker.Finish("pull", "alpine:3.7", nil)
+
+	assert.Nil(tracker.Snapshot())
+}
+
+func TestOverall(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := NewTracker()
+
+	assert.Equal(Overall{}, tracker.Overall())
+	assert.Equal(float64(0), tracker.Overall().Fraction(), "should be zero, if nothing is tracked")
+
+	tracker.Expect("pull", "alpine:3.7", 2000)
+	tracker.Expect("pull", "alpine:3.8", 1000)
+
+	assert.Equal(Overall{Images: 2, Total: 3000}, tracker.Overall(), "should count images expected, but not started yet")
+
+	ioutil.ReadAll(tracker.Track("pull", "alpine:3.7", strings.NewReader(pullStream)))
+	ioutil.ReadAll(tracker.Track("pull", "alpine:3.6", strings.NewReader(pullStream)))
+
+	assert.Equal(
+		Overall{Images: 3, Current: 1200, Total: 4500},
+		tracker.Overall(),
+		"should account image expected by its size and image not expected by layers known so far",
+	)
+
+	tracker.Finish("pull", "alpine:3.7", nil)
+	tracker.Finish("pull", "alpine:3.6", errors.New("boom"))
+
+	overall := tracker.Overall()
+
+	assert.Equal(Overall{Images: 3, Done: 2, Current: 3500, Total: 4500}, overall, "should account images completed as whole")
+	assert.InDelta(0.777, overall.Fraction(), 0.001)
+
+	ioutil.ReadAll(tracker.Track("pull", "alpine:3.8", strings.NewReader(pullStream)))
+	tracker.Finish("pull", "alpine:3.8", nil)
+
+	assert.Equal(float64(1), tracker.Overall().Fraction())
+
+	var nothing *Tracker
+	nothing.Expect("pull", "alpine:3.7", 1000)
+	assert.Equal(Overall{}, nothing.Overall())
+}
+
+func TestOverall_Concurrent(t *testing.T) {
+	tracker := NewTracker()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+
+		go func(ref string) {
+			defer wg.Done()
+
+			tracker.Expect("pull", ref, 1500)
+			ioutil.ReadAll(tracker.Track("pull", ref, strings.NewReader(pullStream)))
+			tracker.Overall()
+			tracker.Finish("pull", ref, nil)
+		}(fmt.Sprintf("alpine:%d", i))
+	}
+	wg.Wait()
+
+	assert.Equal(t, Overall{Images: 16, Done: 16, Current: 16 * 1500, Total: 16 * 1500}, tracker.Overall())
+}
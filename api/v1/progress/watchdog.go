@@ -0,0 +1,106 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StalledError is returned, if Docker daemon reported no progress of the image pull (or push) for too long
+type StalledError struct {
+	Operation string
+	Ref       string
+	Timeout   time.Duration
+}
+
+// Error implements error interface
+func (e *StalledError) Error() string {
+	return fmt.Sprintf("%s of %s stalled: no progress for %v", e.Operation, e.Ref, e.Timeout)
+}
+
+// Watchdog cancels operation, if stream it watches shows no progress for the timeout given
+// (e.g. Docker daemon got stuck downloading a layer and keeps connection open forever).
+// NB! nil *Watchdog is valid and does not watch anything.
+type Watchdog struct {
+	timeout time.Duration
+	cancel  func()
+	timer   *time.Timer
+	seen    map[string]string
+	stalled bool
+	stopped bool
+	mux     sync.Mutex
+}
+
+// NewWatchdog creates a watchdog calling cancel function passed, if no progress seen for the timeout given.
+// NB! Timeout starts right away, so we could also catch operations stuck before giving us a stream.
+func NewWatchdog(timeout time.Duration, cancel func()) *Watchdog {
+	w := &Watchdog{timeout: timeout, cancel: cancel, seen: make(map[string]string)}
+
+	w.timer = time.AfterFunc(timeout, w.fire)
+
+	return w
+}
+
+func (w *Watchdog) fire() {
+	w.mux.Lock()
+	if w.stopped {
+		w.mux.Unlock()
+		return
+	}
+	w.stalled = true
+	w.stopped = true
+	w.mux.Unlock()
+
+	w.cancel()
+}
+
+// Watch gives a reader, that should be read instead of the stream passed.
+// Every message telling us about a new status or more data transferred resets the timeout.
+func (w *Watchdog) Watch(stream io.Reader) io.Reader {
+	if w == nil {
+		return stream
+	}
+
+	return io.TeeReader(stream, &parser{handle: w.observe})
+}
+
+func (w *Watchdog) observe(msg message) {
+	state := msg.Status + " " + strconv.FormatInt(msg.ProgressDetail.Current, 10)
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.stopped || w.seen[msg.ID] == state {
+		return
+	}
+	w.seen[msg.ID] = state
+
+	w.timer.Reset(w.timeout)
+}
+
+// Stop stops the watchdog (to be called once operation is completed)
+func (w *Watchdog) Stop() {
+	if w == nil {
+		return
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	w.stopped = true
+	w.timer.Stop()
+}
+
+// Stalled tells us if watchdog canceled the operation
+func (w *Watchdog) Stalled() bool {
+	if w == nil {
+		return false
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	return w.stalled
+}
@@ -0,0 +1,81 @@
+package progress
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchdog(t *testing.T) {
+	assert := assert.New(t)
+
+	canceled := make(chan struct{})
+	w := NewWatchdog(100*time.Millisecond, func() { close(canceled) })
+
+	data, err := ioutil.ReadAll(w.Watch(strings.NewReader(pullStream)))
+	w.Stop()
+
+	assert.Nil(err)
+	assert.Equal(pullStream, string(data), "should pass stream data through as is")
+
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case <-canceled:
+		t.Fatal("should not cancel operation completed in time")
+	default:
+	}
+	assert.False(w.Stalled())
+}
+
+func TestWatchdog_Stalled(t *testing.T) {
+	assert := assert.New(t)
+
+	r, pw := io.Pipe()
+	w := NewWatchdog(200*time.Millisecond, func() { pw.CloseWithError(io.ErrUnexpectedEOF) })
+	defer w.Stop()
+
+	go func() {
+		// progress keeps coming for a while (longer than timeout), then stops coming, while stream is kept open
+		for i := 1; i <= 5; i++ {
+			pw.Write([]byte(`{"status":"Downloading","progressDetail":{"current":` + strings.Repeat("1", i) + `},"id":"aaa"}` + "\n"))
+			time.Sleep(100 * time.Millisecond)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := pw.Write([]byte(`{"status":"Downloading","progressDetail":{"current":11111},"id":"aaa"}` + "\n")); err != nil {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	started := time.Now()
+	_, err := ioutil.ReadAll(w.Watch(r))
+
+	assert.Equal(io.ErrUnexpectedEOF, err)
+	assert.True(w.Stalled())
+	assert.True(time.Since(started) > 500*time.Millisecond, "should not cancel operation making progress")
+}
+
+func TestWatchdog_Nil(t *testing.T) {
+	assert := assert.New(t)
+
+	var w *Watchdog
+
+	data, err := ioutil.ReadAll(w.Watch(strings.NewReader(pullStream)))
+	w.Stop()
+
+	assert.Nil(err)
+	assert.Equal(pullStream, string(data))
+	assert.False(w.Stalled())
+}
+
+func TestStalledError(t *testing.T) {
+	err := &StalledError{Operation: "pull", Ref: "alpine:3.7", Timeout: time.Minute}
+
+	assert.Equal(t, "pull of alpine:3.7 stalled: no progress for 1m0s", err.Error())
+}
@@ -0,0 +1,144 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag/remote"
+)
+
+// PruneResult tells us what PruneUntagged did (or would do on dry run) to the repository
+type PruneResult struct {
+	// Ref is the repository pruned ("REGISTRY/PATH")
+	Ref string
+	// Referenced is number of manifests referenced by tags (incl. images of multi-arch tags and their referrers)
+	Referenced int
+	// Pruned are digests of untagged manifests deleted (or to be deleted on dry run)
+	Pruned []string
+	// Kept are digests of candidates still referenced by tags, so they are not deleted
+	Kept []string
+	// Absent are digests of candidates not present in the repository (already deleted or never there), nothing is deleted
+	// NB! Digests recorded in checkpoint are the source ones, so they are absent, if Docker daemon pushed images under other digests.
+	Absent []string
+	// Failed maps digests of manifests we failed to delete to the errors we got
+	Failed map[string]error
+	// DryRun is true, if nothing was deleted, as we only dry run (See Config.DryRun)
+	DryRun bool
+	// Unsupported is true, if registry does not let us delete manifests, so nothing was done at all
+	Unsupported bool
+}
+
+// PruneUntagged deletes manifests not referenced by any tag of the repository ("REGISTRY/PATH", e.g. after retention pruning).
+// Registry API does not list untagged manifests, so candidates to delete are the digests passed, together with digests
+// of tags pushed to this repository recorded in checkpoint (See Config.CheckpointFile). Candidates referenced by any tag
+// (directly, as images of multi-arch tags, or as their referrers, e.g. signatures) are kept, ones not present are absent.
+// NB! Checkpoint records digests of source tags, i.e. ones we got while listing the source registry. They are the same as
+// pushed ones for images copied byte for byte, but Docker daemon may push images under other digests (See PruneResult.Absent).
+// NB! Registries not supporting deletes (See Capabilities) are not touched, result is marked as unsupported then.
+func (api *API) PruneUntagged(ref string, candidates []string) (*PruneResult, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if repo.HasTags() {
+		return nil, fmt.Errorf("repository reference expected, got a tag one: %s", ref)
+	}
+
+	result := &PruneResult{
+		Ref:    Ref{Registry: repo.Registry(), Path: repo.Path()}.Repository(),
+		Pruned: make([]string, 0),
+		Kept:   make([]string, 0),
+		Absent: make([]string, 0),
+		Failed: make(map[string]error),
+		DryRun: api.config.DryRun,
+	}
+
+	if api.checkpoint != nil {
+		candidates = append(candidates, api.checkpoint.Digests(result.Ref)...)
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "push")
+	cli, err := remote.Connect(repo.Registry(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := cli.ProbeCapabilities(repo.Path())
+	if err != nil {
+		return nil, err
+	}
+	if !c.Delete {
+		log.Warnf("PRUNE %s skipped: registry %s does not support deleting manifests (or we are not permitted to)", result.Ref, repo.Registry())
+
+		result.Unsupported = true
+
+		return result, nil
+	}
+
+	referenced, err := cli.ReferencedDigests(repo.Path(), c.Referrers)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get manifests referenced by tags of %s: %s", result.Ref, err.Error())
+	}
+	result.Referenced = len(referenced)
+
+	seen := make(map[string]bool)
+	for _, digest := range candidates {
+		if seen[digest] {
+			continue
+		}
+		seen[digest] = true
+
+		if referenced[digest] {
+			log.Debugf("%s %s@%s is still referenced by tags", fn(), result.Ref, digest)
+
+			result.Kept = append(result.Kept, digest)
+			continue
+		}
+
+		if err := api.pruneManifest(cli, repo.Path(), digest); err != nil {
+			var notFound *client.ManifestNotFoundError
+			if errors.As(err, &notFound) {
+				log.Infof("ABSENT %s@%s (nothing to prune)", result.Ref, digest)
+
+				result.Absent = append(result.Absent, digest)
+				continue
+			}
+
+			log.Errorf("PRUNE %s@%s failed: %s", result.Ref, digest, err.Error())
+
+			result.Failed[digest] = err
+			continue
+		}
+
+		if api.config.DryRun {
+			log.Infof("[DRY RUN] PRUNE %s@%s", result.Ref, digest)
+		} else {
+			log.Infof("PRUNED %s@%s", result.Ref, digest)
+		}
+
+		result.Pruned = append(result.Pruned, digest)
+	}
+
+	if len(result.Failed) != 0 {
+		return result, fmt.Errorf("failed to prune %d untagged manifests of %s", len(result.Failed), result.Ref)
+	}
+
+	return result, nil
+}
+
+// pruneManifest deletes manifest with the digest passed, or only checks it is present (with HEAD request) on dry run,
+// so absent manifests give us *client.ManifestNotFoundError in both cases
+func (api *API) pruneManifest(cli *client.RegistryClient, repoPath, digest string) error {
+	if api.config.DryRun {
+		_, err := cli.ResolveDigest(repoPath, digest)
+
+		return err
+	}
+
+	return cli.DeleteManifest(repoPath, digest)
+}
@@ -0,0 +1,127 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pruneIndexDigest  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	pruneImageDigest  = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	pruneOrphanDigest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	pruneAbsentDigest = "sha256:4444444444444444444444444444444444444444444444444444444444444444"
+)
+
+func runPruneRegistry(deletes bool) (*httptest.Server, *[]string) {
+	manifests := map[string]struct{ digest, document string }{
+		"latest": {pruneIndexDigest, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + pruneImageDigest + `"}]}`},
+		pruneImageDigest:  {pruneImageDigest, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`},
+		pruneOrphanDigest: {pruneOrphanDigest, `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`},
+	}
+
+	var deleted []string
+	var mux sync.Mutex
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+		case strings.HasPrefix(r.URL.Path, "/v2/foo/manifests/"):
+			reference := strings.TrimPrefix(r.URL.Path, "/v2/foo/manifests/")
+
+			if r.Method == "DELETE" {
+				if !deletes {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+
+				if _, defined := manifests[reference]; !defined {
+					http.NotFound(w, r)
+					return
+				}
+
+				mux.Lock()
+				deleted = append(deleted, reference)
+				mux.Unlock()
+
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+
+			m, defined := manifests[reference]
+			if !defined {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", strings.Split(strings.Split(m.document, `"mediaType":"`)[1], `"`)[0])
+			w.Header().Set("Docker-Content-Digest", m.digest)
+			w.Write([]byte(m.document))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return server, &deleted
+}
+
+func TestPruneUntagged(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, dryRun := range []bool{false, true} {
+		server, deleted := runPruneRegistry(true)
+		registry := strings.TrimPrefix(server.URL, "http://")
+
+		api, err := New(Config{DryRun: dryRun})
+		assert.Nil(err)
+
+		result, err := api.PruneUntagged(registry+"/foo", []string{pruneIndexDigest, pruneImageDigest, pruneOrphanDigest, pruneOrphanDigest, pruneAbsentDigest})
+		assert.Nil(err)
+
+		assert.Equal(registry+"/foo", result.Ref)
+		assert.Equal(2, result.Referenced)
+		assert.Equal([]string{pruneIndexDigest, pruneImageDigest}, result.Kept, "should keep manifests tagged and images of manifest lists tagged")
+		assert.Equal(dryRun, result.DryRun)
+		assert.False(result.Unsupported)
+
+		assert.Equal([]string{pruneOrphanDigest}, result.Pruned)
+		assert.Equal([]string{pruneAbsentDigest}, result.Absent, "should report manifest not present as absent, not as pruned")
+
+		if dryRun {
+			assert.Nil(*deleted, "should delete nothing on dry run")
+		} else {
+			assert.Equal([]string{pruneOrphanDigest}, *deleted)
+		}
+
+		server.Close()
+	}
+}
+
+func TestPruneUntagged_Unsupported(t *testing.T) {
+	assert := assert.New(t)
+
+	server, deleted := runPruneRegistry(false)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	result, err := api.PruneUntagged(registry+"/foo", []string{pruneOrphanDigest})
+	assert.Nil(err)
+	assert.True(result.Unsupported)
+	assert.Equal([]string{}, result.Pruned)
+	assert.Nil(*deleted)
+
+	_, err = api.PruneUntagged(registry+"/foo:latest", nil)
+	assert.NotNil(err, "should not prune by tag reference")
+}
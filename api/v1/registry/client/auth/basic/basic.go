@@ -4,6 +4,8 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
 )
 
 // Token implementation for Basic authentication
@@ -34,7 +36,7 @@ func getTokenFromHeader(header string) string {
 
 // RequestToken performs Basic authentication and extracts token from response header
 func RequestToken(url, username, password string) (*Token, error) {
-	hc := &http.Client{}
+	hc := transport.Client()
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -5,11 +5,16 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
 )
 
 // Token implementation for Bearer authentication
 type Token struct {
 	T string `json:"token"`
+	A string `json:"access_token"`
 	E int    `json:"expires_in"`
 }
 
@@ -28,6 +33,23 @@ func (tk Token) ExpiresIn() int {
 	return tk.E
 }
 
+// StatusError is returned, if authentication service responds with a non-200 status
+type StatusError struct {
+	StatusCode int
+	Status     string
+	URL        string
+}
+
+// Error implements error interface
+func (e *StatusError) Error() string {
+	return "[AUTH::BEARER] Bad response status: " + e.Status + " >> " + e.URL
+}
+
+// IsRejected tells us if authentication service rejected credentials (or access to the scope requested)
+func (e *StatusError) IsRejected() bool {
+	return e.StatusCode == 401 || e.StatusCode == 403
+}
+
 func decodeTokenResponse(data io.ReadCloser) (*Token, error) {
 	tk := Token{}
 
@@ -36,14 +58,51 @@ func decodeTokenResponse(data io.ReadCloser) (*Token, error) {
 		return nil, err
 	}
 
+	// OAuth2-compatible services may give us "access_token" only
+	if tk.T == "" {
+		tk.T = tk.A
+	}
+
+	if tk.T == "" {
+		return nil, errors.New("[AUTH::BEARER] No token in authentication service response")
+	}
+
 	return &tk, nil
 }
 
+// getTokenURL builds authentication service URL from challenge params, where:
+// * "service" is optional (some registries do not send it at all)
+// * "scope" could have many space-separated scopes, each one is passed as a separate query parameter
+func getTokenURL(params map[string]string) (string, error) {
+	if params["realm"] == "" {
+		return "", errors.New("[AUTH::BEARER] No realm in authentication challenge")
+	}
+
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	for _, scope := range strings.Fields(params["scope"]) {
+		query.Add("scope", scope)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
 // RequestToken requests Bearer token from authentication service
 func RequestToken(username, password string, params map[string]string) (*Token, error) {
-	url := params["realm"] + "?service=" + params["service"] + "&scope=" + params["scope"]
+	url, err := getTokenURL(params)
+	if err != nil {
+		return nil, err
+	}
 
-	hc := &http.Client{}
+	hc := transport.Client()
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -58,7 +117,7 @@ func RequestToken(username, password string, params map[string]string) (*Token,
 		return nil, err
 	}
 	if resp.StatusCode != 200 {
-		return nil, errors.New("[AUTH::BEARER] Bad response status: " + resp.Status + " >> " + url)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, URL: url}
 	}
 
 	return decodeTokenResponse(resp.Body)
@@ -0,0 +1,67 @@
+package bearer
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTokenURL(t *testing.T) {
+	var testCases = []struct {
+		params map[string]string
+		url    string
+	}{
+		{
+			map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull"},
+			"https://auth.docker.io/token?scope=repository%3Alibrary%2Falpine%3Apull&service=registry.docker.io",
+		},
+		{
+			map[string]string{"realm": "https://quay.io/v2/auth", "scope": "repository:coreos/etcd:pull"},
+			"https://quay.io/v2/auth?scope=repository%3Acoreos%2Fetcd%3Apull",
+		},
+		{
+			map[string]string{"realm": "https://gitlab.com/jwt/auth?client_id=docker", "service": "container_registry", "scope": "repository:a:pull repository:b:pull,push"},
+			"https://gitlab.com/jwt/auth?client_id=docker&scope=repository%3Aa%3Apull&scope=repository%3Ab%3Apull%2Cpush&service=container_registry",
+		},
+		{
+			map[string]string{"realm": "https://registry.company.io/token", "service": "Company Registry"},
+			"https://registry.company.io/token?service=Company+Registry",
+		},
+	}
+
+	assert := assert.New(t)
+
+	for _, expected := range testCases {
+		url, err := getTokenURL(expected.params)
+
+		assert.Nil(err, "should be no error (params: %+v)", expected.params)
+		assert.Equal(expected.url, url)
+	}
+
+	_, err := getTokenURL(map[string]string{"service": "registry"})
+
+	assert.NotNil(err, "should be an error, if there is no realm")
+}
+
+func TestDecodeTokenResponse(t *testing.T) {
+	var testCases = map[string]string{
+		`{"token":"t0k3n","expires_in":300}`:           "t0k3n",
+		`{"access_token":"t0k3n","expires_in":300}`:    "t0k3n",
+		`{"token":"t0k3n","access_token":"t0k3n-too"}`: "t0k3n",
+	}
+
+	assert := assert.New(t)
+
+	for body, expected := range testCases {
+		tk, err := decodeTokenResponse(ioutil.NopCloser(strings.NewReader(body)))
+
+		assert.Nil(err, "should be no error (body: %s)", body)
+		assert.Equal(expected, tk.String())
+	}
+
+	_, err := decodeTokenResponse(ioutil.NopCloser(strings.NewReader(`{"expires_in":300}`)))
+
+	assert.NotNil(err, "should be an error, if there is no token")
+}
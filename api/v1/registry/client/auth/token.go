@@ -2,7 +2,6 @@ package auth
 
 import (
 	"errors"
-	"net/http"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -11,6 +10,7 @@ import (
 	basicstore "github.com/ivanilves/lstags/api/v1/registry/client/auth/basic/store"
 	"github.com/ivanilves/lstags/api/v1/registry/client/auth/bearer"
 	"github.com/ivanilves/lstags/api/v1/registry/client/auth/none"
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
 )
 
 // BasicStore stores explicitly set BASIC authorization headers
@@ -40,24 +40,126 @@ func extractAuthHeader(hh []string) (authHeader, error) {
 }
 
 func getAuthMethod(h authHeader) string {
-	return strings.SplitN(string(h), " ", 2)[0]
+	return strings.SplitN(strings.TrimSpace(string(h)), " ", 2)[0]
 }
 
+// readQuotedString reads quoted string value (opening quote is already read) handling escaped characters,
+// returns the value and the rest of the string after the closing quote
+func readQuotedString(s string) (string, string) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), ""
+}
+
+// getAuthParams parses challenge parameters, i.e. comma-separated key=value pairs (keys are lowercased),
+// where values could be either tokens or quoted strings, which may contain commas, spaces and escaped quotes
 func getAuthParams(h authHeader) map[string]string {
 	params := make(map[string]string)
 
-	paramString := strings.SplitN(string(h), " ", 2)[1]
+	parts := strings.SplitN(strings.TrimSpace(string(h)), " ", 2)
+	if len(parts) != 2 {
+		return params
+	}
+
+	s := parts[1]
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			break
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
 
-	for _, keyValueString := range strings.Split(paramString, ",") {
-		kv := strings.Split(keyValueString, "=")
-		if len(kv) == 2 {
-			params[kv[0]] = strings.Trim(kv[1], "\"")
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			value, s = readQuotedString(s[1:])
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
 		}
+
+		params[key] = value
 	}
 
 	return params
 }
 
+// LoginError is returned when registry (or its authentication service) rejects credentials passed
+type LoginError struct {
+	URL    string
+	Reason string
+}
+
+// Error implements error interface
+func (e *LoginError) Error() string {
+	return "Login failed for " + e.URL + ": " + e.Reason
+}
+
+func getChallenge(url string) (string, map[string]string, error) {
+	resp, err := transport.Client().Get(url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	authHeader, err := extractAuthHeader(resp.Header["Www-Authenticate"])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.ToLower(getAuthMethod(authHeader)), getAuthParams(authHeader), nil
+}
+
+// VerifyCredentials checks if registry accepts username and password passed.
+// Returns *LoginError if credentials are rejected, or a generic error if something else went wrong.
+func VerifyCredentials(url, username, password string) error {
+	method, params, err := getChallenge(url)
+	if err != nil {
+		return err
+	}
+
+	switch method {
+	case "none":
+		return nil
+	case "basic":
+		if _, err := basic.RequestToken(url, username, password); err != nil {
+			return &LoginError{URL: url, Reason: err.Error()}
+		}
+
+		return nil
+	case "bearer":
+		if _, err := bearer.RequestToken(username, password, params); err != nil {
+			return &LoginError{URL: url, Reason: err.Error()}
+		}
+
+		return nil
+	default:
+		return errors.New("Unknown authentication method: " + method)
+	}
+}
+
 // NewToken creates a new instance of Token in two steps:
 // * detects authentication type ("Bearer", "Basic" or "None")
 // * delegates actual authentication to the type-specific implementation
@@ -68,18 +170,12 @@ func NewToken(url, username, password, scope string) (Token, error) {
 	storedBasicAuth := BasicStore.GetByURL(url)
 
 	if storedBasicAuth == nil {
-		resp, err := http.Get(url)
-		if err != nil {
-			return nil, err
-		}
+		var err error
 
-		authHeader, err := extractAuthHeader(resp.Header["Www-Authenticate"])
+		method, params, err = getChallenge(url)
 		if err != nil {
 			return nil, err
 		}
-
-		method = strings.ToLower(getAuthMethod(authHeader))
-		params = getAuthParams(authHeader)
 	} else {
 		method = "basic"
 
@@ -101,7 +197,17 @@ func NewToken(url, username, password, scope string) (Token, error) {
 		return t, nil
 	case "bearer":
 		params["scope"] = scope
-		return bearer.RequestToken(username, password, params)
+
+		t, err := bearer.RequestToken(username, password, params)
+		if err != nil {
+			if statusErr, ok := err.(*bearer.StatusError); ok && statusErr.IsRejected() {
+				return nil, &LoginError{URL: url, Reason: err.Error()}
+			}
+
+			return nil, err
+		}
+
+		return t, nil
 	default:
 		return nil, errors.New("Unknown authentication method: " + method)
 	}
@@ -12,21 +12,45 @@ import (
 // WaitBetween defines how much we will wait between batches of requests
 var WaitBetween time.Duration
 
+// MaxTokenAge forces us to re-authenticate once token is cached for this long, even if it has not expired yet,
+// e.g. to comply with security policies rotating credentials (0 means no limit, i.e. only token "expires_in" is honored)
+var MaxTokenAge time.Duration
+
+// now is our clock (it is replaced in tests)
+var now = time.Now
+
 // Token is a structure to hold already obtained tokens
 // Prevents excess HTTP requests to be made (error 429)
-var Token = token{items: make(map[string]auth.Token)}
+var Token = token{items: make(map[string]item)}
+
+type item struct {
+	token   auth.Token
+	expires time.Time
+}
+
+// isExpired tells us if cached token should not be used anymore (zero expiration time means it never expires)
+func (i item) isExpired() bool {
+	return !i.expires.IsZero() && !now().Before(i.expires)
+}
 
 type token struct {
-	items map[string]auth.Token
+	items map[string]item
 	mux   sync.Mutex
 }
 
 // Exists tells if passed key is already present in cache
+// NB! Token expired (See MaxTokenAge) is not present in cache anymore, so it should be obtained again.
 func (t *token) Exists(key string) bool {
 	t.mux.Lock()
 	defer t.mux.Unlock()
 
-	_, defined := t.items[key]
+	i, defined := t.items[key]
+	if defined && i.isExpired() {
+		log.Debugf("[EXISTS] Token expired (key: %s)", key)
+
+		delete(t.items, key)
+		defined = false
+	}
 
 	if !defined && WaitBetween != 0 {
 		log.Debugf("[EXISTS] Locking token operations for %v (key: %s)", WaitBetween, key)
@@ -46,14 +70,26 @@ func (t *token) Get(key string) auth.Token {
 		time.Sleep(WaitBetween)
 	}
 
-	return t.items[key]
+	return t.items[key].token
 }
 
-// Get sets token for a passed key
+// Get sets token for a passed key, it expires once its "expires_in" or MaxTokenAge (whichever is shorter) elapses
 func (t *token) Set(key string, value auth.Token) {
+	ttl := MaxTokenAge
+	if value != nil && value.ExpiresIn() > 0 {
+		if expiresIn := time.Duration(value.ExpiresIn()) * time.Second; ttl == 0 || expiresIn < ttl {
+			ttl = expiresIn
+		}
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = now().Add(ttl)
+	}
+
 	t.mux.Lock()
 
-	t.items[key] = value
+	t.items[key] = item{token: value, expires: expires}
 
 	t.mux.Unlock()
 }
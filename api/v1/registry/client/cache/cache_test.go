@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/auth/bearer"
+)
+
+func TestToken_Expiration(t *testing.T) {
+	clock := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	now = func() time.Time { return clock }
+	defer func() { now, MaxTokenAge = time.Now, 0 }()
+
+	testCases := []struct {
+		maxTokenAge time.Duration
+		expiresIn   int
+		valid       []time.Duration
+		expired     []time.Duration
+	}{
+		{0, 0, []time.Duration{0, 24 * time.Hour}, nil},
+		{0, 300, []time.Duration{0, 299 * time.Second}, []time.Duration{300 * time.Second}},
+		{time.Minute, 300, []time.Duration{0, 59 * time.Second}, []time.Duration{time.Minute, time.Hour}},
+		{time.Hour, 300, []time.Duration{299 * time.Second}, []time.Duration{300 * time.Second}},
+		{time.Minute, 0, []time.Duration{59 * time.Second}, []time.Duration{time.Minute}},
+	}
+
+	assert := assert.New(t)
+
+	for _, tc := range testCases {
+		MaxTokenAge = tc.maxTokenAge
+
+		for _, elapsed := range tc.valid {
+			Token.Set("registry/foo", bearer.Token{T: "foo", E: tc.expiresIn})
+
+			clock = clock.Add(elapsed)
+
+			assert.True(Token.Exists("registry/foo"), "max age: %v, expires in: %d, elapsed: %v", tc.maxTokenAge, tc.expiresIn, elapsed)
+		}
+
+		for _, elapsed := range tc.expired {
+			Token.Set("registry/foo", bearer.Token{T: "foo", E: tc.expiresIn})
+
+			clock = clock.Add(elapsed)
+
+			assert.False(Token.Exists("registry/foo"), "max age: %v, expires in: %d, elapsed: %v", tc.maxTokenAge, tc.expiresIn, elapsed)
+			assert.Nil(Token.Get("registry/foo"), "should forget token expired")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+)
+
+// probeDigest is a digest of nothing we could ever have, so probing requests never touch real content
+const probeDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+// Capabilities tell us which optional operations registry supports (See ProbeCapabilities)
+type Capabilities struct {
+	// Catalog is true, if registry lets us list its repositories
+	Catalog bool
+	// Delete is true, if registry lets us delete manifests (many registries have deletes disabled)
+	Delete bool
+	// Referrers is true, if registry supports OCI referrers API
+	Referrers bool
+}
+
+// String gives us capabilities in a "catalog=yes delete=no referrers=yes" form
+func (c Capabilities) String() string {
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+
+		return "no"
+	}
+
+	return fmt.Sprintf("catalog=%s delete=%s referrers=%s", yesNo(c.Catalog), yesNo(c.Delete), yesNo(c.Referrers))
+}
+
+// probe sends request and tells us if operation is supported by the response status: "supported" statuses are passed,
+// "unsupported" ones are 401, 403, 404 and 405 (unless they are passed as supported), others are errors
+func (cli *RegistryClient) probe(method, url, auth, operation string, supported ...int) (bool, error) {
+	resp, err := request.SendContext(cli.Context(), method, url, auth, nil, nil, cli.Config.TraceRequests)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	for _, status := range supported {
+		if resp.StatusCode == status {
+			return true, nil
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed:
+		log.Debugf("%s is not supported by registry %s: %s", operation, cli.registry, resp.Status)
+
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unable to probe %s support of registry %s: %s", operation, cli.registry, resp.Status)
+}
+
+// ProbeCapabilities checks which optional operations registry supports by their known response statuses,
+// so we could skip unsupported operations instead of failing halfway. Repository passed is used to probe repository
+// operations (delete and referrers), nothing is ever changed in it: we probe with a digest of nothing.
+// NB! Operations we are not permitted to do (e.g. no delete access) are reported as not supported.
+// NB! With no repository passed only catalog is probed, repository operations are reported as not supported.
+func (cli *RegistryClient) ProbeCapabilities(repoPath string) (*Capabilities, error) {
+	if cli.Token == nil {
+		return nil, fmt.Errorf("not logged in to registry: %s", cli.registry)
+	}
+
+	var c Capabilities
+	var err error
+
+	c.Catalog, err = cli.probe("GET", cli.URL()+"_catalog?n=1", authorization(cli.Token), "catalog", http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	if repoPath == "" {
+		return &c, nil
+	}
+
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// registries supporting referrers API give us an (empty) index even for unknown digests
+	c.Referrers, err = cli.probe("GET", cli.URL()+repoPath+"/referrers/"+probeDigest, authorization(repoToken), "referrers API", http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	// registries with deletes disabled give us 405 (UNSUPPORTED), enabled ones just do not know the manifest (404)
+	if deleteToken, err := cli.repoScopedToken(repoPath, "delete"); err != nil {
+		log.Debugf("delete is not permitted by registry %s: %s", cli.registry, strings.TrimSpace(err.Error()))
+	} else {
+		c.Delete, err = cli.probe("DELETE", cli.URL()+repoPath+"/manifests/"+probeDigest, authorization(deleteToken), "delete", http.StatusNotFound, http.StatusAccepted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
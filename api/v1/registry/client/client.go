@@ -2,10 +2,15 @@
 package client
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -13,6 +18,7 @@ import (
 	"github.com/ivanilves/lstags/api/v1/registry/client/auth"
 	"github.com/ivanilves/lstags/api/v1/registry/client/cache"
 	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
 	"github.com/ivanilves/lstags/tag"
 	"github.com/ivanilves/lstags/tag/manifest"
 )
@@ -33,6 +39,8 @@ type RegistryClient struct {
 	username string
 	password string
 
+	ctx context.Context
+
 	// Config has general configuration of the registry client instance
 	Config Config
 	// Token is an authentication token obtained after registry login
@@ -55,6 +63,26 @@ type Config struct {
 	TraceRequests bool
 	// IsInsecure sets if we want to communicate registry over plain HTTP instead of HTTPS
 	IsInsecure bool
+	// Platform is used to select image from manifest list/index (e.g. to get creation date of multi-arch image)
+	Platform manifest.Platform
+	// Annotation is used to select image from manifest list/index instead of platform, if set (e.g. to pick image variant)
+	Annotation *manifest.Annotation
+	// FetchSizes sets if we will get image sizes from manifests, when registry does not give them to us otherwise
+	FetchSizes bool
+	// FetchBlobs sets if we will get sizes of image config and layers by their digests (costs us an extra request per tag)
+	FetchBlobs bool
+	// FetchLayers sets if we will get number of image layers for manifest lists/indexes too (costs us an extra request per tag)
+	// NB! Number of layers of single images is taken from their manifests, we get anyway.
+	FetchLayers bool
+	// MaxManifestBytes limits size of manifests and image configs we read (See TooLargeError), 0 means DefaultMaxManifestBytes
+	// NB! Layer blobs are never read into memory (they are streamed), so they are not limited.
+	MaxManifestBytes int64
+	// AuthRegistry is a registry identity used for token scopes, if it differs from the registry we connect to
+	// (e.g. "docker.io" for a pull-through mirror, so "alpine" is scoped as "library/alpine")
+	AuthRegistry string
+	// ScopedCredentials, if set, gives us credentials to request token of the scope passed with (e.g. scoped ones
+	// auth provider hands out), instead of ones we logged in with (See docker/config.ResolveScopedCredentials)
+	ScopedCredentials func(ctx context.Context, registry, scope, username, password string) (string, string)
 }
 
 // New creates and validates new RegistryClient instance
@@ -67,6 +95,10 @@ func New(registry string, config Config) (*RegistryClient, error) {
 		config.RetryDelay = DefaultRetryDelay
 	}
 
+	if config.Platform.OS == "" {
+		config.Platform = manifest.DefaultPlatform()
+	}
+
 	if config.ConcurrentRequests > MaxConcurrentRequests {
 		err := fmt.Errorf(
 			"Could not run more than %d concurrent requests (%d configured)",
@@ -77,6 +109,8 @@ func New(registry string, config Config) (*RegistryClient, error) {
 		return nil, err
 	}
 
+	warnInsecure(registry, config.IsInsecure)
+
 	return &RegistryClient{
 		registry:   registry,
 		Config:     config,
@@ -84,6 +118,27 @@ func New(registry string, config Config) (*RegistryClient, error) {
 	}, nil
 }
 
+// warnedInsecure remembers registries we warned about insecure communication with, so we warn once per registry
+var warnedInsecure sync.Map
+
+// warnInsecure warns us (loudly), if we communicate registry over plain HTTP or skip verification of its certificate
+func warnInsecure(registry string, isInsecure bool) {
+	var reason string
+
+	switch {
+	case isInsecure:
+		reason = "plain HTTP is used, no TLS at all"
+	case transport.Registries.SkipsVerify(registry):
+		reason = "TLS certificate verification is disabled"
+	default:
+		return
+	}
+
+	if _, warned := warnedInsecure.LoadOrStore(registry, true); !warned {
+		log.Warnf("INSECURE registry %s: %s", registry, reason)
+	}
+}
+
 func (cli *RegistryClient) webScheme() string {
 	if cli.Config.IsInsecure {
 		return "http://"
@@ -97,13 +152,37 @@ func (cli *RegistryClient) URL() string {
 	return cli.webScheme() + cli.registry + "/v2/"
 }
 
+// WithContext gives us a shallow copy of the client (sharing its tokens), which aborts registry requests
+// as soon as context passed is done, e.g. to stop waiting for a stuck registry
+func (cli *RegistryClient) WithContext(ctx context.Context) *RegistryClient {
+	c := *cli
+	c.ctx = ctx
+
+	return &c
+}
+
+// Context gives us context registry requests are bound to (See WithContext)
+func (cli *RegistryClient) Context() context.Context {
+	if cli.ctx == nil {
+		return context.Background()
+	}
+
+	return cli.ctx
+}
+
 // Ping checks basic connectivity to the registry
 func (cli *RegistryClient) Ping() error {
-	resp, err := http.Get(cli.URL())
+	req, err := http.NewRequestWithContext(cli.Context(), "GET", cli.URL(), nil)
 	if err != nil {
 		return err
 	}
 
+	resp, err := transport.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode != 200 && resp.StatusCode != 401 {
 		return fmt.Errorf("Unexpected status: %s", resp.Status)
 	}
@@ -111,8 +190,24 @@ func (cli *RegistryClient) Ping() error {
 	return nil
 }
 
+// scopedCredentials gives us credentials to request token of the scope passed with (See Config.ScopedCredentials)
+func (cli *RegistryClient) scopedCredentials(scope, username, password string) (string, string) {
+	if cli.Config.ScopedCredentials == nil {
+		return username, password
+	}
+
+	return cli.Config.ScopedCredentials(cli.Context(), cli.registry, scope, username, password)
+}
+
+// newToken requests token of the scope passed, with credentials scoped for it, if we have them (See scopedCredentials)
+func (cli *RegistryClient) newToken(username, password, scope string) (auth.Token, error) {
+	username, password = cli.scopedCredentials(scope, username, password)
+
+	return auth.NewToken(cli.URL(), username, password, scope)
+}
+
 func (cli *RegistryClient) registryToken(username, password string) (auth.Token, error) {
-	tk, err := auth.NewToken(cli.URL(), username, password, "registry:catalog:*")
+	tk, err := cli.newToken(username, password, "registry:catalog:*")
 	if err != nil {
 		if cli.Config.WaitBetween == 0 {
 			log.Debugf("Try to login with less permissions (repository:catalog:*)")
@@ -120,7 +215,7 @@ func (cli *RegistryClient) registryToken(username, password string) (auth.Token,
 			log.Debugf("Try to login with less permissions (repository:catalog:*) [after waiting %v]", cli.Config.WaitBetween)
 			time.Sleep(cli.Config.WaitBetween)
 		}
-		tk, err = auth.NewToken(cli.URL(), username, password, "repository:catalog:*")
+		tk, err = cli.newToken(username, password, "repository:catalog:*")
 		if err != nil {
 			if username == "" && password == "" {
 				return tk, nil
@@ -133,25 +228,58 @@ func (cli *RegistryClient) registryToken(username, password string) (auth.Token,
 	return tk, nil
 }
 
+// credentialsKey gives us fingerprint of the credentials (username and hash of the password) to cache tokens by,
+// so tokens got with some credentials are never used by clients logged in with other ones ("" means anonymous)
+func credentialsKey(username, password string) string {
+	if username == "" && password == "" {
+		return ""
+	}
+
+	secret := sha256.Sum256([]byte(password))
+
+	return fmt.Sprintf("%s@%x", username, secret[:8])
+}
+
+// tokenKey gives us key to cache token of the registry (or the repository, if path passed) by
+func (cli *RegistryClient) tokenKey(repoPath string) string {
+	key := cli.registry
+	if repoPath != "" {
+		key += "/" + repoPath
+	}
+
+	if fp := credentialsKey(cli.username, cli.password); fp != "" {
+		key += "#" + fp
+	}
+
+	return key
+}
+
 // Login logs in to the registry (returns error, if failed)
 func (cli *RegistryClient) Login(username, password string) error {
-	if !cache.Token.Exists(cli.registry) {
+	cli.username = username
+	cli.password = password
+
+	key := cli.tokenKey("")
+
+	if !cache.Token.Exists(key) {
 		tk, err := cli.registryToken(username, password)
 		if err != nil {
 			return err
 		}
 
-		cache.Token.Set(cli.registry, tk)
+		cache.Token.Set(key, tk)
 	}
 
-	cli.Token = cache.Token.Get(cli.registry)
-
-	cli.username = username
-	cli.password = password
+	cli.Token = cache.Token.Get(key)
 
 	return nil
 }
 
+// VerifyCredentials checks if registry accepts passed credentials (does not log in and caches nothing)
+func (cli *RegistryClient) VerifyCredentials(username, password string) error {
+	return auth.VerifyCredentials(cli.URL(), username, password)
+}
+
 // IsLoggedIn indicates if we are logged in to registry or not
 func (cli *RegistryClient) IsLoggedIn() bool {
 	return cli.Token != nil
@@ -177,33 +305,118 @@ func decodeTagData(body io.ReadCloser) ([]string, map[string]manifest.Manifest,
 	return tagData.TagNames, manifest.MapByTag(tagManifests), nil
 }
 
+func decodeCatalog(body io.ReadCloser) ([]string, error) {
+	catalog := struct {
+		Repositories []string `json:"repositories"`
+	}{}
+
+	if err := json.NewDecoder(body).Decode(&catalog); err != nil {
+		return nil, err
+	}
+
+	return catalog.Repositories, nil
+}
+
+// Catalog gets list of all repository paths present in the registry
+// NB! Not all registries expose catalog, e.g. DockerHub does not.
+func (cli *RegistryClient) Catalog() ([]string, error) {
+	if cli.Token == nil {
+		return nil, fmt.Errorf("not logged in to registry: %s", cli.registry)
+	}
+
+	allRepoPaths := make([]string, 0)
+
+	link := "_catalog"
+	for {
+		resp, nextlink, err := request.PerformContext(
+			cli.Context(),
+			cli.URL()+link,
+			cli.Token.Method()+" "+cli.Token.String(),
+			"v2",
+			cli.Config.TraceRequests,
+			cli.Config.RetryRequests,
+			cli.Config.RetryDelay,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == 404 {
+			return nil, fmt.Errorf("catalog is not available for registry: %s", cli.registry)
+		}
+
+		repoPaths, err := decodeCatalog(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		allRepoPaths = append(allRepoPaths, repoPaths...)
+
+		if nextlink == "" {
+			break
+		}
+
+		link = "_catalog?" + nextlink
+	}
+
+	return allRepoPaths, nil
+}
+
+// dockerHubIdentities are registry identities of Docker Hub, it has official images under "library/" path
+var dockerHubIdentities = map[string]bool{
+	"docker.io":                   true,
+	"index.docker.io":             true,
+	"registry-1.docker.io":        true,
+	"registry.hub.docker.com":     true,
+	"https://index.docker.io/v1/": true,
+}
+
+// scopePath gives us repository path as it is known to the registry identity (See Config.AuthRegistry)
+func (cli *RegistryClient) scopePath(repoPath string) string {
+	if dockerHubIdentities[cli.Config.AuthRegistry] && !strings.Contains(repoPath, "/") {
+		return "library/" + repoPath
+	}
+
+	return repoPath
+}
+
 func (cli *RegistryClient) repoToken(repoPath string) (auth.Token, error) {
+	return cli.repoScopedToken(repoPath, "pull")
+}
+
+func (cli *RegistryClient) repoScopedToken(repoPath, actions string) (auth.Token, error) {
 	if cli.Token != nil && cli.Token.Method() != "Bearer" {
 		return cli.Token, nil
 	}
 
-	_, tokenDefined := cli.RepoTokens[repoPath]
-	if tokenDefined {
-		return cli.RepoTokens[repoPath], nil
+	key := cli.tokenKey(repoPath)
+	if actions != "pull" {
+		key = key + ":" + actions
 	}
 
-	if !cache.Token.Exists(repoPath) {
-		repoToken, err := auth.NewToken(
-			cli.URL(),
-			cli.username,
-			cli.password,
-			"repository:"+repoPath+":pull",
-		)
+	// token expired in cache (See cache.MaxTokenAge) is not used by the client anymore too
+	if !cache.Token.Exists(key) {
+		repoToken, err := cli.newToken(cli.username, cli.password, "repository:"+cli.scopePath(repoPath)+":"+actions)
 		if err != nil {
 			return nil, err
 		}
 
-		cache.Token.Set(repoPath, repoToken)
+		cache.Token.Set(key, repoToken)
+	} else if tk, defined := cli.RepoTokens[key]; defined {
+		return tk, nil
 	}
 
-	cli.RepoTokens[repoPath] = cache.Token.Get(repoPath)
+	cli.RepoTokens[key] = cache.Token.Get(key)
 
-	return cli.RepoTokens[repoPath], nil
+	return cli.RepoTokens[key], nil
+}
+
+// VerifyAccess checks if we are able to get a token scoped for the actions passed (e.g. "pull" or "pull,push") on the repository
+// NB! Registries not using token authentication (or anonymous ones) could still reject these actions later.
+func (cli *RegistryClient) VerifyAccess(repoPath, actions string) error {
+	_, err := cli.repoScopedToken(repoPath, actions)
+
+	return err
 }
 
 // TagData gets list of all tag names and all additional data for the repository path specified
@@ -218,7 +431,8 @@ func (cli *RegistryClient) TagData(repoPath string) ([]string, map[string]manife
 
 	link := "/tags/list"
 	for {
-		resp, nextlink, err := request.Perform(
+		resp, nextlink, err := request.PerformContext(
+			cli.Context(),
 			cli.URL()+repoPath+link,
 			repoToken.Method()+" "+repoToken.String(),
 			"v2",
@@ -248,13 +462,94 @@ func (cli *RegistryClient) TagData(repoPath string) ([]string, map[string]manife
 	return allTagNames, allTagManifests, nil
 }
 
-func (cli *RegistryClient) tagDigest(repoPath, tagName string) (string, error) {
+// CountTags counts tags of the repository path specified (only ones matched, if match function passed),
+// paging through tag names only. Total count header (e.g. "X-Total-Count"), if registry gives it, is used directly.
+func (cli *RegistryClient) CountTags(repoPath string, match func(string) bool) (int, error) {
 	repoToken, err := cli.repoToken(repoPath)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	resp, _, err := request.Perform(
+	count := 0
+
+	link := "/tags/list"
+	for {
+		resp, nextlink, err := request.PerformContext(
+			cli.Context(),
+			cli.URL()+repoPath+link,
+			repoToken.Method()+" "+repoToken.String(),
+			"v2",
+			cli.Config.TraceRequests,
+			cli.Config.RetryRequests,
+			cli.Config.RetryDelay,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode == 404 {
+			resp.Body.Close()
+
+			return 0, fmt.Errorf("repository not found: %s%s", cli.URL(), repoPath)
+		}
+
+		if match == nil {
+			if total, err := strconv.Atoi(resp.Header.Get("X-Total-Count")); err == nil {
+				resp.Body.Close()
+
+				return total, nil
+			}
+		}
+
+		tagNames := struct {
+			Tags []string `json:"tags"`
+		}{}
+
+		err = json.NewDecoder(resp.Body).Decode(&tagNames)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+
+		for _, tagName := range tagNames.Tags {
+			if match == nil || match(tagName) {
+				count++
+			}
+		}
+
+		if nextlink == "" {
+			break
+		}
+
+		link = "/tags/list?" + nextlink
+	}
+
+	return count, nil
+}
+
+// schema1Warned keeps repositories we already warned about serving deprecated "schema1" manifests
+var schema1Warned sync.Map
+
+func (cli *RegistryClient) warnSchema1(repoPath string) {
+	if _, warned := schema1Warned.LoadOrStore(cli.registry+"/"+repoPath, true); warned {
+		return
+	}
+
+	log.Warnf(
+		"DEPRECATED %s/%s serves \"schema1\" manifests: creation dates and sizes may be unavailable",
+		cli.registry, repoPath,
+	)
+}
+
+// tagManifestOptions gets tag options we could take from its manifest (digest, artifact type) and response headers
+func (cli *RegistryClient) tagManifestOptions(repoPath, tagName string) (*tag.Options, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := request.PerformContext(
+		cli.Context(),
 		cli.URL()+repoPath+"/manifests/"+tagName,
 		repoToken.Method()+" "+repoToken.String(),
 		"v2",
@@ -263,12 +558,49 @@ func (cli *RegistryClient) tagDigest(repoPath, tagName string) (string, error) {
 		cli.Config.RetryDelay,
 	)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+
+	isSchema1 := manifest.IsSchema1MediaType(mediaType)
+	if isSchema1 {
+		cli.warnSchema1(repoPath)
+	}
+
+	data, err := cli.readLimited(resp.Body, "manifest", repoPath+":"+tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &tag.Options{}
+
+	if content, err := manifest.ParseContent(mediaType, data); err == nil {
+		options.ArtifactType = content.GetArtifactType()
+		if !content.IsIndex() {
+			options.LayerCount = content.LayerCount()
+		}
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		options.LastModified = lastModified.Unix()
 	}
 
 	digests, defined := resp.Header["Docker-Content-Digest"]
 	if defined {
-		return digests[0], nil
+		options.Digest = digests[0]
+
+		return options, nil
+	}
+
+	if isSchema1 {
+		options.Digest, err = manifest.Schema1Digest(data)
+		if err != nil {
+			return nil, err
+		}
+
+		return options, nil
 	}
 
 	type configField struct {
@@ -277,15 +609,16 @@ func (cli *RegistryClient) tagDigest(repoPath, tagName string) (string, error) {
 	var values struct {
 		Config configField `json:"config"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
-		return "", err
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
 	}
 
 	if values.Config.Digest == "" {
 		values.Config.Digest = "this.image.is.bad.it.has.no.digest.fuuu!"
 	}
+	options.Digest = values.Config.Digest
 
-	return values.Config.Digest, nil
+	return options, nil
 }
 
 func (cli *RegistryClient) v1TagHistory(s string) (*tag.Options, error) {
@@ -299,12 +632,15 @@ func (cli *RegistryClient) v1TagHistory(s string) (*tag.Options, error) {
 		return nil, err
 	}
 
-	t, err := time.Parse(time.RFC3339, v1history.Created)
-	if err != nil {
-		return nil, err
+	options := &tag.Options{ImageID: v1history.ContainerID}
+
+	if t, err := manifest.ParseCreated(v1history.Created); err == nil {
+		options.Created = t.Unix()
+	} else {
+		log.Warnf("IGNORED creation date of %s image: %s", v1history.ContainerID, err.Error())
 	}
 
-	return &tag.Options{Created: t.Unix(), ImageID: v1history.ContainerID}, nil
+	return options, nil
 }
 
 func (cli *RegistryClient) v1TagOptions(repoPath, tagName string) (*tag.Options, error) {
@@ -313,7 +649,8 @@ func (cli *RegistryClient) v1TagOptions(repoPath, tagName string) (*tag.Options,
 		return nil, err
 	}
 
-	resp, _, err := request.Perform(
+	resp, _, err := request.PerformContext(
+		cli.Context(),
 		cli.URL()+repoPath+"/manifests/"+tagName,
 		repoToken.Method()+" "+repoToken.String(),
 		"v1",
@@ -329,7 +666,7 @@ func (cli *RegistryClient) v1TagOptions(repoPath, tagName string) (*tag.Options,
 		History []map[string]string `json:"history"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&v1manifest); err != nil {
+	if err := cli.decodeLimited(resp.Body, "manifest", repoPath+":"+tagName, &v1manifest); err != nil {
 		return nil, err
 	}
 
@@ -340,19 +677,260 @@ func (cli *RegistryClient) v1TagOptions(repoPath, tagName string) (*tag.Options,
 	return cli.v1TagHistory(v1manifest.History[0]["v1Compatibility"])
 }
 
+// selectManifest selects manifest list/index child by the configured annotation (if any) or platform
+func (cli *RegistryClient) selectManifest(content *manifest.Content, repoPath, tagName string) (*manifest.Descriptor, error) {
+	if cli.Config.Annotation != nil {
+		d := content.SelectManifestByAnnotation(*cli.Config.Annotation)
+		if d == nil {
+			return nil, fmt.Errorf("no image with annotation %s: %s:%s", cli.Config.Annotation, repoPath, tagName)
+		}
+
+		return d, nil
+	}
+
+	d := content.SelectManifest(cli.Config.Platform)
+	if d == nil {
+		return nil, fmt.Errorf("no image for platform %s: %s:%s", cli.Config.Platform, repoPath, tagName)
+	}
+
+	return d, nil
+}
+
+// SelectedImageDigest gives digest of the image we select from manifest list/index tagged (by annotation or platform),
+// or an empty string, if tag references a single image (i.e. there is nothing to select from)
+func (cli *RegistryClient) SelectedImageDigest(repoPath, tagName string) (string, error) {
+	data, mediaType, _, err := cli.ManifestData(repoPath, tagName)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return "", err
+	}
+
+	if !content.IsIndex() {
+		return "", nil
+	}
+
+	d, err := cli.selectManifest(content, repoPath, tagName)
+	if err != nil {
+		return "", err
+	}
+
+	return d.Digest, nil
+}
+
+// platformManifest gets image manifest of the tag specified
+// NB! For manifest lists/indexes image selected by the configured annotation (if any) or platform is used.
+func (cli *RegistryClient) platformManifest(repoPath, tagName string) (*manifest.Content, error) {
+	data, mediaType, _, err := cli.ManifestData(repoPath, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if content.IsIndex() {
+		d, err := cli.selectManifest(content, repoPath, tagName)
+		if err != nil {
+			return nil, err
+		}
+
+		data, mediaType, _, err = cli.ManifestData(repoPath, d.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err = manifest.ParseContent(mediaType, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return content, nil
+}
+
+// configCreated gets image creation date from image config blob referenced by the manifest passed
+func (cli *RegistryClient) configCreated(repoPath, tagName string, content *manifest.Content) (int64, error) {
+	if content.Config == nil {
+		return 0, fmt.Errorf("no image config to extract data from: %s:%s", repoPath, tagName)
+	}
+
+	blob, _, err := cli.Blob(repoPath, content.Config.Digest)
+	if err != nil {
+		return 0, err
+	}
+	defer blob.Close()
+
+	var imageConfig struct {
+		Created string `json:"created"`
+	}
+
+	if err := cli.decodeLimited(blob, "image config", repoPath+"@"+content.Config.Digest, &imageConfig); err != nil {
+		return 0, err
+	}
+
+	if imageConfig.Created == "" {
+		return 0, fmt.Errorf("no creation date in image config: %s:%s", repoPath, tagName)
+	}
+
+	created, err := manifest.ParseCreated(imageConfig.Created)
+	if err != nil {
+		log.Warnf("IGNORED creation date of %s:%s: %s", repoPath, tagName, err.Error())
+
+		return 0, nil
+	}
+
+	return created.Unix(), nil
+}
+
+// configPlatform gets platform of the image from image config blob referenced by the manifest passed
+func (cli *RegistryClient) configPlatform(repoPath, tagName string, content *manifest.Content) (manifest.Platform, error) {
+	if content.Config == nil {
+		return manifest.Platform{}, fmt.Errorf("no image config to extract data from: %s:%s", repoPath, tagName)
+	}
+
+	blob, _, err := cli.Blob(repoPath, content.Config.Digest)
+	if err != nil {
+		return manifest.Platform{}, err
+	}
+	defer blob.Close()
+
+	var p manifest.Platform
+
+	if err := cli.decodeLimited(blob, "image config", repoPath+"@"+content.Config.Digest, &p); err != nil {
+		return manifest.Platform{}, err
+	}
+
+	return p, nil
+}
+
+// Architectures gives architectures ("ARCH[/VARIANT]") the tag has images for: all the ones of manifest list/index children,
+// or the only one taken from image config, if tag references a single image
+func (cli *RegistryClient) Architectures(repoPath, tagName string) ([]string, error) {
+	data, mediaType, _, err := cli.ManifestData(repoPath, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if content.IsIndex() {
+		return content.Architectures(), nil
+	}
+
+	p, err := cli.configPlatform(repoPath, tagName, content)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Architecture == "" {
+		return []string{}, nil
+	}
+
+	if p.Variant != "" {
+		return []string{p.Architecture + "/" + p.Variant}, nil
+	}
+
+	return []string{p.Architecture}, nil
+}
+
+// PlatformImage is an image tag has for the platform: a manifest list/index child or the single image tagged
+type PlatformImage struct {
+	Platform manifest.Platform
+	Digest   string
+}
+
+// Platforms gives images the tag has for every platform: all the manifest list/index children (in the index order),
+// or the only one with platform taken from image config, if tag references a single image. Children with "unknown"
+// platform (e.g. build attestations) are not images, so they are not given.
+func (cli *RegistryClient) Platforms(repoPath, tagName string) ([]PlatformImage, error) {
+	data, mediaType, digest, err := cli.ManifestData(repoPath, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !content.IsIndex() {
+		p, err := cli.configPlatform(repoPath, tagName, content)
+		if err != nil {
+			return nil, err
+		}
+
+		return []PlatformImage{{Platform: p, Digest: digest}}, nil
+	}
+
+	images := make([]PlatformImage, 0, len(content.Manifests))
+	for _, d := range content.Manifests {
+		if d.Platform == nil || d.Platform.Architecture == "" || d.Platform.Architecture == "unknown" {
+			continue
+		}
+
+		images = append(images, PlatformImage{Platform: *d.Platform, Digest: d.Digest})
+	}
+
+	return images, nil
+}
+
+// ImageLabels gets labels of the image tagged (taken from its config blob)
+// NB! For manifest lists/indexes image built for the configured platform is used.
+func (cli *RegistryClient) ImageLabels(repoPath, tagName string) (map[string]string, error) {
+	content, err := cli.platformManifest(repoPath, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	if content.Config == nil {
+		return nil, fmt.Errorf("no image config to extract data from: %s:%s", repoPath, tagName)
+	}
+
+	blob, _, err := cli.Blob(repoPath, content.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	var imageConfig struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+
+	if err := cli.decodeLimited(blob, "image config", repoPath+"@"+content.Config.Digest, &imageConfig); err != nil {
+		return nil, err
+	}
+
+	if imageConfig.Config.Labels == nil {
+		return map[string]string{}, nil
+	}
+
+	return imageConfig.Config.Labels, nil
+}
+
 // Tag gets information about specified repository tag
 func (cli *RegistryClient) Tag(repoPath, tagName string, tagManifest manifest.Manifest) (*tag.Tag, error) {
-	dc := make(chan string, 0)
+	dc := make(chan *tag.Options, 0)
 	ec := make(chan error, 0)
 
-	go func(dc chan string, ec chan error) {
-		digest, err := cli.tagDigest(repoPath, tagName)
+	go func(dc chan *tag.Options, ec chan error) {
+		options, err := cli.tagManifestOptions(repoPath, tagName)
 		if err != nil {
 			ec <- err
 			return
 		}
 
-		dc <- digest
+		dc <- options
 	}(dc, ec)
 
 	options, err := cli.v1TagOptions(repoPath, tagName)
@@ -363,8 +941,11 @@ func (cli *RegistryClient) Tag(repoPath, tagName string, tagManifest manifest.Ma
 	}
 
 	select {
-	case digest := <-dc:
-		options.Digest = digest
+	case mo := <-dc:
+		options.Digest = mo.Digest
+		options.ArtifactType = mo.ArtifactType
+		options.LastModified = mo.LastModified
+		options.LayerCount = mo.LayerCount
 	case err := <-ec:
 		return nil, err
 	}
@@ -373,5 +954,47 @@ func (cli *RegistryClient) Tag(repoPath, tagName string, tagManifest manifest.Ma
 		options.Created = tagManifest.Created()
 	}
 
+	if options.Size == 0 {
+		options.Size = tagManifest.ImageSizeBytes
+	}
+
+	needCreated := options.Created == 0
+	needSize := options.Size == 0 && cli.Config.FetchSizes
+	needLayers := options.LayerCount == 0 && cli.Config.FetchLayers
+
+	if needCreated || needSize || needLayers || cli.Config.FetchBlobs {
+		content, err := cli.platformManifest(repoPath, tagName)
+		if err != nil {
+			log.Debugf("%s\n", err.Error())
+
+			return tag.New(tagName, *options)
+		}
+
+		if needSize {
+			options.Size = content.ImageSize()
+		}
+
+		if needLayers {
+			options.LayerCount = content.LayerCount()
+		}
+
+		if cli.Config.FetchBlobs {
+			options.Blobs = content.Blobs()
+
+			if options.Size == 0 {
+				options.Size = content.ImageSize()
+			}
+		}
+
+		if needCreated {
+			created, err := cli.configCreated(repoPath, tagName, content)
+			if err != nil {
+				log.Debugf("%s\n", err.Error())
+			}
+
+			options.Created = created
+		}
+	}
+
 	return tag.New(tagName, *options)
 }
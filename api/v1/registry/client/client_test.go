@@ -0,0 +1,687 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// runMultiArchRegistry serves "foo/bar:latest" as an index of images (per "indexFile" fixture)
+// NB! Every image built for a different platform has a different creation date (but the same size: 1100 bytes).
+func runMultiArchRegistry(t *testing.T) (*httptest.Server, map[string]time.Time) {
+	index, err := ioutil.ReadFile("../../../../fixtures/manifest/index.json")
+	if err != nil {
+		t.Fatalf("unable to read index fixture: %s", err.Error())
+	}
+
+	c, _ := manifest.ParseContent("", index)
+
+	documents := map[string][]byte{"/v2/foo/bar/manifests/latest": index}
+	types := map[string]string{"/v2/foo/bar/manifests/latest": manifest.MediaTypeOCIIndex}
+	created := make(map[string]time.Time)
+
+	for i, d := range c.Manifests {
+		date := time.Date(2020, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC)
+		config := []byte(`{"created":"` + date.Format(time.RFC3339) + `","os":"` + d.Platform.OS + `","architecture":"` + d.Platform.Architecture + `","variant":"` + d.Platform.Variant + `","config":{"Labels":{"platform":"` + d.Platform.String() + `"}}}`)
+		image := []byte(`{"schemaVersion":2,"config":{"digest":"` + digestOf(config) + `","size":100},"layers":[{"digest":"sha256:0","size":1000}]}`)
+
+		documents["/v2/foo/bar/blobs/"+digestOf(config)] = config
+		documents["/v2/foo/bar/manifests/"+d.Digest] = image
+		types["/v2/foo/bar/manifests/"+d.Digest] = manifest.MediaTypeOCIManifest
+
+		created[d.Platform.String()] = date
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		data, defined := documents[r.URL.Path]
+		if !defined {
+			http.NotFound(w, r)
+			return
+		}
+
+		if reference := path.Base(r.URL.Path); strings.HasPrefix(reference, "sha256:") {
+			w.Header().Set("Docker-Content-Digest", reference)
+		}
+
+		w.Header().Set("Content-Type", types[r.URL.Path])
+		w.Write(data)
+	}))
+
+	return server, created
+}
+
+func TestTag_PlatformCreated(t *testing.T) {
+	server, created := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	for _, platform := range []string{"linux/amd64", "linux/arm/v7", "linux/arm64/v8"} {
+		p, _ := manifest.ParsePlatform(platform)
+
+		cli, err := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p})
+		assert.Nil(err)
+		assert.Nil(cli.Login("", ""))
+
+		tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+		assert.Nil(err, "should be no error (platform: %s)", platform)
+		assert.Equal(created[platform].Unix(), tg.GetCreated(), "unexpected creation date (platform: %s)", platform)
+	}
+
+	p, _ := manifest.ParsePlatform("windows/amd64")
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err, "should NOT fail, if there is no image for platform")
+	assert.Equal(int64(0), tg.GetCreated(), "should have no creation date, if there is no image for platform")
+}
+
+func TestImageLabels(t *testing.T) {
+	server, _ := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	p, _ := manifest.ParsePlatform("linux/arm64/v8")
+
+	cli, err := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p})
+	assert.Nil(err)
+	assert.Nil(cli.Login("", ""))
+
+	labels, err := cli.ImageLabels("foo/bar", "latest")
+
+	assert.Nil(err)
+	assert.Equal(map[string]string{"platform": "linux/arm64/v8"}, labels, "should take labels of the image for platform")
+
+	_, err = cli.ImageLabels("foo/bar", "nonexistent")
+
+	assert.NotNil(err, "should fail for nonexistent tag")
+}
+
+func TestArchitectures(t *testing.T) {
+	server, _ := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	archs, err := cli.Architectures("foo/bar", "latest")
+
+	assert.Nil(err)
+	assert.Equal([]string{"amd64", "arm/v6", "arm/v7", "arm64/v8"}, archs, "should take architectures of all images in index")
+
+	archs, err = cli.Architectures("foo/bar", "sha256:3333333333333333333333333333333333333333333333333333333333333333")
+
+	assert.Nil(err)
+	assert.Equal([]string{"arm/v7"}, archs, "should take architecture of a single image from its config")
+
+	_, err = cli.Architectures("foo/bar", "nonexistent")
+
+	assert.NotNil(err, "should fail for nonexistent tag")
+}
+
+func TestPlatforms(t *testing.T) {
+	server, _ := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	images, err := cli.Platforms("foo/bar", "latest")
+
+	assert.Nil(err)
+	assert.Equal(4, len(images), "should take all images in index")
+
+	platforms := make([]string, 0, len(images))
+	for _, img := range images {
+		platforms = append(platforms, img.Platform.String())
+	}
+
+	assert.Equal([]string{"linux/amd64", "linux/arm/v6", "linux/arm/v7", "linux/arm64/v8"}, platforms)
+	assert.Equal("sha256:2222222222222222222222222222222222222222222222222222222222222222", images[1].Digest)
+
+	const digest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+
+	images, err = cli.Platforms("foo/bar", digest)
+
+	assert.Nil(err)
+	assert.Equal(
+		[]PlatformImage{{Platform: manifest.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, Digest: digest}},
+		images,
+		"should take platform of a single image from its config",
+	)
+
+	_, err = cli.Platforms("foo/bar", "nonexistent")
+
+	assert.NotNil(err, "should fail for nonexistent tag")
+}
+
+func TestImageLabels_Annotation(t *testing.T) {
+	server, _ := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	annotation, _ := manifest.ParseAnnotation("org.opencontainers.image.ref.name=armv7")
+
+	cli, err := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Annotation: annotation})
+	assert.Nil(err)
+	assert.Nil(cli.Login("", ""))
+
+	labels, err := cli.ImageLabels("foo/bar", "latest")
+
+	assert.Nil(err)
+	assert.Equal(map[string]string{"platform": "linux/arm/v7"}, labels, "should take labels of the image selected by annotation")
+
+	digest, err := cli.SelectedImageDigest("foo/bar", "latest")
+
+	assert.Nil(err)
+	assert.Equal("sha256:3333333333333333333333333333333333333333333333333333333333333333", digest)
+
+	digest, err = cli.SelectedImageDigest("foo/bar", digest)
+
+	assert.Nil(err)
+	assert.Equal("", digest, "should select nothing from a single image")
+
+	cli.Config.Annotation, _ = manifest.ParseAnnotation("org.opencontainers.image.ref.name=s390x")
+
+	_, err = cli.SelectedImageDigest("foo/bar", "latest")
+
+	assert.EqualError(err, "no image with annotation org.opencontainers.image.ref.name=s390x: foo/bar:latest")
+}
+
+func TestTag_OddCreated(t *testing.T) {
+	var config []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/manifests/latest":
+			w.Header().Set("Content-Type", manifest.MediaTypeOCIManifest)
+			w.Header().Set("Docker-Content-Digest", "sha256:1111")
+			w.Write([]byte(`{"schemaVersion":2,"config":{"digest":"` + digestOf(config) + `","size":100},"layers":[]}`))
+		case "/v2/foo/bar/blobs/" + digestOf(config):
+			w.Write(config)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	config = []byte(`{"created":"2016-01-01T00:00:00.123456789"}`)
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err)
+	assert.Equal(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), tg.GetCreated(), "should take timestamp with no time zone as UTC one")
+
+	config = []byte(`{"created":"a long time ago"}`)
+
+	tg, err = cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err, "should NOT fail on unsupported timestamp")
+	assert.Equal(int64(0), tg.GetCreated(), "should have no creation date, if timestamp is not supported")
+}
+
+func TestScopePath(t *testing.T) {
+	assert := assert.New(t)
+
+	mirror, _ := New("mirror.internal", Config{AuthRegistry: "docker.io"})
+
+	assert.Equal("library/alpine", mirror.scopePath("alpine"), "should scope official image as Docker Hub does")
+	assert.Equal("bitnami/nginx", mirror.scopePath("bitnami/nginx"))
+
+	registry, _ := New("registry.company.io", Config{})
+
+	assert.Equal("alpine", registry.scopePath("alpine"))
+}
+
+func TestTag_Size(t *testing.T) {
+	server, _ := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	p, _ := manifest.ParsePlatform("linux/arm64/v8")
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err)
+	assert.Equal(int64(0), tg.GetSize(), "should not fetch size, if not asked to")
+
+	cli, _ = New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p, FetchSizes: true})
+	cli.Login("", "")
+
+	tg, err = cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err)
+	assert.Equal(int64(1100), tg.GetSize(), "should sum up config and layer sizes")
+
+	tg, err = cli.Tag("foo/bar", "latest", manifest.Manifest{ImageSizeBytes: 4096})
+
+	assert.Nil(err)
+	assert.Equal(int64(4096), tg.GetSize(), "should prefer size given by registry")
+	assert.Nil(tg.GetBlobs(), "should not fetch blobs, if not asked to")
+
+	cli, _ = New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: p, FetchBlobs: true})
+	cli.Login("", "")
+
+	tg, err = cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err)
+	assert.Equal(2, len(tg.GetBlobs()), "should fetch config and layer sizes")
+	assert.Equal(int64(1000), tg.GetBlobs()["sha256:0"])
+	assert.Equal(int64(1100), tg.GetSize(), "should take size from blobs, if not known otherwise")
+}
+
+func TestTag_CreatedNotUploaded(t *testing.T) {
+	server, created := runMultiArchRegistry(t)
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, Platform: manifest.Platform{OS: "linux", Architecture: "amd64"}})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{TimeUploaded: time.Now().Unix()})
+
+	assert.Nil(err)
+	assert.Equal(created["linux/amd64"].Unix(), tg.GetCreated(), "should take creation date from image config, not upload date")
+}
+
+func TestTag_Schema1(t *testing.T) {
+	schema1, err := ioutil.ReadFile("../../../../fixtures/manifest/schema1.json")
+	if err != nil {
+		t.Fatalf("unable to read schema1 fixture: %s", err.Error())
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/manifests/latest":
+			w.Header().Set("Content-Type", manifest.MediaTypeDockerV1Signed)
+			w.Write(schema1)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err, "should list tags served with schema1 manifests")
+	assert.Equal("sha256:fac05af875df794db016fd83c3ad45f6605e96e096c5101ac794e7178a7b78f7", tg.GetDigest(), "should resolve schema1 digest")
+	assert.Equal(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC).Unix(), tg.GetCreated(), "should take creation date from schema1 history")
+}
+
+func TestTag_Artifact(t *testing.T) {
+	chart := []byte(`{"schemaVersion":2,"mediaType":"` + manifest.MediaTypeOCIManifest + `",` +
+		`"config":{"mediaType":"application/vnd.cncf.helm.config.v1+json","digest":"sha256:c0nf1g","size":100},` +
+		`"layers":[{"mediaType":"application/vnd.cncf.helm.chart.content.v1.tar+gzip","digest":"sha256:ch4rt","size":1000}]}`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/chart/manifests/1.0.0":
+			if !strings.Contains(strings.Join(r.Header["Accept"], ","), manifest.MediaTypeOCIManifest) {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", manifest.MediaTypeOCIManifest)
+			w.Header().Set("Docker-Content-Digest", digestOf(chart))
+			w.Write(chart)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/chart", "1.0.0", manifest.Manifest{})
+
+	assert.Nil(err, "should list tags referencing OCI artifacts")
+	assert.Equal(digestOf(chart), tg.GetDigest())
+	assert.Equal("application/vnd.cncf.helm.config.v1+json", tg.GetArtifactType())
+	assert.False(tg.IsImage())
+}
+
+func TestTag_LastModified(t *testing.T) {
+	lastModified := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+			w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	tg, err := cli.Tag("foo/bar", "latest", manifest.Manifest{})
+
+	assert.Nil(err)
+	assert.Equal(lastModified.Unix(), tg.GetLastModified(), "should take last modification time from registry")
+}
+
+func TestCountTags(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/tags/list":
+			requests++
+
+			if r.URL.Query().Get("last") == "" {
+				w.Header().Set("Link", `</v2/foo/bar/tags/list?last=v2&n=2>; rel="next"`)
+				w.Write([]byte(`{"name":"foo/bar","tags":["v1","v2"]}`))
+				return
+			}
+
+			w.Write([]byte(`{"name":"foo/bar","tags":["v3","latest"]}`))
+		case "/v2/foo/counted/tags/list":
+			w.Header().Set("X-Total-Count", "1000")
+			w.Write([]byte(`{"name":"foo/counted","tags":["v1"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+	cli.Login("", "")
+
+	count, err := cli.CountTags("foo/bar", nil)
+
+	assert.Nil(err)
+	assert.Equal(4, count, "should count tags on all pages")
+	assert.Equal(2, requests)
+
+	count, err = cli.CountTags("foo/bar", func(tagName string) bool { return strings.HasPrefix(tagName, "v") })
+
+	assert.Nil(err)
+	assert.Equal(3, count, "should count only tags matched")
+
+	count, err = cli.CountTags("foo/counted", nil)
+
+	assert.Nil(err)
+	assert.Equal(1000, count, "should take total count from header")
+
+	_, err = cli.CountTags("foo/nonexistent", nil)
+
+	assert.NotNil(err, "should fail for nonexistent repository")
+}
+
+func TestProbeCapabilities(t *testing.T) {
+	testCases := map[string]struct {
+		statuses     map[string]int
+		capabilities Capabilities
+		isError      bool
+	}{
+		"everything supported": {
+			statuses:     map[string]int{"catalog": 200, "referrers": 200, "delete": 404},
+			capabilities: Capabilities{Catalog: true, Delete: true, Referrers: true},
+		},
+		"nothing supported": {
+			statuses:     map[string]int{"catalog": 401, "referrers": 404, "delete": 405},
+			capabilities: Capabilities{},
+		},
+		"delete forbidden": {
+			statuses:     map[string]int{"catalog": 200, "referrers": 404, "delete": 403},
+			capabilities: Capabilities{Catalog: true},
+		},
+		"registry broken": {
+			statuses: map[string]int{"catalog": 500},
+			isError:  true,
+		},
+	}
+
+	assert := assert.New(t)
+
+	for name, testCase := range testCases {
+		statuses := testCase.statuses
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.URL.Path == "/v2/":
+				w.Write([]byte("{}"))
+			case r.URL.Path == "/v2/_catalog":
+				w.WriteHeader(statuses["catalog"])
+			case strings.HasPrefix(r.URL.Path, "/v2/foo/bar/referrers/"):
+				w.WriteHeader(statuses["referrers"])
+			case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v2/foo/bar/manifests/"):
+				w.WriteHeader(statuses["delete"])
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true})
+		cli.Login("", "")
+
+		capabilities, err := cli.ProbeCapabilities("foo/bar")
+
+		server.Close()
+
+		if testCase.isError {
+			assert.NotNil(err, name)
+			continue
+		}
+
+		assert.Nil(err, name)
+		assert.Equal(testCase.capabilities, *capabilities, name)
+	}
+
+	assert.Equal("catalog=yes delete=no referrers=yes", Capabilities{Catalog: true, Referrers: true}.String())
+}
+
+func TestManifestData_TooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/manifests/huge":
+			w.Header().Set("Content-Type", manifest.MediaTypeOCIManifest)
+			w.Write([]byte(`{"schemaVersion":2,"annotations":{"junk":"` + strings.Repeat("x", 2048) + `"}}`))
+		case "/v2/foo/bar/manifests/small":
+			w.Header().Set("Content-Type", manifest.MediaTypeOCIManifest)
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, MaxManifestBytes: 1024})
+	cli.Login("", "")
+
+	_, _, _, err := cli.ManifestData("foo/bar", "huge")
+
+	assert.NotNil(err, "should refuse to read manifest bigger than the limit")
+	assert.IsType(&TooLargeError{}, err)
+
+	_, _, _, err = cli.ManifestData("foo/bar", "small")
+
+	assert.Nil(err, "should read manifest within the limit")
+
+	assert.Equal(int64(DefaultMaxManifestBytes), (&RegistryClient{}).maxManifestBytes(), "should take default limit, if none is set")
+}
+
+func TestBlob_Redirect(t *testing.T) {
+	blob := []byte("layer data")
+
+	// storage models S3/GCS: it serves blobs by signed URLs only and rejects any "Authorization" header
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("only one auth mechanism allowed"))
+			return
+		}
+
+		if r.URL.Query().Get("signature") != "signed" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.Write(blob)
+	}))
+	defer storage.Close()
+
+	var registry *httptest.Server
+
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Write([]byte(`{"token":"secret"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("Www-Authenticate", `Bearer realm="`+registry.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/bar/blobs/" + digestOf(blob):
+			http.Redirect(w, r, storage.URL+"/blobs/"+digestOf(blob)+"?signature=signed", http.StatusTemporaryRedirect)
+		case "/v2/foo/bar/blobs/sha256:moved":
+			http.Redirect(w, r, "/v2/foo/bar/blobs/"+digestOf(blob), http.StatusPermanentRedirect)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+
+	assert := assert.New(t)
+
+	cli, _ := New(strings.TrimPrefix(registry.URL, "http://"), Config{IsInsecure: true})
+	assert.Nil(cli.Login("", ""))
+
+	for _, digest := range []string{digestOf(blob), "sha256:moved"} {
+		body, _, err := cli.Blob("foo/bar", digest)
+		if !assert.Nil(err, "should follow redirects and not forward registry authorization to storage") {
+			continue
+		}
+
+		data, _ := ioutil.ReadAll(body)
+		body.Close()
+
+		assert.Equal(blob, data)
+	}
+}
+
+func TestScopedCredentials(t *testing.T) {
+	var registry *httptest.Server
+
+	var mux sync.Mutex
+	usernames := make(map[string]string)
+
+	registry = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, _, _ := r.BasicAuth()
+
+			mux.Lock()
+			usernames[r.URL.Query().Get("scope")] = username
+			mux.Unlock()
+
+			w.Write([]byte(`{"token":"secret"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("Www-Authenticate", `Bearer realm="`+registry.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		w.Write([]byte("{}"))
+	}))
+	defer registry.Close()
+
+	assert := assert.New(t)
+
+	// auth provider handing out credentials good for repository scopes only
+	scopedCredentials := func(ctx context.Context, _, scope, username, password string) (string, string) {
+		assert.NotNil(ctx)
+
+		if !strings.HasPrefix(scope, "repository:foo/") {
+			return username, password
+		}
+
+		return "scoped", "t0k3n"
+	}
+
+	cli, _ := New(strings.TrimPrefix(registry.URL, "http://"), Config{IsInsecure: true, ScopedCredentials: scopedCredentials})
+	assert.Nil(cli.Login("robot", "s3cr3t"))
+
+	assert.Nil(cli.VerifyAccess("foo/bar", "pull,push"))
+
+	assert.Equal("robot", usernames["registry:catalog:*"], "should log in with credentials passed")
+	assert.Equal("scoped", usernames["repository:foo/bar:pull,push"], "should request repository token with scoped credentials")
+}
@@ -0,0 +1,356 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/auth"
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+func authorization(tk auth.Token) string {
+	if tk == nil {
+		return ""
+	}
+
+	return tk.Method() + " " + tk.String()
+}
+
+func responseError(resp *http.Response, action string) error {
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	return fmt.Errorf("unable to %s: %s >> %s", action, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// ManifestNotFoundError is returned, if there is no manifest for the reference (tag name or digest) in the repository
+type ManifestNotFoundError struct {
+	Location string
+}
+
+// Error implements error interface
+func (e *ManifestNotFoundError) Error() string {
+	return "manifest not found: " + e.Location
+}
+
+// ManifestData gets raw manifest document (as is) together with its media type and digest
+// NB! Reference could be either a tag name, or a digest (e.g. "sha256:...").
+func (cli *RegistryClient) ManifestData(repoPath, reference string) ([]byte, string, string, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	resp, _, err := request.PerformContext(
+		cli.Context(),
+		cli.URL()+repoPath+"/manifests/"+reference,
+		authorization(repoToken),
+		"manifest",
+		cli.Config.TraceRequests,
+		cli.Config.RetryRequests,
+		cli.Config.RetryDelay,
+	)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, "", "", &ManifestNotFoundError{Location: cli.URL() + repoPath + "@" + reference}
+	}
+
+	data, err := cli.readLimited(resp.Body, "manifest", repoPath+"@"+reference)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	mediaType := strings.Split(resp.Header.Get("Content-Type"), ";")[0]
+
+	if manifest.IsSchema1MediaType(mediaType) {
+		cli.warnSchema1(repoPath)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" && manifest.IsSchema1MediaType(mediaType) {
+		digest, err = manifest.Schema1Digest(data)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+	if digest == "" {
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	}
+
+	return data, mediaType, digest, nil
+}
+
+// Referrers gets descriptors of all manifests referring to the manifest with digest specified
+// (signatures, SBOMs, attestations etc.), or nil, if registry does not support referrers API.
+func (cli *RegistryClient) Referrers(repoPath, digest string) ([]manifest.Descriptor, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := request.PerformContext(
+		cli.Context(),
+		cli.URL()+repoPath+"/referrers/"+digest,
+		authorization(repoToken),
+		"manifest",
+		cli.Config.TraceRequests,
+		cli.Config.RetryRequests,
+		cli.Config.RetryDelay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		log.Debugf("referrers API is not supported by registry: %s", cli.registry)
+
+		return nil, nil
+	}
+
+	var index manifest.Content
+	if err := cli.decodeLimited(resp.Body, "referrers index", repoPath+"@"+digest, &index); err != nil {
+		return nil, err
+	}
+
+	return index.Manifests, nil
+}
+
+// ManifestDigest gets digest of the manifest identified by reference passed (tag name or digest) with a HEAD request,
+// i.e. without downloading the manifest itself (same media types are accepted as while listing tags, so digests match)
+func (cli *RegistryClient) ManifestDigest(repoPath, reference string) (string, error) {
+	return cli.manifestDigest(repoPath, reference, []string{manifest.MediaTypeDockerV2, manifest.MediaTypeOCIManifest})
+}
+
+// ResolveDigest gets digest of the manifest identified by reference passed with a HEAD request, accepting all manifest
+// media types we know (See manifest.MediaTypes), i.e. multi-arch tag gives us digest of its manifest list/index,
+// not of the image registry picks for us (as ManifestDigest does)
+func (cli *RegistryClient) ResolveDigest(repoPath, reference string) (string, error) {
+	return cli.manifestDigest(repoPath, reference, manifest.MediaTypes)
+}
+
+func (cli *RegistryClient) manifestDigest(repoPath, reference string, mediaTypes []string) (string, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"HEAD",
+		cli.URL()+repoPath+"/manifests/"+reference,
+		authorization(repoToken),
+		map[string]string{"Accept": strings.Join(mediaTypes, ", ")},
+		nil,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		return "", &ManifestNotFoundError{Location: cli.URL() + repoPath + "@" + reference}
+	default:
+		return "", fmt.Errorf("unable to get manifest digest %s: %s", reference, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("no digest in manifest response: %s%s@%s", cli.URL(), repoPath, reference)
+	}
+
+	return digest, nil
+}
+
+// BlobExists checks if blob with digest specified is already present in the repository
+func (cli *RegistryClient) BlobExists(repoPath, digest string) (bool, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"HEAD",
+		cli.URL()+repoPath+"/blobs/"+digest,
+		authorization(repoToken),
+		nil,
+		nil,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unable to check blob %s: %s", digest, resp.Status)
+	}
+}
+
+// Blob gets blob content stream with digest specified (it's up to caller to close it)
+func (cli *RegistryClient) Blob(repoPath, digest string) (io.ReadCloser, int64, error) {
+	repoToken, err := cli.repoToken(repoPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"GET",
+		cli.URL()+repoPath+"/blobs/"+digest,
+		authorization(repoToken),
+		nil,
+		nil,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, 0, responseError(resp, "get blob "+digest)
+	}
+
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (cli *RegistryClient) uploadURL(location string) (string, error) {
+	base, err := url.Parse(cli.URL())
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// UploadBlob uploads blob content with digest and size specified into the repository
+// NB! Big blobs are uploaded in chunks (and resumed on failure), if registry supports it, or monolithically otherwise.
+func (cli *RegistryClient) UploadBlob(repoPath, digest string, size int64, content io.Reader) error {
+	repoToken, err := cli.repoScopedToken(repoPath, "pull,push")
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"POST",
+		cli.URL()+repoPath+"/blobs/uploads/",
+		authorization(repoToken),
+		map[string]string{"Content-Length": "0"},
+		nil,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 202 {
+		return responseError(resp, "start blob upload")
+	}
+	resp.Body.Close()
+
+	location, err := cli.uploadURL(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+
+	chunkSize, chunked := getChunkSize(resp.Header)
+	if chunked && size > chunkSize {
+		log.Debugf("chunked upload (%d bytes per chunk): %s@%s", chunkSize, repoPath, digest)
+
+		location, err = cli.uploadChunks(repoToken, location, size, chunkSize, content)
+		if err != nil {
+			return err
+		}
+
+		content = nil
+		size = 0
+	}
+
+	resp, err = request.SendContext(
+		cli.Context(),
+		"PUT",
+		withDigest(location, digest),
+		authorization(repoToken),
+		map[string]string{
+			"Content-Type":   "application/octet-stream",
+			"Content-Length": strconv.FormatInt(size, 10),
+		},
+		content,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 201 {
+		return responseError(resp, "upload blob "+digest)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// PutManifest uploads raw manifest document with media type specified into the repository
+// NB! Reference could be either a tag name, or a digest (e.g. "sha256:...").
+// NB! Registry storing manifest under another digest (i.e. not byte for byte) is an error.
+func (cli *RegistryClient) PutManifest(repoPath, reference, mediaType string, data []byte) error {
+	repoToken, err := cli.repoScopedToken(repoPath, "pull,push")
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"PUT",
+		cli.URL()+repoPath+"/manifests/"+reference,
+		authorization(repoToken),
+		map[string]string{
+			"Content-Type":   mediaType,
+			"Content-Length": strconv.Itoa(len(data)),
+		},
+		strings.NewReader(string(data)),
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 201 {
+		return responseError(resp, "put manifest "+reference)
+	}
+	resp.Body.Close()
+
+	if stored := resp.Header.Get("Docker-Content-Digest"); stored != "" && !manifest.IsSchema1MediaType(mediaType) {
+		if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); strings.HasPrefix(stored, "sha256:") && stored != digest {
+			return fmt.Errorf("manifest digest mismatch: put %s, registry stored %s: %s%s:%s", digest, stored, cli.URL(), repoPath, reference)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultMaxManifestBytes is a default limit of manifest (or image config) size we read from registry: 16 MiB,
+// real manifests and configs are kilobytes, so anything bigger is a misconfigured (or malicious) registry
+const DefaultMaxManifestBytes = 16 << 20
+
+// TooLargeError is an error we get, if registry gives us manifest (or image config) bigger than the limit
+// (See Config.MaxManifestBytes), we never read the rest of it, so it could not eat all our memory
+type TooLargeError struct {
+	What     string
+	Location string
+	Limit    int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s is too large (over %d bytes): %s", e.What, e.Limit, e.Location)
+}
+
+func (cli *RegistryClient) maxManifestBytes() int64 {
+	if cli.Config.MaxManifestBytes <= 0 {
+		return DefaultMaxManifestBytes
+	}
+
+	return cli.Config.MaxManifestBytes
+}
+
+// readLimited reads manifest (or image config) data, but no more than the limit configured (See TooLargeError)
+func (cli *RegistryClient) readLimited(r io.Reader, what, location string) ([]byte, error) {
+	limit := cli.maxManifestBytes()
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, &TooLargeError{What: what, Location: location, Limit: limit}
+	}
+
+	return data, nil
+}
+
+// decodeLimited decodes JSON manifest (or image config) read with readLimited
+func (cli *RegistryClient) decodeLimited(r io.Reader, what, location string, v interface{}) error {
+	data, err := cli.readLimited(r, what, location)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+// DeleteManifest deletes manifest of the digest specified from the repository (tags pointing at it are gone too)
+// NB! Gives *ManifestNotFoundError, if manifest is not there (e.g. it is already deleted), so caller could tell it apart.
+func (cli *RegistryClient) DeleteManifest(repoPath, digest string) error {
+	deleteToken, err := cli.repoScopedToken(repoPath, "delete")
+	if err != nil {
+		return err
+	}
+
+	resp, err := request.SendContext(
+		cli.Context(),
+		"DELETE",
+		cli.URL()+repoPath+"/manifests/"+digest,
+		authorization(deleteToken),
+		nil,
+		nil,
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted:
+		resp.Body.Close()
+
+		return nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+
+		return &ManifestNotFoundError{Location: cli.URL() + repoPath + "@" + digest}
+	default:
+		return responseError(resp, "delete manifest "+digest)
+	}
+}
+
+// ReferencedDigests gives us digests of all manifests referenced by repository tags: manifests tagged, images of
+// manifest lists/indexes tagged and, if we check referrers, manifests referring to any of them (e.g. signatures)
+func (cli *RegistryClient) ReferencedDigests(repoPath string, referrers bool) (map[string]bool, error) {
+	tagNames, _, err := cli.TagData(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+
+	var walk func(reference string) error
+	walk = func(reference string) error {
+		data, mediaType, digest, err := cli.ManifestData(repoPath, reference)
+		if err != nil {
+			return err
+		}
+
+		if referenced[digest] {
+			return nil
+		}
+		referenced[digest] = true
+
+		content, err := manifest.ParseContent(mediaType, data)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range content.Manifests {
+			if err := walk(m.Digest); err != nil {
+				return err
+			}
+		}
+
+		if !referrers {
+			return nil
+		}
+
+		descriptors, err := cli.Referrers(repoPath, digest)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range descriptors {
+			if err := walk(d.Digest); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, tagName := range tagNames {
+		if err := walk(tagName); err != nil {
+			return nil, err
+		}
+	}
+
+	return referenced, nil
+}
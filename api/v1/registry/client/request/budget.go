@@ -0,0 +1,71 @@
+package request
+
+import "sync"
+
+// Budget caps total number of retries shared by all the requests of a batch operation (e.g. pull of many images),
+// so registry having an incident is not hammered by retries of many requests failing at once. It works like a token
+// bucket, which is never refilled while the batch operation runs, but is refilled completely by Reset (on the next one).
+// NB! nil *Budget is valid and does not limit anything.
+type Budget struct {
+	max       int
+	left      int
+	exhausted bool
+	mux       sync.Mutex
+}
+
+// NewBudget creates a new retry budget, or gives nil, if there is no limit (0)
+func NewBudget(max int) *Budget {
+	if max <= 0 {
+		return nil
+	}
+
+	return &Budget{max: max, left: max}
+}
+
+// RetryBudget is a budget shared by all the requests we retry (nil means retries are not limited)
+var RetryBudget *Budget
+
+// Take takes a token to retry once more, it tells us if we could retry (if not, budget is exhausted)
+func (b *Budget) Take() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.left == 0 {
+		b.exhausted = true
+
+		return false
+	}
+
+	b.left--
+
+	return true
+}
+
+// Exhausted tells us if we were refused to retry since the last Reset
+func (b *Budget) Exhausted() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.exhausted
+}
+
+// Reset refills budget completely (e.g. on start of the next batch operation)
+func (b *Budget) Reset() {
+	if b == nil {
+		return
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.left = b.max
+	b.exhausted = false
+}
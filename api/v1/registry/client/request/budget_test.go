@@ -0,0 +1,56 @@
+package request
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	var unlimited *Budget
+	assert.True(unlimited.Take(), "nil budget should not limit anything")
+	assert.False(unlimited.Exhausted())
+	assert.Nil(NewBudget(0), "should not limit anything, if budget is zero")
+
+	b := NewBudget(2)
+
+	assert.True(b.Take())
+	assert.True(b.Take())
+	assert.False(b.Exhausted(), "should not be exhausted, until we are refused to retry")
+	assert.False(b.Take())
+	assert.True(b.Exhausted())
+
+	b.Reset()
+
+	assert.False(b.Exhausted())
+	assert.True(b.Take(), "should be refilled on reset")
+}
+
+func TestPerform_RetryBudget(t *testing.T) {
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	RetryBudget = NewBudget(3)
+	defer func() { RetryBudget = nil }()
+
+	assert := assert.New(t)
+
+	for i := 0; i < 3; i++ {
+		_, _, err := Perform(server.URL+"/v2/", "", "json", false, 2, 0)
+
+		assert.NotNil(err)
+	}
+
+	assert.Equal(6, requests, "should retry only 3 times of 6 in total (3 requests x 2 retries)")
+	assert.True(RetryBudget.Exhausted())
+}
@@ -2,14 +2,21 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
+	"github.com/ivanilves/lstags/tag/manifest"
 )
 
 func getRequestID() string {
@@ -29,23 +36,31 @@ func getResponseBody(resp *http.Response) string {
 	return string(b)
 }
 
-func perform(url, auth, mode string, trace bool) (resp *http.Response, err error) {
-	hc := &http.Client{}
+func perform(ctx context.Context, url, auth, mode string, trace bool) (resp *http.Response, err error) {
+	hc := transport.Client()
 	rid := getRequestID()
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", auth)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
 	req.Header.Set("Accept", "application/json")
 
 	switch mode {
+	case "json":
 	case "v1":
 		req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v1+json")
 	case "v2":
-		req.Header.Add("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+		req.Header.Add("Accept", manifest.MediaTypeDockerV2)
+		req.Header.Add("Accept", manifest.MediaTypeOCIManifest)
+	case "manifest":
+		for _, mediaType := range manifest.MediaTypes {
+			req.Header.Add("Accept", mediaType)
+		}
 	default:
 		return nil, errors.New("Unknown request mode: " + mode)
 	}
@@ -56,18 +71,11 @@ func perform(url, auth, mode string, trace bool) (resp *http.Response, err error
 	}
 
 	if trace {
-		fmt.Printf("%s|@URL: %s\n", rid, url)
-		for k, v := range req.Header {
-			fmt.Printf("%s|@REQ-HEADER: %-40s = %s\n", rid, k, v)
-		}
-		for k, v := range resp.Header {
-			fmt.Printf("%s|@RESP-HEADER: %-40s = %s\n", rid, k, v)
-		}
-		fmt.Printf("%s|--- BODY BEGIN ---\n", rid)
-		for _, line := range strings.Split(getResponseBody(resp), "\n") {
-			fmt.Printf("%s|%s\n", rid, line)
-		}
-		fmt.Printf("%s|--- BODY END ---\n", rid)
+		traceRequest(rid, req, resp, true)
+	}
+
+	if err := detectThrottle(resp, url); err != nil {
+		return resp, err
 	}
 
 	if resp.StatusCode != 200 && resp.StatusCode != 404 {
@@ -77,8 +85,83 @@ func perform(url, auth, mode string, trace bool) (resp *http.Response, err error
 	return resp, nil
 }
 
+func traceRequest(rid string, req *http.Request, resp *http.Response, withBody bool) {
+	fmt.Printf("%s|@URL: %s %s\n", rid, req.Method, req.URL)
+	for k, vv := range req.Header {
+		redacted := make([]string, len(vv))
+		for i, v := range vv {
+			redacted[i] = transport.RedactHeader(k, v)
+		}
+
+		fmt.Printf("%s|@REQ-HEADER: %-40s = %s\n", rid, k, redacted)
+	}
+	for k, v := range resp.Header {
+		fmt.Printf("%s|@RESP-HEADER: %-40s = %s\n", rid, k, v)
+	}
+
+	if !withBody {
+		return
+	}
+
+	fmt.Printf("%s|--- BODY BEGIN ---\n", rid)
+	for _, line := range strings.Split(getResponseBody(resp), "\n") {
+		fmt.Printf("%s|%s\n", rid, line)
+	}
+	fmt.Printf("%s|--- BODY END ---\n", rid)
+}
+
+// Send performs HTTP(S) request with the method, headers and body specified (e.g. to upload data to the registry)
+// NB! It does neither retry, nor check response status, as it is up to caller to decide what to do with it.
+func Send(method, url, auth string, headers map[string]string, body io.Reader, trace bool) (*http.Response, error) {
+	return SendContext(context.Background(), method, url, auth, headers, body, trace)
+}
+
+// SendContext does the same as Send, but request is aborted as soon as context passed is done
+func SendContext(ctx context.Context, method, url, auth string, headers map[string]string, body io.Reader, trace bool) (*http.Response, error) {
+	hc := transport.Client()
+	rid := getRequestID()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if length, defined := headers["Content-Length"]; defined {
+		req.ContentLength, _ = strconv.ParseInt(length, 10, 64)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if trace {
+		traceRequest(rid, req, resp, false)
+	}
+
+	return resp, nil
+}
+
 // Perform performs the required HTTP(S) request, retrying if applicable
 func Perform(url, auth, mode string, trace bool, retries int, delay time.Duration) (resp *http.Response, nextlink string, err error) {
+	return PerformContext(context.Background(), url, auth, mode, trace, retries, delay)
+}
+
+// PerformContext does the same as Perform, but request is aborted (and never retried) as soon as context passed is done
+func PerformContext(
+	ctx context.Context,
+	url, auth, mode string,
+	trace bool,
+	retries int,
+	delay time.Duration,
+) (resp *http.Response, nextlink string, err error) {
 	tries := 1
 
 	if retries > 0 {
@@ -86,20 +169,32 @@ func Perform(url, auth, mode string, trace bool, retries int, delay time.Duratio
 	}
 
 	for try := 1; try <= tries; try++ {
-		resp, err := perform(url, auth, mode, trace)
+		resp, err = perform(ctx, url, auth, mode, trace)
 
 		if err == nil {
 			return resp, getNextLink(resp.Header["Link"]), nil
 		}
 
-		if resp != nil {
+		if ctx.Err() != nil {
+			return nil, "", err
+		}
+
+		// registries throttling us in a non-standard way (See ThrottledError) are retried just like on 429
+		if _, throttled := err.(*ThrottledError); resp != nil && !throttled {
 			if resp.StatusCode != 429 && resp.StatusCode >= 400 && resp.StatusCode < 500 {
 				return nil, "", err
 			}
 		}
 
+		if try < tries && !RetryBudget.Take() {
+			fmt.Fprintf(os.Stderr, "Will NOT retry '%s' [%s] (retry budget exhausted)\n=> Error: %s\n", url, mode, err.Error())
+
+			return nil, "", err
+		}
+
 		if try < tries {
-			fmt.Printf(
+			fmt.Fprintf(
+				os.Stderr,
 				"Will retry '%s' [%s] in a %v\n=> Error: %s\n",
 				url,
 				mode,
@@ -107,13 +202,17 @@ func Perform(url, auth, mode string, trace bool, retries int, delay time.Duratio
 				err.Error(),
 			)
 
-			time.Sleep(delay)
+			select {
+			case <-ctx.Done():
+				return nil, "", ctx.Err()
+			case <-time.After(delay):
+			}
 
 			delay += delay
 		}
 	}
 
-	return resp, getNextLink(resp.Header["Link"]), err
+	return nil, "", err
 }
 
 func getNextLink(headers []string) string {
@@ -125,6 +224,7 @@ func getNextLink(headers []string) string {
 
 	nextlink = strings.Split(nextlink, "?")[1]
 	nextlink = strings.Split(nextlink, ";")[0]
+	nextlink = strings.TrimSuffix(nextlink, ">")
 
 	return nextlink
 }
@@ -0,0 +1,122 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxThrottleBody is the biggest response body we look into for throttle signals, bigger ones are never throttle signals
+const maxThrottleBody = 4096
+
+// throttleCodes are (non-standard) error codes registries signal throttling with in response body, instead of status 429
+var throttleCodes = map[string]bool{
+	"TOOMANYREQUESTS":   true,
+	"TOO_MANY_REQUESTS": true,
+}
+
+// throttleMessages are phrases (lowercase) registries describe throttling with in response body, whatever error code is
+var throttleMessages = []string{"too many requests", "rate limit", "rate exceeded", "quota exceeded"}
+
+// ThrottledError is returned, if registry throttles us in a non-standard way (with status 200 or 403 and error body
+// instead of 429), so request is retried the same way it is retried on 429 status
+type ThrottledError struct {
+	Status string
+	URL    string
+	Reason string
+}
+
+// Error implements error interface
+func (e *ThrottledError) Error() string {
+	return "Throttled by registry: " + e.Status + " >> " + e.URL + " (" + e.Reason + ")"
+}
+
+// throttleBody is a (relevant part of) error response body in all the forms registries give it to us
+type throttleBody struct {
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// isThrottleMessage tells us if message describes throttling
+func isThrottleMessage(message string) bool {
+	message = strings.ToLower(message)
+
+	for _, phrase := range throttleMessages {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// throttleReason gives us the reason registry throttles us for, if response body signals throttling (or "" otherwise)
+// NB! Successful (200) response signals throttling only by a JSON error body, forbidden (403) one could do it by plain text.
+func throttleReason(statusCode int, body []byte) string {
+	var tb throttleBody
+	if err := json.Unmarshal(body, &tb); err != nil {
+		if statusCode == 403 && isThrottleMessage(string(body)) {
+			return strings.TrimSpace(string(body))
+		}
+
+		return ""
+	}
+
+	for _, e := range tb.Errors {
+		if throttleCodes[strings.ToUpper(e.Code)] || isThrottleMessage(e.Message) {
+			return e.Code + ": " + e.Message
+		}
+	}
+
+	for _, message := range []string{tb.Error, tb.Message} {
+		if throttleCodes[strings.ToUpper(message)] || isThrottleMessage(message) {
+			return message
+		}
+	}
+
+	return ""
+}
+
+// detectThrottle looks into (small) body of the 200 or 403 response for non-standard throttle signals
+// and gives us *ThrottledError, if registry throttles us. Response body is kept intact to be read by the caller.
+func detectThrottle(resp *http.Response, url string) error {
+	if resp.StatusCode != 200 && resp.StatusCode != 403 {
+		return nil
+	}
+
+	if resp.ContentLength > maxThrottleBody {
+		return nil
+	}
+
+	head, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxThrottleBody+1))
+	if err != nil {
+		resp.Body = ioutil.NopCloser(bytes.NewReader(head))
+
+		return err
+	}
+
+	if len(head) > maxThrottleBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+		return nil
+	}
+
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(head))
+
+	if reason := throttleReason(resp.StatusCode, head); reason != "" {
+		return &ThrottledError{Status: resp.Status, URL: url, Reason: reason}
+	}
+
+	return nil
+}
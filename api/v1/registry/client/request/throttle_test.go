@@ -0,0 +1,114 @@
+package request
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleReason(t *testing.T) {
+	testCases := map[string]map[int]bool{
+		"errors.json.toomanyrequests":   {200: true, 403: true},
+		"errors.json.too_many_requests": {200: true, 403: true},
+		"errors.json.quota":             {200: true, 403: true},
+		"error.json.toomanyrequests":    {200: true, 403: true},
+		"message.json.rateexceeded":     {200: true, 403: true},
+		"text.ratelimit":                {200: false, 403: true},
+		"errors.json.denied":            {200: false, 403: false},
+		"errors.json.unauthorized":      {200: false, 403: false},
+	}
+
+	assert := assert.New(t)
+
+	for fixture, expected := range testCases {
+		body, err := ioutil.ReadFile("../../../../../fixtures/throttle/" + fixture)
+		if err != nil {
+			t.Fatalf("unable to read fixture %s: %s", fixture, err.Error())
+		}
+
+		for statusCode, throttled := range expected {
+			assert.Equal(throttled, throttleReason(statusCode, body) != "", "fixture: %s, status: %d", fixture, statusCode)
+		}
+	}
+
+	assert.Equal(
+		"TOOMANYREQUESTS: Too many",
+		throttleReason(200, []byte(`{"errors":[{"code":"TOOMANYREQUESTS","message":"Too many"}]}`)),
+	)
+}
+
+func TestPerform_Throttled(t *testing.T) {
+	const throttle = `{"errors":[{"code":"TOOMANYREQUESTS","message":"You have reached your pull rate limit"}]}`
+
+	var requests int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		switch r.URL.Path {
+		case "/forbidden":
+			if requests == 1 {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(throttle))
+				return
+			}
+		case "/ok":
+			if requests == 1 {
+				w.Write([]byte(throttle))
+				return
+			}
+		case "/denied":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`))
+			return
+		case "/large":
+			w.Write([]byte(`{"name":"foo","tags":["` + strings.Repeat("x", 2*maxThrottleBody) + `"]}`))
+			return
+		}
+
+		w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	for _, path := range []string{"/forbidden", "/ok"} {
+		requests = 0
+
+		resp, _, err := Perform(server.URL+path, "", "json", false, 2, 0)
+
+		assert.Nil(err, "should retry request throttled: %s", path)
+		assert.Equal(2, requests, path)
+
+		if err == nil {
+			body, _ := ioutil.ReadAll(resp.Body)
+			assert.Equal(`{"name":"foo","tags":["latest"]}`, string(body))
+		}
+	}
+
+	requests = 0
+
+	_, _, err := Perform(server.URL+"/denied", "", "json", false, 2, 0)
+
+	assert.NotNil(err)
+	assert.Equal(1, requests, "should not retry request denied")
+
+	resp, _, err := Perform(server.URL+"/large", "", "json", false, 2, 0)
+
+	assert.Nil(err)
+
+	if err == nil {
+		body, _ := ioutil.ReadAll(resp.Body)
+		assert.Equal(2*maxThrottleBody+len(`{"name":"foo","tags":[""]}`), len(body), "should keep large body intact")
+	}
+
+	requests = 0
+
+	_, _, err = Perform(server.URL+"/ok", "", "json", false, 0, 0)
+
+	assert.IsType(&ThrottledError{}, err)
+}
@@ -0,0 +1,436 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// Host is a registry endpoint with transport options, as configured for containerd (or Docker daemon) on the host
+type Host struct {
+	// Registry is a registry hostname (ADDR[:PORT]) options are applied to
+	Registry string
+	// Insecure tells us if registry is served over plain HTTP
+	Insecure bool
+	// Options are transport options of the registry
+	Options Options
+}
+
+// LoadHostsDir loads registry transport options from the directory laid out as containerd "certs.d" one
+// (e.g. "/etc/containerd/certs.d" or "/etc/docker/certs.d"): every subdirectory is named after the registry and has
+// either "hosts.toml" (server, mirror hosts, ca, client, skip_verify and header settings are used) or Docker-style certificates:
+// "*.crt" CA bundles, "*.cert" client certificates and "*.key" keys. Gives us all the hosts loaded.
+// Options loaded are merged into ones already set for the host (e.g. with LoadPins or LoadHeaders), already set ones win.
+// NB! Mirror hosts only get their transport options: we do no endpoint selection, i.e. requests are never sent to mirrors.
+func (st *Store) LoadHostsDir(dir string) ([]Host, error) {
+	dir = fix.Path(dir)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]Host, 0)
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "_default" {
+			continue
+		}
+
+		hostDir := filepath.Join(dir, entry.Name())
+
+		data, err := ioutil.ReadFile(filepath.Join(hostDir, "hosts.toml"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		var dirHosts []Host
+		if err == nil {
+			dirHosts, err = ParseHostsTOML(entry.Name(), hostDir, data)
+		} else {
+			dirHosts, err = loadCertsDir(entry.Name(), hostDir)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, host := range dirHosts {
+			o, _ := st.Get(host.Registry)
+
+			if err := st.Set(host.Registry, mergeOptions(o, host.Options)); err != nil {
+				return nil, err
+			}
+		}
+
+		hosts = append(hosts, dirHosts...)
+	}
+
+	return hosts, nil
+}
+
+// mergeOptions merges options loaded into the ones already set: CA certificates are trusted all together,
+// headers are added, but client certificate, headers and pins already set are never replaced or dropped
+func mergeOptions(current, loaded Options) Options {
+	o := current
+
+	if len(loaded.CACert) != 0 {
+		o.CACert = append(append([]byte{}, current.CACert...), loaded.CACert...)
+	}
+	o.InsecureSkipVerify = current.InsecureSkipVerify || loaded.InsecureSkipVerify
+
+	if current.ClientCertFile == "" && current.ClientKeyFile == "" {
+		o.ClientCertFile = loaded.ClientCertFile
+		o.ClientKeyFile = loaded.ClientKeyFile
+	}
+
+	if len(loaded.Headers) != 0 {
+		o.Headers = make(map[string]string, len(current.Headers)+len(loaded.Headers))
+		for name, value := range current.Headers {
+			o.Headers[name] = value
+		}
+		for name, value := range loaded.Headers {
+			if !hasHeader(current.Headers, name) {
+				o.Headers[name] = value
+			}
+		}
+	}
+
+	return o
+}
+
+// hasHeader tells us if header is among the ones passed (header names are case-insensitive)
+func hasHeader(headers map[string]string, name string) bool {
+	for n := range headers {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// loadCertsDir loads Docker-style certificates directory: "*.crt" are CA bundles, "*.cert" are client certificates
+// with keys in "*.key" files having the same name (see https://docs.docker.com/engine/security/certificates/)
+func loadCertsDir(registry, dir string) ([]Host, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var o Options
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+
+		switch filepath.Ext(entry.Name()) {
+		case ".crt":
+			ca, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			o.CACert = append(o.CACert, ca...)
+		case ".cert":
+			keyFile := strings.TrimSuffix(path, ".cert") + ".key"
+			if _, err := os.Stat(keyFile); err != nil {
+				return nil, fmt.Errorf("no key for client certificate %s: %s", path, err.Error())
+			}
+
+			o.ClientCertFile = path
+			o.ClientKeyFile = keyFile
+		}
+	}
+
+	if len(o.CACert) == 0 && o.ClientCertFile == "" {
+		return []Host{}, nil
+	}
+
+	return []Host{{Registry: registry, Options: o}}, nil
+}
+
+// ParseHostsTOML parses containerd "hosts.toml" of the registry passed (relative paths are resolved against dir passed)
+// NB! Only a subset of TOML used by "hosts.toml" is supported: tables, strings, booleans and (nested) arrays of strings.
+func ParseHostsTOML(registry, dir string, data []byte) ([]Host, error) {
+	tables, order, err := parseTOML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hosts.toml of '%s': %s", registry, err.Error())
+	}
+
+	server, _ := tables[""]["server"].(string)
+	if server == "" {
+		server = "https://" + registry
+	}
+
+	hosts := make([]Host, 0)
+
+	addHost := func(endpoint string, values, headers map[string]interface{}) error {
+		host, err := makeHost(endpoint, dir, values, headers)
+		if err != nil {
+			return fmt.Errorf("invalid hosts.toml of '%s': %s", registry, err.Error())
+		}
+
+		hosts = append(hosts, host)
+
+		return nil
+	}
+
+	for _, name := range order {
+		if !strings.HasPrefix(name, "host.") {
+			continue
+		}
+
+		endpoint, err := strconv.Unquote(strings.TrimPrefix(name, "host."))
+		if err != nil {
+			continue
+		}
+
+		if err := addHost(endpoint, tables[name], tables[name+".header"]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addHost(server, tables[""], tables["header"]); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+func makeHost(endpoint, dir string, values, headers map[string]interface{}) (Host, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return Host{}, err
+	}
+	if u.Host == "" {
+		return Host{}, fmt.Errorf("no host in endpoint: %s", endpoint)
+	}
+
+	host := Host{Registry: u.Host, Insecure: u.Scheme == "http"}
+
+	resolve := func(path string) string {
+		if filepath.IsAbs(path) || strings.HasPrefix(path, "~") {
+			return path
+		}
+
+		return filepath.Join(dir, path)
+	}
+
+	if skipVerify, defined := values["skip_verify"]; defined {
+		b, ok := skipVerify.(bool)
+		if !ok {
+			return Host{}, fmt.Errorf("'skip_verify' should be a boolean: %s", endpoint)
+		}
+
+		host.Options.InsecureSkipVerify = b
+	}
+
+	if ca, defined := values["ca"]; defined {
+		caFiles, ok := stringList(ca)
+		if !ok {
+			return Host{}, fmt.Errorf("'ca' should be a string or an array of strings: %s", endpoint)
+		}
+
+		for _, caFile := range caFiles {
+			pem, err := ioutil.ReadFile(fix.Path(resolve(caFile)))
+			if err != nil {
+				return Host{}, err
+			}
+
+			host.Options.CACert = append(host.Options.CACert, pem...)
+		}
+	}
+
+	if client, defined := values["client"]; defined {
+		files, ok := stringList(client)
+		if !ok {
+			if pairs, isList := client.([]interface{}); isList && len(pairs) != 0 {
+				files, ok = stringList(pairs[0])
+			}
+		}
+
+		switch {
+		case ok && len(files) == 1:
+			host.Options.ClientCertFile = resolve(files[0])
+			host.Options.ClientKeyFile = resolve(files[0])
+		case ok && len(files) == 2:
+			host.Options.ClientCertFile = resolve(files[0])
+			host.Options.ClientKeyFile = resolve(files[1])
+		default:
+			return Host{}, fmt.Errorf("'client' should be a certificate file or a [certificate, key] pair: %s", endpoint)
+		}
+	}
+
+	for name, value := range headers {
+		values, ok := stringList(value)
+		if !ok {
+			return Host{}, fmt.Errorf("header '%s' should be a string or an array of strings: %s", name, endpoint)
+		}
+
+		if host.Options.Headers == nil {
+			host.Options.Headers = make(map[string]string)
+		}
+		host.Options.Headers[name] = strings.Join(values, ", ")
+	}
+
+	return host, nil
+}
+
+func stringList(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case []interface{}:
+		ss := make([]string, len(v))
+		for i, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, false
+			}
+
+			ss[i] = s
+		}
+
+		return ss, true
+	}
+
+	return nil, false
+}
+
+// parseTOML parses TOML subset into tables of values ("" is a root table), giving us names of tables in order they go
+func parseTOML(data []byte) (map[string]map[string]interface{}, []string, error) {
+	tables := map[string]map[string]interface{}{"": make(map[string]interface{})}
+	order := make([]string, 0)
+	table := ""
+
+	lines := strings.Split(string(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") && !strings.Contains(line, "=") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			if _, defined := tables[table]; !defined {
+				tables[table] = make(map[string]interface{})
+				order = append(order, table)
+			}
+
+			continue
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, nil, fmt.Errorf("line %d: expected KEY = VALUE: %s", i+1, line)
+		}
+
+		key, value := strings.Trim(strings.TrimSpace(kv[0]), `"`), strings.TrimSpace(kv[1])
+
+		// arrays could span multiple lines
+		for strings.Count(value, "[") > strings.Count(value, "]") && i+1 < len(lines) {
+			i++
+			value += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+
+		v, rest, err := parseValue(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s", i+1, err.Error())
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, nil, fmt.Errorf("line %d: unexpected trailing data: %s", i+1, rest)
+		}
+
+		tables[table][key] = v
+	}
+
+	return tables, order, nil
+}
+
+// stripComment strips "#" comment from the line, unless "#" is inside a string
+func stripComment(line string) string {
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // escaped character could not close the string
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+// parseValue parses value at the beginning of the string passed, giving us the rest of the string
+func parseValue(s string) (interface{}, string, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				v, err := strconv.Unquote(s[:i+1])
+
+				return v, s[i+1:], err
+			}
+		}
+
+		return nil, "", fmt.Errorf("unterminated string: %s", s)
+	case strings.HasPrefix(s, "'"):
+		end := strings.Index(s[1:], "'")
+		if end < 0 {
+			return nil, "", fmt.Errorf("unterminated string: %s", s)
+		}
+
+		return s[1 : end+1], s[end+2:], nil
+	case strings.HasPrefix(s, "["):
+		list := make([]interface{}, 0)
+
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "]") {
+			v, rest, err := parseValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, v)
+
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", fmt.Errorf("expected ',' or ']' in array: %s", s)
+			}
+		}
+
+		return list, s[1:], nil
+	case strings.HasPrefix(s, "true"):
+		return true, s[4:], nil
+	case strings.HasPrefix(s, "false"):
+		return false, s[5:], nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported value: %s", s)
+}
@@ -0,0 +1,157 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const hostsTOML = `# mirror of docker.io, see https://github.com/containerd/containerd/blob/main/docs/hosts.md
+server = "https://registry-1.docker.io"
+
+[host."https://mirror.company.io:5000"]
+  capabilities = ["pull", "resolve"]
+  ca = "ca.pem" # relative to hosts.toml
+  client = [["/etc/certs/client.cert", "/etc/certs/client.key"]]
+
+[host."http://192.168.0.10:5000"]
+  capabilities = [
+    "pull",
+    "resolve",
+  ]
+  skip_verify = true
+
+  [host."http://192.168.0.10:5000".header]
+    x-custom = ["#not-a-comment"]
+`
+
+func TestParseHostsTOML(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "certs.d")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "ca.pem"), []byte("CA"), 0644)
+
+	assert := assert.New(t)
+
+	hosts, err := ParseHostsTOML("docker.io", dir, []byte(hostsTOML))
+
+	assert.Nil(err, "should parse hosts.toml")
+	assert.Equal(
+		[]Host{
+			{
+				Registry: "mirror.company.io:5000",
+				Options: Options{
+					CACert:         []byte("CA"),
+					ClientCertFile: "/etc/certs/client.cert",
+					ClientKeyFile:  "/etc/certs/client.key",
+				},
+			},
+			{
+				Registry: "192.168.0.10:5000",
+				Insecure: true,
+				Options:  Options{InsecureSkipVerify: true, Headers: map[string]string{"x-custom": "#not-a-comment"}},
+			},
+			{Registry: "registry-1.docker.io"},
+		},
+		hosts,
+	)
+
+	hosts, err = ParseHostsTOML("registry.company.io", dir, []byte(`skip_verify = true`))
+
+	assert.Nil(err)
+	assert.Equal([]Host{{Registry: "registry.company.io", Options: Options{InsecureSkipVerify: true}}}, hosts, "should default server to registry itself")
+
+	for _, invalid := range []string{
+		`server = "https://registry.company.io`,
+		`skip_verify = "yes"`,
+		`ca = "nonexistent.pem"`,
+		`client = ["a", "b", "c"]`,
+		`server`,
+	} {
+		_, err := ParseHostsTOML("registry.company.io", dir, []byte(invalid))
+
+		assert.NotNil(err, "should fail on invalid hosts.toml: %s", invalid)
+	}
+}
+
+func TestLoadHostsDir(t *testing.T) {
+	server, registry, caCert := runTLSServer()
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "certs.d")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, registry), 0755)
+	ioutil.WriteFile(filepath.Join(dir, registry, "ca.crt"), caCert, 0644)
+
+	os.MkdirAll(filepath.Join(dir, "registry.company.io"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "registry.company.io", "hosts.toml"), []byte(`server = "http://registry.company.io:5000"`), 0644)
+
+	assert := assert.New(t)
+
+	var st Store
+
+	hosts, err := st.LoadHostsDir(dir)
+
+	assert.Nil(err, "should load hosts directory")
+	assert.Equal(2, len(hosts))
+
+	_, err = (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.Nil(err, "should trust CA loaded from Docker-style certificates directory")
+
+	o, defined := st.Get("registry.company.io:5000")
+
+	assert.True(defined, "should set options for the hosts.toml server")
+	assert.Equal(Options{}, o)
+
+	_, err = st.LoadHostsDir(filepath.Join(dir, "nonexistent"))
+
+	assert.NotNil(err, "should fail on nonexistent directory")
+}
+
+func TestLoadHostsDir_Merge(t *testing.T) {
+	server, registry, caCert := runTLSServer()
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "certs.d")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, registry), 0755)
+	ioutil.WriteFile(filepath.Join(dir, registry, "ca.crt"), caCert, 0644)
+
+	os.MkdirAll(filepath.Join(dir, "registry.company.io"), 0755)
+	ioutil.WriteFile(
+		filepath.Join(dir, "registry.company.io", "hosts.toml"),
+		[]byte("[header]\n  x-api-key = \"from-hosts\"\n  x-route = \"eu\"\n"),
+		0644,
+	)
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.LoadPins([]string{registry + " " + strings.Repeat("ab", 32)}))
+	assert.Nil(st.LoadHeaders([]string{"registry.company.io X-Api-Key: from-flag"}))
+
+	_, err := st.LoadHostsDir(dir)
+	assert.Nil(err)
+
+	o, _ := st.Get(registry)
+
+	assert.Equal([]string{strings.Repeat("ab", 32)}, o.PinnedFingerprints, "should keep pins set before")
+	assert.Equal(caCert, o.CACert, "should add CA of the hosts directory")
+
+	_, err = (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.NotNil(err, "should still reject certificate not matching the pin")
+
+	o, _ = st.Get("registry.company.io")
+
+	assert.Equal(map[string]string{"X-Api-Key": "from-flag", "x-route": "eu"}, o.Headers, "should add headers, but keep ones set before")
+}
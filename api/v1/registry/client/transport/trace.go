@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogRequests sets if we log method, URL, status and selected headers of every request (incl. authentication ones)
+// NB! Requests are logged at the debug level, so debug logging should be enabled to see them.
+var LogRequests = false
+
+// loggedHeaders are the headers we log for requests and responses, the ones helping to diagnose registry quirks
+var loggedHeaders = []string{
+	"Authorization",
+	"Accept",
+	"Content-Type",
+	"Content-Length",
+	"Content-Range",
+	"Range",
+	"Location",
+	"Link",
+	"Docker-Content-Digest",
+	"Docker-Distribution-Api-Version",
+	"Www-Authenticate",
+	"Retry-After",
+	"Ratelimit-Limit",
+	"Ratelimit-Remaining",
+}
+
+// RedactHeader gives header value safe to be logged, i.e. with credentials and tokens hidden
+func RedactHeader(name, value string) string {
+	if !strings.EqualFold(name, "Authorization") && !strings.EqualFold(name, "Proxy-Authorization") {
+		return value
+	}
+
+	if value == "" {
+		return value
+	}
+
+	if fields := strings.SplitN(value, " ", 2); len(fields) == 2 {
+		return fields[0] + " <redacted>"
+	}
+
+	return "<redacted>"
+}
+
+func formatHeaders(h http.Header) string {
+	ss := make([]string, 0)
+
+	for _, name := range loggedHeaders {
+		for _, value := range h[http.CanonicalHeaderKey(name)] {
+			ss = append(ss, name+"="+RedactHeader(name, value))
+		}
+	}
+
+	return "[" + strings.Join(ss, " | ") + "]"
+}
+
+func logRequest(req *http.Request, resp *http.Response, err error, took time.Duration) {
+	if err != nil {
+		log.Debugf("HTTP %s %s %s => ERROR: %s (%v)", req.Method, req.URL, formatHeaders(req.Header), err.Error(), took.Round(time.Millisecond))
+		return
+	}
+
+	log.Debugf(
+		"HTTP %s %s %s => %s %s (%v)",
+		req.Method, req.URL, formatHeaders(req.Header), resp.Status, formatHeaders(resp.Header), took.Round(time.Millisecond),
+	)
+}
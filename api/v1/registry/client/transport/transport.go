@@ -0,0 +1,504 @@
+// Package transport provides HTTP transport for Docker registry requests,
+// applying per-registry TLS settings (e.g. custom CA bundles or client certificates) where configured.
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// Registries stores per-registry transport options used by all registry requests
+var Registries Store
+
+// Options holds per-registry transport options
+type Options struct {
+	// CAFile is a path to PEM bundle with CA certificates we trust for the registry
+	CAFile string
+	// CACert is a PEM bundle with CA certificates we trust for the registry (added to CAFile ones)
+	CACert []byte
+	// ClientCertFile is a path to PEM client certificate we present to the registry (mutual TLS)
+	ClientCertFile string
+	// ClientKeyFile is a path to PEM private key matching ClientCertFile
+	ClientKeyFile string
+	// InsecureSkipVerify makes us skip verification of the registry certificate (dangerous!)
+	InsecureSkipVerify bool
+	// Headers are extra headers we send with every request to the registry, e.g. API keys of the gateway fronting it
+	// NB! Authorization header is managed by us, so it could not be set here.
+	Headers map[string]string
+	// PinnedFingerprints are SHA-256 fingerprints of the registry certificate we accept, if set (any other one is rejected)
+	PinnedFingerprints []string
+}
+
+// PinMismatchError is returned, if registry presents certificate not matching any fingerprint pinned
+type PinMismatchError struct {
+	Fingerprint string
+	Pinned      []string
+}
+
+// Error implements error interface
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf(
+		"registry certificate fingerprint %s does not match any pinned one: %s",
+		e.Fingerprint, strings.Join(e.Pinned, ", "),
+	)
+}
+
+// NormalizeFingerprint brings SHA-256 fingerprint to the lowercase hex form without separators
+// (e.g. "AB:CD:..." or "sha256:abcd..." become "abcd..."), failing if it is not a valid one
+func NormalizeFingerprint(fingerprint string) (string, error) {
+	fp := strings.ToLower(strings.TrimSpace(fingerprint))
+	fp = strings.TrimPrefix(fp, "sha256:")
+	fp = strings.Replace(fp, ":", "", -1)
+
+	if len(fp) != sha256.Size*2 || strings.Trim(fp, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint: %s", fingerprint)
+	}
+
+	return fp, nil
+}
+
+// Timeouts limit phases of registry requests separately: slow connection or TLS handshake fails fast,
+// but (legitimately long) download or upload of a big blob over high-latency link is never cut
+// NB! 0 means no limit only for timeouts set here (See Store.SetTimeouts): v1.Config and CLI flags
+// give us a default timeout instead of 0 (See DefaultTimeouts), i.e. timeouts could not be disabled there.
+type Timeouts struct {
+	// Dial limits time we wait for TCP connection to registry to be established
+	Dial time.Duration
+	// TLSHandshake limits time we wait for TLS handshake with registry to complete
+	TLSHandshake time.Duration
+	// ResponseHeader limits time we wait for registry response headers, once request (incl. its body) is sent
+	// NB! Response body (e.g. blob being downloaded) is read with no time limit.
+	ResponseHeader time.Duration
+}
+
+// DefaultTimeouts are timeouts used by the store, unless others are set (See Store.SetTimeouts)
+var DefaultTimeouts = Timeouts{Dial: 30 * time.Second, TLSHandshake: 10 * time.Second, ResponseHeader: 2 * time.Minute}
+
+// Store stores per-registry transport options and transports built from them
+type Store struct {
+	options    map[string]Options
+	transports map[string]*http.Transport
+	fallback   *http.Transport
+	timeouts   *Timeouts
+	hostLimit  int
+	hostSlots  map[string]chan struct{}
+	mux        sync.Mutex
+}
+
+// SetTimeouts sets timeouts of requests to all registries, ones configured before and after the call
+func (st *Store) SetTimeouts(t Timeouts) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	st.timeouts = &t
+	st.fallback = nil
+
+	for registry, tr := range st.transports {
+		st.transports[registry] = newTransport(tr.TLSClientConfig, t)
+	}
+}
+
+// getTimeouts gives us timeouts set or the default ones (NB! Store should be locked by the caller)
+func (st *Store) getTimeouts() Timeouts {
+	if st.timeouts == nil {
+		return DefaultTimeouts
+	}
+
+	return *st.timeouts
+}
+
+// SetHostLimit limits number of requests in flight (sent, but not responded yet) to every registry host (0 means no limit).
+// Limit is shared by all requests made through the store, i.e. by all repositories we process at once.
+func (st *Store) SetHostLimit(n int) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	st.hostLimit = n
+	st.hostSlots = nil
+}
+
+// hostSlot gives us semaphore of the registry host passed, or nil, if there is no limit (See SetHostLimit)
+func (st *Store) hostSlot(host string) chan struct{} {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	if st.hostLimit <= 0 {
+		return nil
+	}
+
+	if st.hostSlots == nil {
+		st.hostSlots = make(map[string]chan struct{})
+	}
+
+	slot, defined := st.hostSlots[host]
+	if !defined {
+		slot = make(chan struct{}, st.hostLimit)
+		st.hostSlots[host] = slot
+	}
+
+	return slot
+}
+
+// Set validates and sets transport options for a registry hostname passed
+func (st *Store) Set(registry string, o Options) error {
+	for name := range o.Headers {
+		if strings.EqualFold(name, "Authorization") {
+			return fmt.Errorf("invalid transport options for registry '%s': Authorization header could not be set", registry)
+		}
+	}
+
+	tlsConfig, err := buildTLSConfig(o)
+	if err != nil {
+		return fmt.Errorf("invalid transport options for registry '%s': %s", registry, err.Error())
+	}
+
+	if len(o.PinnedFingerprints) != 0 {
+		pins := make(map[string]bool, len(o.PinnedFingerprints))
+		for _, fingerprint := range o.PinnedFingerprints {
+			fp, err := NormalizeFingerprint(fingerprint)
+			if err != nil {
+				return fmt.Errorf("invalid transport options for registry '%s': %s", registry, err.Error())
+			}
+
+			pins[fp] = true
+		}
+
+		tlsConfig.VerifyPeerCertificate = verifyPins(pins, o.PinnedFingerprints)
+	}
+
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	if st.options == nil {
+		st.options = make(map[string]Options)
+		st.transports = make(map[string]*http.Transport)
+	}
+
+	st.options[registry] = o
+	st.transports[registry] = newTransport(tlsConfig, st.getTimeouts())
+
+	return nil
+}
+
+// Get gets transport options for a registry hostname passed
+func (st *Store) Get(registry string) (Options, bool) {
+	st.mux.Lock()
+	defer st.mux.Unlock()
+
+	o, defined := st.options[registry]
+
+	return o, defined
+}
+
+// SkipsVerify tells us if we skip verification of the registry certificate: for the registry passed or for all of them
+func (st *Store) SkipsVerify(registry string) bool {
+	if o, defined := st.Get(registry); defined && o.InsecureSkipVerify {
+		return true
+	}
+
+	dt, ok := http.DefaultTransport.(*http.Transport)
+
+	return ok && dt.TLSClientConfig != nil && dt.TLSClientConfig.InsecureSkipVerify
+}
+
+// LoadCAFiles parses and loads a list of "REGISTRY[:PORT] /path/to/ca.pem" strings
+func (st *Store) LoadCAFiles(aa []string) error {
+	for _, a := range aa {
+		registry, caFile, err := splitRegistryValue(strings.TrimSpace(a), "REGISTRY[:PORT] /path/to/ca.pem")
+		if err != nil {
+			return err
+		}
+
+		o, _ := st.Get(registry)
+		o.CAFile = caFile
+
+		if err := st.Set(registry, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadClientCerts parses and loads a list of "REGISTRY[:PORT] /path/to/cert.pem /path/to/key.pem" strings
+func (st *Store) LoadClientCerts(aa []string) error {
+	const format = "REGISTRY[:PORT] /path/to/cert.pem /path/to/key.pem"
+
+	for _, a := range aa {
+		registry, files, err := splitRegistryValue(strings.TrimSpace(a), format)
+		if err != nil {
+			return err
+		}
+
+		ff := strings.Fields(files)
+		if len(ff) != 2 {
+			return fmt.Errorf("invalid format: '%s' (should be: %s)", a, format)
+		}
+
+		o, _ := st.Get(registry)
+		o.ClientCertFile = ff[0]
+		o.ClientKeyFile = ff[1]
+
+		if err := st.Set(registry, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadPins parses and loads a list of "REGISTRY[:PORT] SHA256_FINGERPRINT" strings
+func (st *Store) LoadPins(aa []string) error {
+	for _, a := range aa {
+		registry, fingerprint, err := splitRegistryValue(strings.TrimSpace(a), "REGISTRY[:PORT] SHA256_FINGERPRINT")
+		if err != nil {
+			return err
+		}
+
+		o, _ := st.Get(registry)
+		o.PinnedFingerprints = append(append([]string{}, o.PinnedFingerprints...), fingerprint)
+
+		if err := st.Set(registry, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadHeaders parses and loads a list of "REGISTRY[:PORT] Header-Name: value" strings
+func (st *Store) LoadHeaders(aa []string) error {
+	const format = "REGISTRY[:PORT] Header-Name: value"
+
+	for _, a := range aa {
+		registry, header, err := splitRegistryValue(strings.TrimSpace(a), format)
+		if err != nil {
+			return err
+		}
+
+		nv := strings.SplitN(header, ":", 2)
+		if len(nv) != 2 || strings.TrimSpace(nv[0]) == "" || strings.ContainsAny(strings.TrimSpace(nv[0]), " \t") {
+			return fmt.Errorf("invalid format: '%s' (should be: %s)", a, format)
+		}
+
+		o, _ := st.Get(registry)
+
+		headers := make(map[string]string, len(o.Headers)+1)
+		for name, value := range o.Headers {
+			headers[name] = value
+		}
+		headers[strings.TrimSpace(nv[0])] = strings.TrimSpace(nv[1])
+		o.Headers = headers
+
+		if err := st.Set(registry, o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper, picking a transport configured for the request host
+func (st *Store) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !LogRequests {
+		return st.roundTrip(req)
+	}
+
+	started := time.Now()
+
+	resp, err := st.roundTrip(req)
+
+	logRequest(req, resp, err, time.Since(started))
+
+	return resp, err
+}
+
+func (st *Store) roundTrip(req *http.Request) (*http.Response, error) {
+	if slot := st.hostSlot(req.URL.Host); slot != nil {
+		select {
+		case slot <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		defer func() { <-slot }()
+	}
+
+	st.mux.Lock()
+	t, defined := st.transports[req.URL.Host]
+	if !defined {
+		t, defined = st.getFallback()
+	}
+	headers := st.options[req.URL.Host].Headers
+	st.mux.Unlock()
+
+	if len(headers) != 0 {
+		// RoundTripper should not modify the request passed, so we add headers to its copy
+		req = req.Clone(req.Context())
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+	}
+
+	if !defined {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	return t.RoundTrip(req)
+}
+
+// getFallback gives us transport for registries with no options set: the default one, but with our timeouts,
+// or false, if default transport was replaced with something we could not apply timeouts to
+// NB! Store should be locked by the caller.
+func (st *Store) getFallback() (*http.Transport, bool) {
+	if st.fallback == nil {
+		dt, ok := http.DefaultTransport.(*http.Transport)
+		if !ok {
+			return nil, false
+		}
+
+		st.fallback = newTransport(dt.TLSClientConfig, st.getTimeouts())
+	}
+
+	return st.fallback, true
+}
+
+// maxRedirects is how many redirects in a row we follow (same as net/http does by default)
+const maxRedirects = 10
+
+// checkRedirect follows redirects (e.g. 307/308 of blob downloads to object storage with signed URLs),
+// but never forwards registry "Authorization" header to another host: storage (S3/GCS) rejects it.
+// NB! Unlike net/http, we treat registry subdomains and other ports of the registry host as another host too.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+	}
+
+	return nil
+}
+
+// Client gives us HTTP client to perform registry requests with
+func Client() *http.Client {
+	return &http.Client{Transport: &Registries, CheckRedirect: checkRedirect}
+}
+
+func splitRegistryValue(a, format string) (string, string, error) {
+	ss := strings.SplitN(a, " ", 2)
+	if len(ss) != 2 || ss[0] == "" || strings.TrimSpace(ss[1]) == "" {
+		return "", "", fmt.Errorf("invalid format: '%s' (should be: %s)", a, format)
+	}
+
+	return ss[0], strings.TrimSpace(ss[1]), nil
+}
+
+func loadRootCAs(o Options) (*x509.CertPool, error) {
+	if o.CAFile == "" && len(o.CACert) == 0 {
+		return nil, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if o.CAFile != "" {
+		pem, err := ioutil.ReadFile(fix.Path(o.CAFile))
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid PEM certificates found in: %s", o.CAFile)
+		}
+	}
+
+	if len(o.CACert) != 0 {
+		if !pool.AppendCertsFromPEM(o.CACert) {
+			return nil, fmt.Errorf("no valid PEM certificates found in passed CA certificate")
+		}
+	}
+
+	return pool, nil
+}
+
+// verifyPins gives TLS callback checking that registry (leaf) certificate matches one of the fingerprints pinned
+// NB! It is called after the regular verification, so pinned certificate should still be trusted (or verification skipped).
+func verifyPins(pins map[string]bool, pinned []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return &PinMismatchError{Pinned: pinned}
+		}
+
+		fingerprint := fmt.Sprintf("%x", sha256.Sum256(rawCerts[0]))
+		if !pins[fingerprint] {
+			return &PinMismatchError{Fingerprint: fingerprint, Pinned: pinned}
+		}
+
+		return nil
+	}
+}
+
+func buildTLSConfig(o Options) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if dt, ok := http.DefaultTransport.(*http.Transport); ok && dt.TLSClientConfig != nil {
+		tlsConfig = dt.TLSClientConfig.Clone()
+	}
+
+	if o.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	rootCAs, err := loadRootCAs(o)
+	if err != nil {
+		return nil, err
+	}
+	if rootCAs != nil {
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if o.ClientCertFile != "" || o.ClientKeyFile != "" {
+		if o.ClientCertFile == "" || o.ClientKeyFile == "" {
+			return nil, fmt.Errorf("both client certificate and client key files are required")
+		}
+
+		cert, err := tls.LoadX509KeyPair(fix.Path(o.ClientCertFile), fix.Path(o.ClientKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate/key pair: %s", err.Error())
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func newTransport(tlsConfig *tls.Config, timeouts Timeouts) *http.Transport {
+	var t *http.Transport
+
+	if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+		t = dt.Clone()
+	} else {
+		t = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+
+	t.TLSClientConfig = tlsConfig
+	t.DialContext = (&net.Dialer{Timeout: timeouts.Dial, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = timeouts.TLSHandshake
+	t.ResponseHeaderTimeout = timeouts.ResponseHeader
+
+	return t
+}
@@ -0,0 +1,430 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runTLSServer() (*httptest.Server, string, []byte) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	return server, strings.TrimPrefix(server.URL, "https://"), caCert
+}
+
+func writeTempFile(data []byte) string {
+	f, _ := ioutil.TempFile("", "ca.pem")
+	defer f.Close()
+
+	f.Write(data)
+
+	return f.Name()
+}
+
+func TestClient_UnknownCA(t *testing.T) {
+	server, _, _ := runTLSServer()
+	defer server.Close()
+
+	var st Store
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.NotNil(t, err, "should fail to verify self-signed certificate without CA configured")
+}
+
+func TestClient_CAFile(t *testing.T) {
+	server, registry, caCert := runTLSServer()
+	defer server.Close()
+
+	caFile := writeTempFile(caCert)
+	defer os.Remove(caFile)
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.LoadCAFiles([]string{registry + " " + caFile}))
+
+	resp, err := (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.Nil(err, "should verify self-signed certificate with CA file configured")
+	if err == nil {
+		assert.Equal(200, resp.StatusCode)
+	}
+
+	o, defined := st.Get(registry)
+	assert.True(defined)
+	assert.Equal(caFile, o.CAFile)
+}
+
+func TestClient_CACert(t *testing.T) {
+	server, registry, caCert := runTLSServer()
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.Set(registry, Options{CACert: caCert}))
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.Nil(err, "should verify self-signed certificate with CA certificate configured")
+}
+
+func TestClient_CAForAnotherRegistry(t *testing.T) {
+	server, _, caCert := runTLSServer()
+	defer server.Close()
+
+	var st Store
+
+	st.Set("registry.company.io", Options{CACert: caCert})
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.NotNil(t, err, "should NOT apply CA configured for another registry")
+}
+
+func TestSet_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.NotNil(st.Set("localhost:5000", Options{CAFile: "/i/do/not/exist/sorry"}))
+	assert.NotNil(st.Set("localhost:5000", Options{CACert: []byte("not a certificate")}))
+
+	_, defined := st.Get("localhost:5000")
+	assert.False(defined, "should not store invalid options")
+}
+
+func TestSkipsVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.Set("registry.company.io", Options{InsecureSkipVerify: true}))
+	assert.Nil(st.Set("secure.company.io", Options{Headers: map[string]string{"X-Api-Key": "secret"}}))
+
+	assert.True(st.SkipsVerify("registry.company.io"))
+	assert.False(st.SkipsVerify("secure.company.io"))
+	assert.False(st.SkipsVerify("unknown.company.io"))
+}
+
+func TestLoadCAFiles_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.NotNil(st.LoadCAFiles([]string{""}))
+	assert.NotNil(st.LoadCAFiles([]string{"localhost:5000"}))
+	assert.NotNil(st.LoadCAFiles([]string{" /path/to/ca.pem"}))
+}
+
+func writeClientCert() (string, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "lstags"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+
+	certFile := writeTempFile(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyFile := writeTempFile(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+
+	return certFile, keyFile
+}
+
+func runMutualTLSServer() (*httptest.Server, string, []byte) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+	return server, strings.TrimPrefix(server.URL, "https://"), caCert
+}
+
+func TestClient_ClientCert(t *testing.T) {
+	server, registry, caCert := runMutualTLSServer()
+	defer server.Close()
+
+	certFile, keyFile := writeClientCert()
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.Set(registry, Options{CACert: caCert}))
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL)
+	assert.NotNil(err, "should fail without client certificate")
+
+	assert.Nil(st.LoadClientCerts([]string{registry + " " + certFile + " " + keyFile}))
+
+	_, err = (&http.Client{Transport: &st}).Get(server.URL)
+	assert.Nil(err, "should succeed with client certificate")
+
+	o, _ := st.Get(registry)
+	assert.Equal(caCert, o.CACert, "should keep previously set CA certificate")
+}
+
+func TestLoadClientCerts_Invalid(t *testing.T) {
+	certFile, keyFile := writeClientCert()
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	anotherCertFile, anotherKeyFile := writeClientCert()
+	defer os.Remove(anotherCertFile)
+	defer os.Remove(anotherKeyFile)
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.NotNil(st.LoadClientCerts([]string{"localhost:5000 " + certFile}))
+	assert.NotNil(st.LoadClientCerts([]string{"localhost:5000 " + certFile + " " + anotherKeyFile}), "cert/key mismatch")
+	assert.NotNil(st.Set("localhost:5000", Options{ClientCertFile: certFile}))
+	assert.Nil(st.LoadClientCerts([]string{"localhost:5000 " + certFile + " " + keyFile}))
+}
+
+func TestClient_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.LoadHeaders([]string{registry + " X-Api-Key: secret", registry + " X-Route:  mirror "}))
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Authorization", "Bearer token")
+
+	_, err := (&http.Client{Transport: &st}).Do(req)
+
+	assert.Nil(err)
+
+	headers := <-received
+	assert.Equal("secret", headers.Get("X-Api-Key"))
+	assert.Equal("mirror", headers.Get("X-Route"))
+	assert.Equal("Bearer token", headers.Get("Authorization"), "should keep Authorization managed by us")
+	assert.Equal("", req.Header.Get("X-Api-Key"), "should NOT modify request passed")
+}
+
+func TestLoadHeaders_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	var st Store
+
+	for _, a := range []string{
+		"localhost:5000",
+		"localhost:5000 X-Api-Key",
+		"localhost:5000 : secret",
+		"localhost:5000 Authorization: Basic Zm9vOmJhcg==",
+	} {
+		assert.NotNil(st.LoadHeaders([]string{a}), "should fail on: %s", a)
+	}
+}
+
+func TestClient_PinnedFingerprints(t *testing.T) {
+	server, registry, caCert := runTLSServer()
+	defer server.Close()
+
+	fingerprint := fmt.Sprintf("%X", sha256.Sum256(server.Certificate().Raw))
+
+	assert := assert.New(t)
+
+	var st Store
+
+	assert.Nil(st.Set(registry, Options{CACert: caCert, PinnedFingerprints: []string{fingerprint}}))
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.Nil(err, "should accept certificate matching pinned fingerprint")
+
+	assert.Nil(st.Set(registry, Options{CACert: caCert, PinnedFingerprints: []string{strings.Repeat("ab:", 31) + "ab"}}))
+
+	_, err = (&http.Client{Transport: &st}).Get(server.URL)
+
+	var pinErr *PinMismatchError
+	assert.True(errors.As(err, &pinErr), "should fail with *PinMismatchError on fingerprint mismatch, got: %#v", err)
+	if pinErr != nil {
+		assert.Equal(strings.ToLower(fingerprint), pinErr.Fingerprint)
+	}
+
+	assert.Nil(st.Set(registry, Options{InsecureSkipVerify: true, PinnedFingerprints: []string{"sha256:" + fingerprint}}))
+
+	_, err = (&http.Client{Transport: &st}).Get(server.URL)
+
+	assert.Nil(err, "should enforce pins even if certificate verification is skipped")
+}
+
+func TestLoadPins_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	var st Store
+
+	for _, a := range []string{
+		"localhost:5000",
+		"localhost:5000 abcd",
+		"localhost:5000 " + strings.Repeat("zz", 32),
+	} {
+		assert.NotNil(st.LoadPins([]string{a}), "should fail on: %s", a)
+	}
+
+	assert.Nil(st.LoadPins([]string{"localhost:5000 " + strings.Repeat("AB:", 31) + "AB"}))
+}
+
+func TestClient_HostLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	var st Store
+	st.SetHostLimit(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			resp, err := (&http.Client{Transport: &st}).Get(server.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight), "should run no more than 2 requests to the host at once")
+}
+
+func TestClient_ResponseHeaderTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-headers" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		w.WriteHeader(200)
+
+		// body is "downloaded" slower than headers are allowed to be waited for, but it should never be cut
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	var st Store
+	st.SetTimeouts(Timeouts{ResponseHeader: 100 * time.Millisecond})
+
+	_, err := (&http.Client{Transport: &st}).Get(server.URL + "/slow-headers")
+	assert.NotNil(err, "should fail, if registry is slow to respond with headers")
+
+	resp, err := (&http.Client{Transport: &st}).Get(server.URL + "/slow-body")
+	assert.Nil(err)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Nil(err, "should not cut slow response body")
+	assert.Equal("datadatadatadata", string(body))
+}
+
+func TestClient_TLSHandshakeTimeout(t *testing.T) {
+	// listener accepts connections, but never completes TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %s", err.Error())
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	assert := assert.New(t)
+
+	registry := listener.Addr().String()
+
+	var st Store
+	assert.Nil(st.Set(registry, Options{InsecureSkipVerify: true}))
+
+	st.SetTimeouts(Timeouts{TLSHandshake: 100 * time.Millisecond})
+
+	started := time.Now()
+
+	_, err = (&http.Client{Transport: &st}).Get("https://" + registry + "/v2/")
+
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "TLS handshake timeout", "should apply timeouts to registries configured before")
+	assert.True(time.Since(started) < 5*time.Second, "should fail fast")
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/auth"
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+)
+
+// UploadChunkSize is a size of chunks we upload blobs with, if registry supports chunked uploads
+// NB! Blobs not bigger than a single chunk are always uploaded monolithically.
+var UploadChunkSize int64 = 16 << 20
+
+// getChunkSize tells us if registry supports chunked uploads (it advertises it while starting the upload)
+// and which chunk size we should use, taking minimal chunk size registry accepts into account
+func getChunkSize(header http.Header) (int64, bool) {
+	chunkSize := UploadChunkSize
+
+	if s := header.Get("OCI-Chunk-Min-Length"); s != "" {
+		min, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+
+		if min > chunkSize {
+			chunkSize = min
+		}
+
+		return chunkSize, true
+	}
+
+	return chunkSize, header.Get("Range") != ""
+}
+
+// getUploadedSize gets number of bytes registry already has from the upload "Range" header ("0-1023" or "bytes=0-1023")
+// NB! "0-0" is ambiguous (could mean nothing or a single byte uploaded), so we assume nothing is uploaded.
+func getUploadedSize(header http.Header) (int64, error) {
+	s := strings.TrimPrefix(header.Get("Range"), "bytes=")
+	if s == "" {
+		return 0, nil
+	}
+
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 || parts[0] != "0" {
+		return 0, fmt.Errorf("invalid upload range: %s", s)
+	}
+
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid upload range: %s", s)
+	}
+
+	if end == 0 {
+		return 0, nil
+	}
+
+	return end + 1, nil
+}
+
+func withDigest(location, digest string) string {
+	if strings.Contains(location, "?") {
+		return location + "&digest=" + url.QueryEscape(digest)
+	}
+
+	return location + "?digest=" + url.QueryEscape(digest)
+}
+
+// patchChunk uploads a piece of blob starting at the offset passed, gives next upload location and uploaded size
+func (cli *RegistryClient) patchChunk(repoToken auth.Token, location string, offset int64, data []byte) (string, int64, error) {
+	resp, err := request.SendContext(
+		cli.Context(),
+		"PATCH",
+		location,
+		authorization(repoToken),
+		map[string]string{
+			"Content-Type":   "application/octet-stream",
+			"Content-Range":  fmt.Sprintf("%d-%d", offset, offset+int64(len(data))-1),
+			"Content-Length": strconv.Itoa(len(data)),
+		},
+		bytes.NewReader(data),
+		cli.Config.TraceRequests,
+	)
+	if err != nil {
+		return location, 0, err
+	}
+	if resp.StatusCode != 202 {
+		return location, 0, responseError(resp, "upload blob chunk")
+	}
+	resp.Body.Close()
+
+	next, err := cli.uploadURL(resp.Header.Get("Location"))
+	if err != nil {
+		return location, 0, err
+	}
+
+	uploaded, err := getUploadedSize(resp.Header)
+	if err != nil {
+		return next, 0, err
+	}
+	if uploaded == 0 {
+		uploaded = offset + int64(len(data))
+	}
+
+	return next, uploaded, nil
+}
+
+// uploadStatus asks registry how much of the blob it already has (to resume upload from there)
+func (cli *RegistryClient) uploadStatus(repoToken auth.Token, location string) (string, int64, error) {
+	resp, err := request.SendContext(cli.Context(), "GET", location, authorization(repoToken), nil, nil, cli.Config.TraceRequests)
+	if err != nil {
+		return location, 0, err
+	}
+	if resp.StatusCode != 204 {
+		return location, 0, responseError(resp, "get blob upload status")
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("Location") != "" {
+		location, err = cli.uploadURL(resp.Header.Get("Location"))
+		if err != nil {
+			return location, 0, err
+		}
+	}
+
+	uploaded, err := getUploadedSize(resp.Header)
+
+	return location, uploaded, err
+}
+
+// uploadChunks uploads blob content in chunks with PATCH requests, gives upload location to complete upload with.
+// Content is read up to EOF after the last chunk, so upload of content failing to read (e.g. on digest mismatch) is never completed.
+// NB! Every chunk is kept in memory, so failed chunk upload could be resumed from the last offset registry acknowledged.
+func (cli *RegistryClient) uploadChunks(repoToken auth.Token, location string, size, chunkSize int64, content io.Reader) (string, error) {
+	buf := make([]byte, chunkSize)
+
+	var uploaded int64
+
+	for uploaded < size {
+		chunkStart := uploaded
+
+		n := chunkSize
+		if size-chunkStart < n {
+			n = size - chunkStart
+		}
+
+		chunk := buf[:n]
+		if _, err := io.ReadFull(content, chunk); err != nil {
+			return "", err
+		}
+
+		retries := cli.Config.RetryRequests
+		delay := cli.Config.RetryDelay
+
+		for uploaded < chunkStart+n {
+			var err error
+
+			location, uploaded, err = cli.patchChunk(repoToken, location, uploaded, chunk[uploaded-chunkStart:])
+			if err == nil {
+				continue
+			}
+
+			if retries <= 0 {
+				return "", err
+			}
+			retries--
+
+			log.Warnf("RESUME blob upload in %v (error: %s)", delay, err.Error())
+
+			time.Sleep(delay)
+			delay += delay
+
+			location, uploaded, err = cli.uploadStatus(repoToken, location)
+			if err != nil {
+				return "", err
+			}
+
+			if uploaded < chunkStart || uploaded > chunkStart+n {
+				return "", fmt.Errorf("unable to resume blob upload from offset %d (chunk: %d-%d)", uploaded, chunkStart, chunkStart+n-1)
+			}
+		}
+	}
+
+	// content is read up to EOF, so readers verifying it on EOF (e.g. by digest) fail upload before we complete it
+	extra, err := io.Copy(ioutil.Discard, content)
+	if err != nil {
+		return "", err
+	}
+	if extra != 0 {
+		return "", fmt.Errorf("blob content is bigger than %d bytes", size)
+	}
+
+	return location, nil
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadRegistry models blob upload protocol of the registry, optionally failing chunk uploads in the middle
+type uploadRegistry struct {
+	chunked  bool
+	failures int
+	data     []byte
+	blobs    map[string][]byte
+	patches  int
+	mux      sync.Mutex
+}
+
+func (r *uploadRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	const location = "/v2/foo/bar/blobs/uploads/session"
+
+	setRange := func() {
+		if len(r.data) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("0-%d", len(r.data)-1))
+		}
+	}
+
+	switch {
+	case req.URL.Path == "/v2/":
+		w.Write([]byte("{}"))
+	case req.Method == "POST":
+		w.Header().Set("Location", location)
+		if r.chunked {
+			w.Header().Set("Range", "0-0")
+		}
+		w.WriteHeader(202)
+	case req.Method == "PATCH":
+		r.patches++
+
+		var start, end int
+		fmt.Sscanf(req.Header.Get("Content-Range"), "%d-%d", &start, &end)
+		if start != len(r.data) {
+			w.WriteHeader(416)
+			return
+		}
+
+		data, _ := ioutil.ReadAll(req.Body)
+		if r.patches > 1 && r.failures > 0 {
+			r.failures--
+			r.data = append(r.data, data[:len(data)/2]...)
+			w.WriteHeader(500)
+			return
+		}
+		r.data = append(r.data, data...)
+
+		w.Header().Set("Location", location)
+		setRange()
+		w.WriteHeader(202)
+	case req.Method == "GET" && req.URL.Path == location:
+		w.Header().Set("Location", location)
+		setRange()
+		w.WriteHeader(204)
+	case req.Method == "PUT":
+		data, _ := ioutil.ReadAll(req.Body)
+		r.data = append(r.data, data...)
+
+		digest := req.URL.Query().Get("digest")
+		if digest != digestOf(r.data) {
+			w.WriteHeader(400)
+			return
+		}
+
+		r.blobs[digest] = r.data
+		r.data = nil
+		w.WriteHeader(201)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestUploadBlob(t *testing.T) {
+	defer func(size int64) { UploadChunkSize = size }(UploadChunkSize)
+	UploadChunkSize = 1024
+
+	blob := bytes.Repeat([]byte("0123456789"), 300)
+	digest := digestOf(blob)
+
+	var testCases = map[string]struct {
+		registry *uploadRegistry
+		patches  int
+	}{
+		"monolithic":              {&uploadRegistry{}, 0},
+		"chunked":                 {&uploadRegistry{chunked: true}, 3},
+		"chunked, resumed":        {&uploadRegistry{chunked: true, failures: 1}, 4},
+		"chunked, resumed, twice": {&uploadRegistry{chunked: true, failures: 2}, 5},
+	}
+
+	assert := assert.New(t)
+
+	for name, testCase := range testCases {
+		testCase.registry.blobs = make(map[string][]byte)
+
+		server := httptest.NewServer(testCase.registry)
+
+		cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, RetryRequests: 2, RetryDelay: time.Millisecond})
+		cli.Login("", "")
+
+		err := cli.UploadBlob("foo/bar", digest, int64(len(blob)), bytes.NewReader(blob))
+
+		server.Close()
+
+		assert.Nil(err, "should be no error (%s)", name)
+		assert.Equal(blob, testCase.registry.blobs[digest], "should upload blob as is (%s)", name)
+		assert.Equal(testCase.patches, testCase.registry.patches, "unexpected number of chunks uploaded (%s)", name)
+	}
+
+	registry := &uploadRegistry{chunked: true, failures: 3, blobs: make(map[string][]byte)}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	cli, _ := New(strings.TrimPrefix(server.URL, "http://"), Config{IsInsecure: true, RetryRequests: 2, RetryDelay: time.Millisecond})
+	cli.Login("", "")
+
+	assert.NotNil(cli.UploadBlob("foo/bar", digest, int64(len(blob)), bytes.NewReader(blob)), "should fail, if out of retries")
+}
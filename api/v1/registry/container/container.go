@@ -45,7 +45,7 @@ func getRandomPort() int {
 func getDockerClient() (*dockerclient.DockerClient, error) {
 	dockerConfig, _ := dockerconfig.Load(dockerconfig.DefaultDockerJSON)
 
-	return dockerclient.New(dockerConfig)
+	return dockerclient.NewForContext(dockerConfig, dockerclient.ContextsDir(dockerconfig.DefaultDockerJSON), "")
 }
 
 func getHostname(port int) string {
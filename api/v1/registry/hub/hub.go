@@ -0,0 +1,97 @@
+// Package hub fetches tags of Docker Hub repositories through the Hub API (not the registry one),
+// which gives us digests, sizes and push dates of all the tags with a single (paginated) listing
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+// URL is the base URL of Docker Hub API
+var URL = "https://hub.docker.com"
+
+// PageSize is a number of tags we ask Docker Hub API to give us per page (100 is a maximum it accepts)
+var PageSize = 100
+
+// Image is a platform image of the tag, as Docker Hub API gives it to us
+type Image struct {
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Variant      string    `json:"variant"`
+	Digest       string    `json:"digest"`
+	Size         int64     `json:"size"`
+	LastPushed   time.Time `json:"last_pushed"`
+}
+
+// Platform gives platform the image is built for
+func (img Image) Platform() *manifest.Platform {
+	return &manifest.Platform{OS: img.OS, Architecture: img.Architecture, Variant: img.Variant}
+}
+
+// Tag is a repository tag, as Docker Hub API gives it to us
+type Tag struct {
+	Name        string    `json:"name"`
+	Digest      string    `json:"digest"`
+	FullSize    int64     `json:"full_size"`
+	LastUpdated time.Time `json:"last_updated"`
+	Images      []Image   `json:"images"`
+}
+
+// SelectImage picks image built for the platform passed (gives nil, if there is no such image)
+func (t Tag) SelectImage(p manifest.Platform) *Image {
+	for i := range t.Images {
+		if p.Matches(t.Images[i].Platform()) {
+			return &t.Images[i]
+		}
+	}
+
+	return nil
+}
+
+// Config holds Docker Hub API request configuration
+type Config struct {
+	TraceRequests bool
+	RetryRequests int
+	RetryDelay    time.Duration
+}
+
+// FetchTags gets all the tags of Docker Hub repository path passed (e.g. "library/alpine"), following all the pages
+// NB! Only public repositories could be listed, as we do not log in to Docker Hub API.
+func FetchTags(repoPath string, config Config) ([]Tag, error) {
+	tags := make([]Tag, 0)
+
+	link := fmt.Sprintf("%s/v2/repositories/%s/tags?page_size=%d", URL, repoPath, PageSize)
+	for link != "" {
+		resp, _, err := request.Perform(link, "", "json", config.TraceRequests, config.RetryRequests, config.RetryDelay)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+
+			return nil, fmt.Errorf("unable to list Docker Hub repository %s: %s", repoPath, resp.Status)
+		}
+
+		page := struct {
+			Next    string `json:"next"`
+			Results []Tag  `json:"results"`
+		}{}
+
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, page.Results...)
+
+		link = page.Next
+	}
+
+	return tags, nil
+}
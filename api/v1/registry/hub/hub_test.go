@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+// runHub serves tags of the "library/alpine" repository, giving them page by page
+func runHub(tags []Tag) *httptest.Server {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/repositories/library/alpine/tags" {
+			http.NotFound(w, r)
+			return
+		}
+
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+
+		start := (page - 1) * pageSize
+		end := start + pageSize
+		if end > len(tags) {
+			end = len(tags)
+		}
+
+		var next string
+		if end < len(tags) {
+			next = server.URL + r.URL.Path + "?page_size=" + strconv.Itoa(pageSize) + "&page=" + strconv.Itoa(page+1)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"count": len(tags), "next": next, "results": tags[start:end]})
+	}))
+
+	return server
+}
+
+func TestFetchTags(t *testing.T) {
+	defer func(url string, pageSize int) { URL, PageSize = url, pageSize }(URL, PageSize)
+
+	tags := []Tag{
+		{Name: "3.18", Digest: "sha256:18", FullSize: 3000},
+		{Name: "3.19", Digest: "sha256:19", FullSize: 3100},
+		{Name: "3.20", Digest: "sha256:20", FullSize: 3200},
+	}
+
+	server := runHub(tags)
+	defer server.Close()
+
+	URL = server.URL
+	PageSize = 2
+
+	assert := assert.New(t)
+
+	fetchedTags, err := FetchTags("library/alpine", Config{})
+
+	assert.Nil(err)
+	assert.Equal(tags, fetchedTags, "should fetch tags from all pages")
+
+	_, err = FetchTags("library/nonexistent", Config{})
+
+	assert.NotNil(err, "should fail for a nonexistent repository")
+}
+
+func TestSelectImage(t *testing.T) {
+	tg := Tag{
+		Name: "latest",
+		Images: []Image{
+			{OS: "linux", Architecture: "amd64", Digest: "sha256:amd64", LastPushed: time.Unix(1000, 0)},
+			{OS: "linux", Architecture: "arm", Variant: "v7", Digest: "sha256:armv7"},
+		},
+	}
+
+	assert := assert.New(t)
+
+	assert.Equal("sha256:amd64", tg.SelectImage(manifest.Platform{OS: "linux", Architecture: "amd64"}).Digest)
+	assert.Equal("sha256:armv7", tg.SelectImage(manifest.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}).Digest)
+	assert.Nil(tg.SelectImage(manifest.Platform{OS: "windows", Architecture: "amd64"}))
+}
@@ -0,0 +1,273 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ivanilves/lstags/tag/manifest"
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// LayoutVersion is a version of OCI image layout we write
+const LayoutVersion = "1.0.0"
+
+// RefNameAnnotation is an annotation OCI image layout index uses to name manifests (e.g. by tag)
+const RefNameAnnotation = "org.opencontainers.image.ref.name"
+
+// layoutIndex is an "index.json" of the layout ("manifests" are required there, even if there is none)
+type layoutIndex struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	MediaType     string                `json:"mediaType,omitempty"`
+	Manifests     []manifest.Descriptor `json:"manifests"`
+	Annotations   map[string]string     `json:"annotations,omitempty"`
+}
+
+// Layout is an OCI image layout directory we copy content to, i.e. a destination to export images for air-gapped transfer
+// (see https://github.com/opencontainers/image-spec/blob/main/image-layout.md)
+type Layout struct {
+	path string
+	mux  sync.Mutex
+}
+
+// OpenLayout opens OCI image layout directory, initializing it, if it does not exist or is empty.
+// NB! It fails for a non-empty directory not being an OCI image layout or having a layout version we do not support.
+func OpenLayout(path string) (*Layout, error) {
+	l := &Layout{path: fix.Path(path)}
+
+	entries, err := ioutil.ReadDir(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		if err := os.MkdirAll(filepath.Join(l.path, "blobs"), 0755); err != nil {
+			return nil, err
+		}
+
+		data, _ := json.Marshal(map[string]string{"imageLayoutVersion": LayoutVersion})
+		if err := ioutil.WriteFile(filepath.Join(l.path, "oci-layout"), data, 0644); err != nil {
+			return nil, err
+		}
+
+		return l, l.writeIndex(layoutIndex{SchemaVersion: 2, Manifests: []manifest.Descriptor{}})
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(l.path, "oci-layout"))
+	if err != nil {
+		return nil, fmt.Errorf("not an OCI image layout (non-empty directory with no 'oci-layout' file): %s", path)
+	}
+
+	var version struct {
+		ImageLayoutVersion string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return nil, fmt.Errorf("invalid 'oci-layout' file of %s: %s", path, err.Error())
+	}
+	if version.ImageLayoutVersion != LayoutVersion {
+		return nil, fmt.Errorf("unsupported OCI image layout version of %s: %s", path, version.ImageLayoutVersion)
+	}
+
+	if _, err := l.readIndex(); err != nil {
+		return nil, fmt.Errorf("invalid 'index.json' file of %s: %s", path, err.Error())
+	}
+
+	return l, nil
+}
+
+// Path gives us path to the layout directory
+func (l *Layout) Path() string {
+	return l.path
+}
+
+func (l *Layout) blobPath(digest string) (string, error) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.ContainsAny(parts[1], "/\\.") {
+		return "", fmt.Errorf("invalid digest: %s", digest)
+	}
+
+	return filepath.Join(l.path, "blobs", parts[0], parts[1]), nil
+}
+
+func newHash(digest string) (hash.Hash, error) {
+	switch strings.SplitN(digest, ":", 2)[0] {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported digest algorithm: %s", digest)
+}
+
+// BlobExists checks if blob with digest specified is already present in the layout (repository path is ignored)
+func (l *Layout) BlobExists(_, digest string) (bool, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UploadBlob writes blob content to the layout, verifying its digest (repository path is ignored)
+func (l *Layout) UploadBlob(_, digest string, size int64, content io.Reader) error {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return err
+	}
+
+	h, err := newHash(digest)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	written, err := io.Copy(io.MultiWriter(f, h), content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 && written != size {
+		return fmt.Errorf("blob %s size mismatch: expected %d bytes, got %d", digest, size, written)
+	}
+	if actual := strings.SplitN(digest, ":", 2)[0] + ":" + fmt.Sprintf("%x", h.Sum(nil)); actual != digest {
+		return fmt.Errorf("blob digest mismatch: expected %s, got %s", digest, actual)
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// PutManifest writes manifest to the layout as a blob. Manifest put by tag is also added to the layout index,
+// named with the tag, or "REPOSITORY:TAG", if repository path is not empty (manifest with the same name is replaced).
+func (l *Layout) PutManifest(repoPath, reference, mediaType string, data []byte) error {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+
+	if exists, err := l.BlobExists(repoPath, digest); err != nil {
+		return err
+	} else if !exists {
+		if err := l.UploadBlob(repoPath, digest, int64(len(data)), strings.NewReader(string(data))); err != nil {
+			return err
+		}
+	}
+
+	if strings.Contains(reference, ":") {
+		return nil
+	}
+
+	refName := reference
+	if repoPath != "" {
+		refName = repoPath + ":" + reference
+	}
+
+	d := manifest.Descriptor{
+		MediaType:   mediaType,
+		Digest:      digest,
+		Size:        int64(len(data)),
+		Annotations: map[string]string{RefNameAnnotation: refName},
+	}
+
+	if content, err := manifest.ParseContent(mediaType, data); err == nil {
+		d.ArtifactType = content.ArtifactType
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+
+	manifests := make([]manifest.Descriptor, 0, len(index.Manifests)+1)
+	for _, m := range index.Manifests {
+		if m.Annotations[RefNameAnnotation] != refName {
+			manifests = append(manifests, m)
+		}
+	}
+	index.Manifests = append(manifests, d)
+
+	return l.writeIndex(index)
+}
+
+// Manifests gives us descriptors of all manifests in the layout index
+func (l *Layout) Manifests() ([]manifest.Descriptor, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	index, err := l.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return index.Manifests, nil
+}
+
+func (l *Layout) readIndex() (layoutIndex, error) {
+	var index layoutIndex
+
+	data, err := ioutil.ReadFile(filepath.Join(l.path, "index.json"))
+	if err != nil {
+		return index, err
+	}
+
+	if err := json.Unmarshal(data, &index); err != nil {
+		return index, err
+	}
+
+	if index.SchemaVersion != 2 {
+		return index, fmt.Errorf("unsupported index schema version: %d", index.SchemaVersion)
+	}
+	if index.Manifests == nil {
+		index.Manifests = []manifest.Descriptor{}
+	}
+
+	return index, nil
+}
+
+func (l *Layout) writeIndex(index layoutIndex) error {
+	if index.MediaType == "" {
+		index.MediaType = manifest.MediaTypeOCIIndex
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.path, "index.json")
+
+	if err := ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,107 @@
+package transfer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/tag/manifest"
+)
+
+func TestOpenLayout(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "layout")
+	defer os.RemoveAll(dir)
+
+	assert := assert.New(t)
+
+	_, err := OpenLayout(filepath.Join(dir, "new"))
+
+	assert.Nil(err, "should initialize nonexistent directory")
+
+	ociLayout, _ := ioutil.ReadFile(filepath.Join(dir, "new", "oci-layout"))
+	index, _ := ioutil.ReadFile(filepath.Join(dir, "new", "index.json"))
+
+	assert.JSONEq(`{"imageLayoutVersion":"1.0.0"}`, string(ociLayout))
+	assert.JSONEq(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`, string(index))
+
+	_, err = OpenLayout(filepath.Join(dir, "new"))
+
+	assert.Nil(err, "should open existing layout")
+
+	os.MkdirAll(filepath.Join(dir, "foreign"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "foreign", "file.txt"), []byte("foreign"), 0644)
+
+	_, err = OpenLayout(filepath.Join(dir, "foreign"))
+
+	assert.NotNil(err, "should NOT open non-empty directory not being a layout")
+
+	os.MkdirAll(filepath.Join(dir, "future"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "future", "oci-layout"), []byte(`{"imageLayoutVersion":"2.0.0"}`), 0644)
+
+	_, err = OpenLayout(filepath.Join(dir, "future"))
+
+	assert.NotNil(err, "should NOT open layout of unsupported version")
+}
+
+func TestManifest_Layout(t *testing.T) {
+	srcRegistry := newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"architecture":"amd64"}`))
+	layer := srcRegistry.addBlob([]byte("layer"))
+	image := srcRegistry.addManifest("foo/bar", "", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+		Layers:        []manifest.Descriptor{layer},
+	})
+	index := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIIndex,
+		Manifests:     []manifest.Descriptor{image},
+	})
+
+	srcServer := httptest.NewServer(srcRegistry)
+	defer srcServer.Close()
+
+	dir, _ := ioutil.TempDir("", "layout")
+	defer os.RemoveAll(dir)
+
+	assert := assert.New(t)
+
+	layout, err := OpenLayout(dir)
+	assert.Nil(err)
+
+	for i := 0; i < 2; i++ {
+		digest, err := Manifest(connect(t, srcServer), "foo/bar", layout, "", "latest")
+
+		assert.Nil(err, "should be no error")
+		assert.Equal(index.Digest, digest, "should keep manifest digest")
+	}
+
+	for _, d := range []manifest.Descriptor{index, image, config, layer} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(d.Digest, "sha256:")))
+
+		assert.Nil(err, "should write blob: %s", d.Digest)
+		assert.Equal(d.Digest, digestOf(data))
+	}
+
+	manifests, err := layout.Manifests()
+
+	assert.Nil(err)
+	assert.Equal(1, len(manifests), "should add tagged manifest to index only once")
+	assert.Equal(index.Digest, manifests[0].Digest)
+	assert.Equal(manifest.MediaTypeOCIIndex, manifests[0].MediaType)
+	assert.Equal("latest", manifests[0].Annotations[RefNameAnnotation])
+
+	var idx map[string]interface{}
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	assert.Nil(json.Unmarshal(data, &idx), "should write valid index.json")
+
+	assert.NotNil(layout.UploadBlob("", layer.Digest, layer.Size, strings.NewReader("tampered")), "should verify blob digest")
+}
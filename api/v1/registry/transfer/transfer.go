@@ -0,0 +1,416 @@
+// Package transfer copies registry content (manifests and blobs) between registries (or to OCI layout directories) directly,
+// i.e. without pulling images into the local Docker daemon.
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/tag/manifest"
+	"github.com/ivanilves/lstags/util/throttle"
+	"github.com/ivanilves/lstags/util/wait"
+)
+
+// Destination is where we copy content to: a registry (*client.RegistryClient) or an OCI layout directory (*Layout)
+type Destination interface {
+	BlobExists(repoPath, digest string) (bool, error)
+	UploadBlob(repoPath, digest string, size int64, content io.Reader) error
+	PutManifest(repoPath, reference, mediaType string, data []byte) error
+}
+
+// Limiter limits rate of blob transfers (nil means no limit)
+var Limiter *throttle.Limiter
+
+// LayerConcurrency defines how much blobs of a single image we copy in parallel
+var LayerConcurrency = 3
+
+// Stats counts blobs we copied and ones we skipped, as they were present in destination already
+// (e.g. layers shared by the image re-mirrored with its previous version), along with their bytes
+type Stats struct {
+	// Copied is a number of blobs copied
+	Copied int
+	// CopiedBytes is a number of bytes of blobs copied
+	CopiedBytes int64
+	// Skipped is a number of blobs skipped
+	Skipped int
+	// SavedBytes is a number of bytes of blobs skipped, i.e. ones we did not need to transfer
+	SavedBytes int64
+}
+
+var (
+	stats    Stats
+	statsMux sync.Mutex
+)
+
+// GetStats gives us blob stats accumulated since the last ResetStats call
+func GetStats() Stats {
+	statsMux.Lock()
+	defer statsMux.Unlock()
+
+	return stats
+}
+
+// ResetStats resets blob stats (e.g. on start of the next batch operation)
+func ResetStats() {
+	statsMux.Lock()
+	defer statsMux.Unlock()
+
+	stats = Stats{}
+}
+
+// countBlob accounts blob copied (or skipped) in stats
+func countBlob(copied bool, size int64) {
+	statsMux.Lock()
+	defer statsMux.Unlock()
+
+	if copied {
+		stats.Copied++
+		stats.CopiedBytes += size
+	} else {
+		stats.Skipped++
+		stats.SavedBytes += size
+	}
+}
+
+// verifiedReader reads blob content computing its digest, so blob which is not exactly the one we expect
+// (e.g. config re-serialized on the way) fails with an error on EOF instead of being uploaded
+type verifiedReader struct {
+	r      io.Reader
+	h      hash.Hash
+	digest string
+}
+
+func (vr *verifiedReader) Read(p []byte) (int, error) {
+	n, err := vr.r.Read(p)
+	vr.h.Write(p[:n])
+
+	if err == io.EOF {
+		if actual := strings.SplitN(vr.digest, ":", 2)[0] + ":" + fmt.Sprintf("%x", vr.h.Sum(nil)); actual != vr.digest {
+			return n, fmt.Errorf("blob digest mismatch: expected %s, got %s", vr.digest, actual)
+		}
+	}
+
+	return n, err
+}
+
+// verifyManifest makes sure manifest data are exactly the ones having the digest passed, so it is copied byte for byte
+// NB! Deprecated "schema1" manifests are signed, i.e. their digests are not digests of data served, so they are not verified.
+func verifyManifest(data []byte, mediaType, digest string) error {
+	if manifest.IsSchema1MediaType(mediaType) {
+		return nil
+	}
+
+	h, err := newHash(digest)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+
+	if actual := strings.SplitN(digest, ":", 2)[0] + ":" + fmt.Sprintf("%x", h.Sum(nil)); actual != digest {
+		return fmt.Errorf("manifest digest mismatch: expected %s, got %s", digest, actual)
+	}
+
+	return nil
+}
+
+// Blob copies blob described by descriptor passed, if it is not present in destination repository yet (checked with HEAD request)
+// NB! Blob is copied byte for byte: content not matching its digest fails to copy. Blobs copied and skipped are counted in stats.
+// Copy is aborted, once context of the source client is done (See client.WithContext), even if we wait for the Limiter.
+func Blob(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, d manifest.Descriptor) error {
+	exists, err := dst.BlobExists(dstPath, d.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Debugf("blob already exists: %s@%s", dstPath, d.Digest)
+		countBlob(false, d.Size)
+
+		return nil
+	}
+
+	content, size, err := src.Blob(srcPath, d.Digest)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	if size < 0 {
+		size = d.Size
+	}
+
+	h, err := newHash(d.Digest)
+	if err != nil {
+		return err
+	}
+
+	verified := &verifiedReader{r: content, h: h, digest: d.Digest}
+
+	if err := dst.UploadBlob(dstPath, d.Digest, size, Limiter.Reader(src.Context(), verified)); err != nil {
+		return err
+	}
+	countBlob(true, size)
+
+	return nil
+}
+
+// blobs copies blobs described by descriptors passed, up to "LayerConcurrency" of them in parallel
+// NB! Same blob referenced multiple times is copied only once.
+func blobs(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, ds []manifest.Descriptor) error {
+	concurrency := LayerConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	unique := make([]manifest.Descriptor, 0, len(ds))
+	seen := make(map[string]bool)
+	for _, d := range ds {
+		if seen[d.Digest] {
+			continue
+		}
+
+		unique = append(unique, d)
+		seen[d.Digest] = true
+	}
+
+	if len(unique) == 0 {
+		return nil
+	}
+
+	sem := make(chan struct{}, concurrency)
+	done := make(chan error, len(unique))
+
+	for _, d := range unique {
+		go func(d manifest.Descriptor) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			done <- Blob(src, srcPath, dst, dstPath, d)
+		}(d)
+	}
+
+	return wait.WithTolerance(done)
+}
+
+// Manifest copies manifest (with everything it references) identified by reference passed (tag name or digest)
+// NB! Manifest, its config and layers are copied byte for byte, so it keeps its digest on the destination side.
+// Any digest mismatch (source serving content not matching its digest, destination reporting another digest) is an error.
+// Returns manifest digest.
+func Manifest(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, reference string) (string, error) {
+	return AnnotatedManifest(src, srcPath, dst, dstPath, reference, nil)
+}
+
+// ManifestAs does the same as Manifest, but puts manifest copied under another reference (e.g. index digest => tag)
+func ManifestAs(src *client.RegistryClient, srcPath, srcReference string, dst Destination, dstPath, dstReference string) (string, error) {
+	return copyManifest(src, srcPath, srcReference, dst, dstPath, dstReference, nil)
+}
+
+// AnnotatedManifest does the same as Manifest, but also adds annotations passed to the copied OCI image manifest (or index),
+// e.g. to stamp provenance of the mirrored image. Annotations already present are preserved, i.e. never overwritten.
+// NB! Annotated manifest gets a new digest (it is returned), Docker and "schema1" manifests could not be annotated.
+func AnnotatedManifest(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, reference string, annotations map[string]string) (string, error) {
+	return copyManifest(src, srcPath, reference, dst, dstPath, reference, annotations)
+}
+
+// copyManifest copies manifest (with everything it references) identified by source reference to the destination one
+// (See AnnotatedManifest), e.g. image selected from the index by its digest to the tag
+func copyManifest(src *client.RegistryClient, srcPath, srcReference string, dst Destination, dstPath, reference string, annotations map[string]string) (string, error) {
+	data, mediaType, digest, err := src.ManifestData(srcPath, srcReference)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.Contains(srcReference, ":") && srcReference != digest {
+		return "", fmt.Errorf("manifest digest mismatch: expected %s, got %s", srcReference, digest)
+	}
+
+	if err := verifyManifest(data, mediaType, digest); err != nil {
+		return "", fmt.Errorf("%s: %s@%s", err.Error(), srcPath, srcReference)
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return "", err
+	}
+
+	if len(annotations) != 0 && content.MediaType != manifest.MediaTypeOCIManifest && content.MediaType != manifest.MediaTypeOCIIndex {
+		return "", fmt.Errorf("unable to annotate %s manifest (only OCI ones could be annotated): %s@%s", content.MediaType, srcPath, digest)
+	}
+
+	if content.IsSchema1() {
+		layers := make([]manifest.Descriptor, len(content.FSLayers))
+		for i, l := range content.FSLayers {
+			layers[i] = manifest.Descriptor{Digest: l.BlobSum, Size: -1}
+		}
+
+		if err := blobs(src, srcPath, dst, dstPath, layers); err != nil {
+			return "", err
+		}
+	} else if content.IsIndex() {
+		for _, d := range content.Manifests {
+			if _, err := Manifest(src, srcPath, dst, dstPath, d.Digest); err != nil {
+				return "", err
+			}
+		}
+	} else {
+		if content.Config == nil {
+			return "", fmt.Errorf("unsupported manifest (no config): %s@%s", srcPath, digest)
+		}
+
+		local := make([]manifest.Descriptor, 0, len(content.Layers)+1)
+		for _, d := range append([]manifest.Descriptor{*content.Config}, content.Layers...) {
+			if d.IsForeign() {
+				log.Infof("FOREIGN %s@%s (not copied, stays at: %s)", srcPath, d.Digest, strings.Join(d.URLs, ", "))
+
+				continue
+			}
+
+			local = append(local, d)
+		}
+
+		if err := blobs(src, srcPath, dst, dstPath, local); err != nil {
+			return "", err
+		}
+	}
+
+	if len(annotations) != 0 {
+		data, err = annotate(data, annotations)
+		if err != nil {
+			return "", err
+		}
+
+		digest = fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		if strings.Contains(reference, ":") {
+			reference = digest
+		}
+	}
+
+	if err := dst.PutManifest(dstPath, reference, content.MediaType, data); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// PlatformCopy describes image copied from a multi-arch tag for a single platform (See PlatformManifest)
+type PlatformCopy struct {
+	// ImageDigest is a digest of the single-platform image manifest destination tag points at
+	ImageDigest string
+	// IndexDigest is a digest of the source manifest list/index the image was selected from ("" for a single-arch tag)
+	IndexDigest string
+	// IndexReference is a destination reference the whole index was copied under ("" if it was not copied)
+	IndexReference string
+}
+
+// PlatformManifest copies only the image for the platform passed from the multi-arch tag (manifest list/index),
+// so destination tag points at the single-platform image manifest. If index reference is passed (e.g. "latest-multiarch"),
+// the whole index (with images for all platforms) is copied under it too, keeping its original digest.
+// NB! Single-arch tag is copied as is (and there is no index to copy).
+func PlatformManifest(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, reference string, platform manifest.Platform, indexReference string) (*PlatformCopy, error) {
+	data, mediaType, digest, err := src.ManifestData(srcPath, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !content.IsIndex() {
+		imageDigest, err := copyManifest(src, srcPath, digest, dst, dstPath, reference, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		return &PlatformCopy{ImageDigest: imageDigest}, nil
+	}
+
+	d := content.SelectManifest(platform)
+	if d == nil {
+		return nil, fmt.Errorf("no image for platform %s: %s:%s", platform, srcPath, reference)
+	}
+
+	imageDigest, err := copyManifest(src, srcPath, d.Digest, dst, dstPath, reference, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &PlatformCopy{ImageDigest: imageDigest, IndexDigest: digest}
+
+	if indexReference != "" {
+		if _, err := copyManifest(src, srcPath, digest, dst, dstPath, indexReference, nil); err != nil {
+			return nil, err
+		}
+
+		pc.IndexReference = indexReference
+	}
+
+	return pc, nil
+}
+
+// annotate adds annotations passed to the manifest data, preserving all manifest fields and annotations already present
+func annotate(data []byte, annotations map[string]string) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]string)
+	if raw, defined := fields["annotations"]; defined {
+		if err := json.Unmarshal(raw, &merged); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range annotations {
+		if _, defined := merged[k]; defined {
+			log.Debugf("annotation already present, not overwritten: %s", k)
+
+			continue
+		}
+
+		merged[k] = v
+	}
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	fields["annotations"] = raw
+
+	return json.Marshal(fields)
+}
+
+// Referrers copies all manifests referring to the manifest with digest passed (signatures, SBOMs, attestations),
+// as well as manifests referring to them (e.g. signatures of SBOMs). Returns number of manifests copied.
+func Referrers(src *client.RegistryClient, srcPath string, dst Destination, dstPath string, digest string) (int, error) {
+	referrers, err := src.Referrers(srcPath, digest)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for _, d := range referrers {
+		if _, err := Manifest(src, srcPath, dst, dstPath, d.Digest); err != nil {
+			return count, err
+		}
+		count++
+
+		n, err := Referrers(src, srcPath, dst, dstPath, d.Digest)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
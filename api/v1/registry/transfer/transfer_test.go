@@ -0,0 +1,723 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/tag/manifest"
+	"github.com/ivanilves/lstags/util/throttle"
+)
+
+// registry is a minimal in-memory implementation of the distribution API (enough to copy content around)
+type registry struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	types     map[string]string
+	uploads   int
+	mux       sync.Mutex
+}
+
+func newRegistry() *registry {
+	return &registry{
+		blobs:     make(map[string][]byte),
+		manifests: make(map[string][]byte),
+		types:     make(map[string]string),
+	}
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func (r *registry) addBlob(data []byte) manifest.Descriptor {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	d := digestOf(data)
+	r.blobs[d] = data
+
+	return manifest.Descriptor{MediaType: "application/octet-stream", Digest: d, Size: int64(len(data))}
+}
+
+func (r *registry) addManifest(repoPath, tagName string, content manifest.Content) manifest.Descriptor {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	data, _ := json.Marshal(content)
+	d := digestOf(data)
+
+	r.manifests[repoPath+"@"+d] = data
+	r.types[repoPath+"@"+d] = content.MediaType
+	if tagName != "" {
+		r.manifests[repoPath+":"+tagName] = data
+		r.types[repoPath+":"+tagName] = content.MediaType
+	}
+
+	return manifest.Descriptor{MediaType: content.MediaType, Digest: d, Size: int64(len(data)), ArtifactType: content.ArtifactType}
+}
+
+func (r *registry) referrers(repoPath, digest string) manifest.Content {
+	index := manifest.Content{SchemaVersion: 2, MediaType: manifest.MediaTypeOCIIndex, Manifests: []manifest.Descriptor{}}
+
+	for key, data := range r.manifests {
+		if !strings.HasPrefix(key, repoPath+"@") {
+			continue
+		}
+
+		c, _ := manifest.ParseContent(r.types[key], data)
+		if c.Subject != nil && c.Subject.Digest == digest {
+			index.Manifests = append(index.Manifests, manifest.Descriptor{
+				MediaType:    c.MediaType,
+				Digest:       digestOf(data),
+				Size:         int64(len(data)),
+				ArtifactType: c.ArtifactType,
+			})
+		}
+	}
+
+	return index
+}
+
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+
+	if path == "" {
+		w.Write([]byte("{}"))
+		return
+	}
+
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		parts := strings.SplitN(path, "/manifests/", 2)
+		key := parts[0] + ":" + parts[1]
+		if strings.Contains(parts[1], ":") {
+			key = parts[0] + "@" + parts[1]
+		}
+
+		if req.Method == "PUT" {
+			data, _ := ioutil.ReadAll(req.Body)
+			d := digestOf(data)
+
+			r.manifests[parts[0]+"@"+d] = data
+			r.types[parts[0]+"@"+d] = req.Header.Get("Content-Type")
+			r.manifests[key] = data
+			r.types[key] = req.Header.Get("Content-Type")
+
+			w.Header().Set("Docker-Content-Digest", d)
+			w.WriteHeader(201)
+			return
+		}
+
+		data, defined := r.manifests[key]
+		if !defined {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Content-Type", r.types[key])
+		w.Header().Set("Docker-Content-Digest", digestOf(data))
+		w.Write(data)
+	case strings.Contains(path, "/referrers/"):
+		parts := strings.SplitN(path, "/referrers/", 2)
+
+		w.Header().Set("Content-Type", manifest.MediaTypeOCIIndex)
+		json.NewEncoder(w).Encode(r.referrers(parts[0], parts[1]))
+	case strings.HasSuffix(path, "/blobs/uploads/"):
+		w.Header().Set("Location", "/v2/"+path+"session")
+		w.WriteHeader(202)
+	case strings.HasSuffix(path, "/blobs/uploads/session"):
+		data, _ := ioutil.ReadAll(req.Body)
+		if digestOf(data) != req.URL.Query().Get("digest") {
+			w.WriteHeader(400)
+			return
+		}
+
+		r.blobs[digestOf(data)] = data
+		r.uploads++
+		w.WriteHeader(201)
+	case strings.Contains(path, "/blobs/"):
+		data, defined := r.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !defined {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		if req.Method == "GET" {
+			w.Write(data)
+		}
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func connect(t *testing.T, server *httptest.Server) *client.RegistryClient {
+	cli, err := client.New(strings.TrimPrefix(server.URL, "http://"), client.Config{IsInsecure: true})
+	if err != nil {
+		t.Fatalf("Unable to create registry client: %s", err.Error())
+	}
+
+	if err := cli.Login("", ""); err != nil {
+		t.Fatalf("Unable to log in to registry: %s", err.Error())
+	}
+
+	return cli
+}
+
+func TestManifest(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"architecture":"amd64"}`))
+	layer := srcRegistry.addBlob([]byte("layer"))
+	image := srcRegistry.addManifest("foo/bar", "", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+		Layers:        []manifest.Descriptor{layer},
+	})
+	index := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIIndex,
+		Manifests:     []manifest.Descriptor{image},
+	})
+
+	dstRegistry.addBlob([]byte("layer"))
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	digest, err := Manifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "latest")
+
+	assert.Nil(err, "should be no error")
+	assert.Equal(index.Digest, digest, "should keep manifest digest")
+
+	assert.Equal(srcRegistry.manifests["foo/bar:latest"], dstRegistry.manifests["mirror/bar:latest"], "should copy tagged manifest as is")
+	assert.Contains(dstRegistry.manifests, "mirror/bar@"+image.Digest, "should copy child manifest")
+	assert.Contains(dstRegistry.blobs, config.Digest, "should copy config blob")
+	assert.Equal(1, dstRegistry.uploads, "should NOT upload blob already present")
+}
+
+func TestManifest_Incremental(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	// every image version has its own config and application layer on top of the base layer shared
+	sizes := make(map[string]int64)
+
+	base := srcRegistry.addBlob([]byte(strings.Repeat("base", 256)))
+	for i, tagName := range []string{"v1", "v2"} {
+		config := srcRegistry.addBlob([]byte(fmt.Sprintf(`{"architecture":"amd64","version":%d}`, i+1)))
+		layer := srcRegistry.addBlob([]byte("app " + tagName))
+
+		sizes[tagName] = config.Size + layer.Size
+
+		srcRegistry.addManifest("foo/bar", tagName, manifest.Content{
+			SchemaVersion: 2,
+			MediaType:     manifest.MediaTypeOCIManifest,
+			Config:        &config,
+			Layers:        []manifest.Descriptor{base, layer},
+		})
+	}
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	src, dst := connect(t, srcServer), connect(t, dstServer)
+
+	ResetStats()
+
+	_, err := Manifest(src, "foo/bar", dst, "mirror/bar", "v1")
+	assert.Nil(err)
+	assert.Equal(3, dstRegistry.uploads)
+	assert.Equal(Stats{Copied: 3, CopiedBytes: base.Size + sizes["v1"]}, GetStats())
+
+	ResetStats()
+
+	_, err = Manifest(src, "foo/bar", dst, "mirror/bar", "v2")
+	assert.Nil(err)
+	assert.Equal(5, dstRegistry.uploads, "should upload only blobs changed")
+	assert.Equal(Stats{Copied: 2, CopiedBytes: sizes["v2"], Skipped: 1, SavedBytes: base.Size}, GetStats(), "should count bytes saved")
+}
+
+func TestPlatformManifest(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	images := make(map[string]manifest.Descriptor)
+	for _, arch := range []string{"amd64", "arm64"} {
+		config := srcRegistry.addBlob([]byte(`{"architecture":"` + arch + `"}`))
+		layer := srcRegistry.addBlob([]byte("layer-" + arch))
+
+		image := srcRegistry.addManifest("foo/bar", "", manifest.Content{
+			SchemaVersion: 2,
+			MediaType:     manifest.MediaTypeOCIManifest,
+			Config:        &config,
+			Layers:        []manifest.Descriptor{layer},
+		})
+		image.Platform = &manifest.Platform{OS: "linux", Architecture: arch}
+
+		images[arch] = image
+	}
+	index := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIIndex,
+		Manifests:     []manifest.Descriptor{images["amd64"], images["arm64"]},
+	})
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	src, dst := connect(t, srcServer), connect(t, dstServer)
+	platform := manifest.Platform{OS: "linux", Architecture: "arm64"}
+
+	pc, err := PlatformManifest(src, "foo/bar", dst, "mirror/bar", "latest", platform, "")
+	assert.Nil(err)
+	assert.Equal(&PlatformCopy{ImageDigest: images["arm64"].Digest, IndexDigest: index.Digest}, pc, "should report both digests")
+	assert.Equal(
+		srcRegistry.manifests["foo/bar@"+images["arm64"].Digest], dstRegistry.manifests["mirror/bar:latest"],
+		"should tag single-platform image manifest",
+	)
+	assert.NotContains(dstRegistry.manifests, "mirror/bar@"+images["amd64"].Digest, "should NOT copy images of other platforms")
+
+	pc, err = PlatformManifest(src, "foo/bar", dst, "mirror/bar", "latest", platform, "latest-multiarch")
+	assert.Nil(err)
+	assert.Equal("latest-multiarch", pc.IndexReference)
+	assert.Equal(srcRegistry.manifests["foo/bar:latest"], dstRegistry.manifests["mirror/bar:latest-multiarch"], "should copy index as is")
+	assert.Contains(dstRegistry.manifests, "mirror/bar@"+images["amd64"].Digest, "should copy images of all platforms with index")
+
+	_, err = PlatformManifest(src, "foo/bar", dst, "mirror/bar", "latest", manifest.Platform{OS: "linux", Architecture: "s390x"}, "")
+	assert.NotNil(err, "should fail, if there is no image for platform")
+
+	pc, err = PlatformManifest(src, "foo/bar", dst, "mirror/bar", images["amd64"].Digest, platform, "latest-multiarch")
+	assert.Nil(err)
+	assert.Equal(&PlatformCopy{ImageDigest: images["amd64"].Digest}, pc, "should copy single-arch image as is")
+}
+
+func TestAnnotatedManifest(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"architecture":"amd64"}`))
+	layer := srcRegistry.addBlob([]byte("layer"))
+	image := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+		Layers:        []manifest.Descriptor{layer},
+		Annotations:   map[string]string{"org.opencontainers.image.source": "https://git.company.io/foo/bar"},
+	})
+	srcRegistry.addManifest("foo/bar", "docker", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeDockerV2,
+		Config:        &config,
+		Layers:        []manifest.Descriptor{layer},
+	})
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	annotations := map[string]string{
+		"org.opencontainers.image.source": "https://registry.company.io/foo/bar",
+		"io.lstags.mirrored":              "2026-10-15T00:00:00Z",
+	}
+
+	digest, err := AnnotatedManifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "latest", annotations)
+
+	assert.Nil(err, "should be no error")
+	assert.NotEqual(image.Digest, digest, "should give a new digest of the annotated manifest")
+	assert.Equal(digestOf(dstRegistry.manifests["mirror/bar:latest"]), digest)
+
+	content, err := manifest.ParseContent(manifest.MediaTypeOCIManifest, dstRegistry.manifests["mirror/bar:latest"])
+
+	assert.Nil(err)
+	assert.Equal(
+		map[string]string{
+			"org.opencontainers.image.source": "https://git.company.io/foo/bar",
+			"io.lstags.mirrored":              "2026-10-15T00:00:00Z",
+		},
+		content.Annotations,
+		"should add annotations configured, preserving existing ones",
+	)
+	assert.Equal(layer.Digest, content.Layers[0].Digest, "should preserve manifest content")
+
+	digest, err = AnnotatedManifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", image.Digest, annotations)
+
+	assert.Nil(err, "should be no error")
+	assert.Contains(dstRegistry.manifests, "mirror/bar@"+digest, "should put manifest by its new digest, if copied by digest")
+
+	_, err = AnnotatedManifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "docker", annotations)
+
+	assert.NotNil(err, "should NOT annotate Docker manifest")
+}
+
+func TestManifest_ForeignLayers(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"os":"windows"}`))
+	layer := srcRegistry.addBlob([]byte("layer"))
+	srcRegistry.addManifest("foo/windows", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeDockerV2,
+		Config:        &config,
+		Layers: []manifest.Descriptor{
+			{
+				MediaType: manifest.MediaTypeDockerForeignLayer,
+				Digest:    digestOf([]byte("foreign")),
+				Size:      7,
+				URLs:      []string{"https://mcr.microsoft.com/v2/windows/servercore/blobs/" + digestOf([]byte("foreign"))},
+			},
+			{
+				MediaType: manifest.MediaTypeOCIForeignLayer + "+gzip",
+				Digest:    digestOf([]byte("nondistributable")),
+				Size:      16,
+			},
+			layer,
+		},
+	})
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	_, err := Manifest(connect(t, srcServer), "foo/windows", connect(t, dstServer), "mirror/windows", "latest")
+
+	assert.Nil(err, "should not try to copy foreign layers")
+	assert.Equal(2, dstRegistry.uploads, "should copy only config and non-foreign layer")
+	assert.Equal(srcRegistry.manifests["foo/windows:latest"], dstRegistry.manifests["mirror/windows:latest"], "should keep foreign layer URLs")
+}
+
+func TestManifest_Verbatim(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	// config and manifest are NOT in canonical form (key order, whitespace), re-serializing them would change their digests
+	configData := []byte(`{ "os": "linux",  "architecture": "amd64", "created": "2020-01-01T00:00:00Z",` + "\n" +
+		`  "history": [ { "created_by": "/bin/sh -c #(nop) ADD file:... in / " } ] }`)
+	config := srcRegistry.addBlob(configData)
+	layer := srcRegistry.addBlob([]byte("layer"))
+
+	data := []byte(`{` + "\n" + `   "schemaVersion": 2, "mediaType": "` + manifest.MediaTypeOCIManifest + `",` + "\n" +
+		`   "layers": [ { "size": 5, "digest": "` + layer.Digest + `", "mediaType": "application/octet-stream" } ],` + "\n" +
+		`   "config": { "mediaType": "` + manifest.MediaTypeOCIConfig + `", "digest": "` + config.Digest + `", "size": ` + fmt.Sprintf("%d", config.Size) + ` }` + "\n" +
+		`}`)
+	srcRegistry.manifests["foo/bar:latest"] = data
+	srcRegistry.types["foo/bar:latest"] = manifest.MediaTypeOCIManifest
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	digest, err := Manifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "latest")
+
+	assert.Nil(err, "should be no error")
+	assert.Equal(digestOf(data), digest, "should keep manifest digest")
+	assert.Equal(data, dstRegistry.manifests["mirror/bar:latest"], "should copy manifest byte for byte")
+	assert.Equal(configData, dstRegistry.blobs[config.Digest], "should copy config (with history and creation date) byte for byte")
+}
+
+// laxDestination stores whatever it gets, never verifying digests (unlike registries and OCI layouts)
+type laxDestination struct {
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (d *laxDestination) BlobExists(_, digest string) (bool, error) {
+	_, exists := d.blobs[digest]
+
+	return exists, nil
+}
+
+func (d *laxDestination) UploadBlob(_, digest string, _ int64, content io.Reader) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	d.blobs[digest] = data
+
+	return nil
+}
+
+func (d *laxDestination) PutManifest(_, reference, _ string, data []byte) error {
+	d.manifests[reference] = data
+
+	return nil
+}
+
+func TestManifest_DigestMismatch(t *testing.T) {
+	srcRegistry := newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"architecture":"amd64"}`))
+	image := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+	})
+
+	srcServer := httptest.NewServer(srcRegistry)
+	defer srcServer.Close()
+
+	assert := assert.New(t)
+
+	// destination registry storing manifest under another digest (i.e. not byte for byte)
+	dstServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && strings.Contains(r.URL.Path, "/manifests/") {
+			w.Header().Set("Docker-Content-Digest", digestOf([]byte("re-serialized")))
+			w.WriteHeader(201)
+			return
+		}
+
+		newRegistry().ServeHTTP(w, r)
+	}))
+	defer dstServer.Close()
+
+	_, err := Manifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "latest")
+
+	assert.NotNil(err, "should fail, if destination stored manifest under another digest")
+
+	dst := &laxDestination{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+
+	// source registry serving manifest not matching the digest requested
+	srcRegistry.manifests["foo/bar@"+digestOf([]byte("another"))] = srcRegistry.manifests["foo/bar@"+image.Digest]
+
+	_, err = Manifest(connect(t, srcServer), "foo/bar", dst, "mirror/bar", digestOf([]byte("another")))
+
+	assert.NotNil(err, "should fail, if source manifest does not match its digest")
+	assert.Empty(dst.manifests, "should not put manifest not matching its digest")
+
+	// source registry serving config blob not matching its digest (e.g. re-serialized)
+	srcRegistry.blobs[config.Digest] = []byte(`{"architecture": "amd64"}`)
+
+	_, err = Manifest(connect(t, srcServer), "foo/bar", dst, "mirror/bar", "latest")
+
+	assert.NotNil(err, "should fail, if source config blob does not match its digest")
+	assert.NotContains(dst.manifests, "latest", "should not put manifest referencing blob failed")
+}
+
+func TestBlob_ChunkedDigestMismatch(t *testing.T) {
+	defer func(size int64) { client.UploadChunkSize = size }(client.UploadChunkSize)
+	client.UploadChunkSize = 4
+
+	srcRegistry := newRegistry()
+
+	// source registry serving layer blob not matching its digest, but having exactly the size expected
+	layer := srcRegistry.addBlob([]byte("layer-data"))
+	srcRegistry.blobs[layer.Digest] = []byte("LAYER-DATA")
+
+	srcServer := httptest.NewServer(srcRegistry)
+	defer srcServer.Close()
+
+	var puts int
+
+	// destination registry accepting blob uploaded in chunks, never verifying its digest
+	dstServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const location = "/v2/mirror/bar/blobs/uploads/session"
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.Write([]byte("{}"))
+		case r.Method == "POST":
+			w.Header().Set("Location", location)
+			w.Header().Set("Range", "0-0")
+			w.WriteHeader(202)
+		case r.Method == "PATCH":
+			var start, end int
+			fmt.Sscanf(r.Header.Get("Content-Range"), "%d-%d", &start, &end)
+
+			w.Header().Set("Location", location)
+			w.Header().Set("Range", fmt.Sprintf("0-%d", end))
+			w.WriteHeader(202)
+		case r.Method == "PUT":
+			puts++
+			w.WriteHeader(201)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	err := Blob(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", layer)
+
+	assert.NotNil(err, "should fail, if source blob uploaded in chunks does not match its digest")
+	assert.Equal(0, puts, "should not complete upload of blob not matching its digest")
+}
+
+func TestBlob_Cancel(t *testing.T) {
+	defer func(l *throttle.Limiter) { Limiter = l }(Limiter)
+	Limiter = throttle.New(1)
+
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	layer := srcRegistry.addBlob([]byte("layer-data"))
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := Blob(connect(t, srcServer).WithContext(ctx), "foo/bar", connect(t, dstServer), "mirror/bar", layer)
+
+	assert.NotNil(err, "should abort copy, once context is done")
+	assert.True(time.Since(start) < 5*time.Second, "should not wait for the limiter (10 bytes at 1 byte/s), once context is done")
+	assert.Empty(dstRegistry.blobs, "should not copy blob")
+}
+
+func TestManifest_LayerConcurrency(t *testing.T) {
+	srcRegistry := newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{"architecture":"amd64"}`))
+	layers := make([]manifest.Descriptor, 0)
+	for i := 0; i < 6; i++ {
+		layers = append(layers, srcRegistry.addBlob([]byte(fmt.Sprintf("layer%d", i))))
+	}
+	layers = append(layers, layers[0])
+	srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+		Layers:        layers,
+	})
+
+	var inflight, maxInflight int
+	var mux sync.Mutex
+
+	srcServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" && strings.Contains(req.URL.Path, "/blobs/") {
+			mux.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			mux.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			mux.Lock()
+			inflight--
+			mux.Unlock()
+		}
+
+		srcRegistry.ServeHTTP(w, req)
+	}))
+	defer srcServer.Close()
+
+	defer func(concurrency int) { LayerConcurrency = concurrency }(LayerConcurrency)
+
+	assert := assert.New(t)
+
+	for _, concurrency := range []int{1, 3} {
+		LayerConcurrency = concurrency
+		maxInflight = 0
+
+		dstRegistry := newRegistry()
+		dstServer := httptest.NewServer(dstRegistry)
+
+		_, err := Manifest(connect(t, srcServer), "foo/bar", connect(t, dstServer), "mirror/bar", "latest")
+
+		dstServer.Close()
+
+		assert.Nil(err, "should be no error (concurrency: %d)", concurrency)
+		assert.Equal(7, dstRegistry.uploads, "should upload every unique blob once (concurrency: %d)", concurrency)
+		assert.Equal(concurrency, maxInflight, "unexpected number of blobs copied in parallel")
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	srcRegistry, dstRegistry := newRegistry(), newRegistry()
+
+	config := srcRegistry.addBlob([]byte(`{}`))
+	image := srcRegistry.addManifest("foo/bar", "latest", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		Config:        &config,
+	})
+
+	signatureData := srcRegistry.addBlob([]byte("signature"))
+	signature := srcRegistry.addManifest("foo/bar", "", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		ArtifactType:  "application/vnd.dev.cosign.artifact.sig.v1+json",
+		Config:        &config,
+		Layers:        []manifest.Descriptor{signatureData},
+		Subject:       &image,
+	})
+
+	sbomData := srcRegistry.addBlob([]byte("sbom"))
+	sbom := srcRegistry.addManifest("foo/bar", "", manifest.Content{
+		SchemaVersion: 2,
+		MediaType:     manifest.MediaTypeOCIManifest,
+		ArtifactType:  "application/spdx+json",
+		Config:        &config,
+		Layers:        []manifest.Descriptor{sbomData},
+		Subject:       &signature,
+	})
+
+	srcServer, dstServer := httptest.NewServer(srcRegistry), httptest.NewServer(dstRegistry)
+	defer srcServer.Close()
+	defer dstServer.Close()
+
+	assert := assert.New(t)
+
+	count, err := Referrers(connect(t, srcServer), "foo/bar", connect(t, dstServer), "foo/bar", image.Digest)
+
+	assert.Nil(err, "should be no error")
+	assert.Equal(2, count, "should copy referrers recursively")
+
+	assert.Contains(dstRegistry.manifests, "foo/bar@"+signature.Digest, "should copy signature")
+	assert.Contains(dstRegistry.manifests, "foo/bar@"+sbom.Digest, "should copy referrer of signature")
+	assert.Contains(dstRegistry.blobs, signatureData.Digest, "should copy referrer blobs")
+}
+
+func TestReferrers_NotSupported(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	cli := connect(t, server)
+
+	count, err := Referrers(cli, "foo/bar", cli, "foo/bar", digestOf([]byte("nothing")))
+
+	assert.Nil(t, err, "should be no error, if referrers API is not supported")
+	assert.Equal(t, 0, count)
+}
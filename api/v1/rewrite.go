@@ -0,0 +1,210 @@
+package v1
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ivanilves/lstags/repository"
+)
+
+// Ref is an image reference split into its parts: registry ADDR[:PORT], repository path and tag
+// NB! Source references also carry tag metadata (digest and creation date), so rewriters could use them.
+type Ref struct {
+	Registry string
+	Path     string
+	Tag      string
+	Digest   string
+	Created  int64
+}
+
+// Repository gives repository part of the reference: "REGISTRY/PATH"
+func (r Ref) Repository() string {
+	return r.Registry + "/" + r.Path
+}
+
+// String gives reference in a "REGISTRY/PATH:TAG" form (or "REGISTRY/PATH", if there is no tag)
+func (r Ref) String() string {
+	if r.Tag == "" {
+		return r.Repository()
+	}
+
+	return r.Repository() + ":" + r.Tag
+}
+
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pulling-manifests
+var (
+	refPathRE = regexp.MustCompile(`^[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*(/[a-z0-9]+((\.|_|__|-+)[a-z0-9]+)*)*$`)
+	refTagRE  = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9._-]{0,127}$`)
+)
+
+// Validate checks if reference is a valid one (tag is checked only if it is set)
+func (r Ref) Validate() error {
+	if r.Registry == "" || strings.ContainsAny(r.Registry, "/ ") {
+		return fmt.Errorf("invalid registry in reference: %s", r)
+	}
+
+	if !refPathRE.MatchString(r.Path) {
+		return fmt.Errorf("invalid repository path in reference: %s (should match %s)", r, refPathRE)
+	}
+
+	if r.Tag != "" && !refTagRE.MatchString(r.Tag) {
+		return fmt.Errorf("invalid tag in reference: %s (should match %s)", r, refTagRE)
+	}
+
+	return nil
+}
+
+// RefRewriter computes destination ("push") image reference from the source one
+// NB! Source tag is empty, when we need to know only destination repository (e.g. to list tags present there).
+type RefRewriter func(src Ref) (Ref, error)
+
+// DefaultRefRewriter gives RefRewriter implementing push prefix, path and tag templates of the push config passed
+// NB! It could be wrapped by custom rewriters, e.g. to lowercase paths built with the default strategy.
+func DefaultRefRewriter(push PushConfig) (RefRewriter, error) {
+	if push.PathTemplate == "" {
+		push.PathTemplate = "{{ .Prefix }}{{ .Path }}"
+	}
+	if push.TagTemplate == "" {
+		push.TagTemplate = "{{ .Tag }}"
+	}
+	if push.PathSeparator == "" {
+		push.PathSeparator = "/"
+	}
+
+	if err := validatePushRoutes(push.Routes); err != nil {
+		return nil, err
+	}
+
+	pushPathTemplate, err := makePushPathTemplate(push)
+	if err != nil {
+		return nil, err
+	}
+	pushTagTemplate, err := makePushTagTemplate(push)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(src Ref) (Ref, error) {
+		repo, err := repository.ParseRef(src.Repository())
+		if err != nil {
+			return Ref{}, err
+		}
+
+		name := repo.Name()
+		if repo.IsDefaultRegistry() {
+			name = strings.TrimPrefix(name, "library/")
+		}
+
+		pushRegistry, prefix, err := routePush(push, src.Registry)
+		if err != nil {
+			return Ref{}, err
+		}
+
+		pushPrefix := getPushPrefix(prefix, repo.PushPrefix())
+		if err := validatePushPrefix(pushPrefix); err != nil {
+			return Ref{}, err
+		}
+		pushPath := repo.PushPath(push.PathSeparator)
+
+		fullPath, err := pushPathTemplate(pushPrefix, pushPath, name)
+		if err != nil {
+			return Ref{}, err
+		}
+
+		dst := Ref{Registry: pushRegistry, Path: strings.TrimPrefix(fullPath, "/")}
+
+		if src.Tag != "" {
+			dst.Tag, err = pushTagTemplate(pushPrefix, pushPath, name, src)
+			if err != nil {
+				return Ref{}, err
+			}
+		}
+
+		return dst, nil
+	}, nil
+}
+
+// PushRoute makes us push images from source registries matching the pattern to the registry (and with the prefix) of its own
+type PushRoute struct {
+	// Source is a source registry pattern, e.g. "quay.io" or "*.gcr.io" (See path.Match)
+	Source string
+	// Registry is a registry we push images from matching source registries into
+	Registry string
+	// Prefix is prepended to the repository path while pushing (if not set, push config prefix is used)
+	Prefix string
+}
+
+func validatePushRoutes(routes []PushRoute) error {
+	for _, route := range routes {
+		if _, err := path.Match(route.Source, ""); err != nil || route.Source == "" {
+			return fmt.Errorf("invalid source registry pattern in push route: '%s'", route.Source)
+		}
+
+		if route.Registry == "" || strings.ContainsAny(route.Registry, "/ ") {
+			return fmt.Errorf("invalid registry in push route for '%s': '%s'", route.Source, route.Registry)
+		}
+	}
+
+	return nil
+}
+
+// routePush gives "push" registry and prefix for the source registry: ones of the only push route matching it,
+// or push config (default) ones, if no route matches
+func routePush(push PushConfig, registry string) (string, string, error) {
+	matched := make([]string, 0)
+	var route PushRoute
+
+	for _, r := range push.Routes {
+		if ok, _ := path.Match(r.Source, registry); ok {
+			matched = append(matched, r.Source)
+			route = r
+		}
+	}
+
+	switch {
+	case len(matched) > 1:
+		return "", "", fmt.Errorf("source registry %s matches more than one push route: %s", registry, strings.Join(matched, ", "))
+	case len(matched) == 1:
+		if route.Prefix == "" {
+			return route.Registry, push.Prefix, nil
+		}
+
+		return route.Registry, route.Prefix, nil
+	case len(push.Routes) != 0 && push.Registry == "":
+		return "", "", fmt.Errorf("source registry %s matches no push route (and there is no default push registry)", registry)
+	}
+
+	return push.Registry, push.Prefix, nil
+}
+
+// makeRefRewriter gives RefRewriter configured (or the default one), making sure references it gives are valid
+func makeRefRewriter(push PushConfig) (RefRewriter, error) {
+	rewrite := push.RefRewriter
+	if rewrite == nil {
+		var err error
+
+		rewrite, err = DefaultRefRewriter(push)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(src Ref) (Ref, error) {
+		dst, err := rewrite(src)
+		if err != nil {
+			return Ref{}, fmt.Errorf("unable to rewrite reference %s: %s", src, err.Error())
+		}
+
+		if src.Tag != "" && dst.Tag == "" {
+			return Ref{}, fmt.Errorf("reference %s rewritten with no tag: %s", src, dst)
+		}
+
+		if err := dst.Validate(); err != nil {
+			return Ref{}, err
+		}
+
+		return dst, nil
+	}, nil
+}
@@ -0,0 +1,162 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRefRewriter(t *testing.T) {
+	var testCases = []struct {
+		push PushConfig
+		src  Ref
+		dst  string
+	}{
+		{
+			PushConfig{Registry: "localhost:5000"},
+			Ref{Registry: "registry.hub.docker.com", Path: "library/alpine", Tag: "3.7"},
+			"localhost:5000/registry/hub/docker/com/library/alpine:3.7",
+		},
+		{
+			PushConfig{Registry: "localhost:5000", Prefix: "mirror"},
+			Ref{Registry: "quay.io", Path: "calico/ctl", Tag: "v1.6.1"},
+			"localhost:5000/mirror/calico/ctl:v1.6.1",
+		},
+		{
+			PushConfig{Registry: "localhost:5000", Prefix: "/", PathSeparator: "-"},
+			Ref{Registry: "gcr.io", Path: "google_containers/pause-amd64"},
+			"localhost:5000/google_containers-pause-amd64",
+		},
+		{
+			PushConfig{Registry: "localhost:5000", Prefix: "/", PathTemplate: "/mirror/{{ .Name }}", TagTemplate: "{{ .Tag }}-mirrored"},
+			Ref{Registry: "registry.hub.docker.com", Path: "library/alpine", Tag: "3.7"},
+			"localhost:5000/mirror/alpine:3.7-mirrored",
+		},
+	}
+
+	assert := assert.New(t)
+
+	for _, testCase := range testCases {
+		rewrite, err := DefaultRefRewriter(testCase.push)
+		assert.Nil(err)
+
+		dst, err := rewrite(testCase.src)
+
+		assert.Nil(err, "should be no error (src: %s)", testCase.src)
+		assert.Equal(testCase.dst, dst.String(), "unexpected push reference (src: %s)", testCase.src)
+	}
+
+	rewrite, _ := DefaultRefRewriter(PushConfig{Registry: "localhost:5000", Prefix: "/Invalid/"})
+
+	_, err := rewrite(Ref{Registry: "quay.io", Path: "calico/ctl", Tag: "v1.6.1"})
+
+	assert.NotNil(err, "should be an error for invalid push prefix")
+}
+
+func TestDefaultRefRewriter_Routes(t *testing.T) {
+	assert := assert.New(t)
+
+	routes := []PushRoute{
+		{Source: "quay.io", Registry: "registry-a.company.io", Prefix: "/quay/"},
+		{Source: "*.gcr.io", Registry: "registry-b.company.io"},
+		{Source: "gcr.io", Registry: "registry-b.company.io"},
+	}
+
+	rewrite, err := DefaultRefRewriter(PushConfig{Registry: "localhost:5000", Prefix: "/mirror/", Routes: routes})
+	assert.Nil(err)
+
+	var testCases = map[string]string{
+		"quay.io/calico/ctl:v1.6.1":        "registry-a.company.io/quay/calico/ctl:v1.6.1",
+		"gcr.io/google_containers/pause:3": "registry-b.company.io/mirror/google_containers/pause:3",
+		"eu.gcr.io/project/app:1.0":        "registry-b.company.io/mirror/project/app:1.0",
+		"docker.io/library/alpine:3.7":     "localhost:5000/mirror/library/alpine:3.7",
+	}
+
+	for src, expected := range testCases {
+		registry := strings.SplitN(src, "/", 2)[0]
+		pathTag := strings.SplitN(strings.SplitN(src, "/", 2)[1], ":", 2)
+
+		dst, err := rewrite(Ref{Registry: registry, Path: pathTag[0], Tag: pathTag[1]})
+
+		assert.Nil(err, "should be no error (src: %s)", src)
+		assert.Equal(expected, dst.String(), "unexpected push reference (src: %s)", src)
+	}
+
+	rewrite, err = DefaultRefRewriter(PushConfig{Routes: routes})
+	assert.Nil(err)
+
+	_, err = rewrite(Ref{Registry: "docker.io", Path: "library/alpine", Tag: "3.7"})
+	assert.NotNil(err, "should be an error for source matching no route, if there is no default push registry")
+
+	rewrite, err = DefaultRefRewriter(PushConfig{Routes: append(routes, PushRoute{Source: "*.io", Registry: "localhost:5000"})})
+	assert.Nil(err)
+
+	_, err = rewrite(Ref{Registry: "quay.io", Path: "calico/ctl", Tag: "v1.6.1"})
+	assert.NotNil(err, "should be an error for source matching more than one route")
+
+	_, err = DefaultRefRewriter(PushConfig{Routes: []PushRoute{{Source: "[", Registry: "localhost:5000"}}})
+	assert.NotNil(err, "should be an error for invalid source pattern")
+
+	_, err = DefaultRefRewriter(PushConfig{Routes: []PushRoute{{Source: "quay.io"}}})
+	assert.NotNil(err, "should be an error for route with no registry")
+}
+
+func TestRefValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, r := range []Ref{
+		{Registry: "localhost:5000", Path: "foo"},
+		{Registry: "localhost:5000", Path: "foo/bar-baz/qux__1.0", Tag: "v1.0_rc-1"},
+	} {
+		assert.Nil(r.Validate(), "should be valid: %s", r)
+	}
+
+	for _, r := range []Ref{
+		{Registry: "", Path: "foo"},
+		{Registry: "localhost:5000", Path: "Foo"},
+		{Registry: "localhost:5000", Path: "/foo"},
+		{Registry: "localhost:5000", Path: "foo//bar"},
+		{Registry: "localhost:5000", Path: "foo", Tag: ".bar"},
+		{Registry: "localhost:5000", Path: "foo", Tag: strings.Repeat("x", 129)},
+	} {
+		assert.NotNil(r.Validate(), "should be invalid: %s", r)
+	}
+}
+
+func TestMakeRefRewriter(t *testing.T) {
+	assert := assert.New(t)
+
+	defaultRewriter, _ := DefaultRefRewriter(PushConfig{Registry: "localhost:5000", Prefix: "/"})
+
+	rewrite, err := makeRefRewriter(PushConfig{
+		RefRewriter: func(src Ref) (Ref, error) {
+			src.Path = strings.Replace(strings.ToLower(src.Path), "+", "-", -1)
+
+			return defaultRewriter(src)
+		},
+	})
+	assert.Nil(err)
+
+	dst, err := rewrite(Ref{Registry: "registry.company.io", Path: "Team+A/App", Tag: "latest"})
+
+	assert.Nil(err)
+	assert.Equal("localhost:5000/team-a/app:latest", dst.String())
+
+	dst, err = rewrite(Ref{Registry: "registry.company.io", Path: "Team+A/App"})
+
+	assert.Nil(err)
+	assert.Equal("localhost:5000/team-a/app", dst.String(), "should rewrite repository only, if there is no tag")
+
+	rewrite, _ = makeRefRewriter(PushConfig{RefRewriter: func(src Ref) (Ref, error) { return src, nil }})
+
+	_, err = rewrite(Ref{Registry: "registry.company.io", Path: "Team+A/App", Tag: "latest"})
+
+	assert.NotNil(err, "should validate rewritten reference")
+
+	rewrite, _ = makeRefRewriter(PushConfig{RefRewriter: func(src Ref) (Ref, error) { return Ref{Registry: "localhost:5000", Path: "foo"}, nil }})
+
+	_, err = rewrite(Ref{Registry: "registry.company.io", Path: "foo", Tag: "latest"})
+
+	assert.NotNil(err, "should not allow rewriter to lose the tag")
+}
@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag"
+)
+
+// Scanner scans images for vulnerabilities, e.g. by running Trivy or Grype against the registry (we ship no scanner)
+type Scanner interface {
+	// Scan scans image the tag references (canonical "REGISTRY/PATH:TAG", e.g. "docker.io/library/alpine:3.7")
+	// and gives us a summary of vulnerabilities found. NB! Digest passed is the one tag referenced when we collected it.
+	Scan(ctx context.Context, ref, digest string) (tag.ScanResult, error)
+}
+
+// isScannable tells us if tag could be scanned: it references an image present in registry, we know digest of
+func isScannable(tg *tag.Tag) bool {
+	if tg.GetError() != nil || tg.GetState() == "LOCAL_ONLY" || tg.GetState() == "NOT_FOUND" {
+		return false
+	}
+
+	return tg.IsImage()
+}
+
+// scanTags scans all the tags of the repository with the scanner configured (See Config.Scanner), running
+// no more than ScanConcurrency scans at once, and attaches results to the tags. Failed scans are only logged.
+func (api *API) scanTags(repo *repository.Repository, tags []*tag.Tag) []*tag.Tag {
+	if api.config.Scanner == nil {
+		return tags
+	}
+
+	var wg sync.WaitGroup
+
+	for _, tg := range tags {
+		if !isScannable(tg) {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(tg *tag.Tag) {
+			defer wg.Done()
+
+			api.scans.Acquire()
+			defer api.scans.Release()
+
+			ref := repo.Canonical() + ":" + tg.Name()
+
+			result, err := api.config.Scanner.Scan(context.Background(), ref, tg.GetDigest())
+			if err != nil {
+				log.Warnf("SCAN %s failed: %s", ref, err.Error())
+
+				return
+			}
+
+			log.Debugf("%s %s: %d vulnerabilities %+v", fn(repo.Ref()), ref, result.Total(), result.Severities)
+
+			tg.SetScanResult(&result)
+		}(tg)
+	}
+
+	wg.Wait()
+
+	return tags
+}
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/tag"
+)
+
+// fakeScanner finds one critical vulnerability in every image, except for ones tagged "broken" it fails to scan
+type fakeScanner struct {
+	refs          []string
+	inFlight      int32
+	maxInFlight   int32
+	mux           sync.Mutex
+	scannedDigest string
+}
+
+func (s *fakeScanner) Scan(ctx context.Context, ref, digest string) (tag.ScanResult, error) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt32(&s.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxInFlight, max, n) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	s.mux.Lock()
+	s.refs = append(s.refs, ref)
+	s.scannedDigest = digest
+	s.mux.Unlock()
+
+	if strings.HasSuffix(ref, ":broken") {
+		return tag.ScanResult{}, errors.New("scanner crashed")
+	}
+
+	return tag.ScanResult{Scanner: "fake", Severities: map[string]int{"CRITICAL": 1}}, nil
+}
+
+func TestCollectTags_Scanner(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["a","b","c","broken"]}`))
+		case strings.HasPrefix(r.URL.Path, "/v2/foo/manifests/"):
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Write([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	scanner := &fakeScanner{}
+
+	api, err := New(Config{Scanner: scanner, ScanConcurrency: 2})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err, "should not fail collection, if scan failed")
+
+	assert.Equal(4, len(scanner.refs))
+	assert.Contains(scanner.refs, registry+"/foo:a", "should pass canonical reference to scanner")
+	assert.Equal(digest, scanner.scannedDigest)
+	assert.Equal(int32(2), scanner.maxInFlight, "should run no more than 2 scans at once")
+
+	tags := cn.Tags(cn.Refs()[0])
+	assert.Equal(4, len(tags))
+
+	for _, tg := range tags {
+		if tg.Name() == "broken" {
+			assert.Nil(tg.GetScanResult(), "should attach no result, if scan failed")
+			continue
+		}
+
+		assert.Equal(&tag.ScanResult{Scanner: "fake", Severities: map[string]int{"CRITICAL": 1}}, tg.GetScanResult())
+		assert.Equal(1, tg.GetScanResult().Total())
+	}
+
+	api, err = New(Config{})
+	assert.Nil(err)
+
+	cn, err = api.CollectTags(registry + "/foo")
+	assert.Nil(err)
+
+	for _, tg := range cn.Tags(cn.Refs()[0]) {
+		assert.Nil(tg.GetScanResult(), "should scan nothing, if no scanner is set")
+	}
+}
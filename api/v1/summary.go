@@ -0,0 +1,179 @@
+package v1
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dockerconfig "github.com/ivanilves/lstags/docker/config"
+	"github.com/ivanilves/lstags/util/size"
+)
+
+// TagError is an error we got while pulling or pushing a particular image ("REPOSITORY:TAG")
+type TagError struct {
+	Ref string
+	Err error
+}
+
+// Error implements error interface
+func (e *TagError) Error() string {
+	return e.Ref + ": " + e.Err.Error()
+}
+
+// Unwrap gives the original error (e.g. to check its type with errors.As)
+func (e *TagError) Unwrap() error {
+	return e.Err
+}
+
+// Summary holds the outcome of a pull or push operation
+type Summary struct {
+	// Operation is a name of the operation summarized ("pull" or "push")
+	Operation string
+	// Done is a number of tags pulled or pushed
+	Done int
+	// Skipped is a number of tags we did not need to pull or push
+	Skipped int
+	// Failed is a number of tags we failed to pull or push
+	Failed int
+	// Duration is how much time the operation took
+	Duration time.Duration
+	// BudgetExhausted tells us if we stopped pulling because pull budget (bytes or images) was hit
+	BudgetExhausted bool
+	// RetriesExhausted tells us if some failures were not retried because retry budget was hit (See Config.RetryBudget)
+	RetriesExhausted bool
+	// Stopped tells us if we stopped starting new images because we were asked to stop (e.g. on signal)
+	Stopped bool
+	// CopiedBytes is a number of bytes of blobs we copied directly, i.e. without Docker daemon (e.g. exported to OCI layout)
+	CopiedBytes int64
+	// SavedBytes is a number of bytes of blobs we did not copy directly, as they were present in destination already
+	SavedBytes int64
+	// Credentials tells us how we authenticated to every registry we pushed to (registry => decision), e.g. to audit
+	// that intended credentials were used. NB! Decisions never carry secrets (See dockerconfig.AuthDecision).
+	Credentials map[string]dockerconfig.AuthDecision
+	// Errors holds errors we got for every tag we failed to pull or push
+	Errors []*TagError
+}
+
+// Add adds counters and duration of another summary to this one
+func (s *Summary) Add(other *Summary) {
+	if other == nil {
+		return
+	}
+
+	s.Done += other.Done
+	s.Skipped += other.Skipped
+	s.Failed += other.Failed
+	s.Duration += other.Duration
+	s.BudgetExhausted = s.BudgetExhausted || other.BudgetExhausted
+	s.RetriesExhausted = s.RetriesExhausted || other.RetriesExhausted
+	s.Stopped = s.Stopped || other.Stopped
+	s.CopiedBytes += other.CopiedBytes
+	s.SavedBytes += other.SavedBytes
+	s.Errors = append(s.Errors, other.Errors...)
+
+	for registry, decision := range other.Credentials {
+		if s.Credentials == nil {
+			s.Credentials = make(map[string]dockerconfig.AuthDecision)
+		}
+
+		s.Credentials[registry] = decision
+	}
+}
+
+// String gives a one-line summary, e.g. "pulled 40, skipped 10, failed 2 in 3m12s"
+func (s Summary) String() string {
+	str := fmt.Sprintf(
+		"%sed %d, skipped %d, failed %d in %v",
+		s.Operation, s.Done, s.Skipped, s.Failed, s.Duration.Round(time.Second),
+	)
+
+	if s.BudgetExhausted {
+		str += " (pull budget exhausted)"
+	}
+
+	if s.RetriesExhausted {
+		str += " (retry budget exhausted)"
+	}
+
+	if s.Stopped {
+		str += " (stopped)"
+	}
+
+	if s.CopiedBytes != 0 || s.SavedBytes != 0 {
+		str += fmt.Sprintf(" (copied %s, saved %s)", size.Format(s.CopiedBytes), size.Format(s.SavedBytes))
+	}
+
+	return str
+}
+
+// tally counts outcomes of operations running concurrently
+type tally struct {
+	started     time.Time
+	done        int64
+	skipped     int64
+	failed      int64
+	errors      []*TagError
+	credentials map[string]dockerconfig.AuthDecision
+	mux         sync.Mutex
+}
+
+func newTally() *tally {
+	return &tally{started: time.Now()}
+}
+
+func (t *tally) Done() {
+	atomic.AddInt64(&t.done, 1)
+}
+
+func (t *tally) Skipped() {
+	atomic.AddInt64(&t.skipped, 1)
+}
+
+func (t *tally) Failed(ref string, err error) {
+	atomic.AddInt64(&t.failed, 1)
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	t.errors = append(t.errors, &TagError{Ref: ref, Err: err})
+}
+
+// Authenticated records how we authenticated to the registry, explaining it only once per registry
+func (t *tally) Authenticated(registry string, explain func() dockerconfig.AuthDecision) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	if _, defined := t.credentials[registry]; defined {
+		return
+	}
+
+	if t.credentials == nil {
+		t.credentials = make(map[string]dockerconfig.AuthDecision)
+	}
+
+	t.credentials[registry] = explain()
+}
+
+func (t *tally) Summary(operation string) *Summary {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var credentials map[string]dockerconfig.AuthDecision
+	if len(t.credentials) != 0 {
+		credentials = make(map[string]dockerconfig.AuthDecision, len(t.credentials))
+		for registry, decision := range t.credentials {
+			credentials[registry] = decision
+		}
+	}
+
+	return &Summary{
+		Operation:   operation,
+		Done:        int(atomic.LoadInt64(&t.done)),
+		Skipped:     int(atomic.LoadInt64(&t.skipped)),
+		Failed:      int(atomic.LoadInt64(&t.failed)),
+		Duration:    time.Since(t.started),
+		Credentials: credentials,
+		Errors:      append([]*TagError(nil), t.errors...),
+	}
+}
@@ -0,0 +1,198 @@
+package v1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/api/v1/collection"
+	dockerconfig "github.com/ivanilves/lstags/docker/config"
+	"github.com/ivanilves/lstags/tag"
+)
+
+func TestSummary(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Summary{Operation: "pull", Done: 30, Skipped: 10, Failed: 1, Duration: 2 * time.Minute}
+
+	s.Add(&Summary{Operation: "pull", Done: 10, Failed: 1, Duration: 72 * time.Second})
+	s.Add(nil)
+
+	assert.Equal("pulled 40, skipped 10, failed 2 in 3m12s", s.String())
+
+	s.Add(&Summary{Operation: "pull", BudgetExhausted: true})
+
+	assert.Equal("pulled 40, skipped 10, failed 2 in 3m12s (pull budget exhausted)", s.String())
+
+	s.Add(&Summary{Operation: "pull", RetriesExhausted: true})
+
+	assert.Equal("pulled 40, skipped 10, failed 2 in 3m12s (pull budget exhausted) (retry budget exhausted)", s.String())
+
+	s.Add(&Summary{Operation: "pull", Stopped: true})
+
+	assert.Equal("pulled 40, skipped 10, failed 2 in 3m12s (pull budget exhausted) (retry budget exhausted) (stopped)", s.String())
+
+	s.Add(&Summary{Operation: "pull", CopiedBytes: 1024, SavedBytes: 3 * 1024 * 1024})
+
+	assert.Equal(
+		"pulled 40, skipped 10, failed 2 in 3m12s (pull budget exhausted) (retry budget exhausted) (stopped) (copied 1.0K, saved 3.0M)",
+		s.String(),
+	)
+
+	tagErr := &TagError{Ref: "alpine:3.7", Err: errors.New("manifest unknown")}
+	s.Add(&Summary{Operation: "pull", Errors: []*TagError{tagErr}})
+
+	assert.Equal([]*TagError{tagErr}, s.Errors, "should collect errors of particular tags")
+	assert.Equal("alpine:3.7: manifest unknown", tagErr.Error())
+}
+
+func TestPullTagsWithSummary(t *testing.T) {
+	const ref = "localhost:5000/foo"
+
+	newTag := func(name, digest string) *tag.Tag {
+		tg, _ := tag.New(name, tag.Options{Digest: digest})
+
+		return tg
+	}
+
+	remoteTags := map[string]*tag.Tag{
+		"a": newTag("a", "sha256:aaa"),
+		"b": newTag("b", "sha256:bbb"),
+		"c": newTag("c", "sha256:ccc"),
+	}
+	localTags := map[string]*tag.Tag{
+		"b": newTag("b", "sha256:bbb"),
+		"c": newTag("c", "sha256:000"),
+	}
+
+	keys, names, joined := tag.Join(remoteTags, localTags, nil)
+
+	cn, err := collection.New([]string{ref}, map[string][]*tag.Tag{ref: tag.Collect(keys, names, joined)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	summary, err := api.PullTagsWithSummary(cn)
+
+	assert.Nil(err)
+	assert.Equal("pull", summary.Operation)
+	assert.Equal(2, summary.Done, "should pull ABSENT and CHANGED tags")
+	assert.Equal(1, summary.Skipped, "should skip PRESENT tag")
+	assert.Equal(0, summary.Failed)
+
+	api.Stop()
+
+	summary, err = api.PullTagsWithSummary(cn)
+
+	assert.Nil(err)
+	assert.Equal(0, summary.Done, "should NOT pull anything, once stopped")
+	assert.Equal(3, summary.Skipped)
+	assert.True(summary.Stopped)
+}
+
+func TestPullTagsWithSummary_Budget(t *testing.T) {
+	const ref = "localhost:5000/foo"
+
+	newTag := func(name string, size int64) *tag.Tag {
+		tg, _ := tag.New(name, tag.Options{Digest: "sha256:" + name, Size: size})
+
+		return tg
+	}
+
+	remoteTags := map[string]*tag.Tag{
+		"a": newTag("a", 400),
+		"b": newTag("b", 400),
+		"c": newTag("c", 400),
+		"d": newTag("d", 100),
+	}
+
+	var testCases = []struct {
+		config  Config
+		done    int
+		skipped int
+	}{
+		{Config{DryRun: true}, 4, 0},
+		{Config{DryRun: true, MaxPullBytes: 1000}, 2, 2},
+		{Config{DryRun: true, MaxPullImages: 3}, 3, 1},
+		{Config{DryRun: true, MaxPullBytes: 1000, MaxPullImages: 1}, 1, 3},
+	}
+
+	assert := assert.New(t)
+
+	for _, testCase := range testCases {
+		keys, names, joined := tag.Join(remoteTags, map[string]*tag.Tag{}, nil)
+
+		cn, err := collection.New([]string{ref}, map[string][]*tag.Tag{ref: tag.Collect(keys, names, joined)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		api, err := New(testCase.config)
+		assert.Nil(err)
+
+		summary, err := api.PullTagsWithSummary(cn)
+
+		assert.Nil(err)
+		assert.Equal(testCase.done, summary.Done, "unexpected number of pulled tags (config: %+v)", testCase.config)
+		assert.Equal(testCase.skipped, summary.Skipped, "unexpected number of skipped tags (config: %+v)", testCase.config)
+		assert.Equal(testCase.done < 4, summary.BudgetExhausted, "unexpected budget state (config: %+v)", testCase.config)
+	}
+}
+
+func TestSummary_Credentials(t *testing.T) {
+	assert := assert.New(t)
+
+	api, err := New(Config{DockerJSONConfigFile: "../../fixtures/docker/config.json"})
+	assert.Nil(err)
+
+	tl := newTally()
+
+	var explained int
+	for i := 0; i < 3; i++ {
+		tl.Authenticated("registry.company.io", func() dockerconfig.AuthDecision {
+			explained++
+
+			return api.explainCredentials(&Credentials{Username: "robot", Password: "secret"}, "registry.company.io")
+		})
+	}
+
+	assert.Equal(1, explained, "should explain credentials only once per registry")
+
+	s := tl.Summary("push")
+
+	assert.Equal(
+		map[string]dockerconfig.AuthDecision{
+			"registry.company.io": {
+				Registry:  "registry.company.io",
+				Identity:  "registry.company.io",
+				Source:    dockerconfig.AuthSourceExplicit,
+				Username:  "robot",
+				HasSecret: true,
+			},
+		},
+		s.Credentials,
+	)
+	assert.NotContains(s.Credentials["registry.company.io"].String(), "secret=secret", "should never report secrets")
+
+	s.Add(&Summary{Operation: "push", Credentials: map[string]dockerconfig.AuthDecision{
+		"registry.nowhere.io": api.explainCredentials(nil, "registry.nowhere.io"),
+	}})
+
+	s.Add(&Summary{Operation: "push", Credentials: map[string]dockerconfig.AuthDecision{
+		"registry.hub.docker.com": api.explainCredentials(nil, "registry.hub.docker.com"),
+	}})
+
+	assert.Equal(3, len(s.Credentials))
+	assert.Equal(dockerconfig.AuthSourceAnonymous, s.Credentials["registry.nowhere.io"].Source)
+	assert.Equal(dockerconfig.AuthSourceConfig, s.Credentials["registry.hub.docker.com"].Source)
+	assert.Equal("user2", s.Credentials["registry.hub.docker.com"].Username)
+
+	assert.Nil(newTally().Summary("push").Credentials, "should have no credentials, if nothing was pushed")
+}
@@ -5,6 +5,7 @@ package v1
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,20 +13,31 @@ import (
 	"io"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/ivanilves/lstags/api/v1/checkpoint"
 	"github.com/ivanilves/lstags/api/v1/collection"
+	"github.com/ivanilves/lstags/api/v1/progress"
+	"github.com/ivanilves/lstags/api/v1/registry/client"
 	"github.com/ivanilves/lstags/api/v1/registry/client/cache"
+	"github.com/ivanilves/lstags/api/v1/registry/client/request"
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
+	"github.com/ivanilves/lstags/api/v1/registry/transfer"
 	dockerclient "github.com/ivanilves/lstags/docker/client"
 	dockerconfig "github.com/ivanilves/lstags/docker/config"
 	"github.com/ivanilves/lstags/repository"
 	"github.com/ivanilves/lstags/tag"
 	"github.com/ivanilves/lstags/tag/local"
+	"github.com/ivanilves/lstags/tag/manifest"
 	"github.com/ivanilves/lstags/tag/remote"
+	"github.com/ivanilves/lstags/util/throttle"
 	"github.com/ivanilves/lstags/util/wait"
 )
 
@@ -33,30 +45,143 @@ import (
 type Config struct {
 	// DockerJSONConfigFile is a path to Docker JSON config file
 	DockerJSONConfigFile string
+	// DockerContext is a Docker context we connect to Docker daemon through, like "docker --context" does
+	// NB! If it is not set, we use DOCKER_CONTEXT, DOCKER_HOST or the current context from Docker JSON config file.
+	DockerContext string
 	// ConcurrentRequests defines how much requests to registry we could run in parallel
 	ConcurrentRequests int
+	// MaxRegistryRequests caps requests in flight to every registry host, shared by all repositories we process at once
+	// (e.g. while mirroring the whole registry), so we never open a connection storm to a registry (0 means no limit).
+	// NB! ConcurrentRequests is applied to every repository on its own, so it does not bound the total for the registry.
+	MaxRegistryRequests int
 	// WaitBetween defines how much we will wait between batches of requests (incl. pull and push)
 	WaitBetween time.Duration
+	// MaxTokenAge forces us to re-authenticate to registries once token is cached for this long, even if it has not
+	// expired yet (0 means no limit, i.e. token is cached until it expires, as its "expires_in" tells us)
+	MaxTokenAge time.Duration
+	// DialTimeout limits time we wait for connection to registry to be established (0 means default: 30s)
+	DialTimeout time.Duration
+	// HandshakeTimeout limits time we wait for TLS handshake with registry to complete (0 means default: 10s)
+	HandshakeTimeout time.Duration
+	// HeaderTimeout limits time we wait for registry response headers, once request is sent (0 means default: 2m)
+	// NB! Timeouts never limit reading response body, so download of a big blob over slow link is not cut by them.
+	HeaderTimeout time.Duration
 	// TraceRequests sets if we will print out registry HTTP request traces
 	TraceRequests bool
 	// RetryRequests defines how much retries we will do to the failed HTTP request
 	RetryRequests int
 	// RetryDelay defines how much we will wait between failed HTTP request and retry
 	RetryDelay time.Duration
+	// RetryBudget caps total number of retries (of HTTP requests and stalled pulls) shared by all images of a batch operation
+	// (e.g. collect, pull or push of many images), so we do not hammer registry having an incident (0 means no limit).
+	// Once budget is exhausted, failures are reported without retries. Budget is refilled on start of every batch operation.
+	RetryBudget int
 	// InsecureRegistryEx is a regex string to match insecure (non-HTTPS) registries
 	InsecureRegistryEx string
+	// DefaultRegistry is a registry references with no registry specified (e.g. "ubuntu") are resolved to, DockerHub if not set
+	// NB! It is set globally (See repository.DefaultRegistry), credentials of the registry set are used for such references.
+	DefaultRegistry string
 	// VerboseLogging sets if we will print debug log messages
 	VerboseLogging bool
+	// LogRequests sets if we will log every registry HTTP request: method, URL, status and selected headers (implies VerboseLogging)
+	// NB! Authorization headers are always redacted.
+	LogRequests bool
 	// DryRun sets if we will dry run pull or push
 	DryRun bool
+	// CheckpointFile is a path to file where we record completed pushes to skip them on re-run
+	CheckpointFile string
+	// MaxTags limits number of tags we fetch per repository to the newest ones (by image creation date)
+	MaxTags int
+	// BandwidthLimit limits rate (bytes per second) of image data copied registry to registry (0 means no limit)
+	// NB! Pulls and pushes made by Docker daemon are not affected.
+	BandwidthLimit int64
+	// PullConcurrency limits number of images we pull (or export) at once, e.g. to pull gently from Docker Hub (0 means no limit)
+	PullConcurrency int
+	// PushConcurrency limits number of images we push at once, independently of pulls (0 means no limit)
+	PushConcurrency int
+	// LayerConcurrency defines how much blobs of a single image we copy registry to registry in parallel (default: 3)
+	LayerConcurrency int
+	// Platform ("OS/ARCH[/VARIANT]") is used to pick image from multi-arch tags to get their creation dates
+	// and to pull (and push) only the image for this platform, if it is set explicitly
+	// NB! If no platform is set, we use the one we run on (and Docker daemon pulls images for its own platform).
+	Platform string
+	// Annotation ("KEY=VALUE") is used to pick image from multi-arch tags instead of platform, e.g. to pull image variant
+	// marked with "org.opencontainers.image.ref.name" annotation. Tags having no image with this annotation fail to pull.
+	// NB! Tags referencing a single image (not a manifest list/index) are used as they are.
+	Annotation string
+	// PullIfMissing sets if we will check local Docker daemon right before every pull and skip pull,
+	// if image with the same digest is already there (e.g. pulled after we collected tags)
+	PullIfMissing bool
+	// FetchLastPulled sets if we will inspect local images to know when they were last pulled (costs a request per image)
+	FetchLastPulled bool
+	// ModifiedWithin keeps only tags modified (pushed or re-pushed) within this window, e.g. for activity reports (0 means all tags).
+	// Modification date is the one registry tells us (Last-Modified header or Docker Hub API "last_updated"), or image creation
+	// date, if registry does not tell it. Tags we know neither date of are not kept.
+	ModifiedWithin time.Duration
+	// CapturePattern is a regex with named groups applied to tag names, e.g. "^app-(?P<version>[^-]+)-(?P<env>.+)$",
+	// groups captured are exposed on every tag (See tag.GetCaptures). Tags not matching the pattern are not kept.
+	CapturePattern string
+	// CaptureFilters keeps only tags having groups captured equal to these ones ("NAME=VALUE"), e.g. "env=prod"
+	CaptureFilters []string
+	// LatestPerMinor keeps only this number of the newest semver tags per minor version (e.g. 2 latest patches of "1.2.x"
+	// and of "1.3.x"), tags not being semantic versions (e.g. "latest") are kept as they are (0 means all tags).
+	// NB! API users could get tags dropped by this policy (e.g. to prune them) with tag.LatestPerMinor.
+	LatestPerMinor int
+	// OnlyArch keeps only tags having image for this architecture ("ARCH[/VARIANT]", e.g. "arm64"), i.e. multi-arch tags
+	// listing it in their manifest list/index, or single-arch ones built for it (costs a request or two per tag).
+	// NB! Tags not present in registry (e.g. local-only ones) and tags we failed to fetch are not checked and are kept as they are.
+	OnlyArch string
+	// MaxLayers makes us warn about tags having images with more layers than this, e.g. to enforce image hygiene (0 means no limit).
+	// Number of layers is taken from image manifest (for multi-arch tags the image selected by platform is used).
+	MaxLayers int
+	// ExcludeOverMaxLayers makes us exclude tags having images with more layers than MaxLayers, instead of only warning about them
+	ExcludeOverMaxLayers bool
+	// UseHubAPI sets if we will list Docker Hub repositories through the Hub API (faster, no requests per tag)
+	UseHubAPI bool
+	// AuthRegistries maps registries we connect to (e.g. pull-through mirrors) to registry identities we authenticate as
+	// (use credentials and token scopes of), e.g. "mirror.internal" => "docker.io"
+	AuthRegistries map[string]string
+	// TotalSize sets if we will get sizes of image blobs (config and layers) to know total size of tags collected,
+	// with blobs shared by many images counted once (See collection.TotalSize). It costs us an extra request per tag.
+	TotalSize bool
+	// Denylist has patterns of references we never pull or push, even if they match include filters (deny always wins).
+	// Pattern is either a "/REGEX/" or a glob ("*" matches any characters), e.g. "*:debug" or "quay.io/team/legacy:*".
+	Denylist []string
+	// MaxManifestBytes limits size of manifests and image configs we read from registries, so a misconfigured (or malicious)
+	// registry could not eat all our memory with a huge "manifest" (0 means client.DefaultMaxManifestBytes, i.e. 16 MiB).
+	// NB! Image layers are streamed, never read into memory, so they are not limited.
+	MaxManifestBytes int64
+	// MaxPullBytes stops us from pulling more images, once their total size would exceed this number of bytes (0 means no limit)
+	MaxPullBytes int64
+	// MaxPullImages stops us from pulling more images, once their total number would exceed this one (0 means no limit)
+	MaxPullImages int
+	// PullStallTimeout aborts image pull, if Docker daemon reports no progress for this long (0 means no timeout)
+	// NB! Stalled pulls are retried (as much as failed HTTP requests are), pulls failed otherwise are not.
+	PullStallTimeout time.Duration
+	// CheckDrift makes us re-check digest of every tag right before we pull, push or export it, to detect tags changed
+	// after we listed them (e.g. re-pushed by CI). Drift is logged, unless FailOnDrift is set. It costs an extra request per tag.
+	CheckDrift bool
+	// FailOnDrift makes us fail pull, push or export of tags changed after we listed them (See CheckDrift)
+	// NB! Pushes in strict mode (See PushConfig.Strict) fail on drift regardless of it.
+	FailOnDrift bool
+	// Progress tracks progress of all images pulled and pushed through Docker daemon, if set (e.g. to render it in UI)
+	// NB! Size of every tag pulled is passed to it as expected, so its Overall() completion accounts for the whole image.
+	Progress *progress.Tracker
+	// Scanner scans every tag collected for vulnerabilities, if set, attaching results to tags (See tag.Tag.GetScanResult)
+	// NB! We ship no scanner, bring your own one (e.g. running Trivy or Grype). Failed scans are logged, tags are kept.
+	Scanner Scanner
+	// ScanConcurrency limits number of tags we scan at once (0 means ConcurrentRequests)
+	ScanConcurrency int
 }
 
 // PushConfig holds push-specific configuration (where to push and with which prefix)
 type PushConfig struct {
 	// Prefix is prepended to the repository path while pushing to the registry
 	Prefix string
-	// Registry is an address of the Docker registry in which we push our images
+	// Registry is an address of the Docker registry in which we push our images (default one, if push routes are set)
 	Registry string
+	// Routes make us push images from different source registries to different registries (See PushRoute)
+	Routes []PushRoute
 	// UpdateChanged tells us if we will re-push (update/overwrite) images having same tag, but different digest
 	UpdateChanged bool
 	// PathSeparator defines which path separator to use (default: "/")
@@ -65,13 +190,177 @@ type PushConfig struct {
 	PathTemplate string
 	// TagTemplate is a template to change push tag, sprig functions are supprted
 	TagTemplate string
+	// IncludeReferrers tells us if we will also copy manifests referring to pushed images (signatures, SBOMs etc)
+	IncludeReferrers bool
+	// Strict makes us fail, if tag is already present in the "push" registry, but has a different digest
+	Strict bool
+	// Force makes us overwrite tags having a different digest in the "push" registry, even in strict mode
+	Force bool
+	// RefRewriter computes "push" reference for every source one (default: prefix, path and tag templates)
+	RefRewriter RefRewriter
+	// AllowedDigests makes us push only tags having one of these digests, if set (e.g. images approved for promotion)
+	AllowedDigests []string
+	// PostPush is called for every image pushed (with the "push" reference and digest), before push is reported successful,
+	// e.g. to sign the image with cosign. If it fails, push fails too (and is not recorded in the checkpoint). Optional.
+	// NB! It is not called in dry run mode, images skipped (e.g. already pushed) are not passed to it either.
+	PostPush func(ref, digest string) error
+	// RequiredLabels makes us push only tags of images having all these labels, if set ("KEY=VALUE" or just "KEY" to have it present)
+	RequiredLabels []string
+	// IndexTagSuffix makes us also copy the whole multi-arch index (registry to registry) of every image pushed
+	// under the tag with this suffix, e.g. "-multiarch", so single-platform image pushed has a full fallback
+	// NB! Pushed tag points at the image selected by platform (See Config.Platform), single-arch tags have no index to copy.
+	IndexTagSuffix string
+	// SrcCredentials are used for source ("pull") registries, instead of the ones from Docker config or auth providers, if set
+	SrcCredentials *Credentials
+	// DstCredentials are used for "push" registries, instead of the ones from Docker config or auth providers, if set
+	// NB! Use them to push with ephemeral CI credentials, not stored in any Docker config file.
+	DstCredentials *Credentials
+}
+
+// DigestMismatch describes a tag present in the "push" registry with a digest different from the source one
+type DigestMismatch struct {
+	SrcRef    string
+	SrcDigest string
+	DstRef    string
+	DstDigest string
+}
+
+// DigestMismatchError is returned in strict mode, if some tags in the "push" registry have different digests
+type DigestMismatchError struct {
+	Mismatches []DigestMismatch
+}
+
+// Error implements error interface
+func (e *DigestMismatchError) Error() string {
+	lines := make([]string, len(e.Mismatches))
+
+	for i, m := range e.Mismatches {
+		lines[i] = fmt.Sprintf("* %s (%s) => %s (%s)", m.SrcRef, m.SrcDigest, m.DstRef, m.DstDigest)
+	}
+
+	return fmt.Sprintf(
+		"%d tag(s) already pushed with different digest (use \"force\" to overwrite them):\n%s",
+		len(e.Mismatches), strings.Join(lines, "\n"),
+	)
+}
+
+// CollectError holds errors we got while collecting tags of particular repositories (keyed by their references)
+type CollectError struct {
+	Errors map[string]error
+}
+
+// Error implements error interface
+func (e *CollectError) Error() string {
+	refs := make([]string, 0, len(e.Errors))
+	for ref := range e.Errors {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	lines := make([]string, len(refs))
+	for i, ref := range refs {
+		lines[i] = fmt.Sprintf("* %s: %s", ref, e.Errors[ref].Error())
+	}
+
+	return fmt.Sprintf("unable to collect tags of %d repo(s):\n%s", len(refs), strings.Join(lines, "\n"))
+}
+
+// NoTagsError is returned, if repository has no tags (matched by its reference) to select from
+type NoTagsError struct {
+	Ref string
+}
+
+// Error implements error interface
+func (e *NoTagsError) Error() string {
+	return fmt.Sprintf("no tags found for %s", e.Ref)
+}
+
+// MirrorSummary holds the outcome of a registry-wide mirror operation
+type MirrorSummary struct {
+	// Repositories is a number of repositories taken from the registry catalog
+	Repositories int
+	// Tags is a number of tags analyzed across all these repositories
+	Tags int
+	// Pushed is a number of tags pushed (the rest were already mirrored)
+	Pushed int
+	// Push summarizes the whole mirror operation (tags already mirrored are counted as skipped)
+	Push Summary
+	// Errors holds errors we got for every repository we failed to mirror (keyed by its reference),
+	// NB! errors of particular tags we failed to push are in Push.Errors
+	Errors map[string]error
+}
+
+// MirrorError is returned, if we failed to mirror some repositories or tags (all the others are mirrored anyway)
+type MirrorError struct {
+	// Repos holds errors of repositories we failed to mirror (keyed by their references)
+	Repos map[string]error
+	// Tags holds errors of tags we failed to push
+	Tags []*TagError
+}
+
+// Error implements error interface
+func (e *MirrorError) Error() string {
+	refs := make([]string, 0, len(e.Repos))
+	for ref := range e.Repos {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	lines := make([]string, 0, len(refs)+len(e.Tags))
+	for _, ref := range refs {
+		lines = append(lines, fmt.Sprintf("* %s: %s", ref, e.Repos[ref].Error()))
+	}
+	for _, tagErr := range e.Tags {
+		lines = append(lines, fmt.Sprintf("* %s", tagErr.Error()))
+	}
+
+	return fmt.Sprintf(
+		"unable to mirror %d repo(s) and %d tag(s):\n%s",
+		len(e.Repos), len(e.Tags), strings.Join(lines, "\n"),
+	)
 }
 
 // API represents configured application API instance,
 // the main abstraction you are supposed to work with
 type API struct {
 	config       Config
+	dockerConfig *dockerconfig.Config
 	dockerClient *dockerclient.DockerClient
+	daemonMux    sync.Mutex
+	checkpoint   *checkpoint.Checkpoint
+	budget       *budget
+	denylist     *denylist
+	capture      *capture
+	capabilities *capabilities
+	pulls        limit
+	pushes       limit
+	scans        limit
+	stopping     int32
+}
+
+// Stop makes us stop gracefully: images being pulled or pushed are completed, but no more images are started
+// (they are counted as skipped), and registry mirror stops after the current batch of repositories.
+// NB! It is safe to call from another goroutine, e.g. from a signal handler. Once stopped, API could not be restarted.
+func (api *API) Stop() {
+	if atomic.CompareAndSwapInt32(&api.stopping, 0, 1) {
+		log.Warnf("STOPPING (images in progress will be completed, but no more images will be started)")
+	}
+}
+
+// Stopping tells us if we were asked to stop (See Stop)
+func (api *API) Stopping() bool {
+	return atomic.LoadInt32(&api.stopping) == 1
+}
+
+// reserve tells us if we could start one more image of the size passed: we are not stopping and pull budget is not exhausted
+func (api *API) reserve(ref string, size int64) bool {
+	if api.Stopping() {
+		log.Debugf("%s stopping, will not start %s", fn(), ref)
+
+		return false
+	}
+
+	return api.budget.Reserve(ref, size)
 }
 
 // rtags is a structure to send collection of referenced tags using chan
@@ -97,6 +386,16 @@ func fn(labels ...string) string {
 	return fmt.Sprintf("[%s():%s]", shortname, strings.Join(labels, ":"))
 }
 
+// contextErr gives us context error instead of the error request aborted by context failed with (e.g. "context canceled"
+// wrapped into *url.Error), so callers could always compare it with context.Canceled or context.DeadlineExceeded
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+
+	return err
+}
+
 func getBatchedSlices(batchSize int, unbatched ...string) [][]string {
 	batchedSlices := make([][]string, 0)
 
@@ -152,6 +451,8 @@ func (api *API) CollectTags(refs ...string) (*collection.Collection, error) {
 		return nil, fmt.Errorf("no image references passed")
 	}
 
+	request.RetryBudget.Reset()
+
 	_, err := repository.ParseRefs(refs)
 	if err != nil {
 		return nil, err
@@ -175,34 +476,14 @@ func (api *API) CollectTags(refs ...string) (*collection.Collection, error) {
 
 		for _, repo := range repos {
 			go func(repo *repository.Repository, done chan error) {
-				log.Infof("ANALYZE %s", repo.Ref())
-
-				username, password, _ := api.dockerClient.Config().GetCredentials(repo.Registry())
-
-				remoteTags, err := remote.FetchTags(repo, username, password)
+				tags, err := api.collectRepoTags(repo)
 				if err != nil {
 					done <- err
 					return
 				}
-				log.Debugf("%s remote tags: %+v", fn(repo.Ref()), remoteTags)
-
-				localTags, _ := local.FetchTags(repo, api.dockerClient)
 
-				log.Debugf("%s local tags: %+v", fn(repo.Ref()), localTags)
-
-				sortedKeys, tagNames, joinedTags := tag.Join(
-					remoteTags,
-					localTags,
-					repo.Tags(),
-				)
-				log.Debugf("%s sending joined tags: %+v", fn(repo.Ref()), joinedTags)
-
-				tagc <- rtags{ref: repo.Ref(), tags: tag.Collect(sortedKeys, tagNames, joinedTags)}
+				tagc <- rtags{ref: repo.Ref(), tags: tags}
 				done <- nil
-
-				log.Infof("FETCHED %s", repo.Ref())
-
-				return
 			}(repo, done)
 		}
 
@@ -220,6 +501,63 @@ func (api *API) CollectTags(refs ...string) (*collection.Collection, error) {
 	return collection.New(refs, tags)
 }
 
+// getCredentials resolves credentials for the registry passed, on its own, i.e. the "pull" (source) registry
+// and the "push" (destination) one never share credentials, so we could pull anonymously and push authenticated
+func (api *API) getCredentials(registry, role string) (string, string) {
+	username, password, decision := api.dockerConfig.ResolveCredentials(registry)
+	log.Debugf("%s %s %s", fn(), role, decision)
+
+	if decision.Source == dockerconfig.AuthSourceAnonymous {
+		log.Debugf("%s %s registry %s: no credentials, will go anonymous", fn(), role, registry)
+
+		return "", ""
+	}
+
+	if identity := api.dockerConfig.AuthRegistry(registry); identity != registry {
+		log.Debugf("%s %s registry %s: will use credentials of '%s' (as %s)", fn(), role, registry, username, identity)
+
+		return username, password
+	}
+
+	log.Debugf("%s %s registry %s: will use credentials of '%s'", fn(), role, registry, username)
+
+	return username, password
+}
+
+// ExplainAuth tells us how we resolve credentials for the registry, e.g. why we go anonymous (debugging helper)
+// NB! It is logged on every credentials resolution with debug verbosity level (See Config.VerboseLogging).
+func (api *API) ExplainAuth(registry string) dockerconfig.AuthDecision {
+	return api.dockerConfig.ExplainAuth(registry)
+}
+
+// Capabilities tells us which optional operations (catalog, delete, referrers) the registry supports,
+// so we could skip unsupported ones with a clear message instead of failing halfway. Repository operations
+// are probed against the repository path passed (pass an empty one to probe catalog only).
+// NB! Capabilities are probed once per registry host and cached until ResetCapabilities is called.
+func (api *API) Capabilities(registry, repoPath string) (*client.Capabilities, error) {
+	return api.probeCapabilities(nil, registry, repoPath)
+}
+
+// probeCapabilities probes registry capabilities with explicit credentials, if they are passed (See Credentials)
+func (api *API) probeCapabilities(explicit *Credentials, registry, repoPath string) (*client.Capabilities, error) {
+	return api.capabilities.Get(registry, repoPath, func() (*client.Capabilities, error) {
+		username, password := api.credentials(explicit, registry, "pull")
+
+		c, err := remote.ProbeCapabilities(registry, repoPath, username, password)
+		if err != nil {
+			return nil, err
+		}
+		log.Debugf("%s %s: %s", fn(), registry, c)
+
+		return c, nil
+	})
+}
+
+// ResetCapabilities forgets registry capabilities probed, so they are probed again (e.g. on the next daemon cycle)
+func (api *API) ResetCapabilities() {
+	api.capabilities.Reset()
+}
+
 func getPushPrefix(prefix, defaultPrefix string) string {
 	if prefix == "" {
 		return defaultPrefix
@@ -256,6 +594,229 @@ func validatePushPrefix(prefix string) error {
 	return nil
 }
 
+// collectRepoTags collects tags of a single repository, present in remote registry and [local] Docker daemon
+func (api *API) collectRepoTags(repo *repository.Repository) ([]*tag.Tag, error) {
+	log.Infof("ANALYZE %s", repo.Ref())
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	remoteTags, err := remote.FetchTags(context.Background(), repo, username, password)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%s remote tags: %+v", fn(repo.Ref()), remoteTags)
+
+	var localTags map[string]*tag.Tag
+	if dc, err := api.docker(); err == nil {
+		localTags, _ = local.FetchTags(repo, dc)
+	}
+
+	log.Debugf("%s local tags: %+v", fn(repo.Ref()), localTags)
+
+	sortedKeys, tagNames, joinedTags := tag.Join(
+		remoteTags,
+		localTags,
+		repo.Tags(),
+	)
+	log.Debugf("%s sending joined tags: %+v", fn(repo.Ref()), joinedTags)
+
+	log.Infof("FETCHED %s", repo.Ref())
+
+	tags := tag.Collect(sortedKeys, tagNames, joinedTags)
+	if api.denylist == nil && api.capture == nil && api.config.ModifiedWithin == 0 && api.config.OnlyArch == "" &&
+		api.config.MaxLayers == 0 {
+		return api.scanTags(repo, api.latestPerMinor(repo, tags)), nil
+	}
+
+	allowedTags := make([]*tag.Tag, 0, len(tags))
+	for _, tg := range tags {
+		if pattern, denied := api.denylist.Match(repo, tg.Name()); denied {
+			log.Infof("EXCLUDED %s:%s (denylisted by '%s')", repo.Name(), tg.Name(), pattern)
+			continue
+		}
+
+		if !api.capture.Match(tg) {
+			log.Debugf("%s %s:%s not matched by capture pattern", fn(repo.Ref()), repo.Name(), tg.Name())
+			continue
+		}
+
+		if !api.isModifiedWithin(tg) {
+			log.Debugf("%s %s:%s not modified within %v", fn(repo.Ref()), repo.Name(), tg.Name(), api.config.ModifiedWithin)
+			continue
+		}
+
+		if archs, matched := api.matchArch(repo, tg, username, password); !matched {
+			log.Infof("EXCLUDED %s:%s (no matching arch %s, has: %s)", repo.Name(), tg.Name(), api.config.OnlyArch, strings.Join(archs, ","))
+			continue
+		}
+
+		if !api.checkLayers(repo, tg) {
+			continue
+		}
+
+		allowedTags = append(allowedTags, tg)
+	}
+
+	return api.scanTags(repo, api.latestPerMinor(repo, allowedTags)), nil
+}
+
+// latestPerMinor keeps only the newest semver tags per minor version (See Config.LatestPerMinor), preserving tags order
+func (api *API) latestPerMinor(repo *repository.Repository, tags []*tag.Tag) []*tag.Tag {
+	if api.config.LatestPerMinor <= 0 {
+		return tags
+	}
+
+	names := make([]string, len(tags))
+	for i, tg := range tags {
+		names[i] = tg.Name()
+	}
+
+	dropped := make(map[string]bool)
+	for _, name := range tag.LatestPerMinor(names, api.config.LatestPerMinor).Drop {
+		log.Debugf("%s %s:%s is not one of %d latest tags of %s.x", fn(repo.Ref()), repo.Name(), name, api.config.LatestPerMinor, tag.MinorVersion(name))
+
+		dropped[name] = true
+	}
+
+	kept := make([]*tag.Tag, 0, len(tags)-len(dropped))
+	for _, tg := range tags {
+		if !dropped[tg.Name()] {
+			kept = append(kept, tg)
+		}
+	}
+
+	return kept
+}
+
+// matchArch tells us if tag has image for the architecture configured (See Config.OnlyArch) and gives us architectures it has.
+// Tag we failed to get architectures of is not matched.
+func (api *API) matchArch(repo *repository.Repository, tg *tag.Tag, username, password string) ([]string, bool) {
+	if api.config.OnlyArch == "" || tg.GetError() != nil || tg.GetState() == "LOCAL_ONLY" || tg.GetState() == "NOT_FOUND" {
+		return nil, true
+	}
+
+	archs, err := remote.FetchArchitectures(repo, tg.Name(), username, password)
+	if err != nil {
+		log.Warnf("%s unable to get architectures of %s:%s: %s", fn(repo.Ref()), repo.Name(), tg.Name(), err.Error())
+
+		return []string{"unknown"}, false
+	}
+
+	for _, arch := range archs {
+		if manifest.MatchArchitecture(arch, api.config.OnlyArch) {
+			return archs, true
+		}
+	}
+
+	return archs, false
+}
+
+// checkLayers warns about tag having image with more layers than allowed (See Config.MaxLayers) and tells us if we keep it,
+// i.e. tags over the limit are not kept only if we exclude them (See Config.ExcludeOverMaxLayers)
+// NB! Tags we do not know number of layers of (e.g. local-only ones) are always kept.
+func (api *API) checkLayers(repo *repository.Repository, tg *tag.Tag) bool {
+	if api.config.MaxLayers <= 0 || tg.GetLayerCount() <= api.config.MaxLayers {
+		return true
+	}
+
+	if api.config.ExcludeOverMaxLayers {
+		log.Infof("EXCLUDED %s:%s (%d layers, over %d)", repo.Name(), tg.Name(), tg.GetLayerCount(), api.config.MaxLayers)
+
+		return false
+	}
+
+	log.Warnf("LAYERS %s:%s has %d layers, over %d", repo.Name(), tg.Name(), tg.GetLayerCount(), api.config.MaxLayers)
+
+	return true
+}
+
+// isModifiedWithin tells us if tag was modified within the window configured (See Config.ModifiedWithin),
+// we take image creation date, if registry does not tell us when tag was modified
+func (api *API) isModifiedWithin(tg *tag.Tag) bool {
+	if api.config.ModifiedWithin == 0 {
+		return true
+	}
+
+	modified := tg.GetLastModified()
+	if modified == 0 {
+		modified = tg.GetCreated()
+	}
+
+	return modified != 0 && time.Since(time.Unix(modified, 0)) <= api.config.ModifiedWithin
+}
+
+// CollectTagsByRepo is a batch form of CollectTags for dashboards and alike: it collects tags of all the repositories
+// (references) passed, running no more than ConcurrentRequests of them at once, and gives us tags keyed by reference.
+// Failure to collect tags of some repositories is not fatal: tags of all other ones are given along with *CollectError.
+func (api *API) CollectTagsByRepo(ctx context.Context, refs []string) (map[string][]*tag.Tag, error) {
+	request.RetryBudget.Reset()
+
+	tags := make(map[string][]*tag.Tag, len(refs))
+	errs := make(map[string]error)
+
+	repos := make([]*repository.Repository, 0, len(refs))
+	for _, ref := range refs {
+		repo, err := repository.ParseRef(ref)
+		if err != nil {
+			errs[ref] = err
+			continue
+		}
+
+		repos = append(repos, repo)
+	}
+
+	type response struct {
+		ref  string
+		tags []*tag.Tag
+		err  error
+	}
+
+	for i := 0; i < len(repos); i += api.config.ConcurrentRequests {
+		batch := repos[i:]
+		if len(batch) > api.config.ConcurrentRequests {
+			batch = batch[:api.config.ConcurrentRequests]
+		}
+
+		if err := ctx.Err(); err != nil {
+			for _, repo := range batch {
+				errs[repo.Ref()] = err
+			}
+			continue
+		}
+
+		collected := make(chan response, len(batch))
+
+		for _, repo := range batch {
+			go func(repo *repository.Repository) {
+				tags, err := api.collectRepoTags(repo)
+
+				collected <- response{ref: repo.Ref(), tags: tags, err: err}
+			}(repo)
+		}
+
+		for range batch {
+			resp := <-collected
+
+			if resp.err != nil {
+				log.Warnf("FAILED %s: %s", resp.ref, resp.err.Error())
+
+				errs[resp.ref] = resp.err
+				continue
+			}
+
+			tags[resp.ref] = resp.tags
+		}
+
+		time.Sleep(api.config.WaitBetween)
+	}
+
+	if len(errs) != 0 {
+		return tags, &CollectError{Errors: errs}
+	}
+
+	return tags, nil
+}
+
 // CollectPushTags blends passed collection with information fetched from [local] "push" registry,
 // makes required comparisons between them and spits organized info back as collection.Collection
 func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*collection.Collection, error) {
@@ -265,7 +826,7 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 	)
 	log.Debugf("%s push config: %+v", fn(), push)
 
-	pushPathTemplate, terr := makePushPathTemplate(push)
+	rewrite, terr := makeRefRewriter(push)
 	if terr != nil {
 		return nil, terr
 	}
@@ -274,26 +835,29 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 	done := make(chan error, len(cn.Refs()))
 	tagc := make(chan rtags, len(refs))
 
+	mismatches := make([]DigestMismatch, 0)
+	var mismatchesMux sync.Mutex
+
+	requiredLabels, err := parseRequiredLabels(push.RequiredLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	allowedDigests := make(map[string]bool, len(push.AllowedDigests))
+	for _, digest := range push.AllowedDigests {
+		allowedDigests[digest] = true
+	}
+
 	for i, repo := range cn.Repos() {
 		go func(repo *repository.Repository, i int, done chan error) {
 			refs[i] = repo.Ref()
 
-			pushPrefix := getPushPrefix(push.Prefix, repo.PushPrefix())
-			if err := validatePushPrefix(pushPrefix); err != nil {
+			dst, err := rewrite(Ref{Registry: repo.Registry(), Path: repo.Path()})
+			if err != nil {
 				done <- err
 				return
 			}
-
-			pushPath, perr := pushPathTemplate(pushPrefix, repo.PushPath(push.PathSeparator), repo.Name())
-			if perr != nil {
-				done <- perr
-				return
-			}
-			pushRef := fmt.Sprintf(
-				"%s%s~/.*/",
-				push.Registry,
-				pushPath,
-			)
+			pushRef := dst.Repository() + "~/.*/"
 
 			log.Debugf("%s 'push' reference: %+v", fn(repo.Ref()), pushRef)
 
@@ -301,9 +865,9 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 
 			log.Infof("[PULL/PUSH] ANALYZE %s => %s", repo.Ref(), pushRef)
 
-			username, password, _ := api.dockerClient.Config().GetCredentials(push.Registry)
+			username, password := api.credentials(push.DstCredentials, dst.Registry, "push")
 
-			pushedTags, err := remote.FetchTags(pushRepo, username, password)
+			pushedTags, err := remote.FetchTags(context.Background(), pushRepo, username, password)
 			if err != nil {
 				if !strings.Contains(err.Error(), "404 Not Found") {
 					done <- err
@@ -319,9 +883,25 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 			remoteTags := cn.TagMap(repo.Ref())
 			log.Debugf("%s remote tags: %+v", fn(repo.Ref()), remoteTags)
 
+			// pushed tags are matched by their names rewritten with push tag template
+			dstTagNames := make(map[string]string)
+			matchedPushedTags := make(map[string]*tag.Tag)
+			for name, tg := range remoteTags {
+				tagDst, err := rewrite(Ref{Registry: repo.Registry(), Path: repo.Path(), Tag: name, Digest: tg.GetDigest(), Created: tg.GetCreated()})
+				if err != nil {
+					done <- err
+					return
+				}
+				dstTagNames[name] = tagDst.Tag
+
+				if pushedTag, defined := pushedTags[tagDst.Tag]; defined {
+					matchedPushedTags[name] = pushedTag
+				}
+			}
+
 			sortedKeys, tagNames, joinedTags := tag.Join(
 				remoteTags,
-				pushedTags,
+				matchedPushedTags,
 				repo.Tags(),
 			)
 			log.Debugf("%s joined tags: %+v", fn(repo.Ref()), joinedTags)
@@ -331,7 +911,38 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 				name := tagNames[key]
 				tg := joinedTags[name]
 
-				if tg.NeedsPush(push.UpdateChanged) {
+				if len(allowedDigests) != 0 && !allowedDigests[tg.GetDigest()] {
+					log.Infof("[PULL/PUSH] NOT ALLOWED %s:%s (digest %s is not in the allowlist)", repo.Name(), name, tg.GetDigest())
+					continue
+				}
+
+				if len(requiredLabels) != 0 && tg.GetState() != "PRESENT" {
+					srcUsername, srcPassword := api.credentials(push.SrcCredentials, repo.Registry(), "pull")
+
+					labels, err := remote.FetchLabels(repo, name, srcUsername, srcPassword)
+					if err != nil {
+						done <- err
+						return
+					}
+
+					if missing := missingLabel(labels, requiredLabels); missing != "" {
+						log.Infof("[PULL/PUSH] NOT LABELED %s:%s (no label %s)", repo.Name(), name, missing)
+						continue
+					}
+				}
+
+				if push.Strict && tg.GetState() == "CHANGED" {
+					mismatchesMux.Lock()
+					mismatches = append(mismatches, DigestMismatch{
+						SrcRef:    repo.Name() + ":" + name,
+						SrcDigest: tg.GetDigest(),
+						DstRef:    dst.Repository() + ":" + dstTagNames[name],
+						DstDigest: matchedPushedTags[name].GetDigest(),
+					})
+					mismatchesMux.Unlock()
+				}
+
+				if tg.NeedsPush(push.UpdateChanged || (push.Strict && push.Force)) {
 					tagsToPush = append(tagsToPush, tg)
 				}
 			}
@@ -350,6 +961,18 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 		return nil, err
 	}
 
+	if len(mismatches) != 0 {
+		sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].SrcRef < mismatches[j].SrcRef })
+
+		if !push.Force {
+			return nil, &DigestMismatchError{Mismatches: mismatches}
+		}
+
+		for _, m := range mismatches {
+			log.Warnf("[PULL/PUSH] FORCE %s => %s (%s => %s)", m.SrcRef, m.DstRef, m.DstDigest, m.SrcDigest)
+		}
+	}
+
 	tags := receiveTags(tagc)
 
 	log.Debugf("%s 'push' tags: %+v", fn(), tags)
@@ -357,6 +980,51 @@ func (api *API) CollectPushTags(cn *collection.Collection, push PushConfig) (*co
 	return collection.New(refs, tags)
 }
 
+// parseRequiredLabels parses required labels ("KEY=VALUE" or "KEY") into a map of label values ("" means any value)
+func parseRequiredLabels(labels []string) (map[string]*string, error) {
+	required := make(map[string]*string, len(labels))
+
+	for _, label := range labels {
+		kv := strings.SplitN(label, "=", 2)
+
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, fmt.Errorf("invalid required label (should be KEY=VALUE or KEY): %s", label)
+		}
+
+		if len(kv) == 1 {
+			required[key] = nil
+		} else {
+			value := kv[1]
+			required[key] = &value
+		}
+	}
+
+	return required, nil
+}
+
+// missingLabel gives us the first required label image labels passed do not have (or "", if they have them all)
+func missingLabel(labels map[string]string, required map[string]*string) string {
+	keys := make([]string, 0, len(required))
+	for key := range required {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, defined := labels[key]
+
+		if !defined {
+			return key
+		}
+		if required[key] != nil && *required[key] != value {
+			return key + "=" + *required[key]
+		}
+	}
+
+	return ""
+}
+
 func makePushPathTemplate(push PushConfig) (func(pushPrefix, pushPath, name string) (string, error), error) {
 	tpl, err := template.New("push-path-template").
 		Funcs(sprig.FuncMap()).Parse(push.PathTemplate)
@@ -377,11 +1045,22 @@ func makePushPathTemplate(push PushConfig) (func(pushPrefix, pushPath, name stri
 // PullTags compares images from remote registry and Docker daemon and pulls
 // images that match tag spec passed and are not present in Docker daemon.
 func (api *API) PullTags(cn *collection.Collection) error {
+	_, err := api.PullTagsWithSummary(cn)
+
+	return err
+}
+
+// PullTagsWithSummary does the same as PullTags, but also gives a summary of what was [not] pulled
+func (api *API) PullTagsWithSummary(cn *collection.Collection) (*Summary, error) {
 	log.Debugf(
 		"%s collection: %+v (%d repos / %d tags)",
 		fn(), cn, cn.RepoCount(), cn.TagCount(),
 	)
 
+	request.RetryBudget.Reset()
+
+	t := newTally()
+
 	done := make(chan error, cn.TagCount())
 
 	for _, ref := range cn.Refs() {
@@ -396,27 +1075,56 @@ func (api *API) PullTags(cn *collection.Collection) error {
 		go func(repo *repository.Repository, tags []*tag.Tag, done chan error) {
 			for _, tg := range tags {
 				if !tg.NeedsPull() {
+					t.Skipped()
 					done <- nil
 					continue
 				}
 
 				ref := repo.Name() + ":" + tg.Name()
 
+				if !tg.IsImage() {
+					log.Infof("SKIPPING %s (not an image, but %s artifact)", ref, tg.GetArtifactType())
+					t.Skipped()
+					done <- nil
+					continue
+				}
+
+				if api.config.PullIfMissing && api.isPresentLocally(repo, tg) {
+					log.Infof("PRESENT %s (same digest, not pulled)", ref)
+					t.Skipped()
+					done <- nil
+					continue
+				}
+
+				if !api.reserve(ref, tg.GetSize()) {
+					t.Skipped()
+					done <- nil
+					continue
+				}
+
+				if err := api.checkDrift(repo, tg, false, nil); err != nil {
+					t.Failed(ref, err)
+					done <- err
+					continue
+				}
+
 				log.Infof("PULLING %s", ref)
 				if api.config.DryRun {
 					log.Infof("[DRY-RUN] PULLED %s", ref)
+					t.Done()
 					done <- nil
 					continue
 				}
 
-				resp, err := api.dockerClient.Pull(ref)
-				if err != nil {
+				api.config.Progress.Expect("pull", ref, tg.GetSize())
+
+				if err := api.pullImage(context.Background(), ref, nil); err != nil {
+					t.Failed(ref, err)
 					done <- err
-					return
+					continue
 				}
 
-				logDebugData(resp)
-
+				t.Done()
 				done <- nil
 			}
 		}(repo, tags, done)
@@ -424,120 +1132,1105 @@ func (api *API) PullTags(cn *collection.Collection) error {
 		time.Sleep(api.config.WaitBetween)
 	}
 
-	return wait.WithTolerance(done)
-}
+	err := wait.WithTolerance(done)
+
+	summary := t.Summary("pull")
+	summary.BudgetExhausted = api.budget.Exhausted()
+	summary.Stopped = api.Stopping()
+	summary.RetriesExhausted = request.RetryBudget.Exhausted()
+
+	return summary, err
+}
+
+// ExportTags copies images of all the tags in the collection into OCI image layout directory (e.g. for air-gapped transfer),
+// registry to directory, i.e. without Docker daemon. Images are named with their "REPOSITORY:TAG" in the layout index.
+func (api *API) ExportTags(cn *collection.Collection, dir string) error {
+	_, err := api.ExportTagsWithSummary(cn, dir)
+
+	return err
+}
+
+// ExportTagsWithSummary does the same as ExportTags, but also gives a summary of what was [not] exported
+func (api *API) ExportTagsWithSummary(cn *collection.Collection, dir string) (*Summary, error) {
+	log.Debugf(
+		"%s collection: %+v (%d repos / %d tags)",
+		fn(), cn, cn.RepoCount(), cn.TagCount(),
+	)
+
+	layout, err := transfer.OpenLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	request.RetryBudget.Reset()
+	transfer.ResetStats()
+
+	t := newTally()
+
+	done := make(chan error, cn.TagCount())
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+		tags := cn.Tags(ref)
+
+		go func(repo *repository.Repository, tags []*tag.Tag, done chan error) {
+			username, password := api.getCredentials(repo.Registry(), "pull")
+
+			src, err := remote.Connect(repo.Registry(), username, password)
+
+			for _, tg := range tags {
+				ref := repo.Name() + ":" + tg.Name()
+
+				if err != nil {
+					t.Failed(ref, err)
+					done <- err
+					continue
+				}
+
+				if !api.reserve(ref, tg.GetSize()) {
+					t.Skipped()
+					done <- nil
+					continue
+				}
+
+				if err := api.checkDrift(repo, tg, false, nil); err != nil {
+					t.Failed(ref, err)
+					done <- err
+					continue
+				}
+
+				log.Infof("EXPORTING %s => %s", ref, layout.Path())
+				if api.config.DryRun {
+					log.Infof("[DRY-RUN] EXPORTED %s", ref)
+					t.Done()
+					done <- nil
+					continue
+				}
+
+				api.pulls.Acquire()
+				_, err := transfer.Manifest(src, repo.Path(), layout, repo.Name(), tg.Name())
+				api.pulls.Release()
+				if err != nil {
+					err = fmt.Errorf("unable to export %s: %s", ref, err.Error())
+
+					t.Failed(ref, err)
+					done <- err
+					continue
+				}
+
+				t.Done()
+				done <- nil
+			}
+		}(repo, tags, done)
+
+		time.Sleep(api.config.WaitBetween)
+	}
+
+	err = wait.WithTolerance(done)
+
+	summary := t.Summary("export")
+	summary.BudgetExhausted = api.budget.Exhausted()
+	summary.Stopped = api.Stopping()
+	summary.RetriesExhausted = request.RetryBudget.Exhausted()
+
+	stats := transfer.GetStats()
+	summary.CopiedBytes, summary.SavedBytes = stats.CopiedBytes, stats.SavedBytes
+
+	return summary, err
+}
+
+// Export streams images specified (e.g. ones we just pulled) from local Docker daemon as a "docker save" tar archive,
+// so they could be transferred across isolated networks. Tar archive is streamed, i.e. never buffered as a whole.
+func (api *API) Export(ctx context.Context, refs []string, w io.Writer) error {
+	if len(refs) == 0 {
+		return errors.New("no images to export")
+	}
+
+	log.Infof("EXPORTING %s", strings.Join(refs, ", "))
+	if api.config.DryRun {
+		log.Infof("[DRY-RUN] EXPORTED %d images", len(refs))
+		return nil
+	}
+
+	dc, err := api.docker()
+	if err != nil {
+		return err
+	}
+
+	tar, err := dc.Save(ctx, refs)
+	if err != nil {
+		return err
+	}
+	defer tar.Close()
+
+	if _, err := io.Copy(w, tar); err != nil {
+		return fmt.Errorf("unable to export images: %s", err.Error())
+	}
+
+	log.Infof("EXPORTED %d images", len(refs))
+
+	return nil
+}
+
+// Import loads images into local Docker daemon from a "docker save" tar archive (e.g. one made by Export) being streamed
+func (api *API) Import(ctx context.Context, r io.Reader) error {
+	if api.config.DryRun {
+		log.Infof("[DRY-RUN] IMPORTED")
+		return nil
+	}
+
+	dc, err := api.docker()
+	if err != nil {
+		return err
+	}
+
+	resp, err := dc.Load(ctx, r)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	decoder := json.NewDecoder(resp)
+	for {
+		var msg struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		if msg.Error != "" {
+			return fmt.Errorf("unable to import images: %s", msg.Error)
+		}
+
+		if stream := strings.TrimSpace(msg.Stream); stream != "" {
+			log.Infof("IMPORTED %s", strings.TrimPrefix(strings.TrimPrefix(stream, "Loaded image: "), "Loaded image ID: "))
+		}
+	}
+}
+
+// PullIfChanged pulls a single "REPOSITORY:TAG" image, only if its digest in the registry differs from the known one
+// (e.g. the one we got on the previous run). It gives us the current digest, so caller could persist it for the next run.
+func (api *API) PullIfChanged(ctx context.Context, ref, knownDigest string) (bool, string, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return false, "", err
+	}
+	if !repo.IsSingle() || repo.HasDigest() {
+		return false, "", fmt.Errorf("need a reference with a single tag, e.g. 'alpine:latest', got: %s", ref)
+	}
+
+	tagName := repo.Tags()[0]
+	ref = repo.Name() + ":" + tagName
+
+	if pattern, denied := api.denylist.Match(repo, tagName); denied {
+		log.Infof("EXCLUDED %s (denylisted by '%s')", ref, pattern)
+
+		return false, "", fmt.Errorf("reference is denylisted by '%s': %s", pattern, ref)
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	digest, err := remote.FetchDigest(ctx, repo, tagName, username, password)
+	if err != nil {
+		return false, "", contextErr(ctx, err)
+	}
+
+	if digest == knownDigest {
+		log.Infof("UNCHANGED %s (%s)", ref, digest)
+
+		return false, digest, nil
+	}
+
+	log.Infof("PULLING %s (%s => %s)", ref, knownDigest, digest)
+	if api.config.DryRun {
+		log.Infof("[DRY-RUN] PULLED %s", ref)
+
+		return true, digest, nil
+	}
+
+	if err := api.pullImage(ctx, ref, nil); err != nil {
+		return false, "", contextErr(ctx, err)
+	}
+
+	return true, digest, nil
+}
+
+// CountTags counts tags of the repository (ones matched by its reference), without collecting any tag details,
+// i.e. much faster than CollectTags does. It is a cheap primitive for quotas and monitoring.
+func (api *API) CountTags(ctx context.Context, ref string) (int, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return 0, err
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	count, err := remote.CountTags(ctx, repo, username, password)
+	if err != nil {
+		return 0, contextErr(ctx, err)
+	}
+
+	return count, nil
+}
+
+// Latest gives us the newest tag of the repository (among ones matched by its reference), i.e. the greatest one
+// as compared by the "less" function passed (e.g. tag.SemverLess or a custom one for "build-<n>" tags).
+// Only tag names are fetched, unless "less" is nil: then tags are compared by creation time of tagged images
+// (see tag.CreatedLess), and tag details are fetched to get it. Gives *NoTagsError, if there are no tags to select from.
+func (api *API) Latest(ctx context.Context, ref string, less func(a, b string) bool) (string, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	var names []string
+	if less != nil {
+		names, err = remote.FetchTagNames(ctx, repo, username, password)
+	} else {
+		var tags map[string]*tag.Tag
+		tags, err = remote.FetchTags(ctx, repo, username, password)
+
+		names = make([]string, 0, len(tags))
+		for name := range tags {
+			names = append(names, name)
+		}
+
+		less = tag.CreatedLess(tags)
+	}
+	if err != nil {
+		return "", contextErr(ctx, err)
+	}
+	if len(names) == 0 {
+		return "", &NoTagsError{Ref: ref}
+	}
+
+	latest := names[0]
+	for _, name := range names[1:] {
+		if less(latest, name) {
+			latest = name
+		}
+	}
+
+	return latest, nil
+}
+
+// isPresentLocally checks local Docker daemon for the image with the same tag and digest (errors mean "not present")
+func (api *API) isPresentLocally(repo *repository.Repository, tg *tag.Tag) bool {
+	dc, err := api.docker()
+	if err != nil {
+		return false
+	}
+
+	localTags, err := local.FetchTags(repo, dc)
+	if err != nil {
+		log.Debugf("%s unable to fetch local tags of %s: %s", fn(), repo.Name(), err.Error())
+
+		return false
+	}
+
+	localTag, defined := localTags[tg.Name()]
+
+	return defined && localTag.GetDigest() == tg.GetDigest()
+}
+
+// ResolveDigest resolves "REPOSITORY@DIGEST_PREFIX" reference (e.g. "alpine@sha256:abc123") into the full one,
+// by the digests of repository images present in local Docker daemon, so it could be pulled or tagged then.
+// NB! It fails, if no local image matches the prefix or it matches more than one image.
+func (api *API) ResolveDigest(ref string) (string, error) {
+	refParts := strings.SplitN(ref, "@", 2)
+	if len(refParts) != 2 || refParts[1] == "" {
+		return "", fmt.Errorf("no digest in reference: %s", ref)
+	}
+
+	repo, err := repository.ParseRef(refParts[0])
+	if err != nil {
+		return "", err
+	}
+
+	dc, err := api.docker()
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := local.ResolveDigest(repo, refParts[1], dc)
+	if err != nil {
+		return "", err
+	}
+
+	return repo.Name() + "@" + digest, nil
+}
+
+// ResolveRef resolves reference to a single image into its fully-qualified canonical, digest-pinned form, e.g.
+// "docker.io/library/ubuntu:latest@sha256:..." for "ubuntu" (See repository.NormalizeRef), digest is taken from registry,
+// so no Docker daemon is needed. Reference having a full digest is checked to exist in registry and is given as is (normalized).
+// NB! Short digest prefix (e.g. "alpine@sha256:abc123") could only be resolved by local images (See ResolveDigest).
+func (api *API) ResolveRef(ctx context.Context, ref string) (string, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	if repo.HasDigest() && len(repo.Digest()) < len("sha256:")+64 {
+		if ref, err = api.ResolveDigest(ref); err != nil {
+			return "", err
+		}
+	}
+
+	normalized, err := repository.NormalizeRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	pinned := strings.Contains(normalized, "@")
+
+	reference := "latest"
+	switch {
+	case pinned:
+		reference = strings.SplitN(normalized, "@", 2)[1]
+	case repo.IsSingle():
+		reference = repo.Tags()[0]
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	digest, err := remote.ResolveDigest(ctx, repo, reference, username, password)
+	if err != nil {
+		return "", contextErr(ctx, err)
+	}
+
+	if pinned {
+		if digest != reference {
+			return "", fmt.Errorf("registry gives us another digest for %s: %s", normalized, digest)
+		}
+
+		return normalized, nil
+	}
+
+	return normalized + "@" + digest, nil
+}
+
+// ListPlatforms gives images the single image reference (e.g. "alpine:3.7" or "alpine@sha256:...") has for every platform,
+// i.e. all the children of multi-arch manifest list/index or the only platform of a single image, with their digests.
+// Everything is taken from registry, so no Docker daemon is needed.
+func (api *API) ListPlatforms(ctx context.Context, ref string) ([]client.PlatformImage, error) {
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	reference := "latest"
+	switch {
+	case repo.HasDigest():
+		reference = repo.Digest()
+	case repo.IsSingle():
+		reference = repo.Tags()[0]
+	case repo.HasTags() || repo.Filter() != ".*":
+		return nil, fmt.Errorf("reference should point to a single image: %s", ref)
+	}
+
+	username, password := api.getCredentials(repo.Registry(), "pull")
+
+	images, err := remote.FetchPlatforms(ctx, repo, reference, username, password)
+	if err != nil {
+		return nil, contextErr(ctx, err)
+	}
+
+	return images, nil
+}
 
 // PushTags compares images from remote and "push" (usually local) registries,
 // pulls images that are present in remote registry, but are not in "push" one
 // and then [re-]pushes them to the "push" registry.
 func (api *API) PushTags(cn *collection.Collection, push PushConfig) error {
+	_, err := api.PushTagsWithSummary(cn, push)
+
+	return err
+}
+
+// PushTagsWithSummary does the same as PushTags, but also gives a summary of what was [not] pushed
+// NB! Tags already present in the "push" registry are not in the "push" collection, so they are not counted.
+func (api *API) PushTagsWithSummary(cn *collection.Collection, push PushConfig) (*Summary, error) {
 	log.Debugf(
 		"%s 'push' collection: %+v (%d repos / %d tags)",
 		fn(), cn, cn.RepoCount(), cn.TagCount(),
 	)
 	log.Debugf("%s push config: %+v", fn(), push)
 
-	pushPathTemplate, terr := makePushPathTemplate(push)
-	if terr != nil {
-		return terr
+	request.RetryBudget.Reset()
+	transfer.ResetStats()
+
+	t := newTally()
+
+	rewrite, terr := makeRefRewriter(push)
+	if terr != nil {
+		return nil, terr
+	}
+
+	done := make(chan error, cn.TagCount())
+
+	if cn.TagCount() == 0 {
+		log.Infof("%s No tags to push", fn())
+		return t.Summary("push"), nil
+	}
+
+	pushTag := func(repo *repository.Repository, tg *tag.Tag) (bool, error) {
+		srcRef := repo.Name() + ":" + tg.Name()
+		dst, err := rewrite(Ref{Registry: repo.Registry(), Path: repo.Path(), Tag: tg.Name(), Digest: tg.GetDigest(), Created: tg.GetCreated()})
+		if err != nil {
+			return false, err
+		}
+		dstRef := dst.String()
+
+		if api.checkpoint != nil && api.checkpoint.Has(dstRef, tg.GetDigest()) {
+			log.Infof("[PULL/PUSH] CHECKPOINT %s => %s (already pushed)", srcRef, dstRef)
+			return false, nil
+		}
+
+		if !tg.IsImage() {
+			log.Infof("[PULL/PUSH] SKIPPING %s (not an image, but %s artifact)", srcRef, tg.GetArtifactType())
+			return false, nil
+		}
+
+		if !api.reserve(srcRef, tg.GetSize()) {
+			return false, nil
+		}
+
+		if err := api.checkDrift(repo, tg, push.Strict, push.SrcCredentials); err != nil {
+			return false, err
+		}
+
+		log.Infof("[PULL/PUSH] PUSHING %s => %s", srcRef, dstRef)
+		if api.config.DryRun {
+			log.Infof("[DRY-RUN] PUSHED %s => %s", srcRef, dstRef)
+			return true, nil
+		}
+
+		if api.config.PullIfMissing && api.isPresentLocally(repo, tg) {
+			log.Infof("[PULL/PUSH] PRESENT %s (same digest, not pulled)", srcRef)
+		} else {
+			api.config.Progress.Expect("pull", srcRef, tg.GetSize())
+
+			if err := api.pullImage(context.Background(), srcRef, push.SrcCredentials); err != nil {
+				return false, err
+			}
+		}
+
+		dc, err := api.docker()
+		if err != nil {
+			return false, err
+		}
+		dc.Tag(srcRef, dstRef)
+
+		pushedDigest, err := api.pushImage(dc, srcRef, dstRef, push.DstCredentials)
+		if err != nil {
+			return false, err
+		}
+		t.Authenticated(dst.Registry, func() dockerconfig.AuthDecision {
+			return api.explainCredentials(push.DstCredentials, dst.Registry)
+		})
+		if pushedDigest == "" {
+			pushedDigest = tg.GetDigest()
+		}
+
+		if push.IncludeReferrers {
+			api.pushes.Acquire()
+			err := api.pushReferrers(repo, dst.Registry, dst.Path, tg.GetDigest(), push)
+			api.pushes.Release()
+			if err != nil {
+				return false, err
+			}
+		}
+
+		if push.IndexTagSuffix != "" {
+			api.pushes.Acquire()
+			err := api.pushIndex(repo, tg.Name(), dst, pushedDigest, push)
+			api.pushes.Release()
+			if err != nil {
+				return false, err
+			}
+		}
+
+		if push.PostPush != nil {
+			if err := push.PostPush(dstRef, pushedDigest); err != nil {
+				return false, fmt.Errorf("post-push hook failed for %s@%s: %s", dstRef, pushedDigest, err.Error())
+			}
+			log.Infof("[PULL/PUSH] POST-PUSH %s@%s", dstRef, pushedDigest)
+		}
+
+		if api.checkpoint != nil {
+			if err := api.checkpoint.Add(dstRef, tg.GetDigest()); err != nil {
+				return false, err
+			}
+		}
+
+		return true, nil
+	}
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+		tags := cn.Tags(ref)
+
+		log.Debugf("%s repository: %+v", fn(), repo)
+		for _, tg := range tags {
+			log.Debugf("%s tag: %+v", fn(), tg)
+		}
+
+		go func(repo *repository.Repository, tags []*tag.Tag, done chan error) {
+			for _, tg := range tags {
+				pushed, err := pushTag(repo, tg)
+
+				switch {
+				case err != nil:
+					t.Failed(repo.Name()+":"+tg.Name(), err)
+				case pushed:
+					t.Done()
+				default:
+					t.Skipped()
+				}
+
+				done <- err
+			}
+		}(repo, tags, done)
+
+		time.Sleep(api.config.WaitBetween)
+	}
+
+	err := wait.WithTolerance(done)
+
+	summary := t.Summary("push")
+	summary.BudgetExhausted = api.budget.Exhausted()
+	summary.Stopped = api.Stopping()
+	summary.RetriesExhausted = request.RetryBudget.Exhausted()
+
+	// only manifest lists and referrers are pushed directly (See PushConfig.IndexTagSuffix and IncludeReferrers)
+	stats := transfer.GetStats()
+	summary.CopiedBytes, summary.SavedBytes = stats.CopiedBytes, stats.SavedBytes
+
+	return summary, err
+}
+
+// pushReferrers copies manifests referring to the image digest passed (signatures, SBOMs, attestations etc)
+// from the source repository to the destination one, registry to registry, without involving Docker daemon
+func (api *API) pushReferrers(repo *repository.Repository, registry, dstPath, digest string, push PushConfig) error {
+	srcUsername, srcPassword := api.credentials(push.SrcCredentials, repo.Registry(), "pull")
+	src, err := remote.Connect(repo.Registry(), srcUsername, srcPassword)
+	if err != nil {
+		return err
+	}
+
+	dstUsername, dstPassword := api.credentials(push.DstCredentials, registry, "push")
+	dst, err := remote.Connect(registry, dstUsername, dstPassword)
+	if err != nil {
+		return err
+	}
+
+	if c, err := api.probeCapabilities(push.SrcCredentials, repo.Registry(), repo.Path()); err == nil && !c.Referrers {
+		log.Warnf("%s SKIPPED referrers of %s@%s: registry %s does not support referrers API", fn(), repo.Name(), digest, repo.Registry())
+
+		return nil
+	}
+
+	count, err := transfer.Referrers(src, repo.Path(), dst, dstPath, digest)
+	if err != nil {
+		return fmt.Errorf("unable to copy referrers of %s@%s: %s", repo.Name(), digest, err.Error())
+	}
+
+	if count > 0 {
+		log.Infof("[PULL/PUSH] REFERRERS %s@%s => %s/%s (%d copied)", repo.Name(), digest, registry, dstPath, count)
+	}
+
+	return nil
+}
+
+// pushIndex copies the whole multi-arch index of the tag (registry to registry) under the tag with suffix (See PushConfig.IndexTagSuffix)
+// and reports digests of both the image pushed and the index. Single-arch tags have no index, so nothing is copied.
+func (api *API) pushIndex(repo *repository.Repository, tagName string, dst Ref, imageDigest string, push PushConfig) error {
+	srcUsername, srcPassword := api.credentials(push.SrcCredentials, repo.Registry(), "pull")
+	src, err := remote.Connect(repo.Registry(), srcUsername, srcPassword)
+	if err != nil {
+		return err
+	}
+
+	data, mediaType, indexDigest, err := src.ManifestData(repo.Path(), tagName)
+	if err != nil {
+		return err
+	}
+
+	content, err := manifest.ParseContent(mediaType, data)
+	if err != nil {
+		return err
+	}
+	if !content.IsIndex() {
+		log.Debugf("%s %s:%s is not a multi-arch image, no index to copy", fn(), repo.Name(), tagName)
+
+		return nil
+	}
+
+	dstUsername, dstPassword := api.credentials(push.DstCredentials, dst.Registry, "push")
+	dstClient, err := remote.Connect(dst.Registry, dstUsername, dstPassword)
+	if err != nil {
+		return err
+	}
+
+	indexTag := dst.Tag + push.IndexTagSuffix
+
+	if _, err := transfer.ManifestAs(src, repo.Path(), indexDigest, dstClient, dst.Path, indexTag); err != nil {
+		return fmt.Errorf("unable to copy index of %s:%s: %s", repo.Name(), tagName, err.Error())
 	}
-	pushTagTemplate, terr := makePushTagTemplate(push)
-	if terr != nil {
-		return terr
+
+	log.Infof("[PULL/PUSH] INDEX %s:%s => %s:%s (image: %s, index: %s)", repo.Name(), tagName, dst.Repository(), indexTag, imageDigest, indexDigest)
+
+	return nil
+}
+
+// Ping checks if registries passed are reachable (does not log in), giving us the first unreachable one as an error
+func (api *API) Ping(ctx context.Context, registries ...string) error {
+	for _, registry := range registries {
+		if err := remote.Ping(ctx, registry); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return fmt.Errorf("registry %s is not reachable: %w", registry, err)
+		}
 	}
 
-	done := make(chan error, cn.TagCount())
+	return nil
+}
 
-	if cn.TagCount() == 0 {
-		log.Infof("%s No tags to push", fn())
-		return nil
+// Login verifies credentials against the registry and, if they are accepted, saves them with the credential helper
+// configured in Docker JSON config file or into the file itself (See dockerconfig.SaveCredentials), so bad credentials are never saved.
+// Returns *auth.LoginError, if registry rejects credentials passed.
+func (api *API) Login(ctx context.Context, registry, username, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	for _, ref := range cn.Refs() {
-		repo := cn.Repo(ref)
-		tags := cn.Tags(ref)
+	if err := remote.VerifyCredentials(ctx, registry, username, password); err != nil {
+		return contextErr(ctx, err)
+	}
 
-		log.Debugf("%s repository: %+v", fn(), repo)
-		for _, tg := range tags {
-			log.Debugf("%s tag: %+v", fn(), tg)
+	if err := dockerconfig.SaveCredentials(api.config.DockerJSONConfigFile, registry, username, password); err != nil {
+		return err
+	}
+
+	api.dockerConfig.SetCredentials(registry, username, password)
+
+	log.Infof("LOGGED IN %s (as %s)", registry, username)
+
+	return nil
+}
+
+// splitRegistryGlob splits "REGISTRY[/GLOB]" into registry address and glob matching repository paths (if any)
+func splitRegistryGlob(s string) (string, string) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// CollectRepositories collects references to all repositories present in the registry catalog,
+// keeping only ones with paths matching the filter regexp passed (empty filter matches all of them)
+// NB! Registry could be passed as "REGISTRY/GLOB" (e.g. "registry.company.io/team-*") to match repository paths with glob too.
+func (api *API) CollectRepositories(registry, filter string) ([]string, error) {
+	registry, glob := splitRegistryGlob(registry)
+
+	return api.collectRepositories(registry, glob, filter)
+}
+
+func (api *API) collectRepositories(registry, glob, filter string) ([]string, error) {
+	filterRE, err := regexp.Compile(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	globRE, err := repository.CompileGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+
+	username, password := api.getCredentials(registry, "pull")
+
+	repoPaths, err := remote.FetchRepositories(registry, username, password)
+	if err != nil {
+		if c, _ := api.Capabilities(registry, ""); c != nil && !c.Catalog {
+			return nil, fmt.Errorf("registry %s does not let us list its repositories (no catalog support), pass repositories explicitly", registry)
 		}
 
-		go func(repo *repository.Repository, tags []*tag.Tag, done chan error) {
-			for _, tg := range tags {
-				srcRef := repo.Name() + ":" + tg.Name()
-				pushPrefix := getPushPrefix(push.Prefix, repo.PushPrefix())
-				if err := validatePushPrefix(pushPrefix); err != nil {
-					done <- err
-					return
-				}
-				pushPath := repo.PushPath(push.PathSeparator)
-				fullPath, perr := pushPathTemplate(pushPrefix, pushPath, repo.Name())
-				if perr != nil {
-					done <- perr
-					return
-				}
-				tagName, err := pushTagTemplate(pushPrefix, pushPath, repo.Name(), tg.Name())
-				if err != nil {
-					done <- err
-					return
-				}
-				dstRef := push.Registry + fullPath + ":" + tagName
+		return nil, err
+	}
+	log.Debugf("%s catalog: %+v", fn(registry), repoPaths)
 
-				log.Infof("[PULL/PUSH] PUSHING %s => %s", srcRef, dstRef)
-				if api.config.DryRun {
-					log.Infof("[DRY-RUN] PUSHED %s => %s", srcRef, dstRef)
-					done <- nil
-					continue
-				}
+	refs := make([]string, 0)
+	for _, repoPath := range repoPaths {
+		if (glob == "" || globRE.MatchString(repoPath)) && filterRE.MatchString(repoPath) {
+			refs = append(refs, registry+"/"+repoPath)
+		}
+	}
 
-				pullResp, err := api.dockerClient.Pull(srcRef)
-				if err != nil {
-					done <- err
-					return
-				}
-				logDebugData(pullResp)
+	return refs, nil
+}
 
-				api.dockerClient.Tag(srcRef, dstRef)
+// MirrorRegistry takes all repositories from the registry catalog (matching the filter passed)
+// and [re-]pushes their tags to the "push" registry. Repositories are processed in batches,
+// so we never run more than ConcurrentRequests repositories at once. Tags already present
+// in the "push" registry with the same digest are skipped, so interrupted mirror could be
+// just started again to continue from where it was stopped.
+// NB! Failure to mirror some repositories or tags is not fatal: we mirror all the others and
+// give *MirrorError in the end (failures are recorded in the MirrorSummary too).
+func (api *API) MirrorRegistry(registry, filter string, push PushConfig) (*MirrorSummary, error) {
+	refs, err := api.CollectRepositories(registry, filter)
+	if err != nil {
+		return nil, err
+	}
 
-				pushResp, err := api.dockerClient.Push(dstRef)
-				if err != nil {
-					done <- err
-					return
-				}
-				err = logDebugDataMaybeError(pushResp)
-				if err != nil {
-					errMsg := fmt.Sprintf("PUSH %s => %s failed: '%s'", srcRef, dstRef, err.Error())
-					done <- errors.New(errMsg)
-					return
-				}
+	started := time.Now()
 
-				done <- err
-			}
-		}(repo, tags, done)
+	summary := &MirrorSummary{Push: Summary{Operation: "push"}, Errors: make(map[string]error)}
+	defer func() { summary.Push.Duration = time.Since(started) }()
 
-		time.Sleep(api.config.WaitBetween)
+	if len(refs) == 0 {
+		log.Warnf("%s No repositories to mirror from: %s", fn(), registry)
+		return summary, nil
+	}
+
+	batchedSlicesOfRefs := getBatchedSlices(api.config.ConcurrentRequests, refs...)
+
+	for bindex, brefs := range batchedSlicesOfRefs {
+		log.Infof("MIRROR BATCH %d of %d", bindex+1, len(batchedSlicesOfRefs))
+
+		cn := api.collectMirrorTags(brefs, summary.Errors)
+		if cn == nil {
+			continue
+		}
+
+		cn, pushCn := api.collectMirrorPushTags(cn, push, summary.Errors)
+		if pushCn == nil {
+			continue
+		}
+
+		pushSummary, err := api.PushTagsWithSummary(pushCn, push)
+		if pushSummary == nil {
+			return summary, err
+		}
+		summary.Push.Add(pushSummary)
+		summary.Push.Skipped += cn.TagCount() - pushCn.TagCount()
+
+		summary.Repositories += cn.RepoCount()
+		summary.Tags += cn.TagCount()
+		summary.Pushed += pushCn.TagCount() - pushSummary.Failed
+
+		log.Infof(
+			"MIRRORED %d of %d repos (%d tags analyzed, %d tags pushed)",
+			summary.Repositories, len(refs), summary.Tags, summary.Pushed,
+		)
+
+		if api.budget.Exhausted() {
+			log.Warnf("MIRROR STOPPED after batch %d of %d: pull budget exhausted", bindex+1, len(batchedSlicesOfRefs))
+			break
+		}
+
+		if api.Stopping() {
+			log.Warnf("MIRROR STOPPED after batch %d of %d: stop requested", bindex+1, len(batchedSlicesOfRefs))
+			break
+		}
+	}
+
+	if len(summary.Errors) != 0 || len(summary.Push.Errors) != 0 {
+		return summary, &MirrorError{Repos: summary.Errors, Tags: summary.Push.Errors}
+	}
+
+	return summary, nil
+}
+
+// collectMirrorTags collects tags of the repositories passed, recording errors of ones we failed to collect tags of,
+// gives us collection of all the other repositories (or nil, if there are none)
+func (api *API) collectMirrorTags(refs []string, errs map[string]error) *collection.Collection {
+	tags, err := api.CollectTagsByRepo(context.Background(), refs)
+	if collectErr, is := err.(*CollectError); is {
+		for ref, err := range collectErr.Errors {
+			errs[ref] = err
+		}
+	}
+
+	collectedRefs := make([]string, 0, len(tags))
+	for _, ref := range refs {
+		if _, collected := tags[ref]; collected {
+			collectedRefs = append(collectedRefs, ref)
+		}
+	}
+
+	return api.mirrorCollection(collectedRefs, tags, errs)
+}
+
+// collectMirrorPushTags does the same as CollectPushTags, but if it fails, it analyzes repositories one by one,
+// so failure of a single repository does not fail the others (errors are recorded, as collectMirrorTags does).
+// It gives us collection passed narrowed down to the repositories analyzed successfully too (or nils, if none were).
+func (api *API) collectMirrorPushTags(cn *collection.Collection, push PushConfig, errs map[string]error) (*collection.Collection, *collection.Collection) {
+	pushCn, err := api.CollectPushTags(cn, push)
+	if err == nil {
+		return cn, pushCn
+	}
+
+	if cn.RepoCount() == 1 {
+		log.Warnf("FAILED %s: %s", cn.Refs()[0], err.Error())
+
+		errs[cn.Refs()[0]] = err
+		return nil, nil
+	}
+
+	refs := make([]string, 0, cn.RepoCount())
+	tags := make(map[string][]*tag.Tag, cn.RepoCount())
+	pushTags := make(map[string][]*tag.Tag, cn.RepoCount())
+
+	for _, ref := range cn.Refs() {
+		repoCn, err := collection.New([]string{ref}, map[string][]*tag.Tag{ref: cn.Tags(ref)})
+		if err == nil {
+			repoCn, err = api.CollectPushTags(repoCn, push)
+		}
+		if err != nil {
+			log.Warnf("FAILED %s: %s", ref, err.Error())
+
+			errs[ref] = err
+			continue
+		}
+
+		refs = append(refs, ref)
+		tags[ref] = cn.Tags(ref)
+		pushTags[ref] = repoCn.Tags(ref)
+	}
+
+	cn = api.mirrorCollection(refs, tags, errs)
+	if cn == nil {
+		return nil, nil
+	}
+
+	return cn, api.mirrorCollection(refs, pushTags, errs)
+}
+
+// mirrorCollection creates collection of the repositories passed, recording errors for all of them, if we fail to
+func (api *API) mirrorCollection(refs []string, tags map[string][]*tag.Tag, errs map[string]error) *collection.Collection {
+	if len(refs) == 0 {
+		return nil
+	}
+
+	cn, err := collection.New(refs, tags)
+	if err != nil {
+		for _, ref := range refs {
+			errs[ref] = err
+		}
+		return nil
 	}
 
-	return wait.WithTolerance(done)
+	return cn
+}
+
+// pushTagTemplateData is what push tag template could use: push prefix, path, name, and source tag metadata
+type pushTagTemplateData struct {
+	Prefix  string
+	Path    string
+	Name    string
+	Tag     string
+	Digest  string
+	Created time.Time
 }
 
-func makePushTagTemplate(push PushConfig) (func(pushPrefix, pushPath, name, tag string) (string, error), error) {
+func makePushTagTemplate(push PushConfig) (func(pushPrefix, pushPath, name string, src Ref) (string, error), error) {
 	tpl, err := template.New("push-tag-template").
 		Funcs(sprig.FuncMap()).Parse(push.TagTemplate)
 	if err != nil {
 		return nil, err
 	}
 
-	return func(pushPrefix, pushPath, name, tag string) (string, error) {
+	execute := func(data pushTagTemplateData) (string, error) {
 		var tout bytes.Buffer
-		err = tpl.Execute(&tout, struct{ Prefix, Path, Name, Tag string }{pushPrefix, pushPath, name, tag})
-		if err != nil {
+		if err := tpl.Execute(&tout, data); err != nil {
 			return "", err
 		}
 		return tout.String(), nil
+	}
+
+	// try template on sample data, so we fail before the run, not in the middle of it
+	sample, err := execute(pushTagTemplateData{
+		Prefix:  "/",
+		Path:    "sample",
+		Name:    "sample",
+		Tag:     "latest",
+		Digest:  "sha256:" + strings.Repeat("0", 64),
+		Created: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid push tag template: %s", err.Error())
+	}
+	if !refTagRE.MatchString(sample) {
+		return nil, fmt.Errorf("push tag template gives invalid tag: %q (should match %s)", sample, refTagRE)
+	}
+
+	return func(pushPrefix, pushPath, name string, src Ref) (string, error) {
+		var created time.Time
+		if src.Created != 0 {
+			created = time.Unix(src.Created, 0).UTC()
+		}
+
+		return execute(pushTagTemplateData{
+			Prefix:  pushPrefix,
+			Path:    pushPath,
+			Name:    name,
+			Tag:     src.Tag,
+			Digest:  src.Digest,
+			Created: created,
+		})
 	}, nil
 }
 
+// pullImage pulls image through Docker daemon, aborting and retrying pull, if it stalls (or giving up, if context is done)
+// NB! Explicit credentials (See PushConfig.SrcCredentials) are used, if passed, Docker config ones otherwise.
+func (api *API) pullImage(ctx context.Context, ref string, auth *Credentials) error {
+	api.pulls.Acquire()
+	defer api.pulls.Release()
+
+	pullRef, err := api.selectedImageRef(ctx, ref, auth)
+	if err != nil {
+		return err
+	}
+
+	err = api.pullImageOnce(ctx, pullRef, auth)
+
+	for try := 1; try <= api.config.RetryRequests; try++ {
+		if _, stalled := err.(*progress.StalledError); !stalled || api.Stopping() || ctx.Err() != nil {
+			break
+		}
+
+		if !request.RetryBudget.Take() {
+			log.Warnf("%s (will NOT retry, retry budget exhausted)", err)
+			break
+		}
+
+		log.Warnf("%s (will retry in %v)", err, api.config.RetryDelay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(api.config.RetryDelay):
+		}
+
+		err = api.pullImageOnce(ctx, pullRef, auth)
+	}
+
+	if err != nil || pullRef == ref {
+		return err
+	}
+
+	dc, err := api.docker()
+	if err != nil {
+		return err
+	}
+
+	return dc.Tag(pullRef, ref)
+}
+
+// selectedImageRef gives "REPOSITORY@DIGEST" reference of the image selected by annotation or platform set explicitly
+// (See Config.Annotation and Config.Platform) from the multi-arch tag, so we pull it instead of the tag itself
+// (Docker daemon selects images by the platform it runs on only)
+func (api *API) selectedImageRef(ctx context.Context, ref string, auth *Credentials) (string, error) {
+	if api.config.Annotation == "" && api.config.Platform == "" {
+		return ref, nil
+	}
+
+	repo, err := repository.ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	tagName := repo.Tags()[0]
+
+	username, password := api.credentials(auth, repo.Registry(), "pull")
+
+	digest, err := remote.FetchSelectedImageDigest(ctx, repo, tagName, username, password)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		return ref, nil
+	}
+
+	if api.config.Annotation != "" {
+		log.Infof("SELECTED %s@%s (annotated with %s)", ref, digest, api.config.Annotation)
+	} else {
+		log.Infof("SELECTED %s@%s (platform %s)", ref, digest, api.config.Platform)
+	}
+
+	return repo.Name() + "@" + digest, nil
+}
+
+func (api *API) pullImageOnce(ctx context.Context, ref string, auth *Credentials) error {
+	dc, err := api.docker()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var watchdog *progress.Watchdog
+	if api.config.PullStallTimeout > 0 {
+		watchdog = progress.NewWatchdog(api.config.PullStallTimeout, cancel)
+		defer watchdog.Stop()
+	}
+
+	var resp io.ReadCloser
+	if auth != nil {
+		resp, err = dc.PullContextWithAuth(ctx, ref, auth.registryAuth())
+	} else {
+		resp, err = dc.PullContext(ctx, ref)
+	}
+	if err == nil {
+		logDebugData(api.config.Progress.Track("pull", ref, watchdog.Watch(resp)))
+		resp.Close()
+	}
+	if watchdog.Stalled() {
+		err = &progress.StalledError{Operation: "pull", Ref: ref, Timeout: api.config.PullStallTimeout}
+	}
+	api.config.Progress.Finish("pull", ref, err)
+
+	return err
+}
+
+// pushImage pushes image tagged as "push" reference passed through Docker daemon and gives us its digest (if daemon tells it)
+// NB! Explicit credentials (See PushConfig.DstCredentials) are used, if passed, Docker config ones otherwise.
+func (api *API) pushImage(dc *dockerclient.DockerClient, srcRef, dstRef string, auth *Credentials) (string, error) {
+	api.pushes.Acquire()
+	defer api.pushes.Release()
+
+	var resp io.ReadCloser
+	var err error
+	if auth != nil {
+		resp, err = dc.PushWithAuth(dstRef, auth.registryAuth())
+	} else {
+		resp, err = dc.Push(dstRef)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := logPushDataMaybeError(api.config.Progress.Track("push", dstRef, resp))
+	api.config.Progress.Finish("push", dstRef, err)
+	if err != nil {
+		return "", fmt.Errorf("PUSH %s => %s failed: '%s'", srcRef, dstRef, err.Error())
+	}
+
+	return digest, nil
+}
+
 func logDebugData(data io.Reader) {
 	scanner := bufio.NewScanner(data)
 	for scanner.Scan() {
@@ -545,10 +2238,24 @@ func logDebugData(data io.Reader) {
 	}
 }
 
-func logDebugDataMaybeError(data io.Reader) error {
+// logPushDataMaybeError logs push stream Docker daemon gives us, failing on the first error message,
+// and gives us digest of the image pushed, if daemon reported it ("aux" message at the end of the stream)
+func logPushDataMaybeError(data io.Reader) (string, error) {
+	var digest string
+
 	scanner := bufio.NewScanner(data)
 	for scanner.Scan() {
 		msg := scanner.Text()
+		if strings.Contains(msg, `"aux":`) {
+			aux := struct {
+				Aux struct {
+					Digest string `json:"Digest"`
+				} `json:"aux"`
+			}{}
+			if err := json.Unmarshal([]byte(msg), &aux); err == nil && aux.Aux.Digest != "" {
+				digest = aux.Aux.Digest
+			}
+		}
 		// error message need return error
 		if strings.Index(msg, `"error":`) > 0 {
 			dataErr := struct {
@@ -556,40 +2263,96 @@ func logDebugDataMaybeError(data io.Reader) error {
 			}{}
 			err := json.Unmarshal([]byte(msg), &dataErr)
 			if err != nil {
-				return err
+				return "", err
 			}
 			if len(dataErr.Error) > 0 {
-				return errors.New(dataErr.Error)
+				return "", errors.New(dataErr.Error)
 			}
 			break
 		}
 		log.Debug(msg)
 	}
-	return nil
+	return digest, nil
 }
 
 // New creates new instance of application API
 func New(config Config) (*API, error) {
-	if config.VerboseLogging {
+	if config.VerboseLogging || config.LogRequests {
 		log.SetLevel(log.DebugLevel)
 	}
 	log.Debugf("%s API config: %+v", fn(), config)
 
+	transport.LogRequests = config.LogRequests
+	transport.Registries.SetHostLimit(config.MaxRegistryRequests)
+
+	timeouts := transport.DefaultTimeouts
+	if config.DialTimeout != 0 {
+		timeouts.Dial = config.DialTimeout
+	}
+	if config.HandshakeTimeout != 0 {
+		timeouts.TLSHandshake = config.HandshakeTimeout
+	}
+	if config.HeaderTimeout != 0 {
+		timeouts.ResponseHeader = config.HeaderTimeout
+	}
+	transport.Registries.SetTimeouts(timeouts)
+
 	if config.ConcurrentRequests == 0 {
 		config.ConcurrentRequests = 8
 	}
+	if config.ScanConcurrency == 0 {
+		config.ScanConcurrency = config.ConcurrentRequests
+	}
 	remote.ConcurrentRequests = config.ConcurrentRequests
 	remote.WaitBetween = config.WaitBetween
 	remote.TraceRequests = config.TraceRequests
 	remote.RetryRequests = config.RetryRequests
 	remote.RetryDelay = config.RetryDelay
+	request.RetryBudget = request.NewBudget(config.RetryBudget)
+	remote.MaxTags = config.MaxTags
+	remote.MaxManifestBytes = config.MaxManifestBytes
+	remote.UseHubAPI = config.UseHubAPI
+	remote.AuthRegistries = make(map[string]string, len(config.AuthRegistries))
+	for registry, identity := range config.AuthRegistries {
+		remote.AuthRegistries[registry] = identity
+	}
+
+	platform, err := manifest.ParsePlatform(config.Platform)
+	if err != nil {
+		return nil, err
+	}
+	remote.Platform = platform
+	annotation, err := manifest.ParseAnnotation(config.Annotation)
+	if err != nil {
+		return nil, err
+	}
+	remote.Annotation = annotation
+	remote.FetchSizes = config.MaxPullBytes > 0
+	remote.FetchBlobs = config.TotalSize
+	remote.FetchLayers = config.MaxLayers > 0
+	local.FetchLastPulled = config.FetchLastPulled
+
+	transfer.Limiter = throttle.New(config.BandwidthLimit)
+	if config.LayerConcurrency > 0 {
+		transfer.LayerConcurrency = config.LayerConcurrency
+	}
 
 	cache.WaitBetween = config.WaitBetween
+	cache.MaxTokenAge = config.MaxTokenAge
 
 	if config.InsecureRegistryEx != "" {
 		repository.InsecureRegistryEx = config.InsecureRegistryEx
 	}
 
+	if config.DefaultRegistry != "" {
+		repo, err := repository.ParseRef(config.DefaultRegistry + "/library/alpine")
+		if err != nil || repo.Registry() != config.DefaultRegistry {
+			return nil, fmt.Errorf("invalid default registry: %s (should be: REGISTRY[:PORT])", config.DefaultRegistry)
+		}
+
+		repository.DefaultRegistry = config.DefaultRegistry
+	}
+
 	if config.DockerJSONConfigFile == "" {
 		config.DockerJSONConfigFile = dockerconfig.DefaultDockerJSON
 	}
@@ -597,13 +2360,47 @@ func New(config Config) (*API, error) {
 	if err != nil {
 		return nil, err
 	}
-	dockerClient, err := dockerclient.New(dockerConfig)
+	for registry, identity := range config.AuthRegistries {
+		dockerConfig.SetAuthRegistry(registry, identity)
+	}
+	remote.ScopedCredentials = func(ctx context.Context, registry, scope, username, password string) (string, string) {
+		username, password, decision, scoped := dockerConfig.ResolveScopedCredentials(ctx, registry, scope, username, password)
+		if scoped || len(decision.ProviderFailures) != 0 {
+			log.Debugf("%s %s", fn(), decision)
+		}
+
+		return username, password
+	}
+
+	denylist, err := newDenylist(config.Denylist)
+	if err != nil {
+		return nil, err
+	}
+
+	capture, err := newCapture(config.CapturePattern, config.CaptureFilters)
 	if err != nil {
 		return nil, err
 	}
 
+	var cp *checkpoint.Checkpoint
+	if config.CheckpointFile != "" {
+		cp, err = checkpoint.Load(config.CheckpointFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("CHECKPOINT %s (%d pushes completed)", cp.Path(), cp.Count())
+	}
+
 	return &API{
 		config:       config,
-		dockerClient: dockerClient,
+		dockerConfig: dockerConfig,
+		checkpoint:   cp,
+		budget:       newBudget(config.MaxPullBytes, config.MaxPullImages),
+		denylist:     denylist,
+		capture:      capture,
+		capabilities: newCapabilities(),
+		pulls:        newLimit(config.PullConcurrency),
+		pushes:       newLimit(config.PushConcurrency),
+		scans:        newLimit(config.ScanConcurrency),
 	}, nil
 }
@@ -1,7 +1,17 @@
 package v1
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,8 +19,12 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/api/v1/registry/client/auth"
 	registrycontainer "github.com/ivanilves/lstags/api/v1/registry/container"
 	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag"
+	"github.com/ivanilves/lstags/tag/manifest"
 )
 
 func runEnd2EndJob(pullRefs, seedRefs []string) ([]string, error) {
@@ -162,6 +176,25 @@ func TestNew_InsecureRegistryEx(t *testing.T) {
 	assert.Equal(ex, repository.InsecureRegistryEx)
 }
 
+func TestNew_DefaultRegistry(t *testing.T) {
+	defer func() { repository.DefaultRegistry = repository.HubRegistry }()
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DefaultRegistry: "registry.internal:5000"})
+
+	assert.NotNil(api)
+	assert.Nil(err)
+	assert.Equal("registry.internal:5000", repository.DefaultRegistry)
+
+	for _, invalid := range []string{"internal", "registry.internal/mirror", "REGISTRY.internal"} {
+		api, err = New(Config{DefaultRegistry: invalid})
+
+		assert.Nil(api)
+		assert.NotNil(err, "should fail with invalid default registry: "+invalid)
+	}
+}
+
 func TestNew_InvalidDockerJSONConfigFile(t *testing.T) {
 	assert := assert.New(t)
 
@@ -172,6 +205,48 @@ func TestNew_InvalidDockerJSONConfigFile(t *testing.T) {
 	assert.NotNil(err)
 }
 
+func TestNew_CheckpointFile(t *testing.T) {
+	assert := assert.New(t)
+
+	api, err := New(Config{CheckpointFile: "/i/do/not/exist/sorry"})
+
+	assert.NotNil(api, "should start with empty checkpoint, if file does not exist yet")
+	assert.Nil(err)
+
+	api, err = New(Config{CheckpointFile: "/"})
+
+	assert.Nil(api)
+	assert.NotNil(err, "should fail to load checkpoint from a directory")
+}
+
+func TestNew_Platform(t *testing.T) {
+	assert := assert.New(t)
+
+	api, err := New(Config{Platform: "linux/arm/v7"})
+
+	assert.NotNil(api)
+	assert.Nil(err)
+
+	api, err = New(Config{Platform: "linux"})
+
+	assert.Nil(api)
+	assert.NotNil(err, "should fail with invalid platform")
+}
+
+func TestNew_Annotation(t *testing.T) {
+	assert := assert.New(t)
+
+	api, err := New(Config{Annotation: "org.opencontainers.image.ref.name=slim"})
+
+	assert.NotNil(api)
+	assert.Nil(err)
+
+	api, err = New(Config{Annotation: "slim"})
+
+	assert.Nil(api)
+	assert.NotNil(err, "should fail with invalid annotation")
+}
+
 func TestGetPushPrefix(t *testing.T) {
 	var testCases = map[string]struct {
 		prefix        string
@@ -265,7 +340,7 @@ func TestMakePushTagTemplate(t *testing.T) {
 		TagTemplate: "{{ .Tag }}"})
 	assert.NoError(t, err)
 
-	actualDefault, err := defaultTemplate("starter/", "kill/me", "bill", "1.0.0")
+	actualDefault, err := defaultTemplate("starter/", "kill/me", "bill", Ref{Tag: "1.0.0"})
 	assert.NoError(t, err)
 	assert.Equal(t, "1.0.0", actualDefault)
 
@@ -274,7 +349,7 @@ func TestMakePushTagTemplate(t *testing.T) {
 		TagTemplate: "{{ .Tag }}-prd"})
 	assert.NoError(t, err)
 
-	suffixTag, err := suffixTemplate("volavola/", "kill/me", "bill", "2.1.3")
+	suffixTag, err := suffixTemplate("volavola/", "kill/me", "bill", Ref{Tag: "2.1.3"})
 	assert.NoError(t, err)
 	assert.Equal(t, "2.1.3-prd", suffixTag)
 
@@ -284,9 +359,29 @@ func TestMakePushTagTemplate(t *testing.T) {
 	assert.NoError(t, err)
 
 	curDate := time.Now().Format("20060102")
-	actualDate, err := dateTemplate("starter/", "kill/me", "bill", "16.3.1")
+	actualDate, err := dateTemplate("starter/", "kill/me", "bill", Ref{Tag: "16.3.1"})
 	assert.NoError(t, err)
 	assert.Equal(t, "SNAPSHOT-16.3.1-"+curDate, actualDate)
+
+	// Use source tag metadata: creation date and digest
+	metadataTemplate, err := makePushTagTemplate(PushConfig{
+		TagTemplate: `mirrored-{{ .Created.Format "20060102" }}-{{ .Tag }}-{{ .Digest | trimPrefix "sha256:" | trunc 7 }}`})
+	assert.NoError(t, err)
+
+	actualMetadata, err := metadataTemplate("starter/", "kill/me", "bill", Ref{
+		Tag:     "1.0",
+		Digest:  "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		Created: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC).Unix(),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "mirrored-20230501-1.0-0123456", actualMetadata)
+
+	// Templates are tried before the run
+	_, err = makePushTagTemplate(PushConfig{TagTemplate: "{{ .Tga }}"})
+	assert.Error(t, err, "should fail on unknown field")
+
+	_, err = makePushTagTemplate(PushConfig{TagTemplate: "{{ .Tag }}:{{ .Digest }}"})
+	assert.Error(t, err, "should fail on template giving invalid tags")
 }
 
 func TestValidatePushPrefix(t *testing.T) {
@@ -296,3 +391,1085 @@ func TestValidatePushPrefix(t *testing.T) {
 	assert.Error(t, validatePushPrefix("/baz"))
 	assert.Error(t, validatePushPrefix("http://localhost:5000"))
 }
+
+func TestCollectRepositories(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.String() {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/_catalog":
+			w.Header().Set("Link", `</v2/_catalog?last=team-b%2Fapp&n=2>; rel="next"`)
+			w.Write([]byte(`{"repositories":["team-a/app","team-b/app"]}`))
+		case "/v2/_catalog?last=team-b%2Fapp&n=2":
+			w.Write([]byte(`{"repositories":["team-a/db"]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	var testCases = map[string][]string{
+		"":         {registry + "/team-a/app", registry + "/team-b/app", registry + "/team-a/db"},
+		"^team-a/": {registry + "/team-a/app", registry + "/team-a/db"},
+		"/db$":     {registry + "/team-a/db"},
+		"^nope/":   {},
+	}
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	for filter, expected := range testCases {
+		refs, err := api.CollectRepositories(registry, filter)
+
+		assert.Nil(err, "should be no error (filter: %s)", filter)
+
+		assert.Equal(expected, refs, "unexpected repositories (filter: %s)", filter)
+	}
+
+	var globTestCases = map[string][]string{
+		registry + "/team-*":     {registry + "/team-a/app", registry + "/team-b/app", registry + "/team-a/db"},
+		registry + "/team-a":     {registry + "/team-a/app", registry + "/team-a/db"},
+		registry + "/team-?/app": {registry + "/team-a/app", registry + "/team-b/app"},
+		registry + "/*/db":       {registry + "/team-a/db"},
+	}
+
+	for registryGlob, expected := range globTestCases {
+		refs, err := api.CollectRepositories(registryGlob, "")
+
+		assert.Nil(err, "should be no error (registry: %s)", registryGlob)
+
+		assert.Equal(expected, refs, "unexpected repositories (registry: %s)", registryGlob)
+	}
+
+	refs, err := api.CollectRepositories(registry+"/team-*", "/app$")
+
+	assert.Nil(err)
+	assert.Equal([]string{registry + "/team-a/app", registry + "/team-b/app"}, refs, "should apply both glob and filter")
+
+	_, err = api.CollectRepositories(registry, "(")
+
+	assert.NotNil(err, "should be an error for invalid filter")
+}
+
+func TestMirrorRegistry_Failures(t *testing.T) {
+	const d1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	srcCatalog := runCatalogRegistry(map[string]map[string]string{
+		"app":    {"v1": d1, "v2": d1},
+		"broken": {"latest": d1},
+		"denied": {"latest": d1},
+	})
+	defer srcCatalog.Close()
+	srcServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v2/broken/") {
+			http.Error(w, "broken", http.StatusForbidden)
+			return
+		}
+
+		srcCatalog.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer srcServer.Close()
+	dstCatalog := runCatalogRegistry(map[string]map[string]string{"app": {}})
+	defer dstCatalog.Close()
+	dstServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/v2/denied/") {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+
+		dstCatalog.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer dstServer.Close()
+
+	src := strings.TrimPrefix(srcServer.URL, "http://")
+	dst := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true, ConcurrentRequests: 3})
+	assert.Nil(err)
+
+	summary, err := api.MirrorRegistry(src, "", PushConfig{
+		Registry:      dst,
+		Prefix:        "/",
+		PathSeparator: "/",
+		PathTemplate:  "{{ .Prefix }}{{ .Path }}",
+	})
+
+	assert.IsType(&MirrorError{}, err, "should tell us about repositories we failed to mirror")
+	assert.NotNil(summary)
+	assert.Len(summary.Errors, 2)
+	assert.Contains(summary.Errors, src+"/broken", "should record repository we failed to collect tags of")
+	assert.Contains(summary.Errors, src+"/denied", "should record repository we failed to analyze in \"push\" registry")
+	assert.Equal(1, summary.Repositories, "should mirror all the other repositories")
+	assert.Equal(2, summary.Tags)
+	assert.Equal(2, summary.Pushed)
+	assert.Equal(2, summary.Push.Done)
+}
+
+func TestLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, _ := r.BasicAuth()
+
+		if username != "foo" || password != "bar" {
+			w.Header().Set("Www-Authenticate", `Basic realm="Registry"`)
+			w.WriteHeader(401)
+			return
+		}
+
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	dockerJSON := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(dockerJSON, []byte(`{"auths":{}}`), 0600)
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DockerJSONConfigFile: dockerJSON})
+	assert.Nil(err)
+
+	err = api.Login(context.Background(), registry, "foo", "wrong")
+	assert.NotNil(err, "should fail with wrong credentials")
+	_, isLoginError := err.(*auth.LoginError)
+	assert.True(isLoginError, "should fail with *auth.LoginError, got: %#v", err)
+
+	data, _ := ioutil.ReadFile(dockerJSON)
+	assert.NotContains(string(data), registry, "should NOT save wrong credentials")
+
+	err = api.Login(context.Background(), registry, "foo", "bar")
+	assert.Nil(err, "should log in with correct credentials")
+
+	data, _ = ioutil.ReadFile(dockerJSON)
+	assert.Contains(string(data), registry, "should save correct credentials")
+
+	username, password, _ := api.dockerConfig.GetCredentials(registry)
+	assert.Equal("foo:bar", username+":"+password, "should use saved credentials right away")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(context.Canceled, api.Login(ctx, registry, "foo", "bar"))
+}
+
+// runTokenRegistry runs registry with "Bearer" token authentication serving "foo:latest" tag only,
+// tokens are issued for username and password passed (or for anyone, if no username is passed)
+func runTokenRegistry(username, password string) *httptest.Server {
+	var server *httptest.Server
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := "token-for-" + strings.TrimPrefix(server.URL, "http://")
+
+		if r.URL.Path == "/token" {
+			u, p, _ := r.BasicAuth()
+			if username != "" && (u != username || p != password) {
+				w.WriteHeader(401)
+				return
+			}
+
+			w.Write([]byte(`{"token":"` + token + `"}`))
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.Header().Set("Www-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+			w.WriteHeader(401)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+		case "/v2/foo/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return server
+}
+
+func TestCollectPushTags_SeparateCredentials(t *testing.T) {
+	srcServer := runTokenRegistry("", "")
+	defer srcServer.Close()
+	dstServer := runTokenRegistry("foo", "bar")
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	dockerJSON := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(dockerJSON, []byte(`{"auths":{"`+dstRegistry+`":{"auth":"Zm9vOmJhcg=="}}}`), 0600)
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DockerJSONConfigFile: dockerJSON})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(srcRegistry + "/foo")
+	assert.Nil(err, "should pull anonymously from the source registry")
+	assert.Equal(1, cn.TagCount())
+
+	pushCn, err := api.CollectPushTags(cn, PushConfig{
+		Registry:      dstRegistry,
+		Prefix:        "/",
+		PathSeparator: "/",
+		PathTemplate:  "{{ .Prefix }}{{ .Path }}",
+	})
+	assert.Nil(err, "should use credentials of the destination registry")
+	assert.Equal(0, pushCn.TagCount(), "should see tag already pushed to the destination registry")
+}
+
+func TestCollectPushTags_DstCredentials(t *testing.T) {
+	srcServer := runTokenRegistry("", "")
+	defer srcServer.Close()
+	dstServer := runTokenRegistry("ci", "ephemeral")
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	dockerJSON := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(dockerJSON, []byte(`{"auths":{"`+dstRegistry+`":{"auth":"Zm9vOmJhcg=="}}}`), 0600)
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DockerJSONConfigFile: dockerJSON})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(srcRegistry + "/foo")
+	assert.Nil(err)
+
+	push := PushConfig{
+		Registry:      dstRegistry,
+		Prefix:        "/",
+		PathSeparator: "/",
+		PathTemplate:  "{{ .Prefix }}{{ .Path }}",
+	}
+
+	_, err = api.CollectPushTags(cn, push)
+	assert.NotNil(err, "should fail with (wrong) credentials from Docker config")
+
+	push.DstCredentials = &Credentials{Username: "ci", Password: "ephemeral"}
+
+	pushCn, err := api.CollectPushTags(cn, push)
+	assert.Nil(err, "should use explicit credentials for the destination registry, bypassing Docker config")
+	assert.Equal(0, pushCn.TagCount(), "should see tag already pushed to the destination registry")
+
+	issues := api.Validate(context.Background(), []string{srcRegistry + "/foo"}, &push)
+	assert.Empty(issues, "should validate with explicit credentials for the destination registry")
+
+	// promotion inside the same (Basic auth) registry: "reader" could only read "foo", "ci" could only read "promoted/foo"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, _ := r.BasicAuth()
+
+		allowed := map[string]bool{
+			"reader:r":     r.URL.Path == "/v2/" || strings.HasPrefix(r.URL.Path, "/v2/foo/"),
+			"ci:ephemeral": r.URL.Path == "/v2/" || strings.HasPrefix(r.URL.Path, "/v2/promoted/foo/"),
+		}
+		if !allowed[u+":"+p] {
+			w.Header().Set("Www-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(401)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/":
+			w.Write([]byte("{}"))
+		case strings.HasSuffix(r.URL.Path, "/tags/list"):
+			w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+		default:
+			w.Header().Set("Docker-Content-Digest", "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+			w.Write([]byte(`{"schemaVersion":2}`))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	ioutil.WriteFile(dockerJSON, []byte(`{"auths":{"`+registry+`":{"auth":"cmVhZGVyOnI="}}}`), 0600)
+
+	api, err = New(Config{DockerJSONConfigFile: dockerJSON})
+	assert.Nil(err)
+
+	cn, err = api.CollectTags(registry + "/foo")
+	assert.Nil(err, "should log in to the registry with Docker config credentials")
+
+	push = PushConfig{
+		Registry:       registry,
+		Prefix:         "/promoted/",
+		PathSeparator:  "/",
+		PathTemplate:   "{{ .Prefix }}{{ .Path }}",
+		DstCredentials: &Credentials{Username: "ci", Password: "ephemeral"},
+	}
+
+	pushCn, err = api.CollectPushTags(cn, push)
+	assert.Nil(err, "should not reuse token of Docker config credentials for explicit ones (same registry)")
+	assert.Equal(0, pushCn.TagCount(), "should see tag already promoted")
+}
+
+func TestCollectPushTags_TagTemplate(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	srcServer := runCatalogRegistry(map[string]map[string]string{"foo": {"v1": digest}})
+	defer srcServer.Close()
+	dstServer := runCatalogRegistry(map[string]map[string]string{"foo": {"v1": digest, "v1-mirrored": digest}})
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(srcRegistry + "/foo")
+	assert.Nil(err)
+
+	for tagTemplate, expectedCount := range map[string]int{
+		"{{ .Tag }}-mirrored": 0,
+		"{{ .Tag }}-copy":     1,
+	} {
+		pushCn, err := api.CollectPushTags(cn, PushConfig{Registry: dstRegistry, Prefix: "/", TagTemplate: tagTemplate})
+
+		assert.Nil(err)
+		assert.Equal(expectedCount, pushCn.TagCount(), "should match pushed tags by templated names (template: %s)", tagTemplate)
+	}
+}
+
+func TestCollectPushTags_AllowedDigests(t *testing.T) {
+	const approvedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const otherDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	srcServer := runCatalogRegistry(map[string]map[string]string{"foo": {"v1": approvedDigest, "v2": otherDigest}})
+	defer srcServer.Close()
+	dstServer := runCatalogRegistry(map[string]map[string]string{"foo": {}})
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(srcRegistry + "/foo")
+	assert.Nil(err)
+
+	pushCn, err := api.CollectPushTags(cn, PushConfig{Registry: dstRegistry, Prefix: "/"})
+	assert.Nil(err)
+	assert.Equal(2, pushCn.TagCount(), "should push all tags, if there is no allowlist")
+
+	pushCn, err = api.CollectPushTags(cn, PushConfig{Registry: dstRegistry, Prefix: "/", AllowedDigests: []string{approvedDigest}})
+	assert.Nil(err)
+	assert.Equal(1, pushCn.TagCount(), "should push only tags with allowed digests")
+
+	for _, tg := range pushCn.Tags(srcRegistry + "/foo") {
+		assert.Equal("v1", tg.Name())
+	}
+}
+
+// runTagRegistry runs registry without authentication serving "foo:latest" tag with digest passed
+func runTagRegistry(digest string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["latest"]}`))
+		case "/v2/foo/manifests/latest":
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestExportTagsWithSummary(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := runTagRegistry(digest)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "layout")
+	defer os.RemoveAll(dir)
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err)
+
+	summary, err := api.ExportTagsWithSummary(cn, dir)
+
+	assert.Nil(err)
+	assert.Equal(1, summary.Done)
+	assert.FileExists(filepath.Join(dir, "oci-layout"), "should initialize OCI layout")
+
+	api.config.DryRun = false
+
+	summary, err = api.ExportTagsWithSummary(cn, dir)
+
+	assert.NotNil(err, "should fail to export invalid image (no config)")
+	assert.Equal(1, summary.Failed)
+
+	ioutil.WriteFile(filepath.Join(dir, "..", filepath.Base(dir)+".txt"), []byte("file"), 0644)
+	defer os.Remove(filepath.Join(dir, "..", filepath.Base(dir)+".txt"))
+
+	_, err = api.ExportTagsWithSummary(cn, filepath.Join(dir, "..", filepath.Base(dir)+".txt"))
+
+	assert.NotNil(err, "should fail to export into anything not being a directory")
+}
+
+func TestExport(t *testing.T) {
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	assert.NotNil(api.Export(context.Background(), []string{}, ioutil.Discard), "should fail, if there are no images to export")
+	assert.Nil(api.Export(context.Background(), []string{"alpine:3.7"}, ioutil.Discard), "should do nothing in dry run mode")
+	assert.Nil(api.Import(context.Background(), strings.NewReader("")), "should do nothing in dry run mode")
+}
+
+func TestCollectTagsByRepo(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := runCatalogRegistry(map[string]map[string]string{
+		"byrepo/foo": {"latest": digest, "stable": digest},
+		"byrepo/bar": {"v1": digest},
+	})
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{ConcurrentRequests: 2})
+	assert.Nil(err)
+
+	refs := []string{registry + "/byrepo/foo", registry + "/byrepo/bar", registry + "/byrepo/nonexistent", "INVALID!"}
+
+	tags, err := api.CollectTagsByRepo(context.Background(), refs)
+
+	assert.IsType(&CollectError{}, err, "should aggregate errors of particular repos")
+	assert.Equal(2, len(err.(*CollectError).Errors))
+	assert.Contains(err.(*CollectError).Errors, registry+"/byrepo/nonexistent")
+	assert.Contains(err.(*CollectError).Errors, "INVALID!")
+
+	assert.Equal(2, len(tags), "should collect tags of all the other repos")
+	assert.Equal(2, len(tags[registry+"/byrepo/foo"]))
+	assert.Equal(1, len(tags[registry+"/byrepo/bar"]))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tags, err = api.CollectTagsByRepo(ctx, refs[:2])
+
+	assert.NotNil(err, "should fail, if context is canceled")
+	assert.Equal(0, len(tags))
+}
+
+func TestLatest(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := runCatalogRegistry(map[string]map[string]string{
+		"latest/builds": {"build-9": digest, "build-10": digest, "v1.2.0": digest, "v1.10.0": digest},
+		"latest/empty":  {},
+	})
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	buildLess := func(a, b string) bool {
+		an, _ := strconv.Atoi(strings.TrimPrefix(a, "build-"))
+		bn, _ := strconv.Atoi(strings.TrimPrefix(b, "build-"))
+
+		return an < bn
+	}
+
+	latest, err := api.Latest(context.Background(), registry+"/latest/builds~/^build-/", buildLess)
+
+	assert.Nil(err)
+	assert.Equal("build-10", latest, "should select the newest tag by the custom comparison")
+
+	latest, err = api.Latest(context.Background(), registry+"/latest/builds", tag.SemverLess)
+
+	assert.Nil(err)
+	assert.Equal("v1.10.0", latest, "should select the newest tag by semver")
+
+	_, err = api.Latest(context.Background(), registry+"/latest/empty", tag.SemverLess)
+
+	assert.IsType(&NoTagsError{}, err, "should fail with a typed error for repository with no tags")
+
+	_, err = api.Latest(context.Background(), registry+"/latest/builds~/^nothing/", tag.SemverLess)
+
+	assert.IsType(&NoTagsError{}, err, "should fail with a typed error, if no tags matched")
+}
+
+func TestPullIfChanged(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := runTagRegistry(digest)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	pulled, newDigest, err := api.PullIfChanged(context.Background(), registry+"/foo:latest", digest)
+
+	assert.Nil(err)
+	assert.False(pulled, "should NOT pull image with unchanged digest")
+	assert.Equal(digest, newDigest)
+
+	pulled, newDigest, err = api.PullIfChanged(context.Background(), registry+"/foo:latest", "sha256:0000")
+
+	assert.Nil(err)
+	assert.True(pulled, "should pull image with changed digest")
+	assert.Equal(digest, newDigest)
+
+	for _, ref := range []string{registry + "/foo", registry + "/foo=latest,stable", registry + "/foo~/^l/"} {
+		_, _, err := api.PullIfChanged(context.Background(), ref, digest)
+
+		assert.NotNil(err, "should fail for reference having no single tag: %s", ref)
+	}
+
+	_, _, err = api.PullIfChanged(context.Background(), registry+"/foo:nonexistent", digest)
+
+	assert.NotNil(err, "should fail for nonexistent tag")
+}
+
+func TestPullIfChanged_Context(t *testing.T) {
+	aborted := make(chan struct{}, 1)
+
+	// registry never answers manifest requests, so we could only stop waiting for it by the context
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			w.Write([]byte("{}"))
+			return
+		}
+
+		<-r.Context().Done()
+
+		aborted <- struct{}{}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DryRun: true})
+	assert.Nil(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, _, err = api.PullIfChanged(ctx, registry+"/foo:latest", "sha256:0000")
+
+	assert.Equal(context.DeadlineExceeded, err, "should give us context error")
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("registry request should be aborted, when context is done")
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	server := runTagRegistry(digest)
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	for _, ref := range []string{registry + "/foo", registry + "/foo:latest"} {
+		resolved, err := api.ResolveRef(context.Background(), ref)
+
+		assert.Nil(err)
+		assert.Equal(registry+"/foo:latest@"+digest, resolved, "should pin reference to the digest: %s", ref)
+	}
+
+	for _, ref := range []string{registry + "/foo:nonexistent", registry + "/foo=latest,stable", registry + "/foo@sha256:" + strings.Repeat("2", 64)} {
+		_, err := api.ResolveRef(context.Background(), ref)
+
+		assert.NotNil(err, "should fail to resolve reference: %s", ref)
+	}
+}
+
+func TestResolveRef_Index(t *testing.T) {
+	index, err := ioutil.ReadFile("../../fixtures/manifest/index.json")
+	if err != nil {
+		t.Fatalf("unable to read index fixture: %s", err.Error())
+	}
+
+	indexDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(index))
+
+	const amd64Digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	// registry picks amd64 image for clients not accepting index, just as Docker Hub does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/manifests/latest", "/v2/foo/manifests/" + indexDigest:
+			if strings.Contains(r.Header.Get("Accept"), manifest.MediaTypeOCIIndex) {
+				w.Header().Set("Content-Type", manifest.MediaTypeOCIIndex)
+				w.Header().Set("Docker-Content-Digest", indexDigest)
+				w.Write(index)
+				return
+			}
+
+			w.Header().Set("Content-Type", manifest.MediaTypeOCIManifest)
+			w.Header().Set("Docker-Content-Digest", amd64Digest)
+			w.Write([]byte(`{"schemaVersion":2}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	resolved, err := api.ResolveRef(context.Background(), registry+"/foo")
+
+	assert.Nil(err)
+	assert.Equal(registry+"/foo:latest@"+indexDigest, resolved, "should pin multi-arch index, not image of a single platform")
+
+	resolved, err = api.ResolveRef(context.Background(), registry+"/foo@"+indexDigest)
+
+	assert.Nil(err, "should accept index digest as is")
+	assert.Equal(registry+"/foo@"+indexDigest, resolved)
+}
+
+func TestListPlatforms(t *testing.T) {
+	const amd64Digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const arm64Digest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	index := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+		`{"digest":"` + amd64Digest + `","platform":{"os":"linux","architecture":"amd64"}},` +
+		`{"digest":"` + arm64Digest + `","platform":{"os":"linux","architecture":"arm64","variant":"v8"}},` +
+		`{"digest":"sha256:3333333333333333333333333333333333333333333333333333333333333333","platform":{"os":"unknown","architecture":"unknown"}}]}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/manifests/latest", "/v2/foo/manifests/multi":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+			w.Write([]byte(index))
+		case "/v2/foo/manifests/single", "/v2/foo/manifests/" + amd64Digest:
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", amd64Digest)
+			w.Write([]byte(`{"schemaVersion":2,"config":{"digest":"sha256:c0nf1g","size":2}}`))
+		case "/v2/foo/blobs/sha256:c0nf1g":
+			w.Write([]byte(`{"os":"linux","architecture":"amd64"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	for _, ref := range []string{registry + "/foo", registry + "/foo:multi"} {
+		images, err := api.ListPlatforms(context.Background(), ref)
+
+		assert.Nil(err)
+		assert.Equal(
+			[]client.PlatformImage{
+				{Platform: manifest.Platform{OS: "linux", Architecture: "amd64"}, Digest: amd64Digest},
+				{Platform: manifest.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, Digest: arm64Digest},
+			},
+			images,
+			"should list platforms of all images in index, but not of attestations: %s", ref,
+		)
+	}
+
+	for _, ref := range []string{registry + "/foo:single", registry + "/foo@" + amd64Digest} {
+		images, err := api.ListPlatforms(context.Background(), ref)
+
+		assert.Nil(err)
+		assert.Equal(
+			[]client.PlatformImage{{Platform: manifest.Platform{OS: "linux", Architecture: "amd64"}, Digest: amd64Digest}},
+			images,
+			"should list the only platform of a single image: %s", ref,
+		)
+	}
+
+	for _, ref := range []string{registry + "/foo:nonexistent", registry + "/foo=multi,single", registry + "/foo~/^s/"} {
+		_, err := api.ListPlatforms(context.Background(), ref)
+
+		assert.NotNil(err, "should fail to list platforms: %s", ref)
+	}
+}
+
+func TestCollectTags_ModifiedWithin(t *testing.T) {
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+
+	lastModified := map[string]time.Time{
+		"recent": time.Now().Add(-24 * time.Hour),
+		"old":    time.Now().Add(-30 * 24 * time.Hour),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["recent","old","unknown"]}`))
+		default:
+			name := strings.TrimPrefix(r.URL.Path, "/v2/foo/manifests/")
+			if date, defined := lastModified[name]; defined {
+				w.Header().Set("Last-Modified", date.UTC().Format(http.TimeFormat))
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.Write([]byte(`{"schemaVersion":2}`))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{ModifiedWithin: 7 * 24 * time.Hour})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err)
+
+	names := make([]string, 0)
+	for _, tg := range cn.Tags(cn.Refs()[0]) {
+		names = append(names, tg.Name())
+	}
+
+	assert.Equal([]string{"recent"}, names, "should keep only tags modified within the window")
+
+	created, _ := tag.New("created", tag.Options{Digest: digest, Created: time.Now().Add(-time.Hour).Unix()})
+
+	assert.True(api.isModifiedWithin(created), "should take creation date, if modification date is unknown")
+}
+
+func TestCollectTags_FailedTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["good","broken"]}`))
+		case "/v2/foo/manifests/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Header().Set("Docker-Content-Digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+			w.Write([]byte(`{"schemaVersion":2}`))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err, "should not fail because of a single broken tag")
+
+	tags := cn.TagMap(cn.Refs()[0])
+
+	assert.Nil(tags["good"].GetError())
+	assert.Equal("ABSENT", tags["good"].GetState())
+	assert.NotNil(tags["broken"].GetError(), "broken tag should carry its own error")
+	assert.Equal("ERROR", tags["broken"].GetState())
+}
+
+func TestCollectTags_LatestPerMinor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["1.2.0","1.2.1","1.2.2","1.3.0","latest"]}`))
+		default:
+			w.Header().Set("Docker-Content-Digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+			w.Write([]byte(`{"schemaVersion":2}`))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{LatestPerMinor: 2})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(registry + "/foo")
+	assert.Nil(err)
+
+	names := make([]string, 0)
+	for _, tg := range cn.Tags(cn.Refs()[0]) {
+		names = append(names, tg.Name())
+	}
+	sort.Strings(names)
+
+	assert.Equal([]string{"1.2.1", "1.2.2", "1.3.0", "latest"}, names, "should keep 2 latest tags per minor version and non-semver ones")
+}
+
+func TestCollectTags_OnlyArch(t *testing.T) {
+	const configDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	documents := map[string]string{
+		"/v2/foo/manifests/multi": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[` +
+			`{"digest":"sha256:1","platform":{"os":"linux","architecture":"amd64"}},` +
+			`{"digest":"sha256:2","platform":{"os":"linux","architecture":"arm64","variant":"v8"}}]}`,
+		"/v2/foo/manifests/amd64-only": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+			`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest + `","size":2}}`,
+		"/v2/foo/blobs/" + configDigest: `{"architecture":"amd64","os":"linux"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["multi","amd64-only"]}`))
+		default:
+			document, defined := documents[r.URL.Path]
+			if !defined {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Header().Set("Docker-Content-Digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+			w.Write([]byte(document))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	for arch, expected := range map[string][]string{
+		"arm64":    {"multi"},
+		"arm64/v8": {"multi"},
+		"amd64":    {"amd64-only", "multi"},
+		"s390x":    {},
+	} {
+		api, err := New(Config{OnlyArch: arch})
+		assert.Nil(err)
+
+		cn, err := api.CollectTags(registry + "/foo")
+		assert.Nil(err)
+
+		names := make([]string, 0)
+		for _, tg := range cn.Tags(cn.Refs()[0]) {
+			names = append(names, tg.Name())
+		}
+		sort.Strings(names)
+
+		assert.Equal(expected, names, "should keep only tags having image for arch: %s", arch)
+	}
+}
+
+func TestCollectTags_MaxLayers(t *testing.T) {
+	const layer = `{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":"sha256:3","size":1}`
+
+	documents := map[string]string{
+		"/v2/foo/manifests/slim": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[` +
+			layer + `]}`,
+		"/v2/foo/manifests/fat": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[` +
+			layer + `,` + layer + `,` + layer + `]}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.Write([]byte("{}"))
+		case "/v2/foo/tags/list":
+			w.Write([]byte(`{"name":"foo","tags":["slim","fat"]}`))
+		default:
+			document, defined := documents[r.URL.Path]
+			if !defined {
+				http.NotFound(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", "sha256:1111111111111111111111111111111111111111111111111111111111111111")
+			w.Write([]byte(document))
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+
+	assert := assert.New(t)
+
+	for exclude, expected := range map[bool]map[string]int{
+		false: {"fat": 3, "slim": 1},
+		true:  {"slim": 1},
+	} {
+		api, err := New(Config{MaxLayers: 2, ExcludeOverMaxLayers: exclude})
+		assert.Nil(err)
+
+		cn, err := api.CollectTags(registry + "/foo")
+		assert.Nil(err)
+
+		layers := make(map[string]int)
+		for _, tg := range cn.Tags(cn.Refs()[0]) {
+			layers[tg.Name()] = tg.GetLayerCount()
+		}
+
+		assert.Equal(expected, layers, "exclude: %v", exclude)
+	}
+}
+
+func TestMissingLabel(t *testing.T) {
+	assert := assert.New(t)
+
+	required, err := parseRequiredLabels([]string{"promote=true", "team", "empty="})
+	assert.Nil(err)
+
+	assert.Equal("", missingLabel(map[string]string{"promote": "true", "team": "a", "empty": ""}, required))
+	assert.Equal("promote=true", missingLabel(map[string]string{"promote": "false", "team": "a", "empty": ""}, required))
+	assert.Equal("team", missingLabel(map[string]string{"promote": "true", "empty": ""}, required))
+	assert.Equal("empty=", missingLabel(map[string]string{"promote": "true", "team": "a", "empty": "x"}, required))
+
+	for _, invalid := range []string{"", "=true", " =x"} {
+		_, err := parseRequiredLabels([]string{invalid})
+
+		assert.NotNil(err, "should fail on invalid label: %q", invalid)
+	}
+}
+
+func TestLogPushDataMaybeError(t *testing.T) {
+	assert := assert.New(t)
+
+	const digest = "sha256:6905a419c4fe7e29acb03cabd2aa9a01226c69277bf718faff52537b1b7b38ab"
+
+	pushed, err := logPushDataMaybeError(strings.NewReader(
+		`{"status":"The push refers to repository [localhost:5000/alpine]"}` + "\n" +
+			`{"status":"Pushed","progressDetail":{},"id":"aaa"}` + "\n" +
+			`{"status":"3.7: digest: ` + digest + ` size: 528"}` + "\n" +
+			`{"progressDetail":{},"aux":{"Tag":"3.7","Digest":"` + digest + `","Size":528}}` + "\n",
+	))
+
+	assert.Nil(err)
+	assert.Equal(digest, pushed, "should give digest Docker daemon reported")
+
+	pushed, err = logPushDataMaybeError(strings.NewReader(`{"status":"Pushed","progressDetail":{},"id":"aaa"}` + "\n"))
+
+	assert.Nil(err)
+	assert.Equal("", pushed, "should give no digest, if Docker daemon reported none")
+
+	_, err = logPushDataMaybeError(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied"}` + "\n"))
+
+	assert.NotNil(err)
+}
+
+func TestCollectPushTags_Strict(t *testing.T) {
+	const srcDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const dstDigest = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+	srcServer := runTagRegistry(srcDigest)
+	defer srcServer.Close()
+	dstServer := runTagRegistry(dstDigest)
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	assert := assert.New(t)
+
+	api, err := New(Config{})
+	assert.Nil(err)
+
+	cn, err := api.CollectTags(srcRegistry + "/foo")
+	assert.Nil(err)
+
+	push := PushConfig{
+		Registry:      dstRegistry,
+		Prefix:        "/",
+		PathSeparator: "/",
+		PathTemplate:  "{{ .Prefix }}{{ .Path }}",
+	}
+
+	pushCn, err := api.CollectPushTags(cn, push)
+	assert.Nil(err, "should skip tag with different digest silently by default")
+	assert.Equal(0, pushCn.TagCount())
+
+	push.Strict = true
+
+	_, err = api.CollectPushTags(cn, push)
+	assert.NotNil(err, "should fail on tag with different digest in strict mode")
+
+	mismatchErr, isMismatchErr := err.(*DigestMismatchError)
+	assert.True(isMismatchErr, "should fail with *DigestMismatchError, got: %#v", err)
+	if isMismatchErr {
+		assert.Equal(
+			[]DigestMismatch{{srcRegistry + "/foo:latest", srcDigest, dstRegistry + "/foo:latest", dstDigest}},
+			mismatchErr.Mismatches,
+		)
+	}
+
+	push.Force = true
+
+	pushCn, err = api.CollectPushTags(cn, push)
+	assert.Nil(err, "should NOT fail on tag with different digest in strict mode, if forced")
+	assert.Equal(1, pushCn.TagCount(), "should overwrite tag with different digest, if forced")
+}
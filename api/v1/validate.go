@@ -0,0 +1,149 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag/remote"
+)
+
+// validator connects to every registry only once, remembering connection (or failure) for every registry and role
+type validator struct {
+	api     *API
+	clients map[string]*client.RegistryClient
+	errors  map[string]error
+	// explicit credentials by role (See PushConfig.SrcCredentials and PushConfig.DstCredentials)
+	auths map[string]*Credentials
+}
+
+func (v *validator) connect(registry, role string) (*client.RegistryClient, error) {
+	key := role + ":" + registry
+
+	if err, failed := v.errors[key]; failed {
+		return nil, err
+	}
+	if cli, connected := v.clients[key]; connected {
+		return cli, nil
+	}
+
+	cli, err := func() (*client.RegistryClient, error) {
+		if err := remote.Ping(context.Background(), registry); err != nil {
+			return nil, fmt.Errorf("%s registry %s is not reachable: %w", role, registry, err)
+		}
+
+		username, password := v.api.credentials(v.auths[role], registry, role)
+
+		cli, err := remote.Connect(registry, username, password)
+		if err != nil {
+			return nil, fmt.Errorf("unable to log in to %s registry %s: %w", role, registry, err)
+		}
+
+		return cli, nil
+	}()
+	if err != nil {
+		v.errors[key] = err
+
+		return nil, err
+	}
+
+	v.clients[key] = cli
+
+	return cli, nil
+}
+
+func (v *validator) verifyAccess(registry, repoPath, role, actions string) error {
+	cli, err := v.connect(registry, role)
+	if err != nil {
+		return err
+	}
+
+	if err := cli.VerifyAccess(repoPath, actions); err != nil {
+		return fmt.Errorf("no %s access to %s/%s: %w", actions, registry, repoPath, err)
+	}
+
+	return nil
+}
+
+// Validate checks configuration before we pull or push anything: repository references (and tag filters) should be valid,
+// registries should be reachable and accept our credentials, "push" references should be valid (if push config is passed)
+// NB! It gives us all the issues found, so empty list means the configuration is fine.
+func (api *API) Validate(ctx context.Context, refs []string, push *PushConfig) []error {
+	issues := make([]error, 0)
+
+	v := &validator{
+		api:     api,
+		clients: make(map[string]*client.RegistryClient),
+		errors:  make(map[string]error),
+	}
+	if push != nil {
+		v.auths = map[string]*Credentials{"pull": push.SrcCredentials, "push": push.DstCredentials}
+	}
+
+	addIssue := func(err error) {
+		log.Debugf("%s issue: %s", fn(), err.Error())
+
+		issues = append(issues, err)
+	}
+
+	reportedErrors := make(map[error]bool)
+	addAccessIssue := func(err error) {
+		if reportedErrors[err] {
+			return
+		}
+		reportedErrors[err] = true
+
+		addIssue(err)
+	}
+
+	var rewrite RefRewriter
+	if push != nil {
+		var err error
+
+		rewrite, err = makeRefRewriter(*push)
+		if err != nil {
+			addIssue(err)
+		}
+	}
+
+	for _, ref := range refs {
+		if err := ctx.Err(); err != nil {
+			return append(issues, err)
+		}
+
+		repo, err := repository.ParseRef(ref)
+		if err != nil {
+			addIssue(err)
+			continue
+		}
+
+		if err := v.verifyAccess(repo.Registry(), repo.Path(), "pull", "pull"); err != nil {
+			addAccessIssue(err)
+		}
+
+		if rewrite == nil {
+			continue
+		}
+
+		dst, err := rewrite(Ref{Registry: repo.Registry(), Path: repo.Path()})
+		if err != nil {
+			addIssue(err)
+			continue
+		}
+
+		for _, tagName := range repo.Tags() {
+			if _, err := rewrite(Ref{Registry: repo.Registry(), Path: repo.Path(), Tag: tagName}); err != nil {
+				addIssue(err)
+			}
+		}
+
+		if err := v.verifyAccess(dst.Registry, dst.Path, "push", "pull,push"); err != nil {
+			addAccessIssue(err)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,71 @@
+package v1
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	srcServer := runTokenRegistry("", "")
+	defer srcServer.Close()
+	dstServer := runTokenRegistry("foo", "bar")
+	defer dstServer.Close()
+
+	srcRegistry := strings.TrimPrefix(srcServer.URL, "http://")
+	dstRegistry := strings.TrimPrefix(dstServer.URL, "http://")
+
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	dockerJSON := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(dockerJSON, []byte(`{"auths":{"`+dstRegistry+`":{"auth":"Zm9vOmJhcg=="}}}`), 0600)
+
+	assert := assert.New(t)
+
+	api, err := New(Config{DockerJSONConfigFile: dockerJSON})
+	assert.Nil(err)
+
+	issues := api.Validate(
+		context.Background(),
+		[]string{srcRegistry + "/foo", srcRegistry + "/foo:latest"},
+		&PushConfig{Registry: dstRegistry, Prefix: "/mirror/"},
+	)
+
+	assert.Empty(issues, "should be no issues with a valid configuration")
+
+	issues = api.Validate(
+		context.Background(),
+		[]string{srcRegistry + "/foo~/^v(1/", "127.0.0.1:1/foo", "127.0.0.1:1/bar"},
+		nil,
+	)
+
+	assert.Len(issues, 2, "should report invalid filter and unreachable registry (only once): %v", issues)
+
+	anonymousJSON := filepath.Join(dir, "anonymous.json")
+	ioutil.WriteFile(anonymousJSON, []byte(`{"auths":{}}`), 0600)
+
+	anonymousAPI, err := New(Config{DockerJSONConfigFile: anonymousJSON})
+	assert.Nil(err)
+
+	issues = anonymousAPI.Validate(
+		context.Background(),
+		[]string{srcRegistry + "/foo"},
+		&PushConfig{Registry: dstRegistry, Prefix: "/anonymous/"},
+	)
+
+	assert.Len(issues, 1, "should report no access to the 'push' registry: %v", issues)
+
+	issues = api.Validate(
+		context.Background(),
+		[]string{srcRegistry + "/foo:latest"},
+		&PushConfig{Registry: dstRegistry, TagTemplate: "{{ .Tag }}!"},
+	)
+
+	assert.Len(issues, 1, "should report invalid 'push' reference: %v", issues)
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 
@@ -15,7 +18,15 @@ import (
 // We could implement it, but we need to see an explicit demand
 // for this feature from our stakeholders.
 type Config struct {
-	Repositories []string `yaml:"repositories"`
+	Repositories []string    `yaml:"repositories"`
+	PushRoutes   []PushRoute `yaml:"push_routes"`
+}
+
+// PushRoute maps source registries (matching the pattern) to the registry (and prefix) we push their images into
+type PushRoute struct {
+	Source   string `yaml:"source"`
+	Registry string `yaml:"registry"`
+	Prefix   string `yaml:"prefix"`
 }
 
 // LoadYAMLFile loads YAML file into Config structure
@@ -39,3 +50,99 @@ func LoadYAMLFile(path string) (*Config, error) {
 
 	return &structure.ConfigRoot, nil
 }
+
+var digestRE = regexp.MustCompile(`^[a-z0-9]+([+._-][a-z0-9]+)*:[a-fA-F0-9]{32,}$`)
+
+// LoadDigestFile loads list of image digests from file having one digest per line
+// (empty lines and lines starting with "#" are ignored)
+func LoadDigestFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(fix.Path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	digests := make([]string, 0)
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !digestRE.MatchString(line) {
+			return nil, fmt.Errorf("invalid digest at %s:%d: %s", path, i+1, line)
+		}
+
+		digests = append(digests, line)
+	}
+
+	if len(digests) == 0 {
+		return nil, errors.New("no digests could be loaded from: " + path)
+	}
+
+	return digests, nil
+}
+
+// LoadDenylistFile loads list of reference patterns we never pull or push from file having one pattern per line
+// (empty lines and lines starting with "#" are ignored), patterns themselves are validated by API
+func LoadDenylistFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(fix.Path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]string, 0)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, line)
+	}
+
+	if len(patterns) == 0 {
+		return nil, errors.New("no denylist patterns could be loaded from: " + path)
+	}
+
+	return patterns, nil
+}
+
+// ParseAuthRegistries parses "REGISTRY IDENTITY" pairs (e.g. "mirror.internal docker.io") into a map of registry identities,
+// i.e. registries we authenticate as, when we connect to the registries (e.g. pull-through mirrors)
+func ParseAuthRegistries(pairs []string) (map[string]string, error) {
+	authRegistries := make(map[string]string, len(pairs))
+
+	for _, pair := range pairs {
+		fields := strings.Fields(pair)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid auth registry (should be 'REGISTRY IDENTITY'): %s", pair)
+		}
+
+		authRegistries[fields[0]] = fields[1]
+	}
+
+	return authRegistries, nil
+}
+
+// ParsePushRoutes parses "SOURCE REGISTRY [PREFIX]" specs (e.g. "*.gcr.io registry-b.company.io /gcr/") into push routes
+func ParsePushRoutes(specs []string) ([]PushRoute, error) {
+	routes := make([]PushRoute, 0, len(specs))
+
+	for _, spec := range specs {
+		fields := strings.Fields(spec)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid push route (should be 'SOURCE REGISTRY [PREFIX]'): %s", spec)
+		}
+
+		route := PushRoute{Source: fields[0], Registry: fields[1]}
+		if len(fields) == 3 {
+			route.Prefix = fields[2]
+		}
+
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
@@ -71,3 +71,156 @@ func TestLoadYAMLFile_NonExisting(t *testing.T) {
 
 	assert.NotNil(err, "should give an error while trying to load non-existing config file")
 }
+
+func TestLoadDigestFile(t *testing.T) {
+	assert := assert.New(t)
+
+	digests, err := LoadDigestFile("../fixtures/config/digests.txt")
+
+	assert.Nil(err, "should NOT give an error while loading valid digest file")
+	assert.Equal(
+		[]string{
+			"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			"sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210",
+		},
+		digests,
+	)
+
+	_, err = LoadDigestFile("../fixtures/config/digests.txt.invalid")
+
+	assert.NotNil(err, "should give an error while loading file with invalid digest")
+
+	_, err = LoadDigestFile("../fixtures/config/nonexistent.txt")
+
+	assert.NotNil(err, "should give an error while loading nonexistent file")
+}
+
+func TestLoadDenylistFile(t *testing.T) {
+	assert := assert.New(t)
+
+	patterns, err := LoadDenylistFile("../fixtures/config/denylist.txt")
+
+	assert.Nil(err, "should NOT give an error while loading valid denylist file")
+	assert.Equal([]string{"*:debug", "quay.io/coreos/awscli:edge", `/^gcr\.io/.*:v1\.9\./`}, patterns)
+
+	_, err = LoadDenylistFile("../fixtures/config/nonexistent.txt")
+
+	assert.NotNil(err, "should give an error while loading nonexistent file")
+}
+
+func TestParseAuthRegistries(t *testing.T) {
+	assert := assert.New(t)
+
+	authRegistries, err := ParseAuthRegistries([]string{"mirror.internal docker.io", "  proxy.internal:5000   registry.company.io "})
+
+	assert.Nil(err)
+	assert.Equal(
+		map[string]string{"mirror.internal": "docker.io", "proxy.internal:5000": "registry.company.io"},
+		authRegistries,
+	)
+
+	for _, invalid := range []string{"mirror.internal", "mirror.internal docker.io quay.io", ""} {
+		_, err := ParseAuthRegistries([]string{invalid})
+
+		assert.NotNil(err, "should fail on invalid auth registry: %q", invalid)
+	}
+}
+
+func TestLoadYAMLFile_PushRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	yc, err := LoadYAMLFile("../fixtures/config/config.yaml.routes")
+
+	assert.Nil(err, "should NOT give an error while loading valid config file with push routes")
+
+	if yc != nil {
+		assert.Equal(
+			[]PushRoute{
+				{Source: "quay.io", Registry: "registry-a.company.io", Prefix: "/quay/"},
+				{Source: "*gcr.io", Registry: "registry-b.company.io"},
+			},
+			yc.PushRoutes,
+		)
+	}
+}
+
+func TestParsePushRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	routes, err := ParsePushRoutes([]string{"quay.io registry-a.company.io /quay/", "  *.gcr.io   registry-b.company.io "})
+
+	assert.Nil(err)
+	assert.Equal(
+		[]PushRoute{
+			{Source: "quay.io", Registry: "registry-a.company.io", Prefix: "/quay/"},
+			{Source: "*.gcr.io", Registry: "registry-b.company.io"},
+		},
+		routes,
+	)
+
+	for _, invalid := range []string{"quay.io", "quay.io registry-a.company.io /quay/ extra", ""} {
+		_, err := ParsePushRoutes([]string{invalid})
+
+		assert.NotNil(err, "should fail on invalid push route: %q", invalid)
+	}
+}
+
+func TestLoadOptionsFile(t *testing.T) {
+	assert := assert.New(t)
+
+	of, err := LoadOptionsFile("../fixtures/config/options.yaml")
+	assert.Nil(err)
+
+	if of == nil {
+		return
+	}
+
+	assert.Equal(
+		map[string][]string{
+			"concurrent-requests": {"8"},
+			"retry-requests":      {"5"},
+			"retry-delay":         {"5s"},
+			"verbose":             {"2"},
+			"json":                {"true"},
+			"denylist-file":       {"./denylist.txt"},
+			"auth-provider":       {"ecr", "gcr"},
+			"auth-registry":       {"mirror.internal docker.io"},
+			"basic-auth":          {"registry.company.io robot:secret"},
+			"registry-ca":         {"registry.company.io /etc/lstags/company-ca.pem"},
+			"registry-header":     {"registry.company.io X-Api-Key: secret", "registry.company.io X-Team: platform"},
+		},
+		of.Options,
+	)
+	assert.Equal("auth-provider", of.Names()[0])
+}
+
+func TestLoadOptionsFile_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := LoadOptionsFile("../fixtures/config/options.yaml.invalid")
+	assert.NotNil(err, "should fail on unknown per-registry option")
+
+	_, err = LoadOptionsFile("../fixtures/config/options.yaml.nonexistent")
+	assert.NotNil(err, "should fail on non-existent file")
+}
+
+func TestFindOptionsFile(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(files []string) { DefaultOptionsFiles = files }(DefaultOptionsFiles)
+
+	DefaultOptionsFiles = []string{"../fixtures/config/options.yaml.nonexistent", "../fixtures/config/options.yaml"}
+
+	path, err := FindOptionsFile("")
+	assert.Nil(err)
+	assert.Equal("../fixtures/config/options.yaml", path, "should find the first options file present")
+
+	_, err = FindOptionsFile("../fixtures/config/options.yaml.nonexistent")
+	assert.NotNil(err, "should fail on options file passed explicitly, but non-existent")
+
+	DefaultOptionsFiles = []string{"../fixtures/config/options.yaml.nonexistent"}
+
+	path, err = FindOptionsFile("")
+	assert.Nil(err)
+	assert.Equal("", path, "should find nothing, if there are no options files")
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// DefaultOptionsFiles are locations we look for options file at (in this order), if it is not passed explicitly
+var DefaultOptionsFiles = []string{"./lstags.yaml", "~/.config/lstags/config.yaml"}
+
+// RegistryOptions are per-registry options loaded from the "registries" section of the options file
+type RegistryOptions struct {
+	BasicAuth  string   `yaml:"basic-auth"`
+	CA         string   `yaml:"ca"`
+	ClientCert string   `yaml:"client-cert"`
+	ClientKey  string   `yaml:"client-key"`
+	Pin        string   `yaml:"pin"`
+	Headers    []string `yaml:"headers"`
+	AuthAs     string   `yaml:"auth-as"`
+}
+
+// options gives us per-registry options in the form of command line options, e.g. "basic-auth" => "REGISTRY username:password"
+func (ro RegistryOptions) options(registry string) (map[string][]string, error) {
+	options := make(map[string][]string)
+
+	add := func(name string, values ...string) {
+		options[name] = append(options[name], registry+" "+strings.Join(values, " "))
+	}
+
+	if ro.BasicAuth != "" {
+		add("basic-auth", ro.BasicAuth)
+	}
+	if ro.CA != "" {
+		add("registry-ca", ro.CA)
+	}
+	if ro.ClientCert != "" || ro.ClientKey != "" {
+		if ro.ClientCert == "" || ro.ClientKey == "" {
+			return nil, fmt.Errorf("registry %s: need both 'client-cert' and 'client-key'", registry)
+		}
+		add("registry-client-cert", ro.ClientCert, ro.ClientKey)
+	}
+	if ro.Pin != "" {
+		add("registry-pin", ro.Pin)
+	}
+	for _, header := range ro.Headers {
+		add("registry-header", header)
+	}
+	if ro.AuthAs != "" {
+		add("auth-registry", ro.AuthAs)
+	}
+
+	return options, nil
+}
+
+// OptionsFile holds default command line options loaded from YAML (or JSON) file: keys are long option names
+// and values are scalars or lists (for repeatable options), per-registry options go to the "registries" section.
+// NB! Options file does not know which options are valid, it is up to caller to validate their names.
+type OptionsFile struct {
+	Path    string
+	Options map[string][]string
+}
+
+// Names gives us names of all the options loaded, sorted
+func (of *OptionsFile) Names() []string {
+	names := make([]string, 0, len(of.Options))
+	for name := range of.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// FindOptionsFile gives us path of the options file: the one passed, or the first of DefaultOptionsFiles present
+// (or "", if there are none). NB! Options file passed explicitly should exist.
+func FindOptionsFile(path string) (string, error) {
+	if path != "" {
+		if _, err := os.Stat(fix.Path(path)); err != nil {
+			return "", err
+		}
+
+		return path, nil
+	}
+
+	for _, path := range DefaultOptionsFiles {
+		if _, err := os.Stat(fix.Path(path)); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", nil
+}
+
+// LoadOptionsFile loads default command line options from YAML (or JSON) file (See OptionsFile)
+func LoadOptionsFile(path string) (*OptionsFile, error) {
+	data, err := ioutil.ReadFile(fix.Path(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var structure map[string]interface{}
+	if err := yaml.Unmarshal(data, &structure); err != nil {
+		return nil, fmt.Errorf("invalid options file %s: %s", path, err.Error())
+	}
+
+	of := &OptionsFile{Path: path, Options: make(map[string][]string)}
+
+	for name, value := range structure {
+		if name == "registries" {
+			continue
+		}
+
+		values, err := optionValues(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid options file %s: option '%s': %s", path, name, err.Error())
+		}
+
+		of.Options[name] = values
+	}
+
+	if registries, defined := structure["registries"]; defined {
+		if err := of.loadRegistries(registries); err != nil {
+			return nil, fmt.Errorf("invalid options file %s: %s", path, err.Error())
+		}
+	}
+
+	return of, nil
+}
+
+func (of *OptionsFile) loadRegistries(section interface{}) error {
+	data, err := yaml.Marshal(section)
+	if err != nil {
+		return err
+	}
+
+	var registries map[string]RegistryOptions
+	if err := yaml.UnmarshalStrict(data, &registries); err != nil {
+		return fmt.Errorf("section 'registries': %s", err.Error())
+	}
+
+	names := make([]string, 0, len(registries))
+	for registry := range registries {
+		names = append(names, registry)
+	}
+	sort.Strings(names)
+
+	for _, registry := range names {
+		options, err := registries[registry].options(registry)
+		if err != nil {
+			return err
+		}
+
+		for name, values := range options {
+			of.Options[name] = append(of.Options[name], values...)
+		}
+	}
+
+	return nil
+}
+
+// optionValues gives us values of the option loaded: a list for list, a single value for scalar
+func optionValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, fmt.Errorf("no value")
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case []interface{}, map[interface{}]interface{}:
+				return nil, fmt.Errorf("list items should be scalars")
+			}
+			values[i] = fmt.Sprint(item)
+		}
+
+		return values, nil
+	case map[interface{}]interface{}:
+		return nil, fmt.Errorf("should be a scalar or a list")
+	default:
+		return []string{fmt.Sprint(v)}, nil
+	}
+}
@@ -1,8 +1,11 @@
 package client
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -49,6 +52,13 @@ func (dc *DockerClient) Config() *config.Config {
 	return dc.cnf
 }
 
+// Ping checks if Docker daemon is there and responds to us
+func (dc *DockerClient) Ping(ctx context.Context) error {
+	_, err := dc.cli.Ping(ctx)
+
+	return err
+}
+
 // ListImagesForRepo lists images present locally for the repo specified
 func (dc *DockerClient) ListImagesForRepo(repo string) ([]types.ImageSummary, error) {
 	listOptions, err := buildImageListOptions(repo)
@@ -59,30 +69,104 @@ func (dc *DockerClient) ListImagesForRepo(repo string) ([]types.ImageSummary, er
 	return dc.cli.ImageList(context.Background(), listOptions)
 }
 
-func buildImageListOptions(repo string) (types.ImageListOptions, error) {
-	repoFilter := "reference=" + repo
-	filterArgs := filters.NewArgs()
+// ListImages lists images present locally matching any of the reference patterns specified, like "docker images" does
+// (e.g. "alpine", "registry.company.io/team/*" or "nginx:1.*"). Images matched by more than one pattern are listed once.
+func (dc *DockerClient) ListImages(patterns []string) ([]types.ImageSummary, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("no image reference patterns to list images by")
+	}
+
+	listOptions, err := buildImageListOptions(patterns...)
+	if err != nil {
+		return nil, err
+	}
 
-	filterArgs, err := filters.ParseFlag(repoFilter, filterArgs)
+	imageSummaries, err := dc.cli.ImageList(context.Background(), listOptions)
 	if err != nil {
-		return types.ImageListOptions{}, err
+		return nil, err
+	}
+
+	return uniqueImages(imageSummaries), nil
+}
+
+// uniqueImages gives us image summaries passed with duplicates (by image ID) dropped, keeping the order
+func uniqueImages(imageSummaries []types.ImageSummary) []types.ImageSummary {
+	seen := make(map[string]bool, len(imageSummaries))
+	unique := make([]types.ImageSummary, 0, len(imageSummaries))
+
+	for _, imageSummary := range imageSummaries {
+		if seen[imageSummary.ID] {
+			continue
+		}
+		seen[imageSummary.ID] = true
+
+		unique = append(unique, imageSummary)
+	}
+
+	return unique
+}
+
+// buildImageListOptions builds image list options with a "reference" filter for every pattern passed
+// NB! Docker daemon treats multiple "reference" filters as alternatives, i.e. gives us a union of images matched.
+func buildImageListOptions(patterns ...string) (types.ImageListOptions, error) {
+	filterArgs := filters.NewArgs()
+
+	for _, pattern := range patterns {
+		var err error
+
+		filterArgs, err = filters.ParseFlag("reference="+pattern, filterArgs)
+		if err != nil {
+			return types.ImageListOptions{}, err
+		}
 	}
 
 	return types.ImageListOptions{Filters: filterArgs}, nil
 }
 
+// LastTagTime gets the time image was last pulled or tagged locally (from image metadata)
+// NB! Zero time is returned, if Docker daemon is too old to track it.
+func (dc *DockerClient) LastTagTime(id string) (time.Time, error) {
+	_, raw, err := dc.cli.ImageInspectWithRaw(context.Background(), id)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var inspect struct {
+		Metadata struct {
+			LastTagTime time.Time
+		}
+	}
+
+	if err := json.Unmarshal(raw, &inspect); err != nil {
+		return time.Time{}, err
+	}
+
+	return inspect.Metadata.LastTagTime, nil
+}
+
 // Pull pulls Docker image specified
 func (dc *DockerClient) Pull(ref string) (io.ReadCloser, error) {
+	return dc.PullContext(context.Background(), ref)
+}
+
+// PullContext pulls Docker image specified, pull is aborted (and stream is closed) once context is canceled
+func (dc *DockerClient) PullContext(ctx context.Context, ref string) (io.ReadCloser, error) {
 	registryAuth := dc.cnf.GetRegistryAuth(
 		repository.GetRegistry(ref),
 	)
 
+	return dc.PullContextWithAuth(ctx, ref, registryAuth)
+}
+
+// PullContextWithAuth does the same as PullContext, but with base64 authentication string passed explicitly
+// (i.e. not the one Docker config gives us), anonymously if it is empty
+func (dc *DockerClient) PullContextWithAuth(ctx context.Context, ref, registryAuth string) (io.ReadCloser, error) {
 	pullOptions := types.ImagePullOptions{RegistryAuth: registryAuth}
 	if registryAuth == "" {
 		pullOptions = types.ImagePullOptions{}
 	}
 
-	return dc.cli.ImagePull(context.Background(), ref, pullOptions)
+	return dc.cli.ImagePull(ctx, ref, pullOptions)
 }
 
 // Push pushes Docker image specified
@@ -91,6 +175,12 @@ func (dc *DockerClient) Push(ref string) (io.ReadCloser, error) {
 		repository.GetRegistry(ref),
 	)
 
+	return dc.PushWithAuth(ref, registryAuth)
+}
+
+// PushWithAuth does the same as Push, but with base64 authentication string passed explicitly
+// (i.e. not the one Docker config gives us), anonymously if it is empty
+func (dc *DockerClient) PushWithAuth(ref, registryAuth string) (io.ReadCloser, error) {
 	pushOptions := types.ImagePushOptions{RegistryAuth: registryAuth}
 	if registryAuth == "" {
 		pushOptions = types.ImagePushOptions{RegistryAuth: "IA=="}
@@ -99,6 +189,22 @@ func (dc *DockerClient) Push(ref string) (io.ReadCloser, error) {
 	return dc.cli.ImagePush(context.Background(), ref, pushOptions)
 }
 
+// Save streams images specified as a tar archive (like "docker save"), it's up to caller to close the stream
+func (dc *DockerClient) Save(ctx context.Context, refs []string) (io.ReadCloser, error) {
+	return dc.cli.ImageSave(ctx, refs)
+}
+
+// Load loads images from a tar archive stream (like "docker load"), giving us daemon response (JSON message stream)
+// NB! It's up to caller to close the response.
+func (dc *DockerClient) Load(ctx context.Context, input io.Reader) (io.ReadCloser, error) {
+	resp, err := dc.cli.ImageLoad(ctx, input, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
 // Tag puts a "dst" tag on "src" Docker image
 func (dc *DockerClient) Tag(src, dst string) error {
 	return dc.cli.ImageTag(context.Background(), src, dst)
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ivanilves/lstags/docker/config"
+)
+
+func TestBuildImageListOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	listOptions, err := buildImageListOptions("alpine", "registry.company.io/team/*")
+
+	assert.Nil(err)
+	assert.Equal([]string{"alpine", "registry.company.io/team/*"}, sortedValues(listOptions.Filters.Get("reference")))
+}
+
+func TestUniqueImages(t *testing.T) {
+	imageSummaries := []types.ImageSummary{{ID: "sha256:aaa"}, {ID: "sha256:bbb"}, {ID: "sha256:aaa"}}
+
+	assert.Equal(t, []types.ImageSummary{{ID: "sha256:aaa"}, {ID: "sha256:bbb"}}, uniqueImages(imageSummaries))
+}
+
+func sortedValues(values []string) []string {
+	sort.Strings(values)
+
+	return values
+}
+
+func writeContext(t *testing.T, contextsDir, name, meta string) {
+	dir := filepath.Join(contextsDir, "meta", contextID(name))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "meta.json"), []byte(meta), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadContext(t *testing.T) {
+	assert := assert.New(t)
+
+	contextsDir, err := ioutil.TempDir("", "lstags-contexts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(contextsDir)
+
+	writeContext(t, contextsDir, "remote", `{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://10.0.0.1:2375","SkipTLSVerify":true}}}`)
+	writeContext(t, contextsDir, "broken", `{"Name":"broken","Endpoints":{}}`)
+
+	ctx, err := LoadContext(contextsDir, "remote")
+	assert.Nil(err)
+	assert.Equal(&Context{Name: "remote", Host: "tcp://10.0.0.1:2375", SkipTLSVerify: true}, ctx)
+
+	_, err = LoadContext(contextsDir, "broken")
+	assert.NotNil(err)
+
+	_, err = LoadContext(contextsDir, "missing")
+	assert.NotNil(err)
+
+	dc, err := NewForContext(&config.Config{}, contextsDir, "remote")
+	assert.Nil(err)
+	assert.NotNil(dc)
+}
+
+func TestContextName(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	defer os.Setenv("DOCKER_CONTEXT", os.Getenv("DOCKER_CONTEXT"))
+	os.Unsetenv("DOCKER_HOST")
+	os.Unsetenv("DOCKER_CONTEXT")
+
+	cnf := &config.Config{CurrentContext: "current"}
+
+	assert.Equal("explicit", ContextName("explicit", cnf))
+	assert.Equal("current", ContextName("", cnf))
+	assert.Equal("", ContextName("", &config.Config{}))
+
+	os.Setenv("DOCKER_CONTEXT", "env")
+	assert.Equal("env", ContextName("", cnf))
+
+	os.Setenv("DOCKER_HOST", "tcp://127.0.0.1:2375")
+	assert.Equal(DefaultContext, ContextName("", cnf))
+	assert.Equal("explicit", ContextName("explicit", cnf))
+}
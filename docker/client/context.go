@@ -0,0 +1,160 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/moby/moby/client"
+
+	"github.com/ivanilves/lstags/docker/config"
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// DefaultContext is a name of the Docker context standing for the daemon configured by environment variables
+// (DOCKER_HOST, DOCKER_CERT_PATH etc.), the same way Docker CLI treats it
+const DefaultContext = "default"
+
+// Context is a Docker context ("docker context create"), i.e. a named Docker daemon endpoint with its TLS settings
+type Context struct {
+	Name          string
+	Host          string
+	SkipTLSVerify bool
+	// TLSPath is a directory with "ca.pem", "cert.pem" and "key.pem" files stored for the context (if any)
+	TLSPath string
+}
+
+type contextMeta struct {
+	Name      string `json:"Name"`
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// ContextsDir gives us a directory Docker contexts are stored in, i.e. "contexts" one next to Docker JSON config file
+func ContextsDir(dockerJSON string) string {
+	return filepath.Join(filepath.Dir(fix.Path(dockerJSON)), "contexts")
+}
+
+// ContextName gives us a name of the Docker context to use, the same way Docker CLI picks it: context passed explicitly,
+// then "default" one, if DOCKER_HOST is set, then DOCKER_CONTEXT environment variable, then the current context from
+// Docker JSON config file. Empty name means no context is set (and environment variables are used).
+func ContextName(name string, cnf *config.Config) string {
+	if name != "" {
+		return name
+	}
+
+	if os.Getenv("DOCKER_HOST") != "" {
+		return DefaultContext
+	}
+
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name
+	}
+
+	if cnf != nil {
+		return cnf.CurrentContext
+	}
+
+	return ""
+}
+
+// LoadContext loads Docker context specified from the contexts directory passed (See ContextsDir)
+func LoadContext(contextsDir, name string) (*Context, error) {
+	id := contextID(name)
+
+	b, err := ioutil.ReadFile(filepath.Join(contextsDir, "meta", id, "meta.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Docker context not found: %s", name)
+		}
+		return nil, err
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("invalid Docker context '%s': %s", name, err.Error())
+	}
+
+	endpoint, defined := meta.Endpoints["docker"]
+	if !defined || endpoint.Host == "" {
+		return nil, fmt.Errorf("Docker context '%s' has no Docker endpoint", name)
+	}
+
+	ctx := &Context{Name: name, Host: endpoint.Host, SkipTLSVerify: endpoint.SkipTLSVerify}
+
+	tlsPath := filepath.Join(contextsDir, "tls", id, "docker")
+	if _, err := os.Stat(tlsPath); err == nil {
+		ctx.TLSPath = tlsPath
+	}
+
+	return ctx, nil
+}
+
+// contextID is a name of the directory Docker stores context under (SHA256 digest of context name)
+func contextID(name string) string {
+	sum := sha256.Sum256([]byte(name))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NewForContext creates new instance of DockerClient connected to the daemon of the Docker context specified
+// (See ContextName for the way we pick it, if no context is passed), like "docker --context" does.
+// NB! If no context is set, or "default" one is, we use environment variables (See New).
+func NewForContext(cnf *config.Config, contextsDir, name string) (*DockerClient, error) {
+	name = ContextName(name, cnf)
+	if name == "" || name == DefaultContext {
+		return New(cnf)
+	}
+
+	ctx, err := LoadContext(contextsDir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cli, err := newContextClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DockerClient{cli: cli, cnf: cnf}, nil
+}
+
+func newContextClient(ctx *Context) (*client.Client, error) {
+	if strings.HasPrefix(ctx.Host, "ssh://") {
+		return nil, fmt.Errorf("Docker context '%s' uses SSH endpoint, which is not supported: %s", ctx.Name, ctx.Host)
+	}
+
+	var httpClient *http.Client
+	if ctx.TLSPath != "" || ctx.SkipTLSVerify {
+		options := tlsconfig.Options{InsecureSkipVerify: ctx.SkipTLSVerify}
+		for file, option := range map[string]*string{"ca.pem": &options.CAFile, "cert.pem": &options.CertFile, "key.pem": &options.KeyFile} {
+			path := filepath.Join(ctx.TLSPath, file)
+			if _, err := os.Stat(path); ctx.TLSPath != "" && err == nil {
+				*option = path
+			}
+		}
+
+		tlsc, err := tlsconfig.Client(options)
+		if err != nil {
+			return nil, err
+		}
+
+		httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsc}}
+	}
+
+	version := os.Getenv("DOCKER_API_VERSION")
+	if version == "" {
+		version = client.DefaultVersion
+	}
+
+	return client.NewClient(ctx.Host, version, httpClient, nil)
+}
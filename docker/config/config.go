@@ -1,12 +1,16 @@
 package config
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/ivanilves/lstags/docker/config/credhelper"
 
@@ -23,6 +27,19 @@ type Config struct {
 	passwords   map[string]string
 	CredsStore  string            `json:"credsStore,omitempty"`
 	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+	// CurrentContext is a Docker context ("docker context use") we connect to Docker daemon through
+	CurrentContext string `json:"currentContext,omitempty"`
+
+	authRegistries map[string]string
+
+	// issued are credentials auth providers gave us per registry identity (See ResolveScopedCredentials)
+	issued    map[string]credentials
+	issuedMux sync.Mutex
+}
+
+type credentials struct {
+	username string
+	password string
 }
 
 // Auth contains Docker registry username and password in base64-encoded form
@@ -35,8 +52,145 @@ func (c *Config) IsEmpty() bool {
 	return len(c.Auths) == 0
 }
 
-// GetCredentials gets per-registry credentials from loaded Docker config
+// SetAuthRegistry makes us use credentials of another registry (identity) for the registry we connect to,
+// e.g. "docker.io" ones for a pull-through mirror "mirror.internal" (in memory only)
+func (c *Config) SetAuthRegistry(registry, identity string) {
+	if c.authRegistries == nil {
+		c.authRegistries = make(map[string]string)
+	}
+
+	c.authRegistries[registry] = identity
+}
+
+// AuthRegistry gives us registry identity we use credentials of for the registry passed (See SetAuthRegistry)
+func (c *Config) AuthRegistry(registry string) string {
+	if identity, defined := c.authRegistries[registry]; defined {
+		return identity
+	}
+
+	return registry
+}
+
+// GetCredentials gets per-registry credentials from registered auth providers (See RegisterAuthProvider) or loaded Docker config
+// NB! Credentials of the registry identity are given, if it is set for the registry (See SetAuthRegistry).
 func (c *Config) GetCredentials(registry string) (string, string, bool) {
+	username, password, decision := c.ResolveCredentials(registry)
+
+	return username, password, decision.Source != AuthSourceAnonymous
+}
+
+// ResolveCredentials gets per-registry credentials (See GetCredentials), together with the decision on how we got them
+// (See ExplainAuth), e.g. to log it while debugging auth problems
+func (c *Config) ResolveCredentials(registry string) (string, string, AuthDecision) {
+	decision := AuthDecision{Registry: registry, Identity: c.AuthRegistry(registry)}
+
+	if username, password, resolved := resolveProviderCredentials(context.Background(), "", &decision); resolved {
+		c.issue(decision.Identity, username, password)
+
+		return username, password, decision
+	}
+
+	if _, defined := c.usernames[decision.Identity]; defined {
+		username, password := c.usernames[decision.Identity], c.passwords[decision.Identity]
+
+		return username, password, decision.with(AuthSourceConfig, username, password)
+	}
+
+	decision.CredHelper = c.credHelper(decision.Identity)
+
+	username, password, defined := c.getStoredCredentials(decision.Identity)
+	if !defined {
+		return "", "", decision.with(AuthSourceAnonymous, "", "")
+	}
+
+	return username, password, decision.with(AuthSourceCredHelper, username, password)
+}
+
+// ResolveScopedCredentials gives us credentials to request token of the scope passed (e.g. "repository:team/app:pull") with,
+// so auth providers could hand out ones good for this scope only (and could give up, if context is done). Credentials passed
+// are kept, unless auth provider gave them to us (See ResolveCredentials), i.e. Docker config or explicit ones are never replaced.
+// NB! We fall back to credentials passed, if provider fails to authenticate us for the scope, "scoped" is false then.
+func (c *Config) ResolveScopedCredentials(ctx context.Context, registry, scope, username, password string) (string, string, AuthDecision, bool) {
+	decision := AuthDecision{Registry: registry, Identity: c.AuthRegistry(registry)}
+
+	if !c.issuedBy(decision.Identity, username, password) {
+		return username, password, decision, false
+	}
+
+	scopedUsername, scopedPassword, scoped := resolveProviderCredentials(ctx, scope, &decision)
+	if !scoped {
+		return username, password, decision.with(AuthSourceProvider, username, password), false
+	}
+
+	return scopedUsername, scopedPassword, decision, true
+}
+
+// resolveProviderCredentials gets credentials from the first registered auth provider authenticating us for the registry
+// identity of the decision passed (and the token scope, if it is known), updating the decision on the way
+func resolveProviderCredentials(ctx context.Context, scope string, decision *AuthDecision) (string, string, bool) {
+	auth, p, failures := resolveProviderAuth(ctx, decision.Identity, scope)
+	decision.Scope = scope
+	decision.ProviderFailures = failures
+	if p == nil {
+		return "", "", false
+	}
+
+	decision.Provider = fmt.Sprintf("%T", p)
+	if h, is := p.(*CredHelperProvider); is {
+		decision.CredHelper = h.Helper
+	}
+
+	username, password, err := decodeRegistryAuth(auth)
+	if err != nil {
+		decision.ProviderFailures = append(decision.ProviderFailures, fmt.Sprintf("%T: %s", p, err.Error()))
+
+		return "", "", false
+	}
+
+	*decision = decision.with(AuthSourceProvider, username, password)
+
+	return username, password, true
+}
+
+// issue remembers credentials auth provider gave us for the registry identity
+func (c *Config) issue(identity, username, password string) {
+	c.issuedMux.Lock()
+	defer c.issuedMux.Unlock()
+
+	if c.issued == nil {
+		c.issued = make(map[string]credentials)
+	}
+
+	c.issued[identity] = credentials{username: username, password: password}
+}
+
+// issuedBy tells us, if credentials passed are the ones auth provider gave us for the registry identity
+func (c *Config) issuedBy(identity, username, password string) bool {
+	c.issuedMux.Lock()
+	defer c.issuedMux.Unlock()
+
+	issued, defined := c.issued[identity]
+
+	return defined && issued == credentials{username: username, password: password}
+}
+
+// credHelper gives name(s) of the Docker config credential helper(s) we would invoke for the registry, or ""
+func (c *Config) credHelper(registry string) string {
+	var helpers []string
+
+	if c.CredsStore != "" {
+		helpers = append(helpers, c.CredsStore)
+	}
+
+	if helper, defined := c.CredHelpers[registry]; defined {
+		helpers = append(helpers, helper)
+	}
+
+	return strings.Join(helpers, ",")
+}
+
+// getStoredCredentials gets per-registry credentials from loaded Docker config (incl. its credential helpers)
+func (c *Config) getStoredCredentials(registry string) (string, string, bool) {
 	if _, defined := c.usernames[registry]; !defined {
 		username, password, err := credhelper.GetCredentials(
 			registry,
@@ -54,6 +208,17 @@ func (c *Config) GetCredentials(registry string) (string, string, bool) {
 	return c.usernames[registry], c.passwords[registry], true
 }
 
+// SetCredentials sets per-registry credentials in the loaded Docker config (in memory only)
+func (c *Config) SetCredentials(registry, username, password string) {
+	if c.usernames == nil {
+		c.usernames = make(map[string]string)
+		c.passwords = make(map[string]string)
+	}
+
+	c.usernames[registry] = username
+	c.passwords[registry] = password
+}
+
 func getAuthJSONString(username, password string) string {
 	if username == "_json_key" {
 		return fmt.Sprintf("%s:%s", username, password)
@@ -67,15 +232,28 @@ func getAuthJSONString(username, password string) string {
 }
 
 // GetRegistryAuth gets per-registry base64 authentication string
+// NB! Authentication of the registry identity is given, if it is set for the registry (See SetAuthRegistry).
 func (c *Config) GetRegistryAuth(registry string) string {
-	username, password, defined := c.GetCredentials(registry)
+	return c.GetRegistryAuthAs(registry, c.AuthRegistry(registry))
+}
+
+// GetRegistryAuthAs gets base64 authentication string for the registry we connect to, using credentials of
+// the registry identity passed explicitly (e.g. "docker.io" for a pull-through mirror)
+func (c *Config) GetRegistryAuthAs(registry, identity string) string {
+	if identity == "" {
+		identity = registry
+	}
+
+	if auth, supported := providerAuth(identity); supported {
+		return auth
+	}
+
+	username, password, defined := c.getStoredCredentials(identity)
 	if !defined {
 		return ""
 	}
 
-	return base64.StdEncoding.EncodeToString(
-		[]byte(getAuthJSONString(username, password)),
-	)
+	return EncodeRegistryAuth(username, password)
 }
 
 // Load loads a Config object from Docker JSON configuration file specified
@@ -103,7 +281,8 @@ func Load(fileName string) (*Config, error) {
 		}
 
 		authenticationToken := string(b)
-		usernameAndPassword := strings.Split(authenticationToken, ":")
+		// NB! Password (e.g. access token) may contain colons, while username may not
+		usernameAndPassword := strings.SplitN(authenticationToken, ":", 2)
 
 		if len(usernameAndPassword) == 2 {
 			c.usernames[registry] = usernameAndPassword[0]
@@ -132,6 +311,98 @@ func Load(fileName string) (*Config, error) {
 	return c, nil
 }
 
+// SaveCredentials saves per-registry credentials the same way "docker login" does it: with the credential helper
+// configured for the registry ("credHelpers" entry or "credsStore"), if any, or into Docker JSON configuration file
+// specified otherwise. In both cases all other data present in the file is left untouched.
+// NB! With a credential helper no secret is written into the file, stale ones present there for the registry are removed.
+func SaveCredentials(fileName, registry, username, password string) error {
+	path := fix.Path(fileName)
+
+	data := make(map[string]json.RawMessage)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(b) != 0 {
+		if err := json.Unmarshal(b, &data); err != nil {
+			return err
+		}
+	}
+
+	auths := make(map[string]json.RawMessage)
+	if _, defined := data["auths"]; defined {
+		if err := json.Unmarshal(data["auths"], &auths); err != nil {
+			return err
+		}
+	}
+
+	var credsStore string
+	if _, defined := data["credsStore"]; defined {
+		if err := json.Unmarshal(data["credsStore"], &credsStore); err != nil {
+			return err
+		}
+	}
+
+	credHelpers := make(map[string]string)
+	if _, defined := data["credHelpers"]; defined {
+		if err := json.Unmarshal(data["credHelpers"], &credHelpers); err != nil {
+			return err
+		}
+	}
+
+	if helper := credhelper.Helper(registry, credsStore, credHelpers); helper != "" {
+		if err := credhelper.StoreCredentials(registry, username, password, helper); err != nil {
+			return err
+		}
+
+		if _, defined := auths[registry]; !defined {
+			return nil
+		}
+
+		delete(auths, registry)
+	} else {
+		auths[registry], err = json.Marshal(Auth{
+			B64Auth: base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	data["auths"], err = json.Marshal(auths)
+	if err != nil {
+		return err
+	}
+
+	b, err = json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
 func parseConfig(f *os.File) (*Config, error) {
 	c := &Config{}
 
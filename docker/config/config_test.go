@@ -1,6 +1,10 @@
 package config
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +37,34 @@ func TestGetRegistryAuth(t *testing.T) {
 	}
 }
 
+func TestGetRegistryAuth_AuthRegistry(t *testing.T) {
+	c, err := Load(configFile)
+
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", configFile, err.Error())
+	}
+
+	expectedAuth := c.GetRegistryAuth("registry.company.io")
+
+	if auth := c.GetRegistryAuthAs("mirror.internal", "registry.company.io"); auth != expectedAuth {
+		t.Fatalf("Unexpected authentication string for explicit identity: %s (expected: %s)", auth, expectedAuth)
+	}
+
+	if auth := c.GetRegistryAuth("mirror.internal"); auth != "" {
+		t.Fatalf("Unexpected authentication string for registry with no identity set: %s", auth)
+	}
+
+	c.SetAuthRegistry("mirror.internal", "registry.company.io")
+
+	if auth := c.GetRegistryAuth("mirror.internal"); auth != expectedAuth {
+		t.Fatalf("Unexpected authentication string for registry with identity set: %s (expected: %s)", auth, expectedAuth)
+	}
+
+	if username, _, defined := c.GetCredentials("mirror.internal"); !defined || username != "user1" {
+		t.Fatalf("Unexpected credentials for registry with identity set: '%s' (defined: %v)", username, defined)
+	}
+}
+
 func TestLoad(t *testing.T) {
 	examples := map[string]string{
 		"registry.company.io":     "user1:pass1",
@@ -156,3 +188,185 @@ func TestLoadWithCorruptConfigFile(t *testing.T) {
 		)
 	}
 }
+
+func TestSaveCredentials(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	data, _ := ioutil.ReadFile(configFile)
+	data = []byte(strings.Replace(string(data), "{\n\t\"auths\"", "{\n\t\"currentContext\": \"build-host\",\n\t\"auths\"", 1))
+
+	savedConfigFile := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(savedConfigFile, data, 0600)
+
+	if err := SaveCredentials(savedConfigFile, "registry.mindundi.org", "user3", "pass3"); err != nil {
+		t.Fatalf("Unable to save credentials into '%s': %s", savedConfigFile, err.Error())
+	}
+
+	c, err := Load(savedConfigFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", savedConfigFile, err.Error())
+	}
+
+	examples := map[string]string{
+		"registry.company.io":     "user1:pass1",
+		"registry.hub.docker.com": "user2:pass2",
+		"registry.mindundi.org":   "user3:pass3",
+	}
+
+	for registry, expected := range examples {
+		username, password, _ := c.GetCredentials(registry)
+
+		if username+":"+password != expected {
+			t.Fatalf(
+				"Unexpected 'username:password' for registry '%s': '%s' (expected: '%s')",
+				registry,
+				username+":"+password,
+				expected,
+			)
+		}
+	}
+
+	if c.CurrentContext != "build-host" {
+		t.Fatalf("Expected to preserve other data present in config file, but 'currentContext' is lost")
+	}
+}
+
+// installCredHelper puts fake "docker-credential-lstags" helper into PATH, it stores credentials into "stored.json"
+// file next to itself and gives them back for any registry
+func installCredHelper(t *testing.T, dir string) func() {
+	script := "#!/bin/sh\n" +
+		"case \"$1\" in\n" +
+		"store) cat > \"$(dirname \"$0\")/stored.json\" ;;\n" +
+		"get) cat \"$(dirname \"$0\")/stored.json\" ;;\n" +
+		"*) exit 1 ;;\n" +
+		"esac\n"
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "docker-credential-lstags"), []byte(script), 0755); err != nil {
+		t.Fatalf("Unable to install credential helper: %s", err.Error())
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+
+	return func() { os.Setenv("PATH", path) }
+}
+
+func TestSaveCredentials_CredHelper(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	defer installCredHelper(t, dir)()
+
+	data, _ := ioutil.ReadFile(configFile)
+	data = []byte(strings.Replace(string(data), "{\n\t\"auths\"", "{\n\t\"credHelpers\": {\"registry.company.io\": \"lstags\"},\n\t\"auths\"", 1))
+
+	savedConfigFile := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(savedConfigFile, data, 0600)
+
+	if err := SaveCredentials(savedConfigFile, "registry.company.io", "user3", "pass3"); err != nil {
+		t.Fatalf("Unable to save credentials with credential helper: %s", err.Error())
+	}
+
+	saved, _ := ioutil.ReadFile(savedConfigFile)
+	if strings.Contains(string(saved), "registry.company.io\": {") {
+		t.Fatalf("Expected to remove credentials stored with credential helper from config file:\n%s", saved)
+	}
+	if strings.Contains(string(saved), "pass3") {
+		t.Fatalf("Expected NOT to write secret into config file, if credential helper is used:\n%s", saved)
+	}
+
+	c, err := Load(savedConfigFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", savedConfigFile, err.Error())
+	}
+
+	examples := map[string]string{
+		"registry.company.io":     "user3:pass3",
+		"registry.hub.docker.com": "user2:pass2",
+	}
+
+	for registry, expected := range examples {
+		username, password, _ := c.GetCredentials(registry)
+
+		if username+":"+password != expected {
+			t.Fatalf(
+				"Unexpected 'username:password' for registry '%s': '%s' (expected: '%s')",
+				registry,
+				username+":"+password,
+				expected,
+			)
+		}
+	}
+}
+
+func TestSaveCredentials_CredsStoreFailure(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	data := []byte("{\n\t\"credsStore\": \"lstags-nonexistent\"\n}\n")
+
+	savedConfigFile := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(savedConfigFile, data, 0600)
+
+	if err := SaveCredentials(savedConfigFile, "localhost:5000", "foo", "bar"); err == nil {
+		t.Fatalf("Expected to fail, if credential helper could not store credentials")
+	}
+
+	saved, _ := ioutil.ReadFile(savedConfigFile)
+	if string(saved) != string(data) {
+		t.Fatalf("Expected NOT to fall back to storing credentials in config file:\n%s", saved)
+	}
+}
+
+func TestSaveCredentials_NewFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	newConfigFile := filepath.Join(dir, ".docker", "config.json")
+
+	if err := SaveCredentials(newConfigFile, "localhost:5000", "foo", "bar"); err != nil {
+		t.Fatalf("Unable to save credentials into new file '%s': %s", newConfigFile, err.Error())
+	}
+
+	c, err := Load(newConfigFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", newConfigFile, err.Error())
+	}
+
+	if c.GetRegistryAuth("localhost:5000") == "" {
+		t.Fatalf("Expected to load saved credentials from new file: %s", newConfigFile)
+	}
+}
+
+func TestSetCredentials(t *testing.T) {
+	c := &Config{}
+
+	c.SetCredentials("localhost:5000", "foo", "bar")
+
+	username, password, defined := c.GetCredentials("localhost:5000")
+	if !defined || username != "foo" || password != "bar" {
+		t.Fatalf("Unexpected credentials set: '%s:%s'", username, password)
+	}
+}
+
+func TestLoad_PasswordWithColons(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "docker")
+	defer os.RemoveAll(dir)
+
+	savedConfigFile := filepath.Join(dir, "config.json")
+
+	if err := SaveCredentials(savedConfigFile, "ghcr.io", "octocat", "ghp:token:with:colons"); err != nil {
+		t.Fatalf("Unable to save credentials into '%s': %s", savedConfigFile, err.Error())
+	}
+
+	c, err := Load(savedConfigFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", savedConfigFile, err.Error())
+	}
+
+	username, password, _ := c.GetCredentials("ghcr.io")
+	if username != "octocat" || password != "ghp:token:with:colons" {
+		t.Fatalf("Unexpected credentials loaded: '%s' / '%s'", username, password)
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 type storedCredentials struct {
@@ -58,3 +60,45 @@ func getCredentials(registry, provider string) (*storedCredentials, error) {
 
 	return &c, nil
 }
+
+// Helper gives us name of the credential helper Docker stores credentials of the registry with ("credHelpers" entry
+// of the registry takes precedence over "credsStore"), or an empty string, if they are stored in Docker config itself
+func Helper(registry, credsStore string, credHelpers map[string]string) string {
+	if provider, defined := credHelpers[registry]; defined {
+		return provider
+	}
+
+	return credsStore
+}
+
+// StoreCredentials stores Docker registry credentials with the credential helper passed (like "docker login" does)
+func StoreCredentials(registry, username, password, provider string) error {
+	b, err := json.Marshal(struct {
+		ServerURL string
+		Username  string
+		Secret    string
+	}{registry, username, password})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("docker-credential-"+provider, "store")
+
+	var output bytes.Buffer
+
+	cmd.Stdin = bytes.NewBuffer(b)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf(
+			"credential helper '%s' failed to store credentials of %s: %s (%s)",
+			provider,
+			registry,
+			err.Error(),
+			strings.TrimSpace(output.String()),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Sources of credentials we could end up with (See AuthDecision)
+const (
+	AuthSourceProvider   = "provider"
+	AuthSourceConfig     = "config"
+	AuthSourceCredHelper = "credhelper"
+	AuthSourceAnonymous  = "anonymous"
+	AuthSourceExplicit   = "explicit"
+)
+
+// AuthDecision explains how we resolved credentials for the registry, e.g. why we went anonymous (See ExplainAuth)
+// NB! It never carries secrets: we only tell, if there was a password (or token) or not.
+type AuthDecision struct {
+	// Registry we connect to
+	Registry string
+	// Identity is a registry we use credentials of (See SetAuthRegistry), the same as Registry, if not set
+	Identity string
+	// Source is one of: "provider", "config", "credhelper" or "anonymous" (or "explicit" for credentials passed by API user)
+	Source string
+	// Provider is a type of the registered auth provider matched, "" if none did
+	Provider string
+	// ProviderFailures are failures of the auth providers supporting the registry, but not authenticating us
+	ProviderFailures []string
+	// CredHelper is a name of the credential helper invoked ("docker-credential-HELPER"), "" if none was
+	CredHelper string
+	// Scope is a token scope requested from auth provider, "" if not known (i.e. any scope)
+	Scope string
+	// Username we resolved, "" if anonymous
+	Username string
+	// HasSecret is true, if we resolved a password (or token) too
+	HasSecret bool
+}
+
+func (d AuthDecision) with(source, username, password string) AuthDecision {
+	d.Source = source
+	d.Username = username
+	d.HasSecret = password != ""
+
+	return d
+}
+
+// CredHelperInvoked tells us, if we invoked a credential helper to resolve credentials
+func (d AuthDecision) CredHelperInvoked() bool {
+	return d.CredHelper != ""
+}
+
+// String gives a single-line explanation of the decision, suitable for logging
+func (d AuthDecision) String() string {
+	s := fmt.Sprintf("registry %s", d.Registry)
+	if d.Identity != d.Registry {
+		s += fmt.Sprintf(" (as %s)", d.Identity)
+	}
+
+	s += fmt.Sprintf(": source=%s", d.Source)
+
+	if d.Provider != "" {
+		s += fmt.Sprintf(" provider=%s", d.Provider)
+	}
+	if d.CredHelper != "" {
+		s += fmt.Sprintf(" credhelper=%s", d.CredHelper)
+	}
+	if d.Scope != "" {
+		s += fmt.Sprintf(" scope=%s", d.Scope)
+	}
+	if d.Username != "" {
+		s += fmt.Sprintf(" username=%s", d.Username)
+	}
+
+	secret := "none"
+	if d.HasSecret {
+		secret = "<redacted>"
+	}
+	s += fmt.Sprintf(" secret=%s", secret)
+
+	if len(d.ProviderFailures) > 0 {
+		s += fmt.Sprintf(" provider_failures=[%s]", strings.Join(d.ProviderFailures, "; "))
+	}
+
+	return s
+}
+
+// ExplainAuth resolves credentials for the registry (just as GetCredentials does) and tells us how we did it:
+// which auth provider matched, if credential helper was invoked, which scope was requested and so on.
+// NB! Resolution is not dry, i.e. auth providers and credential helpers are really invoked.
+func (c *Config) ExplainAuth(registry string) AuthDecision {
+	_, _, decision := c.ResolveCredentials(registry)
+
+	return decision
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExplainAuth(t *testing.T) {
+	defer func() { authProviders = nil }()
+
+	c, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", configFile, err.Error())
+	}
+
+	if d := c.ExplainAuth("registry.company.io"); d.Source != AuthSourceConfig || d.Username != "user1" || !d.HasSecret || d.CredHelperInvoked() {
+		t.Fatalf("Unexpected decision for Docker config credentials: %s", d)
+	}
+
+	if d := c.ExplainAuth("registry.mindundi.org"); d.Source != AuthSourceAnonymous || d.Username != "" || d.HasSecret {
+		t.Fatalf("Unexpected decision for registry with no credentials: %s", d)
+	}
+
+	RegisterAuthProvider(&failingProvider{})
+	RegisterAuthProvider(&StaticProvider{Pattern: "*.company.io", Username: "robot", Password: "s3cr3t"})
+
+	c.SetAuthRegistry("mirror.internal", "registry.company.io")
+
+	d := c.ExplainAuth("mirror.internal")
+	if d.Source != AuthSourceProvider || d.Identity != "registry.company.io" || d.Provider != "*config.StaticProvider" || d.Username != "robot" {
+		t.Fatalf("Unexpected decision for auth provider credentials: %s", d)
+	}
+
+	if len(d.ProviderFailures) != 1 || !strings.Contains(d.ProviderFailures[0], "secret store is down") {
+		t.Fatalf("Expected failure of the failing provider to be explained, got: %+v", d.ProviderFailures)
+	}
+
+	if s := d.String(); strings.Contains(s, "s3cr3t") || !strings.Contains(s, "secret=<redacted>") {
+		t.Fatalf("Expected secret to be redacted in decision explained: %s", s)
+	}
+}
+
+func TestExplainAuth_CredHelper(t *testing.T) {
+	c := &Config{CredHelpers: map[string]string{"registry.nowhere.io": "nonexistent"}}
+
+	d := c.ExplainAuth("registry.nowhere.io")
+	if d.Source != AuthSourceAnonymous || !d.CredHelperInvoked() || d.CredHelper != "nonexistent" {
+		t.Fatalf("Expected to go anonymous after failing credential helper, got: %s", d)
+	}
+}
+
+func TestExplainAuth_Scope(t *testing.T) {
+	defer func() { authProviders = nil }()
+
+	c, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", configFile, err.Error())
+	}
+
+	RegisterAuthProvider(&scopedProvider{})
+
+	if d := c.ExplainAuth("registry.company.io"); d.Scope != "" || strings.Contains(d.String(), "scope=") {
+		t.Fatalf("Expected no scope to be explained for the whole registry, got: %s", d)
+	}
+
+	username, password, _ := c.ResolveCredentials("registry.company.io")
+
+	const scope = "repository:team/app:pull,push"
+
+	_, _, d, _ := c.ResolveScopedCredentials(context.Background(), "registry.company.io", scope, username, password)
+	if d.Scope != scope || d.Source != AuthSourceProvider || !strings.Contains(d.String(), "scope="+scope) {
+		t.Fatalf("Expected scope '%s' requested from auth provider to be explained, got: %s", scope, d)
+	}
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/docker/config/credhelper"
+)
+
+// AuthProvider authenticates us to the registries it supports, e.g. getting short-lived credentials from a cloud provider
+// or a secret store. Providers registered (See RegisterAuthProvider) are consulted before Docker config credentials.
+type AuthProvider interface {
+	// Supports tells us if provider could authenticate us to the registry ADDR[:PORT] passed
+	Supports(registry string) bool
+	// Auth gives base64-encoded authentication string for the registry (the same GetRegistryAuth gives us)
+	// NB! Scope is a token scope (e.g. "repository:team/app:pull") or "", if it is not known.
+	Auth(ctx context.Context, registry, scope string) (string, error)
+}
+
+var (
+	authProviders    []AuthProvider
+	authProvidersMux sync.Mutex
+)
+
+// RegisterAuthProvider registers provider to be consulted (in order of registration) for the registries it supports.
+// NB! Register providers before constructing any client, credentials are not re-resolved for connected registries.
+func RegisterAuthProvider(p AuthProvider) {
+	authProvidersMux.Lock()
+	defer authProvidersMux.Unlock()
+
+	authProviders = append(authProviders, p)
+}
+
+// providerAuth gives authentication string of the first registered provider supporting the registry and authenticating us
+func providerAuth(registry string) (string, bool) {
+	auth, p, _ := resolveProviderAuth(context.Background(), registry, "")
+
+	return auth, p != nil
+}
+
+// resolveProviderAuth gives authentication string and the first registered provider supporting the registry and
+// authenticating us for the token scope passed (nil, if none did), and failures of the providers supporting the registry,
+// but failed to do so. NB! Scope is "", if it is not known (e.g. while we resolve credentials for the whole registry).
+func resolveProviderAuth(ctx context.Context, registry, scope string) (string, AuthProvider, []string) {
+	authProvidersMux.Lock()
+	providers := make([]AuthProvider, len(authProviders))
+	copy(providers, authProviders)
+	authProvidersMux.Unlock()
+
+	var failures []string
+
+	for _, p := range providers {
+		if !p.Supports(registry) {
+			continue
+		}
+
+		auth, err := p.Auth(ctx, registry, scope)
+		if err != nil {
+			log.Warnf("Unable to authenticate to %s with auth provider %T: %s", registry, p, err.Error())
+			failures = append(failures, fmt.Sprintf("%T: %s", p, err.Error()))
+			continue
+		}
+
+		return auth, p, failures
+	}
+
+	return "", nil, failures
+}
+
+// EncodeRegistryAuth encodes username and password into base64 authentication string (the one GetRegistryAuth gives us)
+func EncodeRegistryAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString(
+		[]byte(getAuthJSONString(username, password)),
+	)
+}
+
+// decodeRegistryAuth decodes username and password from base64 authentication string (See EncodeRegistryAuth)
+func decodeRegistryAuth(auth string) (string, string, error) {
+	data, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return "", "", err
+	}
+
+	var c struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(data, &c); err == nil {
+		return c.Username, c.Password, nil
+	}
+
+	fields := strings.SplitN(string(data), ":", 2)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("invalid authentication string (neither JSON, nor USERNAME:PASSWORD)")
+	}
+
+	return fields[0], fields[1], nil
+}
+
+func matchAny(patterns []string, registry string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, registry); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// StaticProvider authenticates us to registries matching the pattern (e.g. "*.company.io") with the same credentials
+type StaticProvider struct {
+	Pattern  string
+	Username string
+	Password string
+}
+
+// Supports implements AuthProvider interface
+func (p *StaticProvider) Supports(registry string) bool {
+	return matchAny([]string{p.Pattern}, registry)
+}
+
+// Auth implements AuthProvider interface
+func (p *StaticProvider) Auth(_ context.Context, _, _ string) (string, error) {
+	return EncodeRegistryAuth(p.Username, p.Password), nil
+}
+
+// CredHelperProvider authenticates us to registries matching any of the patterns with Docker credential helper
+// ("docker-credential-HELPER" binary), even if it is not configured in Docker config for these registries
+type CredHelperProvider struct {
+	Helper   string
+	Patterns []string
+}
+
+// Supports implements AuthProvider interface
+func (p *CredHelperProvider) Supports(registry string) bool {
+	return matchAny(p.Patterns, registry)
+}
+
+// Auth implements AuthProvider interface
+func (p *CredHelperProvider) Auth(_ context.Context, registry, _ string) (string, error) {
+	username, password, err := credhelper.GetCredentials(registry, "", map[string]string{registry: p.Helper})
+	if err != nil {
+		return "", err
+	}
+
+	return EncodeRegistryAuth(username, password), nil
+}
+
+// builtinAuthProviders are providers we could enable by name (See BuiltinAuthProvider)
+var builtinAuthProviders = map[string]func() AuthProvider{
+	// Amazon ECR, with "docker-credential-ecr-login" helper
+	"ecr": func() AuthProvider {
+		return &CredHelperProvider{Helper: "ecr-login", Patterns: []string{"*.dkr.ecr.*.amazonaws.com", "*.dkr.ecr.*.amazonaws.com.cn"}}
+	},
+	// Google Container and Artifact registries, with "docker-credential-gcr" helper
+	"gcr": func() AuthProvider {
+		return &CredHelperProvider{Helper: "gcr", Patterns: []string{"gcr.io", "*.gcr.io", "*-docker.pkg.dev"}}
+	},
+}
+
+// BuiltinAuthProvider gives us one of the built-in providers by its name: "ecr" or "gcr"
+func BuiltinAuthProvider(name string) (AuthProvider, error) {
+	newProvider, defined := builtinAuthProviders[name]
+	if !defined {
+		names := make([]string, 0, len(builtinAuthProviders))
+		for name := range builtinAuthProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown auth provider '%s' (should be one of: %s)", name, strings.Join(names, ", "))
+	}
+
+	return newProvider(), nil
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type failingProvider struct{}
+
+func (p *failingProvider) Supports(registry string) bool {
+	return true
+}
+
+func (p *failingProvider) Auth(_ context.Context, _, _ string) (string, error) {
+	return "", errors.New("secret store is down")
+}
+
+func TestAuthProviders(t *testing.T) {
+	defer func() { authProviders = nil }()
+
+	c, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", configFile, err.Error())
+	}
+
+	storedAuth := c.GetRegistryAuth("registry.company.io")
+
+	RegisterAuthProvider(&failingProvider{})
+	RegisterAuthProvider(&StaticProvider{Pattern: "*.company.io", Username: "robot", Password: "s3cr3t"})
+	RegisterAuthProvider(&StaticProvider{Pattern: "registry.company.io", Username: "never", Password: "used"})
+
+	expectedAuth := EncodeRegistryAuth("robot", "s3cr3t")
+
+	if auth := c.GetRegistryAuth("registry.company.io"); auth != expectedAuth {
+		t.Fatalf("Unexpected authentication string of the first working provider: %s (expected: %s)", auth, expectedAuth)
+	}
+
+	if username, password, defined := c.GetCredentials("registry.company.io"); !defined || username != "robot" || password != "s3cr3t" {
+		t.Fatalf("Unexpected credentials of the first working provider: '%s' / '%s' (defined: %v)", username, password, defined)
+	}
+
+	c.SetAuthRegistry("mirror.internal", "registry.company.io")
+
+	if auth := c.GetRegistryAuth("mirror.internal"); auth != expectedAuth {
+		t.Fatalf("Unexpected authentication string for registry with identity set: %s (expected: %s)", auth, expectedAuth)
+	}
+
+	authProviders = []AuthProvider{&StaticProvider{Pattern: "*.company.io", Username: "robot", Password: "s3cr3t"}}
+
+	if auth := c.GetRegistryAuth("registry.hub.docker.com"); auth == expectedAuth || auth == "" {
+		t.Fatalf("Expected Docker config credentials for registry not supported by providers, got: %s", auth)
+	}
+
+	authProviders = []AuthProvider{&failingProvider{}}
+
+	if auth := c.GetRegistryAuth("registry.company.io"); auth != storedAuth {
+		t.Fatalf("Expected Docker config credentials, if no provider works, got: %s (expected: %s)", auth, storedAuth)
+	}
+}
+
+// scopedProvider hands out credentials good for the token scope requested only (e.g. like Vault does)
+type scopedProvider struct {
+	scopes []string
+}
+
+func (p *scopedProvider) Supports(registry string) bool {
+	return registry == "registry.company.io"
+}
+
+func (p *scopedProvider) Auth(ctx context.Context, _, scope string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	p.scopes = append(p.scopes, scope)
+
+	return EncodeRegistryAuth("robot", "token-for-"+scope), nil
+}
+
+func TestResolveScopedCredentials(t *testing.T) {
+	defer func() { authProviders = nil }()
+
+	c, err := Load(configFile)
+	if err != nil {
+		t.Fatalf("Error while loading '%s': %s", configFile, err.Error())
+	}
+
+	p := &scopedProvider{}
+	RegisterAuthProvider(p)
+
+	username, password, _ := c.ResolveCredentials("registry.company.io")
+	if username != "robot" || password != "token-for-" {
+		t.Fatalf("Unexpected credentials resolved for the whole registry: '%s' / '%s'", username, password)
+	}
+
+	const scope = "repository:team/app:pull"
+
+	username, password, _, scoped := c.ResolveScopedCredentials(context.Background(), "registry.company.io", scope, username, password)
+	if !scoped || username != "robot" || password != "token-for-"+scope {
+		t.Fatalf("Unexpected credentials resolved for the scope '%s': '%s' / '%s' (scoped: %v)", scope, username, password, scoped)
+	}
+	if len(p.scopes) != 2 || p.scopes[1] != scope {
+		t.Fatalf("Expected provider to be asked for the scope '%s', got: %+v", scope, p.scopes)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	username, password, _, scoped = c.ResolveScopedCredentials(ctx, "registry.company.io", scope, "robot", "token-for-")
+	if scoped || username != "robot" || password != "token-for-" {
+		t.Fatalf("Expected to keep credentials passed, if context is done, got: '%s' / '%s' (scoped: %v)", username, password, scoped)
+	}
+
+	username, password, _, scoped = c.ResolveScopedCredentials(context.Background(), "registry.company.io", scope, "user1", "pass1")
+	if scoped || username != "user1" || password != "pass1" {
+		t.Fatalf("Expected to keep credentials not given by provider, got: '%s' / '%s' (scoped: %v)", username, password, scoped)
+	}
+}
+
+func TestDecodeRegistryAuth(t *testing.T) {
+	for _, example := range [][2]string{{"user1", "pass1"}, {"_json_key", `{"type": "service_account"}`}} {
+		username, password, err := decodeRegistryAuth(EncodeRegistryAuth(example[0], example[1]))
+		if err != nil {
+			t.Fatalf("Unable to decode authentication string of '%s': %s", example[0], err.Error())
+		}
+
+		if username != example[0] || password != example[1] {
+			t.Fatalf("Unexpected credentials decoded: '%s' / '%s' (expected: '%s' / '%s')", username, password, example[0], example[1])
+		}
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGEgcGFpcg=="} {
+		if _, _, err := decodeRegistryAuth(invalid); err == nil {
+			t.Fatalf("Expected to fail while decoding invalid authentication string: %s", invalid)
+		}
+	}
+}
+
+func TestBuiltinAuthProvider(t *testing.T) {
+	examples := map[string][]string{
+		"ecr": {"123456789012.dkr.ecr.eu-west-1.amazonaws.com", "123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn"},
+		"gcr": {"gcr.io", "eu.gcr.io", "europe-west1-docker.pkg.dev"},
+	}
+
+	for name, registries := range examples {
+		p, err := BuiltinAuthProvider(name)
+		if err != nil {
+			t.Fatalf("Unable to get built-in auth provider '%s': %s", name, err.Error())
+		}
+
+		for _, registry := range registries {
+			if !p.Supports(registry) {
+				t.Fatalf("Built-in auth provider '%s' does not support registry: %s", name, registry)
+			}
+		}
+
+		if p.Supports("registry.company.io") {
+			t.Fatalf("Built-in auth provider '%s' supports unrelated registry", name)
+		}
+	}
+
+	if _, err := BuiltinAuthProvider("vault"); err == nil {
+		t.Fatalf("Expected to fail while getting unknown built-in auth provider")
+	}
+}
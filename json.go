@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	v1 "github.com/ivanilves/lstags/api/v1"
+	"github.com/ivanilves/lstags/api/v1/collection"
+)
+
+// errorCodes are machine-readable names of our exit codes, we give them for errors in JSON output
+var errorCodes = map[int]string{
+	exitConfigError:    "config_error",
+	exitUnreachable:    "unreachable",
+	exitAuthError:      "auth_error",
+	exitPartialFailure: "partial_failure",
+	exitFailure:        "failure",
+}
+
+type jsonTag struct {
+	Ref          string            `json:"ref"`
+	State        string            `json:"state"`
+	Digest       string            `json:"digest"`
+	ImageID      string            `json:"image_id,omitempty"`
+	Created      int64             `json:"created,omitempty"`
+	Size         int64             `json:"size,omitempty"`
+	LayerCount   int               `json:"layer_count,omitempty"`
+	ArtifactType string            `json:"artifact_type,omitempty"`
+	LastPulled   int64             `json:"last_pulled,omitempty"`
+	LastModified int64             `json:"last_modified,omitempty"`
+	Captures     map[string]string `json:"captures,omitempty"`
+	Error        string            `json:"error,omitempty"`
+}
+
+type jsonSummary struct {
+	Operation        string            `json:"operation"`
+	Done             int               `json:"done"`
+	Skipped          int               `json:"skipped"`
+	Failed           int               `json:"failed"`
+	Duration         float64           `json:"duration_seconds"`
+	BudgetExhausted  bool              `json:"budget_exhausted,omitempty"`
+	RetriesExhausted bool              `json:"retries_exhausted,omitempty"`
+	Stopped          bool              `json:"stopped,omitempty"`
+	CopiedBytes      int64             `json:"copied_bytes,omitempty"`
+	SavedBytes       int64             `json:"saved_bytes,omitempty"`
+	Credentials      []jsonCredentials `json:"credentials,omitempty"`
+}
+
+// jsonCredentials tells how we authenticated to the registry we pushed to (secrets are never given)
+type jsonCredentials struct {
+	Registry   string `json:"registry"`
+	Identity   string `json:"identity,omitempty"`
+	Source     string `json:"source"`
+	Provider   string `json:"provider,omitempty"`
+	CredHelper string `json:"credhelper,omitempty"`
+	Username   string `json:"username,omitempty"`
+	HasSecret  bool   `json:"has_secret"`
+}
+
+type jsonAliases struct {
+	Repo      string   `json:"repo"`
+	Digest    string   `json:"digest"`
+	Tags      []string `json:"tags"`
+	Redundant int      `json:"redundant"`
+}
+
+type jsonGroup struct {
+	Repo  string   `json:"repo"`
+	Name  string   `json:"name"`
+	Value string   `json:"value"`
+	Tags  []string `json:"tags"`
+}
+
+type jsonTotalSize struct {
+	Tags        int   `json:"tags"`
+	Bytes       int64 `json:"bytes"`
+	UniqueBytes int64 `json:"unique_bytes"`
+	Unknown     int   `json:"unknown"`
+}
+
+type jsonError struct {
+	Ref     string `json:"ref,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// jsonReport is what we print in JSON mode (See 'json'): tags collected, summaries of operations done and all errors we got
+type jsonReport struct {
+	Tags      []jsonTag      `json:"tags"`
+	Summaries []jsonSummary  `json:"summaries"`
+	Errors    []jsonError    `json:"errors"`
+	Aliases   []jsonAliases  `json:"aliases,omitempty"`
+	Groups    []jsonGroup    `json:"groups,omitempty"`
+	TotalSize *jsonTotalSize `json:"total_size,omitempty"`
+
+	// quiet report is not printed, it is collected only to be sent to the webhook (See 'webhook')
+	quiet bool
+}
+
+// jsonNotification is what we send to the webhook after every run (See 'webhook')
+type jsonNotification struct {
+	Run       int           `json:"run"`
+	Status    string        `json:"status"`
+	ExitCode  int           `json:"exit_code"`
+	Duration  float64       `json:"duration_seconds"`
+	Summaries []jsonSummary `json:"summaries"`
+	Errors    []jsonError   `json:"errors"`
+}
+
+// report collects JSON output of the current run (it is nil, if we are not in JSON mode)
+var report *jsonReport
+
+func newJSONReport() *jsonReport {
+	return &jsonReport{
+		Tags:      make([]jsonTag, 0),
+		Summaries: make([]jsonSummary, 0),
+		Errors:    make([]jsonError, 0),
+	}
+}
+
+func (r *jsonReport) AddTags(cn *collection.Collection) {
+	if r == nil {
+		return
+	}
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, tg := range cn.Tags(ref) {
+			var message string
+			if err := tg.GetError(); err != nil {
+				message = err.Error()
+			}
+
+			r.Tags = append(r.Tags, jsonTag{
+				Ref:          imageName(repo) + ":" + tg.Name(),
+				State:        tg.GetState(),
+				Digest:       tg.GetDigest(),
+				ImageID:      tg.GetImageID(),
+				Created:      tg.GetCreated(),
+				Size:         tg.GetSize(),
+				LayerCount:   tg.GetLayerCount(),
+				ArtifactType: tg.GetArtifactType(),
+				LastPulled:   tg.GetLastPulled(),
+				LastModified: tg.GetLastModified(),
+				Captures:     tg.GetCaptures(),
+				Error:        message,
+			})
+		}
+	}
+}
+
+// AddAliases adds tags pointing at the same content (digest) for every repository in the collection (See 'aliases')
+func (r *jsonReport) AddAliases(cn *collection.Collection) {
+	if r == nil {
+		return
+	}
+
+	if r.Aliases == nil {
+		r.Aliases = make([]jsonAliases, 0)
+	}
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, aliases := range cn.Aliases(ref) {
+			r.Aliases = append(r.Aliases, jsonAliases{
+				Repo:      imageName(repo),
+				Digest:    aliases.Digest,
+				Tags:      aliases.Tags,
+				Redundant: aliases.Redundant(),
+			})
+		}
+	}
+}
+
+// AddGroups adds tags grouped by the value of the named group captured from their names for every repository (See 'group-by')
+func (r *jsonReport) AddGroups(cn *collection.Collection, name string) {
+	if r == nil {
+		return
+	}
+
+	if r.Groups == nil {
+		r.Groups = make([]jsonGroup, 0)
+	}
+
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, group := range cn.Groups(ref, name) {
+			r.Groups = append(r.Groups, jsonGroup{
+				Repo:  imageName(repo),
+				Name:  name,
+				Value: group.Value,
+				Tags:  group.Tags,
+			})
+		}
+	}
+}
+
+// AddTotalSize adds total size of tags collected (See 'total-size')
+func (r *jsonReport) AddTotalSize(cn *collection.Collection) {
+	if r == nil {
+		return
+	}
+
+	total := cn.TotalSize()
+
+	r.TotalSize = &jsonTotalSize{
+		Tags:        total.Tags,
+		Bytes:       total.Bytes,
+		UniqueBytes: total.UniqueBytes,
+		Unknown:     total.Unknown,
+	}
+}
+
+// AddSummary adds summary of the operation along with errors we got for particular tags
+func (r *jsonReport) AddSummary(summary *v1.Summary) {
+	if r == nil || summary == nil {
+		return
+	}
+
+	r.Summaries = append(r.Summaries, jsonSummary{
+		Operation:        summary.Operation,
+		Done:             summary.Done,
+		Skipped:          summary.Skipped,
+		Failed:           summary.Failed,
+		Duration:         summary.Duration.Seconds(),
+		BudgetExhausted:  summary.BudgetExhausted,
+		RetriesExhausted: summary.RetriesExhausted,
+		Stopped:          summary.Stopped,
+		CopiedBytes:      summary.CopiedBytes,
+		SavedBytes:       summary.SavedBytes,
+		Credentials:      getJSONCredentials(summary),
+	})
+
+	for _, tagErr := range summary.Errors {
+		r.Errors = append(r.Errors, jsonError{
+			Ref:     imageRef(tagErr.Ref),
+			Code:    errorCodes[getExitCode(tagErr.Err, nil)],
+			Message: tagErr.Err.Error(),
+		})
+	}
+}
+
+// getJSONCredentials gives us how we authenticated to every registry we pushed to, sorted by registry
+func getJSONCredentials(summary *v1.Summary) []jsonCredentials {
+	var credentials []jsonCredentials
+
+	for _, registry := range getCredentialRegistries(summary) {
+		d := summary.Credentials[registry]
+
+		c := jsonCredentials{
+			Registry:   d.Registry,
+			Source:     d.Source,
+			Provider:   d.Provider,
+			CredHelper: d.CredHelper,
+			Username:   d.Username,
+			HasSecret:  d.HasSecret,
+		}
+		if d.Identity != d.Registry {
+			c.Identity = d.Identity
+		}
+
+		credentials = append(credentials, c)
+	}
+
+	return credentials
+}
+
+// AddError adds error not related to any particular tag (e.g. we failed to reach the registry)
+func (r *jsonReport) AddError(err error, code int) {
+	if r == nil {
+		return
+	}
+
+	r.Errors = append(r.Errors, jsonError{Code: errorCodes[code], Message: err.Error()})
+}
+
+// Notification gives us notification of the run (summaries and errors of the report, without tags)
+func (r *jsonReport) Notification(run, code int, duration time.Duration) jsonNotification {
+	status := "ok"
+	if code != exitOK {
+		status = errorCodes[code]
+	}
+
+	n := jsonNotification{
+		Run:       run,
+		Status:    status,
+		ExitCode:  code,
+		Duration:  duration.Seconds(),
+		Summaries: make([]jsonSummary, 0),
+		Errors:    make([]jsonError, 0),
+	}
+
+	if r != nil {
+		n.Summaries = append(n.Summaries, r.Summaries...)
+		n.Errors = append(n.Errors, r.Errors...)
+	}
+
+	return n
+}
+
+// Print prints report to the output (one JSON object per run, See 'output')
+func (r *jsonReport) Print() {
+	if r == nil || r.quiet {
+		return
+	}
+
+	json.NewEncoder(out).Encode(r)
+}
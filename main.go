@@ -1,64 +1,314 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jessevdk/go-flags"
 	log "github.com/sirupsen/logrus"
 
 	v1 "github.com/ivanilves/lstags/api/v1"
+	"github.com/ivanilves/lstags/api/v1/collection"
+	"github.com/ivanilves/lstags/api/v1/lockfile"
 	"github.com/ivanilves/lstags/api/v1/registry/client/auth"
+	"github.com/ivanilves/lstags/api/v1/registry/client/transport"
 	"github.com/ivanilves/lstags/config"
+	dockerconfig "github.com/ivanilves/lstags/docker/config"
+	"github.com/ivanilves/lstags/repository"
+	"github.com/ivanilves/lstags/tag"
+	"github.com/ivanilves/lstags/util/health"
+	"github.com/ivanilves/lstags/util/output"
+	"github.com/ivanilves/lstags/util/size"
+	"github.com/ivanilves/lstags/util/throttle"
+	"github.com/ivanilves/lstags/util/webhook"
 )
 
 // Options represents configuration options we extract from passed command line arguments
 type Options struct {
+	ConfigFile         string        `long:"config" description:"YAML (or JSON) file with default options, flags passed win (default: './lstags.yaml' or '~/.config/lstags/config.yaml', if present)" env:"CONFIG"`
 	YAMLConfig         string        `short:"f" long:"yaml-config" description:"YAML file to load repositories from" env:"YAML_CONFIG"`
 	DockerJSON         string        `short:"j" long:"docker-json" default:"~/.docker/config.json" description:"JSON file with credentials" env:"DOCKER_JSON"`
+	DockerContext      string        `long:"docker-context" description:"Docker context to connect to Docker daemon through, like 'docker --context' (default: DOCKER_CONTEXT or current one)"`
 	Pull               bool          `short:"p" long:"pull" description:"Pull Docker images matched by filter (will use local Docker deamon)" env:"PULL"`
 	Push               bool          `short:"P" long:"push" description:"Push Docker images matched by filter to some registry (See 'push-registry')" env:"PUSH"`
+	ExportTar          string        `long:"export-tar" description:"Export pulled images into 'docker save' tar archive file (See 'pull')" env:"EXPORT_TAR"`
+	ImportTar          string        `long:"import-tar" description:"Import images from 'docker save' tar archive file into local Docker daemon and exit" env:"IMPORT_TAR"`
+	ExportLayout       string        `long:"export-layout" description:"Export images matched by filter into OCI image layout directory, registry to directory (e.g. for air-gapped transfer)" env:"EXPORT_LAYOUT"`
 	DryRun             bool          `long:"dry-run" description:"Dry run pull or push" env:"DRY_RUN"`
+	SinceDigest        string        `long:"since-digest" description:"Pull a single REPO:TAG only if its digest differs from this one (e.g. got on the last run), print the current digest" env:"SINCE_DIGEST"`
+	PullIfMissing      bool          `long:"pull-if-missing" description:"Check local Docker daemon right before every pull, skip it if image with the same digest is already there" env:"PULL_IF_MISSING"`
 	PushRegistry       string        `short:"r" long:"push-registry" description:"[Re]Push pulled images to a specified remote registry" env:"PUSH_REGISTRY"`
 	PushPrefix         string        `short:"R" long:"push-prefix" description:"[Re]Push pulled images with a specified repo path prefix" env:"PUSH_PREFIX"`
+	PushRoute          []string      `long:"push-route" description:"Push images from source registries matching the pattern into another registry, e.g. '*.gcr.io registry-b.company.io [PREFIX]' (See 'push-registry' for the default one)" env:"PUSH_ROUTE"`
+	PushAuth           string        `long:"push-auth" description:"Push with username:password pair passed, instead of credentials from Docker config (e.g. ephemeral CI ones)" env:"PUSH_AUTH"`
+	PushIndexSuffix    string        `long:"push-index-suffix" description:"Also copy the whole multi-arch index of every image pushed under the tag with this suffix, e.g. '-multiarch' (See 'platform')" env:"PUSH_INDEX_SUFFIX"`
 	PushPathTemplate   string        `long:"push-path-template" default:"{{ .Prefix }}{{ .Path }}" description:"[Re]Push pulled images with a go template to change repo path, sprig functions are supported" env:"PUSH_PATH_TEMPLATE"`
-	PushTagTemplate    string        `long:"push-tag-template" default:"{{ .Tag }}" description:"[Re]Push pulled images with a go template to change repo tag, sprig functions are supported" env:"PUSH_TAG_TEMPLATE"`
-	NoSSLVerify        bool          `short:"k" long:"no-ssl-verify" description:"Allow registry without certificate verify" env:"NO_SSL_VERIFY"`
+	PushTagTemplate    string        `long:"push-tag-template" default:"{{ .Tag }}" description:"[Re]Push pulled images with a go template to change repo tag (.Tag, .Digest and .Created are available), sprig functions are supported" env:"PUSH_TAG_TEMPLATE"`
+	NoSSLVerify        bool          `short:"k" long:"no-ssl-verify" description:"Allow registry without certificate verify (needs '--allow-insecure')" env:"NO_SSL_VERIFY"`
+	AllowInsecure      bool          `long:"allow-insecure" description:"Allow insecure communication with registries: plain HTTP or no certificate verification (dangerous!)" env:"ALLOW_INSECURE"`
+	IncludeManifests   bool          `long:"include-manifests" description:"Also copy manifests referring to pushed images (signatures, SBOMs, attestations)" env:"INCLUDE_MANIFESTS"`
+	Strict             bool          `long:"strict" description:"Fail, if tags already pushed have different digest (See 'force') or tags were changed after we listed them (See 'check-drift')" env:"STRICT"`
+	Force              bool          `long:"force" description:"Overwrite tags already pushed with different digest in strict mode" env:"FORCE"`
+	PushRequireLabel   []string      `long:"push-require-label" description:"Push only tags of images having this label, e.g. 'promote=true' or just 'promote' to have it present (could be repeated)" env:"PUSH_REQUIRE_LABEL"`
+	DenylistFile       string        `long:"denylist-file" description:"Never pull or push references matching patterns listed in this file (one per line, globs or /REGEX/), even if they match filters" env:"DENYLIST_FILE"`
+	PostPushExec       string        `long:"post-push-exec" description:"Run this shell command for every image pushed, failing push if it fails, e.g. to sign image (LSTAGS_PUSHED_REF, LSTAGS_PUSHED_DIGEST and LSTAGS_PUSHED_IMAGE are set)" env:"POST_PUSH_EXEC"`
+	PushDigestFile     string        `long:"push-digest-file" description:"Push only tags having digests listed in this file (one per line, e.g. images approved for promotion)" env:"PUSH_DIGEST_FILE"`
 	PushUpdate         bool          `short:"U" long:"push-update" description:"Update our pushed images if remote image digest changes" env:"PUSH_UPDATE"`
 	PathSeparator      string        `short:"s" long:"path-separator" default:"/" description:"Configure path separator for registries that only allow single folder depth" env:"PATH_SEPARATOR"`
 	ConcurrentRequests int           `short:"c" long:"concurrent-requests" default:"16" description:"Limit of concurrent requests to the registry" env:"CONCURRENT_REQUESTS"`
+	MaxRegistryReqs    int           `long:"max-registry-requests" description:"Limit of requests in flight to every registry host, shared by all repositories processed at once (0 means no limit)" env:"MAX_REGISTRY_REQUESTS"`
 	WaitBetween        time.Duration `short:"w" long:"wait-between" default:"0" description:"Time to wait between batches of requests (incl. pulls and pushes)" env:"WAIT_BETWEEN"`
+	MaxTokenAge        time.Duration `long:"max-token-age" default:"0" description:"Re-authenticate to registry once token is this old, even if it has not expired yet (0 means no limit)" env:"MAX_TOKEN_AGE"`
+	DialTimeout        time.Duration `long:"dial-timeout" default:"30s" description:"Advanced: limit time to establish connection to the registry (0 means the default one, it could not be disabled)" env:"DIAL_TIMEOUT"`
+	HandshakeTimeout   time.Duration `long:"tls-handshake-timeout" default:"10s" description:"Advanced: limit time of TLS handshake with the registry (0 means the default one, it could not be disabled)" env:"TLS_HANDSHAKE_TIMEOUT"`
+	HeaderTimeout      time.Duration `long:"response-header-timeout" default:"2m" description:"Advanced: limit time to wait for registry response headers, response body (e.g. big blob) is never limited (0 means the default one, it could not be disabled)" env:"RESPONSE_HEADER_TIMEOUT"`
 	RetryRequests      int           `short:"y" long:"retry-requests" default:"2" description:"Number of retries for failed Docker registry requests" env:"RETRY_REQUESTS"`
 	RetryDelay         time.Duration `short:"D" long:"retry-delay" default:"2s" description:"Delay between retries of failed registry requests" env:"RETRY_DELAY"`
-	InsecureRegistryEx string        `short:"I" long:"insecure-registry-ex" description:"Expression to match insecure registry hostnames" env:"INSECURE_REGISTRY_EX"`
+	RetryBudget        int           `long:"retry-budget" default:"0" description:"Limit of retries shared by all images of a batch (collect, pull, push etc), not to hammer registry having an incident (0 means no limit)" env:"RETRY_BUDGET"`
+	InsecureRegistryEx string        `short:"I" long:"insecure-registry-ex" description:"Expression to match insecure registry hostnames (needs '--allow-insecure')" env:"INSECURE_REGISTRY_EX"`
+	DefaultRegistry    string        `long:"default-registry" description:"Registry to resolve references with no registry specified to, e.g. 'ubuntu' (default: Docker Hub)" env:"DEFAULT_REGISTRY"`
 	BasicAuth          []string      `short:"B" long:"basic-auth" description:"Set per-registry BASIC auth username:password pair" env:"BASIC_AUTH"`
+	RegistryCA         []string      `long:"registry-ca" description:"Set per-registry CA bundle to trust, e.g. 'registry.company.io /path/to/ca.pem'" env:"REGISTRY_CA"`
+	RegistryClientCert []string      `long:"registry-client-cert" description:"Set per-registry client certificate and key, e.g. 'registry.company.io /path/to/cert.pem /path/to/key.pem'" env:"REGISTRY_CLIENT_CERT"`
+	RegistryPin        []string      `long:"registry-pin" description:"Pin per-registry SHA-256 certificate fingerprint, fail if registry presents another certificate, e.g. 'registry.company.io AB:CD:...'" env:"REGISTRY_PIN"`
+	AuthProvider       []string      `long:"auth-provider" description:"Authenticate to cloud registries with a built-in provider before Docker config credentials: 'ecr' or 'gcr' (needs their credential helper)" env:"AUTH_PROVIDER"`
+	AuthRegistry       []string      `long:"auth-registry" description:"Authenticate to the registry as another one (use its credentials and token scopes), e.g. 'mirror.internal docker.io' for a pull-through mirror" env:"AUTH_REGISTRY"`
+	RegistryHeader     []string      `long:"registry-header" description:"Set per-registry extra header sent with every request, e.g. 'registry.company.io X-Api-Key: secret'" env:"REGISTRY_HEADER"`
+	HostsDir           string        `long:"hosts-dir" description:"Load per-registry CA, client certificates and TLS settings from containerd (or Docker) 'certs.d' directory, e.g. '/etc/containerd/certs.d'" env:"HOSTS_DIR"`
 	TraceRequests      bool          `short:"T" long:"trace-requests" description:"Trace Docker registry HTTP requests" env:"TRACE_REQUESTS"`
 	DoNotFail          bool          `short:"N" long:"do-not-fail" description:"Do not fail on non-critical errors (could be dangerous!)" env:"DO_NOT_FAIL"`
 	DaemonMode         bool          `short:"d" long:"daemon-mode" description:"Run as daemon instead of just execute and exit" env:"DAEMON_MODE"`
+	PollingBackoffMax  time.Duration `long:"polling-backoff-max" default:"30m" description:"Max wait between polls in daemon mode, wait is doubled after every failed poll up to this value (See 'polling-interval')" env:"POLLING_BACKOFF_MAX"`
+	Webhook            string        `long:"webhook" description:"POST JSON summary of every run to this webhook URL (e.g. Slack or CI trigger)" env:"WEBHOOK"`
+	WebhookTemplate    string        `long:"webhook-template" description:"Render webhook payload with a go template instead of sending JSON summary as is, sprig functions are supported" env:"WEBHOOK_TEMPLATE"`
+	WebhookHeader      []string      `long:"webhook-header" description:"Set extra header sent to the webhook, e.g. 'X-Token: secret'" env:"WEBHOOK_HEADER"`
+	WebhookBasicAuth   string        `long:"webhook-basic-auth" description:"Set BASIC auth username:password pair for the webhook" env:"WEBHOOK_BASIC_AUTH"`
+	MetricsFile        string        `long:"metrics-file" description:"Write Prometheus metrics of every run to this file, e.g. 'lstags.prom' for node_exporter textfile collector" env:"METRICS_FILE"`
+	HealthAddr         string        `long:"health-addr" description:"Serve '/healthz' and '/readyz' probes on this address in daemon mode, e.g. ':8080'" env:"HEALTH_ADDR"`
 	PollingInterval    time.Duration `short:"i" long:"polling-interval" default:"60s" description:"Wait between polls when running in daemon mode" env:"POLLING_INTERVAL"`
-	Verbose            bool          `short:"v" long:"verbose" description:"Give verbose output while running application" env:"VERBOSE"`
+	MirrorRegistry     string        `short:"m" long:"mirror-registry" description:"Mirror all repositories from the specified registry catalog, optionally matched with glob, e.g. 'registry.company.io/team-*' (See 'push-registry')" env:"MIRROR_REGISTRY"`
+	MirrorFilter       string        `long:"mirror-filter" default:".*" description:"Regexp to match repository paths from registry catalog while mirroring" env:"MIRROR_FILTER"`
+	MirrorDiff         bool          `long:"mirror-diff" description:"Only report difference between mirrored and 'push' registries, do not mirror anything (See 'mirror-registry')" env:"MIRROR_DIFF"`
+	MaxTags            int           `long:"max-tags" default:"0" description:"Fetch only N newest tags per repository, by image creation date (0 means no limit)" env:"MAX_TAGS"`
+	BandwidthLimit     string        `long:"bandwidth-limit" description:"Limit rate of image data copied registry to registry, bytes per second (e.g. 512K or 10M)" env:"BANDWIDTH_LIMIT"`
+	PullConcurrency    int           `long:"pull-concurrency" default:"0" description:"Limit of images pulled (or exported) at once (0 means no limit)" env:"PULL_CONCURRENCY"`
+	PushConcurrency    int           `long:"push-concurrency" default:"0" description:"Limit of images pushed at once, independent from pulls (0 means no limit)" env:"PUSH_CONCURRENCY"`
+	LayerConcurrency   int           `long:"layer-concurrency" default:"3" description:"Number of image blobs copied registry to registry in parallel" env:"LAYER_CONCURRENCY"`
+	MaxManifestSize    string        `long:"max-manifest-size" default:"16M" description:"Refuse to read manifests and image configs bigger than this from registries (image layers are not limited)" env:"MAX_MANIFEST_SIZE"`
+	MaxPullSize        string        `long:"max-pull-size" description:"Stop pulling, once total size of pulled images would exceed this (e.g. 500M or 20G)" env:"MAX_PULL_SIZE"`
+	MaxPullImages      int           `long:"max-pull-images" default:"0" description:"Stop pulling, once total number of pulled images would exceed this (0 means no limit)" env:"MAX_PULL_IMAGES"`
+	PullStallTimeout   time.Duration `long:"pull-stall-timeout" default:"0" description:"Abort (and retry) pull, if Docker daemon reports no progress for this long (0 means no timeout)" env:"PULL_STALL_TIMEOUT"`
+	HubAPI             bool          `long:"hub-api" description:"List Docker Hub repositories through the Hub API, without requests per tag (falls back to registry API)" env:"HUB_API"`
+	Platform           string        `long:"platform" description:"Platform (OS/ARCH[/VARIANT]) to take creation date of multi-arch images from and to pull (and push) image for (default: linux/ARCH, ARCH of the current host)" env:"PLATFORM"`
+	Annotation         string        `long:"annotation" description:"Annotation (KEY=VALUE) to select image from multi-arch tags by, instead of platform (e.g. to pull image variant)" env:"ANNOTATION"`
+	LatestPerMinor     int           `long:"latest-per-minor" default:"0" description:"Keep only N newest semver tags per minor version, e.g. 2 latest patches of 1.2.x and of 1.3.x (non-semver tags are kept, 0 means all tags)" env:"LATEST_PER_MINOR"`
+	MaxLayers          int           `long:"max-layers" description:"Warn about tags having images with more layers than this, e.g. to enforce image hygiene (0 means no limit)" env:"MAX_LAYERS"`
+	ExcludeOverLayers  bool          `long:"exclude-over-max-layers" description:"Exclude tags having images with more layers than allowed, instead of only warning about them (See 'max-layers')" env:"EXCLUDE_OVER_MAX_LAYERS"`
+	OnlyArch           string        `long:"only-arch" description:"Keep only tags having image for this architecture (ARCH[/VARIANT], e.g. 'arm64'), others are reported as excluded (costs an extra request per tag)" env:"ONLY_ARCH"`
+	Checkpoint         string        `long:"checkpoint" description:"File to record completed pushes to, so re-run will skip them" env:"CHECKPOINT"`
+	Validate           bool          `long:"validate" description:"Only validate configuration (repositories, registries, credentials, push references), do not pull or push anything" env:"VALIDATE"`
+	CheckDrift         bool          `long:"check-drift" description:"Re-check digest of every tag right before pull, push or export and warn, if tag was changed after we listed it (costs an extra request per tag)" env:"CHECK_DRIFT"`
+	ModifiedWithin     time.Duration `long:"modified-within" default:"0" description:"Keep only tags modified (pushed or re-pushed) in registry within this window, e.g. '168h' for the last 7 days (0 means all tags)" env:"MODIFIED_WITHIN"`
+	Capture            string        `long:"capture" description:"Capture parts of tag names by named groups of the regex, e.g. '^app-(?P<version>[^-]+)-(?P<env>.+)$' (tags not matching it are not kept)" env:"CAPTURE"`
+	CaptureFilter      []string      `long:"capture-filter" description:"Keep only tags having group captured equal to the value, e.g. 'env=prod' (See 'capture', could be repeated)" env:"CAPTURE_FILTER"`
+	GroupBy            string        `long:"group-by" description:"Report tags grouped by the value of the named group captured from their names, e.g. 'env' (See 'capture')" env:"GROUP_BY"`
+	TotalSize          bool          `long:"total-size" description:"Report total size of tags collected, with layers shared by images counted once (costs an extra request per tag)" env:"TOTAL_SIZE"`
+	Aliases            bool          `long:"aliases" description:"Report tags pointing at the same content (digest) in every repository, e.g. to clean them up (report only)" env:"ALIASES"`
+	Timestamps         bool          `long:"timestamps" description:"Show when tags were last pulled locally and modified in registry (if registry tells it)" env:"TIMESTAMPS"`
+	JSON               bool          `long:"json" description:"Print tags, summaries and errors as a single JSON object per run, all other output goes to stderr" env:"JSON"`
+	Output             string        `long:"output" default:"-" description:"Write tags, reports and other data to this file (replaced atomically, '-' means stdout), messages and logs are not affected" env:"OUTPUT"`
+	Lockfile           string        `long:"lockfile" description:"Write lockfile of tags collected (sorted 'REPO:TAG DIGEST' lines, or JSON for '*.json' file) to pin images" env:"LOCKFILE"`
+	VerifyLockfile     string        `long:"verify-lockfile" description:"Only check digests of images pinned in this lockfile against registries, report drift and fail on it (See 'lockfile')" env:"VERIFY_LOCKFILE"`
+	PruneUntagged      bool          `long:"prune-untagged" description:"Only delete manifests not referenced by any tag from repositories passed, i.e. ones we pushed there (See 'checkpoint') or listed in 'prune-digest-file'" env:"PRUNE_UNTAGGED"`
+	PruneDigestFile    string        `long:"prune-digest-file" description:"Delete these manifests (digests listed one per line), if they are not referenced by any tag (See 'prune-untagged')" env:"PRUNE_DIGEST_FILE"`
+	Resolve            bool          `long:"resolve" description:"Only resolve references passed into fully-qualified canonical, digest-pinned form, e.g. 'docker.io/library/ubuntu:latest@sha256:...' for 'ubuntu'" env:"RESOLVE"`
+	ListPlatforms      bool          `long:"list-platforms" description:"Only print platforms (OS/ARCH[/VARIANT]) and digests of images references passed have, i.e. all the ones of multi-arch images" env:"LIST_PLATFORMS"`
+	Normalize          bool          `long:"normalize" description:"Print image references in fully-qualified canonical form, e.g. 'docker.io/library/alpine:3.7' for 'alpine:3.7'" env:"NORMALIZE"`
+	Quiet              bool          `short:"q" long:"quiet" description:"Print only tag names (IMAGE:TAG, if many repositories or 'normalize' is set), all other output goes to stderr" env:"QUIET"`
+	Digests            bool          `long:"digests" description:"Print full image digest next to the tag name in quiet mode (See 'quiet')" env:"DIGESTS"`
+	Verbose            []bool        `short:"v" long:"verbose" description:"Give verbose output while running application (repeat, e.g. '-vv', to also log every registry HTTP request)" env:"VERBOSE"`
 	Version            bool          `short:"V" long:"version" description:"Show version and exit"`
 	Positional         struct {
 		Repositories []string `positional-arg-name:"REPO1 REPO2 REPOn" description:"Docker repositories to operate on, e.g.: alpine nginx~/1\\.13\\.5$/ busybox~/1.27.2/"`
 	} `positional-args:"yes" required:"yes"`
 }
 
-var exitCode = 0
+// Exit codes we give, so scripts could tell one kind of failure from another (see README)
+const (
+	exitOK             = 0
+	exitConfigError    = 1
+	exitUnreachable    = 251
+	exitAuthError      = 252
+	exitPartialFailure = 253
+	exitFailure        = 254 // not typical error code, for "git grep" friendliness
+)
+
+// exitCodeSeverity tells us which exit code to keep, if we have several failures in a single run
+var exitCodeSeverity = map[int]int{
+	exitOK:             0,
+	exitPartialFailure: 1,
+	exitFailure:        2,
+	exitAuthError:      3,
+	exitUnreachable:    4,
+	exitConfigError:    5,
+}
+
+var exitCode = exitOK
 
 var doNotFail = false
 
-func suicide(err error, critical bool) {
+// notify sends notification of the current run to the webhook (See 'webhook') and writes its metrics (See 'metrics-file'),
+// it is nil, if there is neither webhook, nor metrics file
+var notify func()
+
+// pushRoutes are parsed from the options passed and loaded from YAML config (See 'push-route')
+var pushRoutes []v1.PushRoute
+
+// normalizeRefs makes us print image references in fully-qualified canonical form (See 'normalize')
+var normalizeRefs bool
+
+// imageName gives us repository name to print: canonical one, if we normalize references (See 'normalize'), or a short one
+func imageName(repo *repository.Repository) string {
+	if normalizeRefs {
+		return repo.Canonical()
+	}
+
+	return repo.Name()
+}
+
+// imageRef gives us image reference to print: canonical one, if we normalize references (See 'normalize'), or the one passed
+func imageRef(ref string) string {
+	if !normalizeRefs {
+		return ref
+	}
+
+	normalized, err := repository.NormalizeRef(ref)
+	if err != nil {
+		return ref
+	}
+
+	return normalized
+}
+
+// out is where we write the primary output: tags, reports etc (See 'output')
+var out = output.Stdout()
+
+// openOutput opens output for the run, the one of the previous run (if any) is discarded, unless it is committed
+func openOutput(o *Options) {
+	out.Discard()
+
+	var err error
+	if out, err = output.Open(o.Output); err != nil {
+		out = output.Stdout()
+		suicide(err, exitConfigError, true)
+	}
+}
+
+// commitOutput makes output of the run visible (See 'output')
+func commitOutput() {
+	if err := out.Commit(); err != nil {
+		suicide(err, exitFailure, true)
+	}
+}
+
+// pushCredentials are parsed from the option passed (See 'push-auth'), we use Docker config credentials to push, if nil
+var pushCredentials *v1.Credentials
+
+// getPushCredentials parses "username:password" pair passed to push with (See 'push-auth')
+func getPushCredentials(o *Options) (*v1.Credentials, error) {
+	if o.PushAuth == "" {
+		return nil, nil
+	}
+
+	fields := strings.SplitN(o.PushAuth, ":", 2)
+	if len(fields) != 2 || fields[0] == "" {
+		return nil, errors.New("Option '--push-auth' should be a 'username:password' pair")
+	}
+
+	return &v1.Credentials{Username: fields[0], Password: fields[1]}, nil
+}
+
+// allowedDigests are loaded from the file passed (See 'push-digest-file'), we push only tags having these digests
+var allowedDigests []string
+
+// pruneDigests are loaded from the file passed (See 'prune-digest-file'), we delete them, if no tag references them
+var pruneDigests []string
+
+func setExitCode(code int) {
+	if exitCodeSeverity[code] > exitCodeSeverity[exitCode] {
+		exitCode = code
+	}
+}
+
+// getExitCode gives exit code for the error: authentication and connectivity errors are recognized by their types,
+// all other ones are failures (partial ones, if summary passed tells us that some tags were processed successfully)
+func getExitCode(err error, summary *v1.Summary) int {
+	var loginErr *auth.LoginError
+	if errors.As(err, &loginErr) {
+		return exitAuthError
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return exitUnreachable
+	}
+
+	if summary != nil && summary.Failed > 0 && summary.Done+summary.Skipped > 0 {
+		return exitPartialFailure
+	}
+
+	return exitFailure
+}
+
+func suicide(err error, code int, critical bool) {
+	setExitCode(code)
+
+	report.AddError(err, code)
+
+	die(err, critical)
+}
+
+// suicideWithSummary is the same as suicide, but for operations giving us summaries (with errors of particular tags)
+func suicideWithSummary(err error, summary *v1.Summary) {
+	code := getExitCode(err, summary)
+
+	if summary == nil || len(summary.Errors) == 0 {
+		suicide(err, code, false)
+		return
+	}
+
+	setExitCode(code)
+
+	die(err, false)
+}
+
+func die(err error, critical bool) {
 	if !doNotFail || critical {
-		log.Fatal(err.Error())
-	} else {
-		log.Error(err.Error())
+		log.StandardLogger().Log(log.FatalLevel, err.Error())
+		report.Print()
+		out.Discard()
+		if notify != nil {
+			notify()
+		}
+		os.Exit(exitCode)
 	}
 
-	exitCode = 254 // not typical error code, for "git grep" friendliness
+	log.Error(err.Error())
 }
 
 func parseFlags() (*Options, error) {
@@ -66,17 +316,77 @@ func parseFlags() (*Options, error) {
 
 	o := &Options{}
 
-	_, err = flags.Parse(o)
+	args := os.Args[1:]
+
+	parser := flags.NewParser(o, flags.Default)
+	_, err = parser.ParseArgs(args)
 	if err != nil {
 		os.Exit(1) // YES! Just exit! Flags will compain on errors on it's own behalf
 	}
 
+	optionsFile, err := config.FindOptionsFile(o.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if optionsFile != "" {
+		defaultArgs, err := getDefaultArgs(parser, optionsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		o = &Options{}
+
+		_, err = flags.NewParser(o, flags.Default).ParseArgs(append(defaultArgs, args...))
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+
 	if o.Version {
 		fmt.Printf("VERSION: %s\n", getVersion())
 		os.Exit(0)
 	}
 
-	if len(o.Positional.Repositories) == 0 && o.YAMLConfig == "" {
+	if o.MirrorRegistry != "" {
+		if len(o.Positional.Repositories) != 0 || o.YAMLConfig != "" {
+			return nil, errors.New("Mirror registry catalog or load repositories from YAML or CLI args, not all at the same time")
+		}
+
+		if o.PushRegistry == "" && len(o.PushRoute) == 0 {
+			return nil, errors.New("Need a registry to mirror repositories into (See 'push-registry' and 'push-route')")
+		}
+	}
+
+	if o.MirrorDiff && o.MirrorRegistry == "" {
+		return nil, errors.New("Option '--mirror-diff' makes sense only together with '--mirror-registry'")
+	}
+
+	if o.MirrorDiff && len(o.PushRoute) != 0 {
+		return nil, errors.New("Option '--mirror-diff' could not be used together with '--push-route'")
+	}
+
+	if o.JSON && (o.Quiet || o.MirrorDiff) {
+		return nil, errors.New("Option '--json' could not be used together with '--quiet' or '--mirror-diff'")
+	}
+
+	if o.Validate && o.MirrorRegistry != "" {
+		return nil, errors.New("Option '--validate' could not be used together with '--mirror-registry'")
+	}
+
+	if o.ImportTar != "" {
+		if len(o.Positional.Repositories) != 0 || o.YAMLConfig != "" || o.MirrorRegistry != "" {
+			return nil, errors.New("Option '--import-tar' only imports images, it could not be used together with any repositories")
+		}
+
+		return o, nil
+	}
+
+	if o.ExportTar != "" && !o.Pull {
+		return nil, errors.New("Option '--export-tar' makes sense only together with '--pull'")
+	}
+
+	if len(o.Positional.Repositories) == 0 && o.YAMLConfig == "" && o.MirrorRegistry == "" && o.VerifyLockfile == "" {
 		return nil, errors.New(`Need at least one repository name, e.g. 'nginx~/^1\.13/' or 'mesosphere/chronos'`)
 	}
 
@@ -84,123 +394,1234 @@ func parseFlags() (*Options, error) {
 		return nil, errors.New("Load repositories from YAML or from CLI args, not from both at the same time")
 	}
 
-	if o.PushRegistry != "localhost:5000" && o.PushRegistry != "" {
+	if o.PushRegistry != "localhost:5000" && o.PushRegistry != "" || len(o.PushRoute) != 0 {
 		o.Push = true
 	}
 
+	if o.Force && !o.Strict {
+		return nil, errors.New("Option '--force' makes sense only together with '--strict'")
+	}
+
 	if o.Pull && o.Push {
 		return nil, errors.New("You either '--pull' or '--push', not both")
 	}
 
+	if o.ExportLayout != "" && (o.Pull || o.Push || o.MirrorRegistry != "") {
+		return nil, errors.New("Option '--export-layout' could not be used together with '--pull', '--push' or '--mirror-registry'")
+	}
+
+	if o.Resolve && (o.Pull || o.Push || o.JSON || o.SinceDigest != "" || o.ExportLayout != "" || len(o.Positional.Repositories) == 0) {
+		return nil, errors.New("Option '--resolve' only prints references passed (as CLI args) resolved, it could not be used together with '--pull', '--push', '--json' etc")
+	}
+
+	if o.ListPlatforms && (o.Pull || o.Push || o.JSON || o.Resolve || o.PruneUntagged || o.SinceDigest != "" || o.ExportLayout != "" || len(o.Positional.Repositories) == 0) {
+		return nil, errors.New("Option '--list-platforms' only prints platforms of references passed (as CLI args), it could not be used together with '--pull', '--push', '--json' etc")
+	}
+
+	if o.VerifyLockfile != "" && (o.Pull || o.Push || o.JSON || o.Resolve || o.PruneUntagged || o.Lockfile != "" || o.MirrorRegistry != "" || o.YAMLConfig != "" || len(o.Positional.Repositories) != 0) {
+		return nil, errors.New("Option '--verify-lockfile' only checks images pinned in lockfile, it could not be used together with repositories, '--pull', '--push', '--json' etc")
+	}
+
+	if o.PruneUntagged && (o.Pull || o.Push || o.JSON || o.Resolve || o.SinceDigest != "" || o.ExportLayout != "" || len(o.Positional.Repositories) == 0) {
+		return nil, errors.New("Option '--prune-untagged' only prunes repositories passed (as CLI args), it could not be used together with '--pull', '--push', '--json' etc")
+	}
+
+	if o.PruneUntagged && o.Checkpoint == "" && o.PruneDigestFile == "" {
+		return nil, errors.New("Option '--prune-untagged' needs manifests to prune: pass '--checkpoint' of pushes done or '--prune-digest-file'")
+	}
+
+	if o.PruneDigestFile != "" && !o.PruneUntagged {
+		return nil, errors.New("Option '--prune-digest-file' makes sense only together with '--prune-untagged'")
+	}
+
+	if o.SinceDigest != "" && (!o.Pull || len(o.Positional.Repositories) != 1) {
+		return nil, errors.New("Option '--since-digest' makes sense only together with '--pull' and a single REPO:TAG")
+	}
+
+	if (o.NoSSLVerify || o.InsecureRegistryEx != "") && !o.AllowInsecure {
+		return nil, errors.New("Options '--no-ssl-verify' and '--insecure-registry-ex' make registry communication insecure, pass '--allow-insecure' to confirm")
+	}
+
+	if o.GroupBy != "" && !hasCaptureGroup(o.Capture, o.GroupBy) {
+		return nil, errors.New("Option '--group-by' needs a named group of the '--capture' regex, e.g. '--capture=^app-(?P<env>.+)$ --group-by=env'")
+	}
+
+	if o.ExcludeOverLayers && o.MaxLayers <= 0 {
+		return nil, errors.New("Option '--exclude-over-max-layers' makes sense only together with '--max-layers'")
+	}
+
+	if o.HealthAddr != "" && !o.DaemonMode {
+		return nil, errors.New("Option '--health-addr' makes sense only in daemon mode (See '--daemon-mode')")
+	}
+
 	doNotFail = o.DoNotFail || o.DaemonMode
 
 	return o, nil
 }
 
+// getDefaultArgs loads default options from the file passed (See 'config') and gives them to us as command line arguments,
+// but only for options not set already with command line arguments or environment variables (they win)
+func getDefaultArgs(parser *flags.Parser, path string) ([]string, error) {
+	of, err := config.LoadOptionsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0)
+
+	for _, name := range of.Names() {
+		option := parser.FindOptionByLongName(name)
+		if option == nil || name == "config" {
+			return nil, fmt.Errorf("invalid options file %s: unknown option '%s'", path, name)
+		}
+
+		if !option.IsSetDefault() {
+			continue
+		}
+		if _, defined := os.LookupEnv(option.EnvDefaultKey); defined && option.EnvDefaultKey != "" {
+			continue
+		}
+
+		values := of.Options[name]
+
+		switch option.Field().Type.Kind() {
+		case reflect.Bool:
+			set := false
+			if len(values) == 1 {
+				set, err = strconv.ParseBool(values[0])
+			}
+			if err != nil || len(values) != 1 {
+				return nil, fmt.Errorf("invalid options file %s: option '%s' should be true or false", path, name)
+			}
+			if set {
+				args = append(args, "--"+name)
+			}
+		case reflect.Slice:
+			if option.Field().Type.Elem().Kind() == reflect.Bool {
+				count := 0
+				if len(values) == 1 {
+					count, err = strconv.Atoi(values[0])
+				}
+				if err != nil || len(values) != 1 {
+					return nil, fmt.Errorf("invalid options file %s: option '%s' should be a number (of times it is repeated)", path, name)
+				}
+				for i := 0; i < count; i++ {
+					args = append(args, "--"+name)
+				}
+				continue
+			}
+
+			for _, value := range values {
+				args = append(args, "--"+name+"="+value)
+			}
+		default:
+			if len(values) != 1 {
+				return nil, fmt.Errorf("invalid options file %s: option '%s' should have a single value", path, name)
+			}
+			args = append(args, "--"+name+"="+values[0])
+		}
+	}
+
+	return args, nil
+}
+
+// hasCaptureGroup tells us if capture regex passed has the named group (See 'capture' and 'group-by')
+func hasCaptureGroup(pattern, name string) bool {
+	ex, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+
+	for _, groupName := range ex.SubexpNames() {
+		if groupName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getVersion() string {
 	return VERSION
 }
 
-func main() {
-	o, err := parseFlags()
-	if err != nil {
-		suicide(err, true)
+// getInsecureHosts gives us hosts served over plain HTTP or with certificate verification skipped, with the reason
+func getInsecureHosts(hosts []transport.Host) []string {
+	insecureHosts := make([]string, 0)
+
+	for _, host := range hosts {
+		if host.Insecure {
+			insecureHosts = append(insecureHosts, host.Registry+" (plain HTTP)")
+		} else if host.Options.InsecureSkipVerify {
+			insecureHosts = append(insecureHosts, host.Registry+" (skip_verify)")
+		}
 	}
 
-	if err := auth.BasicStore.LoadAll(o.BasicAuth); err != nil {
-		suicide(err, true)
+	return insecureHosts
+}
+
+// withInsecureHosts extends insecure registry expression to match hosts served over plain HTTP too
+func withInsecureHosts(insecureRegistryEx string, hosts []transport.Host) string {
+	if insecureRegistryEx == "" {
+		insecureRegistryEx = repository.InsecureRegistryEx
 	}
 
-	apiConfig := v1.Config{
-		DockerJSONConfigFile: o.DockerJSON,
-		ConcurrentRequests:   o.ConcurrentRequests,
-		WaitBetween:          o.WaitBetween,
-		TraceRequests:        o.TraceRequests,
-		RetryRequests:        o.RetryRequests,
-		RetryDelay:           o.RetryDelay,
-		InsecureRegistryEx:   o.InsecureRegistryEx,
-		VerboseLogging:       o.Verbose,
-		DryRun:               o.DryRun,
+	for _, host := range hosts {
+		if host.Insecure {
+			insecureRegistryEx += "|^" + regexp.QuoteMeta(host.Registry) + "$"
+		}
 	}
 
-	if o.NoSSLVerify {
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return insecureRegistryEx
+}
+
+func getPushConfig(o *Options) v1.PushConfig {
+	return v1.PushConfig{
+		Registry:         o.PushRegistry,
+		Prefix:           o.PushPrefix,
+		PathTemplate:     o.PushPathTemplate,
+		TagTemplate:      o.PushTagTemplate,
+		UpdateChanged:    o.PushUpdate,
+		PathSeparator:    o.PathSeparator,
+		IncludeReferrers: o.IncludeManifests,
+		Strict:           o.Strict,
+		Force:            o.Force,
+		AllowedDigests:   allowedDigests,
+		RequiredLabels:   o.PushRequireLabel,
+		Routes:           pushRoutes,
+		PostPush:         getPostPushHook(o.PostPushExec),
+		DstCredentials:   pushCredentials,
+		IndexTagSuffix:   o.PushIndexSuffix,
 	}
-	api, err := v1.New(apiConfig)
-	if err != nil {
-		suicide(err, true)
+}
+
+// getPostPushHook gives a hook running the shell command passed for every image pushed (See 'post-push-exec'),
+// with pushed reference, digest and image ("REPOSITORY@DIGEST", e.g. to be signed with cosign) in the environment
+func getPostPushHook(command string) func(ref, digest string) error {
+	if command == "" {
+		return nil
 	}
 
-	for {
-		repositories := o.Positional.Repositories
+	return func(ref, digest string) error {
+		image := ref[:strings.LastIndex(ref, ":")] + "@" + digest
 
-		if o.YAMLConfig != "" {
-			yc, err := config.LoadYAMLFile(o.YAMLConfig)
-			if err != nil {
-				suicide(err, !o.DaemonMode)
-			}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(
+			os.Environ(),
+			"LSTAGS_PUSHED_REF="+ref,
+			"LSTAGS_PUSHED_DIGEST="+digest,
+			"LSTAGS_PUSHED_IMAGE="+image,
+		)
 
-			repositories = yc.Repositories
+		output, err := cmd.CombinedOutput()
+		log.Debugf("post-push command output for %s:\n%s", image, output)
+		if err != nil {
+			return fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(output)))
 		}
 
-		collection, err := api.CollectTags(repositories...)
+		return nil
+	}
+}
+
+// getPushRoutes gives push routes passed as options and loaded from YAML config (if any), in this order
+func getPushRoutes(o *Options) ([]v1.PushRoute, error) {
+	routes, err := config.ParsePushRoutes(o.PushRoute)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.YAMLConfig != "" {
+		yc, err := config.LoadYAMLFile(o.YAMLConfig)
 		if err != nil {
-			suicide(err, !o.DaemonMode)
+			return nil, err
 		}
 
-		const format = "%-12s %-45s %-15s %-25s %s:%s\n"
-		fmt.Printf("-\n")
-		fmt.Printf(format, "<STATE>", "<DIGEST>", "<(local) ID>", "<Created At>", "<IMAGE>", "<TAG>")
-		for _, ref := range collection.Refs() {
-			repo := collection.Repo(ref)
-			tags := collection.Tags(ref)
+		routes = append(routes, yc.PushRoutes...)
+	}
 
-			for _, tg := range tags {
-				fmt.Printf(
-					format,
-					tg.GetState(),
-					tg.GetShortDigest(),
-					tg.GetImageID(),
-					tg.GetCreatedString(),
-					repo.Name(),
-					tg.Name(),
-				)
-			}
+	pushRoutes := make([]v1.PushRoute, len(routes))
+	for i, route := range routes {
+		pushRoutes[i] = v1.PushRoute{Source: route.Source, Registry: route.Registry, Prefix: route.Prefix}
+	}
+
+	return pushRoutes, nil
+}
+
+func mirrorRegistry(api *v1.API, o *Options) {
+	summary, err := api.MirrorRegistry(o.MirrorRegistry, o.MirrorFilter, getPushConfig(o))
+	if summary == nil {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+		return
+	}
+
+	fmt.Fprintf(
+		getMessageOutput(o),
+		"MIRRORED: %d repos / %d tags (%d pushed, %d repos failed)\n-\n",
+		summary.Repositories,
+		summary.Tags,
+		summary.Pushed,
+		len(summary.Errors),
+	)
+	printSummary(&summary.Push, o)
+
+	if err != nil {
+		suicideWithSummary(err, &summary.Push)
+	}
+}
+
+func diffRegistries(api *v1.API, o *Options) {
+	diff, err := api.DiffRegistries(context.Background(), o.MirrorRegistry, o.PushRegistry, o.MirrorFilter)
+	if _, partial := err.(*v1.CollectError); err != nil && !partial {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+		return
+	}
+
+	const format = "%-14s %s\n"
+	fmt.Fprintf(out, "-\n")
+	for _, path := range diff.MissingRepos {
+		fmt.Fprintf(out, format, "MISSING_REPO", path)
+	}
+	for _, path := range diff.ExtraRepos {
+		fmt.Fprintf(out, format, "EXTRA_REPO", path)
+	}
+	for _, ref := range diff.MissingTags {
+		fmt.Fprintf(out, format, "MISSING_TAG", ref)
+	}
+	for _, ref := range diff.ExtraTags {
+		fmt.Fprintf(out, format, "EXTRA_TAG", ref)
+	}
+	for _, m := range diff.Mismatches {
+		fmt.Fprintf(out, format, "MISMATCH", m.SrcRef+" ("+m.SrcDigest+") => "+m.DstRef+" ("+m.DstDigest+")")
+	}
+	for _, td := range diff.Tags {
+		switch td.State {
+		case v1.TagStateExcluded, v1.TagStateProtected:
+			fmt.Fprintf(out, format, td.State, td.Path+":"+td.Tag)
+		case v1.TagStateError:
+			fmt.Fprintf(out, format, td.State, td.Path+": "+td.Err.Error())
 		}
-		fmt.Printf("-\n")
+	}
+	fmt.Fprintf(out, "-\n")
 
-		if o.Pull {
-			if err := api.PullTags(collection); err != nil {
-				suicide(err, false)
-			}
+	fmt.Fprintf(
+		getMessageOutput(o),
+		"DIFF: %d missing repos / %d extra repos / %d missing tags / %d extra tags / %d digest mismatches"+
+			" (%d excluded / %d protected tags, %d repos failed)\n-\n",
+		len(diff.MissingRepos),
+		len(diff.ExtraRepos),
+		len(diff.MissingTags),
+		len(diff.ExtraTags),
+		len(diff.Mismatches),
+		diff.Count(v1.TagStateExcluded),
+		diff.Count(v1.TagStateProtected),
+		diff.Count(v1.TagStateError),
+	)
+
+	if err != nil {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+	}
+}
+
+// verifyLockfile checks digests of images pinned in lockfile against registries (See 'verify-lockfile'), drift is a failure
+func verifyLockfile(api *v1.API, o *Options) {
+	lf, err := lockfile.Load(o.VerifyLockfile)
+	if err != nil {
+		suicide(err, exitConfigError, !o.DaemonMode)
+		return
+	}
+
+	diffs, err := api.VerifyLockfile(context.Background(), lf)
+	if err != nil {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+		return
+	}
+
+	counts := make(map[v1.TagState]int)
+
+	const format = "%-14s %s\n"
+	fmt.Fprintf(out, "-\n")
+	for _, td := range diffs {
+		counts[td.State]++
+
+		switch td.State {
+		case v1.TagStateMismatch:
+			fmt.Fprintf(out, format, td.State, td.Path+":"+td.Tag+" ("+td.SrcDigest+" => "+td.DstDigest+")")
+		case v1.TagStateMissing:
+			fmt.Fprintf(out, format, td.State, td.Path+":"+td.Tag)
+		case v1.TagStateError:
+			fmt.Fprintf(out, format, td.State, td.Path+":"+td.Tag+": "+td.Err.Error())
 		}
+	}
+	fmt.Fprintf(out, "-\n")
 
-		if o.Push {
-			pushConfig := v1.PushConfig{
-				Registry:      o.PushRegistry,
-				Prefix:        o.PushPrefix,
-				PathTemplate:  o.PushPathTemplate,
-				TagTemplate:   o.PushTagTemplate,
-				UpdateChanged: o.PushUpdate,
-				PathSeparator: o.PathSeparator,
-			}
+	fmt.Fprintf(
+		getMessageOutput(o),
+		"LOCKFILE: %d in sync / %d changed / %d missing / %d failed to check\n-\n",
+		counts[v1.TagStateInSync],
+		counts[v1.TagStateMismatch],
+		counts[v1.TagStateMissing],
+		counts[v1.TagStateError],
+	)
 
-			pushCollection, err := api.CollectPushTags(collection, pushConfig)
-			if err != nil {
-				suicide(err, false)
-			}
+	if drifted := counts[v1.TagStateMismatch] + counts[v1.TagStateMissing]; drifted != 0 {
+		suicide(fmt.Errorf("%d images drifted from lockfile %s", drifted, o.VerifyLockfile), exitFailure, !o.DaemonMode)
+		return
+	}
+
+	if failed := counts[v1.TagStateError]; failed != 0 {
+		suicide(fmt.Errorf("failed to check %d images pinned in lockfile %s", failed, o.VerifyLockfile), exitFailure, !o.DaemonMode)
+	}
+}
+
+// getMessageOutput gives the writer for informational messages, which should not mix up with tag names in quiet mode
+func getMessageOutput(o *Options) io.Writer {
+	if o.Quiet || o.JSON {
+		return os.Stderr
+	}
 
-			if err := api.PushTags(pushCollection, pushConfig); err != nil {
-				suicide(err, false)
+	return os.Stdout
+}
+
+func printSummary(summary *v1.Summary, o *Options) {
+	if summary == nil {
+		return
+	}
+
+	report.AddSummary(summary)
+
+	fmt.Fprintf(getMessageOutput(o), "SUMMARY: %s\n", summary)
+	for _, registry := range getCredentialRegistries(summary) {
+		fmt.Fprintf(getMessageOutput(o), "CREDENTIALS: %s\n", summary.Credentials[registry])
+	}
+	fmt.Fprintln(getMessageOutput(o), "-")
+}
+
+// getCredentialRegistries gives us registries summary tells how we authenticated to (See Summary.Credentials), sorted
+func getCredentialRegistries(summary *v1.Summary) []string {
+	registries := make([]string, 0, len(summary.Credentials))
+	for registry := range summary.Credentials {
+		registries = append(registries, registry)
+	}
+
+	sort.Strings(registries)
+
+	return registries
+}
+
+// getArtifactLabel labels tags referencing OCI artifacts (Helm charts, WASM modules etc) with their type
+func getArtifactLabel(tg *tag.Tag) string {
+	if tg.IsImage() {
+		return ""
+	}
+
+	return " [" + tg.GetArtifactType() + "]"
+}
+
+// printAliases prints tags pointing at the same content (digest) for every repository in the collection (See 'aliases')
+func printAliases(cn *collection.Collection, w io.Writer) {
+	const format = "%-72s %s\n"
+
+	var digests, redundant int
+
+	fmt.Fprintf(out, format, "<DIGEST>", "<ALIASES>")
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, aliases := range cn.Aliases(ref) {
+			tags := make([]string, len(aliases.Tags))
+			for i, name := range aliases.Tags {
+				tags[i] = imageName(repo) + ":" + name
 			}
-		}
 
-		if !o.DaemonMode {
-			os.Exit(exitCode)
+			fmt.Fprintf(out, format, aliases.Digest, strings.Join(tags, " "))
+
+			digests++
+			redundant += aliases.Redundant()
 		}
+	}
+	fmt.Fprintf(out, "-\n")
+
+	fmt.Fprintf(w, "ALIASES: %d digests tagged more than once / %d redundant tags\n-\n", digests, redundant)
+}
 
-		fmt.Printf("WAIT: %v\n-\n", o.PollingInterval)
+// printGroups prints tags grouped by the value of the named group captured from their names for every repository (See 'group-by')
+func printGroups(cn *collection.Collection, name string, w io.Writer) {
+	const format = "%-32s %s\n"
 
-		time.Sleep(o.PollingInterval)
-	}
+	var groups int
+
+	fmt.Fprintf(out, format, "<"+strings.ToUpper(name)+">", "<TAGS>")
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, group := range cn.Groups(ref, name) {
+			tags := make([]string, len(group.Tags))
+			for i, tagName := range group.Tags {
+				tags[i] = imageName(repo) + ":" + tagName
+			}
+
+			fmt.Fprintf(out, format, group.Value, strings.Join(tags, " "))
+
+			groups++
+		}
+	}
+	fmt.Fprintf(out, "-\n")
+
+	fmt.Fprintf(w, "GROUPS: %d groups of tags by '%s'\n-\n", groups, name)
+}
+
+// printTotalSize prints total size of tags collected, both unique (shared layers counted once) and naive one (See 'total-size')
+func printTotalSize(cn *collection.Collection, w io.Writer) {
+	total := cn.TotalSize()
+
+	fmt.Fprintf(
+		w,
+		"TOTAL SIZE: %s unique / %s naive sum of %d tags (%d of unknown size)\n-\n",
+		size.Format(total.UniqueBytes), size.Format(total.Bytes), total.Tags, total.Unknown,
+	)
+}
+
+func printTags(cn *collection.Collection, withTimestamps bool) {
+	const format = "%-12s %-45s %-15s %-25s %s%s:%s%s\n"
+	const timestampsFormat = "%-25s %-25s "
+
+	var timestamps string
+	if withTimestamps {
+		timestamps = fmt.Sprintf(timestampsFormat, "<Last Pulled>", "<Last Modified>")
+	}
+
+	fmt.Fprintf(out, "-\n")
+	fmt.Fprintf(out, format, "<STATE>", "<DIGEST>", "<(local) ID>", "<Created At>", timestamps, "<IMAGE>", "<TAG>", "")
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+		tags := cn.Tags(ref)
+
+		for _, tg := range tags {
+			if withTimestamps {
+				timestamps = fmt.Sprintf(timestampsFormat, tg.GetLastPulledString(), tg.GetLastModifiedString())
+			}
+
+			fmt.Fprintf(out,
+				format,
+				tg.GetState(),
+				tg.GetShortDigest(),
+				tg.GetImageID(),
+				tg.GetCreatedString(),
+				timestamps,
+				imageName(repo),
+				tg.Name(),
+				getArtifactLabel(tg),
+			)
+		}
+	}
+	fmt.Fprintf(out, "-\n")
+}
+
+// printTagNames prints tag names only (one per line), much like "docker images -q" does,
+// NB! Names are prefixed with image name, if we have more than one repository to print.
+func printTagNames(cn *collection.Collection, withDigests bool) {
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, tg := range cn.Tags(ref) {
+			name := tg.Name()
+			if cn.RepoCount() > 1 || normalizeRefs {
+				name = imageName(repo) + ":" + tg.Name()
+			}
+
+			if withDigests {
+				fmt.Fprintln(out, name+" "+tg.GetDigest())
+			} else {
+				fmt.Fprintln(out, name)
+			}
+		}
+	}
+}
+
+func getRepositories(o *Options) ([]string, error) {
+	if o.YAMLConfig == "" {
+		return o.Positional.Repositories, nil
+	}
+
+	yc, err := config.LoadYAMLFile(o.YAMLConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return yc.Repositories, nil
+}
+
+// getRegistries gives us all the registries we work with: ones of the repositories, "push" and "mirror" ones
+func getRegistries(o *Options) []string {
+	registries := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(registry string) {
+		if registry != "" && !seen[registry] {
+			seen[registry] = true
+			registries = append(registries, registry)
+		}
+	}
+
+	repositories, _ := getRepositories(o)
+	for _, ref := range repositories {
+		if repo, err := repository.ParseRef(ref); err == nil {
+			add(repo.Registry())
+		}
+	}
+
+	if o.Push || o.MirrorRegistry != "" {
+		add(o.PushRegistry)
+
+		for _, route := range pushRoutes {
+			add(route.Registry)
+		}
+	}
+	add(o.MirrorRegistry)
+
+	return registries
+}
+
+// serveHealth serves health and readiness probes (See 'health-addr'), registries are pinged on every readiness probe
+func serveHealth(api *v1.API, o *Options) (*health.Status, error) {
+	listener, err := net.Listen("tcp", o.HealthAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	registries := getRegistries(o)
+
+	status := health.New(func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		return api.Ping(ctx, registries...)
+	})
+
+	go func() {
+		if err := http.Serve(listener, status.Handler()); err != nil {
+			log.Errorf("unable to serve health probes: %s", err.Error())
+		}
+	}()
+
+	log.Infof("SERVING health probes on %s", listener.Addr())
+
+	return status, nil
+}
+
+func validateConfig(api *v1.API, o *Options) {
+	repositories, err := getRepositories(o)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	var push *v1.PushConfig
+	if o.Push {
+		pushConfig := getPushConfig(o)
+		push = &pushConfig
+	}
+
+	issues := api.Validate(context.Background(), repositories, push)
+
+	if !o.JSON {
+		fmt.Fprintf(out, "-\n")
+		for _, issue := range issues {
+			fmt.Fprintf(out, "ISSUE: %s\n", issue.Error())
+		}
+		fmt.Fprintf(out, "-\n")
+	}
+
+	fmt.Fprintf(getMessageOutput(o), "VALIDATED: %d repos / %d issues\n-\n", len(repositories), len(issues))
+
+	for _, issue := range issues {
+		code := getExitCode(issue, nil)
+		if code == exitFailure {
+			code = exitConfigError
+		}
+
+		setExitCode(code)
+
+		report.AddError(issue, code)
+	}
+}
+
+// exportTar exports images of all the tags in the collection into "docker save" tar archive file (See 'export-tar')
+func exportTar(api *v1.API, cn *collection.Collection, path string) error {
+	refs := make([]string, 0)
+	for _, ref := range cn.Refs() {
+		repo := cn.Repo(ref)
+
+		for _, tg := range cn.Tags(ref) {
+			if tg.IsImage() {
+				refs = append(refs, repo.Name()+":"+tg.Name())
+			}
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := api.Export(context.Background(), refs, f); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// importTar imports images from "docker save" tar archive file into local Docker daemon (See 'import-tar')
+func importTar(api *v1.API, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return api.Import(context.Background(), f)
+}
+
+// pullIfChanged pulls a single tag only if its digest changed since the last run (See 'since-digest')
+func pullIfChanged(api *v1.API, o *Options) {
+	ref := o.Positional.Repositories[0]
+
+	pulled, digest, err := api.PullIfChanged(context.Background(), ref, o.SinceDigest)
+	if err != nil {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+		return
+	}
+
+	if o.JSON {
+		state := "PRESENT"
+		if pulled {
+			state = "CHANGED"
+		}
+
+		report.Tags = append(report.Tags, jsonTag{Ref: ref, State: state, Digest: digest})
+	} else {
+		fmt.Fprintln(out, digest)
+	}
+
+	// in daemon mode we only pull, if digest changed since the previous poll
+	o.SinceDigest = digest
+}
+
+// resolveRefs prints every reference passed in fully-qualified canonical, digest-pinned form (See 'resolve')
+func resolveRefs(api *v1.API, o *Options) {
+	for _, ref := range o.Positional.Repositories {
+		resolved, err := api.ResolveRef(context.Background(), ref)
+		if err != nil {
+			suicide(err, getExitCode(err, nil), !o.DaemonMode)
+			return
+		}
+
+		fmt.Fprintln(out, resolved)
+	}
+}
+
+// listPlatforms prints platform and digest of every image references passed have (See 'list-platforms'),
+// prefixed with the reference, if many references are passed
+func listPlatforms(api *v1.API, o *Options) {
+	for _, ref := range o.Positional.Repositories {
+		images, err := api.ListPlatforms(context.Background(), ref)
+		if err != nil {
+			suicide(err, getExitCode(err, nil), !o.DaemonMode)
+			return
+		}
+
+		for _, img := range images {
+			if len(o.Positional.Repositories) > 1 {
+				fmt.Fprintf(out, "%s\t", ref)
+			}
+
+			fmt.Fprintf(out, "%s\t%s\n", img.Platform, img.Digest)
+		}
+	}
+}
+
+// pruneUntagged deletes untagged manifests from every repository passed (See 'prune-untagged'), printing digests pruned
+func pruneUntagged(api *v1.API, o *Options) {
+	for _, ref := range o.Positional.Repositories {
+		result, err := api.PruneUntagged(ref, pruneDigests)
+		if result != nil {
+			for _, digest := range result.Pruned {
+				fmt.Fprintf(out, "%s@%s\n", result.Ref, digest)
+			}
+
+			fmt.Fprintf(getMessageOutput(o), "PRUNE: %s\n-\n", formatPruneResult(result))
+		}
+		if err != nil {
+			suicide(err, getExitCode(err, nil), false)
+		}
+	}
+}
+
+// formatPruneResult gives us a human-readable line about what was pruned (or not) from the repository
+func formatPruneResult(result *v1.PruneResult) string {
+	if result.Unsupported {
+		return fmt.Sprintf("%s: nothing pruned, registry does not support deleting manifests", result.Ref)
+	}
+
+	s := fmt.Sprintf(
+		"%s: %d pruned, %d kept (still referenced), %d absent, %d failed",
+		result.Ref,
+		len(result.Pruned),
+		len(result.Kept),
+		len(result.Absent),
+		len(result.Failed),
+	)
+	if result.DryRun {
+		s += " [DRY RUN]"
+	}
+
+	return s
+}
+
+func processRepositories(api *v1.API, o *Options) {
+	repositories, err := getRepositories(o)
+	if err != nil {
+		suicide(err, exitConfigError, !o.DaemonMode)
+		return
+	}
+
+	if _, err := repository.ParseRefs(repositories); err != nil {
+		suicide(err, exitConfigError, !o.DaemonMode)
+		return
+	}
+
+	collection, err := api.CollectTags(repositories...)
+	if err != nil {
+		suicide(err, getExitCode(err, nil), !o.DaemonMode)
+		return
+	}
+
+	if o.JSON {
+		report.AddTags(collection)
+	} else if o.Quiet {
+		printTagNames(collection, o.Digests)
+	} else {
+		printTags(collection, o.Timestamps)
+	}
+
+	if o.Aliases {
+		if o.JSON {
+			report.AddAliases(collection)
+		} else {
+			printAliases(collection, getMessageOutput(o))
+		}
+	}
+
+	if o.GroupBy != "" {
+		if o.JSON {
+			report.AddGroups(collection, o.GroupBy)
+		} else {
+			printGroups(collection, o.GroupBy, getMessageOutput(o))
+		}
+	}
+
+	if o.TotalSize {
+		if o.JSON {
+			report.AddTotalSize(collection)
+		} else {
+			printTotalSize(collection, getMessageOutput(o))
+		}
+	}
+
+	if o.Lockfile != "" {
+		lf := lockfile.FromCollection(collection)
+		if err := lf.Save(o.Lockfile); err != nil {
+			suicide(err, exitFailure, !o.DaemonMode)
+			return
+		}
+
+		fmt.Fprintf(getMessageOutput(o), "LOCKFILE: %d images pinned in %s\n-\n", lf.Len(), o.Lockfile)
+	}
+
+	if o.Pull {
+		summary, err := api.PullTagsWithSummary(collection)
+		printSummary(summary, o)
+		if err != nil {
+			suicideWithSummary(err, summary)
+		}
+	}
+
+	if o.ExportTar != "" {
+		if err := exportTar(api, collection, o.ExportTar); err != nil {
+			suicide(err, getExitCode(err, nil), !o.DaemonMode)
+			return
+		}
+	}
+
+	if o.ExportLayout != "" {
+		summary, err := api.ExportTagsWithSummary(collection, o.ExportLayout)
+		if summary == nil {
+			suicide(err, exitConfigError, !o.DaemonMode)
+			return
+		}
+		printSummary(summary, o)
+		if err != nil {
+			suicideWithSummary(err, summary)
+		}
+	}
+
+	if o.Push {
+		pushConfig := getPushConfig(o)
+
+		pushCollection, err := api.CollectPushTags(collection, pushConfig)
+		if err != nil {
+			suicide(err, getExitCode(err, nil), false)
+			return
+		}
+
+		summary, err := api.PushTagsWithSummary(pushCollection, pushConfig)
+		if summary != nil {
+			summary.Skipped += collection.TagCount() - pushCollection.TagCount()
+		}
+		printSummary(summary, o)
+		if err != nil {
+			suicideWithSummary(err, summary)
+		}
+	}
+}
+
+func main() {
+	o, err := parseFlags()
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if o.JSON {
+		report = newJSONReport()
+	}
+
+	normalizeRefs = o.Normalize
+
+	if err := auth.BasicStore.LoadAll(o.BasicAuth); err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if o.NoSSLVerify {
+		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	if err := transport.Registries.LoadCAFiles(o.RegistryCA); err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if err := transport.Registries.LoadClientCerts(o.RegistryClientCert); err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if err := transport.Registries.LoadPins(o.RegistryPin); err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if err := transport.Registries.LoadHeaders(o.RegistryHeader); err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if o.HostsDir != "" {
+		hosts, err := transport.Registries.LoadHostsDir(o.HostsDir)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+
+		if insecureHosts := getInsecureHosts(hosts); len(insecureHosts) != 0 && !o.AllowInsecure {
+			suicide(
+				fmt.Errorf("Hosts directory configures insecure registries: %s, pass '--allow-insecure' to confirm", strings.Join(insecureHosts, ", ")),
+				exitConfigError,
+				true,
+			)
+		}
+
+		o.InsecureRegistryEx = withInsecureHosts(o.InsecureRegistryEx, hosts)
+	}
+
+	bandwidthLimit, err := throttle.ParseRate(o.BandwidthLimit)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	maxPullBytes, err := size.Parse(o.MaxPullSize)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	maxManifestBytes, err := size.Parse(o.MaxManifestSize)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if o.PushDigestFile != "" {
+		allowedDigests, err = config.LoadDigestFile(o.PushDigestFile)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+	}
+
+	if o.PruneDigestFile != "" {
+		pruneDigests, err = config.LoadDigestFile(o.PruneDigestFile)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+	}
+
+	pushRoutes, err = getPushRoutes(o)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	pushCredentials, err = getPushCredentials(o)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	var denylist []string
+	if o.DenylistFile != "" {
+		denylist, err = config.LoadDenylistFile(o.DenylistFile)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+	}
+
+	for _, name := range o.AuthProvider {
+		provider, err := dockerconfig.BuiltinAuthProvider(name)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+
+		dockerconfig.RegisterAuthProvider(provider)
+	}
+
+	authRegistries, err := config.ParseAuthRegistries(o.AuthRegistry)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	apiConfig := v1.Config{
+		DockerJSONConfigFile: o.DockerJSON,
+		DockerContext:        o.DockerContext,
+		ConcurrentRequests:   o.ConcurrentRequests,
+		MaxRegistryRequests:  o.MaxRegistryReqs,
+		WaitBetween:          o.WaitBetween,
+		MaxTokenAge:          o.MaxTokenAge,
+		DialTimeout:          o.DialTimeout,
+		HandshakeTimeout:     o.HandshakeTimeout,
+		HeaderTimeout:        o.HeaderTimeout,
+		TraceRequests:        o.TraceRequests,
+		RetryRequests:        o.RetryRequests,
+		RetryDelay:           o.RetryDelay,
+		RetryBudget:          o.RetryBudget,
+		InsecureRegistryEx:   o.InsecureRegistryEx,
+		DefaultRegistry:      o.DefaultRegistry,
+		VerboseLogging:       len(o.Verbose) > 0,
+		LogRequests:          len(o.Verbose) > 1,
+		DryRun:               o.DryRun,
+		CheckpointFile:       o.Checkpoint,
+		MaxTags:              o.MaxTags,
+		Platform:             o.Platform,
+		Annotation:           o.Annotation,
+		BandwidthLimit:       bandwidthLimit,
+		PullConcurrency:      o.PullConcurrency,
+		PushConcurrency:      o.PushConcurrency,
+		LayerConcurrency:     o.LayerConcurrency,
+		FetchLastPulled:      o.Timestamps,
+		PullIfMissing:        o.PullIfMissing,
+		MaxPullBytes:         maxPullBytes,
+		MaxManifestBytes:     maxManifestBytes,
+		MaxPullImages:        o.MaxPullImages,
+		PullStallTimeout:     o.PullStallTimeout,
+		Denylist:             denylist,
+		TotalSize:            o.TotalSize,
+		ModifiedWithin:       o.ModifiedWithin,
+		CapturePattern:       o.Capture,
+		CaptureFilters:       o.CaptureFilter,
+		LatestPerMinor:       o.LatestPerMinor,
+		OnlyArch:             o.OnlyArch,
+		MaxLayers:            o.MaxLayers,
+		ExcludeOverMaxLayers: o.ExcludeOverLayers,
+		CheckDrift:           o.CheckDrift,
+		FailOnDrift:          o.Strict,
+		UseHubAPI:            o.HubAPI,
+		AuthRegistries:       authRegistries,
+	}
+
+	api, err := v1.New(apiConfig)
+	if err != nil {
+		suicide(err, exitConfigError, true)
+	}
+
+	if o.Validate {
+		openOutput(o)
+		validateConfig(api, o)
+
+		report.Print()
+		commitOutput()
+		os.Exit(exitCode)
+	}
+
+	if o.ImportTar != "" {
+		openOutput(o)
+		if err := importTar(api, o.ImportTar); err != nil {
+			suicide(err, getExitCode(err, nil), true)
+		}
+
+		report.Print()
+		commitOutput()
+		os.Exit(exitCode)
+	}
+
+	var status *health.Status
+	if o.HealthAddr != "" {
+		status, err = serveHealth(api, o)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+	}
+
+	var hook *webhook.Webhook
+	if o.Webhook != "" {
+		hook, err = webhook.New(o.Webhook, o.WebhookTemplate, o.WebhookHeader, o.WebhookBasicAuth)
+		if err != nil {
+			suicide(err, exitConfigError, true)
+		}
+	}
+
+	stopping := make(chan struct{})
+	if o.DaemonMode {
+		handleSignals(api, stopping)
+	}
+
+	var failures int
+	for cycle := 1; ; cycle++ {
+		if o.JSON || hook != nil || o.MetricsFile != "" {
+			report = newJSONReport()
+			report.quiet = !o.JSON
+		}
+
+		if hook != nil || o.MetricsFile != "" {
+			started := time.Now()
+			run := cycle
+
+			notify = func() {
+				if o.MetricsFile != "" {
+					writeMetrics(o.MetricsFile, report.Metrics(run, exitCode, time.Since(started)))
+				}
+				if hook != nil {
+					notifyWebhook(hook, report.Notification(run, exitCode, time.Since(started)))
+				}
+			}
+		}
+
+		if o.DaemonMode {
+			exitCode = exitOK
+			api.ResetCapabilities()
+		}
+
+		openOutput(o)
+
+		if o.MirrorRegistry != "" && o.MirrorDiff {
+			diffRegistries(api, o)
+		} else if o.MirrorRegistry != "" {
+			mirrorRegistry(api, o)
+		} else if o.SinceDigest != "" {
+			pullIfChanged(api, o)
+		} else if o.Resolve {
+			resolveRefs(api, o)
+		} else if o.ListPlatforms {
+			listPlatforms(api, o)
+		} else if o.PruneUntagged {
+			pruneUntagged(api, o)
+		} else if o.VerifyLockfile != "" {
+			verifyLockfile(api, o)
+		} else {
+			processRepositories(api, o)
+		}
+
+		report.Print()
+		commitOutput()
+		if notify != nil {
+			notify()
+		}
+
+		if !o.DaemonMode {
+			os.Exit(exitCode)
+		}
+
+		if status != nil {
+			if exitCode != exitOK {
+				status.Synced(fmt.Errorf("exit code %d", exitCode))
+			} else {
+				status.Synced(nil)
+			}
+		}
+
+		if exitCode == exitOK || exitCode == exitPartialFailure {
+			failures = 0
+		} else {
+			failures++
+		}
+
+		log.Infof("CYCLE %d completed (exit code %d, %d failed in a row)", cycle, exitCode, failures)
+
+		if api.Stopping() {
+			os.Exit(exitCode)
+		}
+
+		wait := getPollingWait(o.PollingInterval, o.PollingBackoffMax, failures)
+
+		fmt.Fprintf(getMessageOutput(o), "WAIT: %v\n-\n", wait)
+
+		select {
+		case <-stopping:
+			os.Exit(exitCode)
+		case <-time.After(wait):
+		}
+	}
+}
+
+// notifyWebhook sends notification to the webhook, failure to notify is logged, but it never fails the run
+func notifyWebhook(hook *webhook.Webhook, n jsonNotification) {
+	if err := hook.Send(n); err != nil {
+		log.Warnf("WEBHOOK notification failed: %s", err.Error())
+		return
+	}
+
+	log.Debugf("WEBHOOK notification sent: %+v", n)
+}
+
+// handleSignals makes us stop gracefully on SIGINT or SIGTERM (See v1.API.Stop): images in progress are completed,
+// then we exit. Channel passed is closed when signal is received. Second signal makes us exit immediately.
+func handleSignals(api *v1.API, stopping chan struct{}) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		log.Warnf("SIGNAL %v received, will exit once images in progress are completed (send it again to exit now)", sig)
+
+		api.Stop()
+		close(stopping)
+
+		<-signals
+		out.Discard()
+		os.Exit(exitCode)
+	}()
+}
+
+// getPollingWait gives us wait before the next poll: polling interval doubled after every failed poll, but not above the max
+func getPollingWait(interval, max time.Duration, failures int) time.Duration {
+	wait := interval
+
+	for i := 0; i < failures && wait < max; i++ {
+		wait *= 2
+	}
+
+	if failures > 0 && wait > max && max > interval {
+		return max
+	}
+
+	return wait
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/ivanilves/lstags/util/metrics"
+	"github.com/ivanilves/lstags/util/output"
+)
+
+// Metrics gives us metrics of the run (See 'metrics-file'): tags and their sizes per repository, summaries and errors
+func (r *jsonReport) Metrics(run, code int, duration time.Duration) *metrics.Set {
+	s := metrics.New()
+
+	if r != nil {
+		repos := make([]string, 0)
+		tags := make(map[string]int)
+		bytes := make(map[string]int64)
+		for _, tg := range r.Tags {
+			repo := tg.Ref
+			if i := strings.LastIndex(tg.Ref, ":"); i != -1 {
+				repo = tg.Ref[:i]
+			}
+
+			if _, defined := tags[repo]; !defined {
+				repos = append(repos, repo)
+			}
+
+			tags[repo]++
+			bytes[repo] += tg.Size
+		}
+
+		for _, repo := range repos {
+			s.Gauge("lstags_tags_total", "Number of tags collected per repository", float64(tags[repo]), "repo", repo)
+		}
+		for _, repo := range repos {
+			s.Gauge("lstags_bytes_total", "Size of images (in bytes) of tags collected per repository, where known", float64(bytes[repo]), "repo", repo)
+		}
+
+		if r.TotalSize != nil {
+			s.Gauge("lstags_unique_bytes_total", "Size of tags collected (in bytes) with blobs shared by many images counted once", float64(r.TotalSize.UniqueBytes))
+		}
+
+		const imagesHelp = "Number of images processed by operation and result (done, skipped or failed)"
+		for _, summary := range r.Summaries {
+			s.Gauge("lstags_images_total", imagesHelp, float64(summary.Done), "operation", summary.Operation, "result", "done")
+			s.Gauge("lstags_images_total", imagesHelp, float64(summary.Skipped), "operation", summary.Operation, "result", "skipped")
+			s.Gauge("lstags_images_total", imagesHelp, float64(summary.Failed), "operation", summary.Operation, "result", "failed")
+		}
+		for _, summary := range r.Summaries {
+			s.Gauge("lstags_operation_duration_seconds", "Duration of operation", summary.Duration, "operation", summary.Operation)
+		}
+
+		s.Gauge("lstags_errors_total", "Number of errors we got on the run", float64(len(r.Errors)))
+	}
+
+	s.Gauge("lstags_last_run", "Number of the run (cycle in daemon mode)", float64(run))
+	s.Gauge("lstags_last_run_exit_code", "Exit code of the run (0 means success)", float64(code))
+	s.Gauge("lstags_last_run_duration_seconds", "Duration of the run", duration.Seconds())
+	s.Gauge("lstags_last_run_timestamp_seconds", "Unix time the run completed at", float64(time.Now().Unix()))
+
+	return s
+}
+
+// writeMetrics writes metrics of the run into the file (replaced atomically), failure to write is logged, but it never fails the run
+func writeMetrics(path string, s *metrics.Set) {
+	o, err := output.Open(path)
+	if err == nil {
+		_, err = s.WriteTo(o)
+		if err == nil {
+			err = o.Commit()
+		} else {
+			o.Discard()
+		}
+	}
+
+	if err != nil {
+		log.Warnf("METRICS not written to %s: %s", path, err.Error())
+		return
+	}
+
+	log.Debugf("METRICS written to %s", path)
+}
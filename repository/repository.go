@@ -13,11 +13,12 @@ import (
 var InsecureRegistryEx = `^(127\..*|::1|localhost)(:[0-9]+)?$`
 
 // RefSpec is the description of a valid Docker repository specification
-const RefSpec = "[REGISTRY[:PORT]/]REPOSITORY[:TAG|=TAG1,TAG2,TAGn|~/FILTER_REGEXP/]"
+const RefSpec = "[REGISTRY[:PORT]/]REPOSITORY[:TAG|@DIGEST|=TAG1,TAG2,TAGn|~/FILTER_REGEXP/]"
 
 const (
 	refWithNothing   = "[REGISTRY[:PORT]/]REPOSITORY"
 	refWithSingleTag = "[REGISTRY[:PORT]/]REPOSITORY:TAG"
+	refWithDigest    = "[REGISTRY[:PORT]/]REPOSITORY@DIGEST"
 	refWithManyTags  = "[REGISTRY[:PORT]/]REPOSITORY=TAG1,TAG2,TAGn"
 	refWithFilter    = "[REGISTRY[:PORT]/]REPOSITORY~/FILTER_REGEXP/"
 )
@@ -26,17 +27,36 @@ const (
 	registryEx = `[a-z0-9][a-z0-9\-\.]+[a-z0-9](:[0-9]+)?/`
 	repoPathEx = `[a-z0-9_][a-z0-9_\-\.\/]+[a-z0-9_]`
 	tagEx      = `[a-zA-Z0-9_\-\.]+`
+	digestEx   = `[a-z0-9]+:[a-fA-F0-9]{32,}`
 	filterEx   = `\/.*\/`
 )
 
 var validRefExprs = map[string]*regexp.Regexp{
 	refWithNothing:   regexp.MustCompile(fmt.Sprintf("^(%s)?%s$", registryEx, repoPathEx)),
 	refWithSingleTag: regexp.MustCompile(fmt.Sprintf("^(%s)?%s:%s$", registryEx, repoPathEx, tagEx)),
+	refWithDigest:    regexp.MustCompile(fmt.Sprintf("^(%s)?%s@%s$", registryEx, repoPathEx, digestEx)),
 	refWithManyTags:  regexp.MustCompile(fmt.Sprintf("^(%s)?%s=%s(,%s)*$", registryEx, repoPathEx, tagEx, tagEx)),
 	refWithFilter:    regexp.MustCompile(fmt.Sprintf("^(%s)?%s~%s$", registryEx, repoPathEx, filterEx)),
 }
 
-const defaultRegistry = "registry.hub.docker.com"
+// HubRegistry is how we connect to DockerHub
+const HubRegistry = "registry.hub.docker.com"
+
+// DefaultRegistry is a registry references with no registry specified (e.g. "ubuntu") are resolved to, DockerHub by default.
+// NB! Set it to the internal registry (e.g. in an air-gapped setup) to resolve all such references there,
+// official images of the internal registry get no "library/" prefix then, e.g. "ubuntu" is "registry.internal/ubuntu".
+var DefaultRegistry = HubRegistry
+
+// canonicalRegistry is how we name DockerHub in canonical references
+const canonicalRegistry = "docker.io"
+
+// hubRegistries are all the names DockerHub is known by
+var hubRegistries = map[string]bool{
+	HubRegistry:            true,
+	canonicalRegistry:      true,
+	"index.docker.io":      true,
+	"registry-1.docker.io": true,
+}
 
 // Repository is a parsed, valid Docker repository reference
 type Repository struct {
@@ -44,6 +64,7 @@ type Repository struct {
 	registry string
 	fullRepo string
 	repoTags []string
+	digest   string
 	filterRE *regexp.Regexp
 	isSecure bool
 	isSingle bool
@@ -59,9 +80,15 @@ func (r *Repository) Registry() string {
 	return r.registry
 }
 
-// IsDefaultRegistry tells us if we use default registry (DockerHub)
+// IsDefaultRegistry tells us if we use DockerHub the way it is used by default, i.e. as "registry.hub.docker.com"
+// NB! Registry overriding the default one (See DefaultRegistry) is not treated as DockerHub, so it is not "default" here.
 func (r *Repository) IsDefaultRegistry() bool {
-	return r.registry == defaultRegistry
+	return r.registry == HubRegistry
+}
+
+// IsHubRegistry tells us if registry is DockerHub, known by any of its names (e.g. "docker.io" or "index.docker.io")
+func (r *Repository) IsHubRegistry() bool {
+	return hubRegistries[r.registry]
 }
 
 // Full gives us repository in a "full" form REGISTRY[:PORT]/REPOSITORY
@@ -89,6 +116,21 @@ func (r *Repository) Path() string {
 	return path
 }
 
+// Canonical gives us repository in a fully-qualified canonical form REGISTRY[:PORT]/PATH, so all the equivalent references
+// give the same one, e.g. "docker.io/library/ubuntu" for "ubuntu", "library/ubuntu" and "registry.hub.docker.com/ubuntu"
+func (r *Repository) Canonical() string {
+	if !hubRegistries[r.registry] {
+		return r.Full()
+	}
+
+	path := r.Path()
+	if !strings.Contains(path, "/") {
+		path = "library/" + path
+	}
+
+	return canonicalRegistry + "/" + path
+}
+
 // PushPath returns a repository path with a custom path element separator
 func (r *Repository) PushPath(pathSeparator string) string {
 	path := r.Path()
@@ -113,6 +155,17 @@ func (r *Repository) Tags() []string {
 	return r.repoTags
 }
 
+// HasDigest tells us if we've specified image digest (REPOSITORY@DIGEST) for this repository
+func (r *Repository) HasDigest() bool {
+	return r.digest != ""
+}
+
+// Digest gives us image digest we specified for this repository
+// (It will return "" if we have not specified any)
+func (r *Repository) Digest() string {
+	return r.digest
+}
+
 // HasFilter tells us if we've specified /FILTER/ regexp to match tags for this repository
 func (r *Repository) HasFilter() bool {
 	return r.filterRE != nil
@@ -209,12 +262,19 @@ func isHostname(s string) bool {
 	return false
 }
 
+// IsSecureRegistry tells us if we use secure (HTTPS) connection for the registry passed
+func IsSecureRegistry(registry string) bool {
+	return !regexp.MustCompile(InsecureRegistryEx).MatchString(registry)
+}
+
 // GetRegistry extracts registry address from the repository reference
+// NB! Registry could have a port, so we never split the whole reference by ":"
 func GetRegistry(ref string) string {
 	ref = strings.Split(ref, "~")[0]
+	ref = strings.Split(ref, "@")[0]
 
 	if !strings.Contains(ref, "/") {
-		return defaultRegistry
+		return DefaultRegistry
 	}
 
 	registry := strings.Split(ref, "/")[0]
@@ -223,7 +283,7 @@ func GetRegistry(ref string) string {
 		return registry
 	}
 
-	return defaultRegistry
+	return DefaultRegistry
 }
 
 func getFullRef(ref, registry string) string {
@@ -247,6 +307,7 @@ func ParseRef(ref string) (*Repository, error) {
 
 	var fullRepo string
 	var repoTags []string
+	var digest string
 	var filterRE *regexp.Regexp
 	var isSingle bool
 
@@ -255,10 +316,14 @@ func ParseRef(ref string) (*Repository, error) {
 		fullRepo = fullRef
 		filterRE = regexp.MustCompile(".*")
 	case refWithSingleTag:
-		refParts := strings.Split(fullRef, ":")
-		fullRepo = strings.Replace(fullRef, ":"+refParts[len(refParts)-1], "", 1)
-		repoTags = []string{refParts[len(refParts)-1]}
+		i := strings.LastIndex(fullRef, ":")
+		fullRepo = fullRef[:i]
+		repoTags = []string{fullRef[i+1:]}
 		isSingle = true
+	case refWithDigest:
+		refParts := strings.SplitN(fullRef, "@", 2)
+		fullRepo = refParts[0]
+		digest = refParts[1]
 	case refWithManyTags:
 		refParts := strings.Split(fullRef, "=")
 		fullRepo = refParts[0]
@@ -266,7 +331,10 @@ func ParseRef(ref string) (*Repository, error) {
 	case refWithFilter:
 		refParts := strings.Split(fullRef, "~")
 		fullRepo = refParts[0]
-		filterRE = regexp.MustCompile(refParts[1][1 : len(refParts[1])-1])
+		filterRE, err = regexp.Compile(refParts[1][1 : len(refParts[1])-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag filter in repository reference '%s': %s", ref, err.Error())
+		}
 	default:
 		return nil, fmt.Errorf("unknown repository  reference specification: %s", spec)
 	}
@@ -276,12 +344,36 @@ func ParseRef(ref string) (*Repository, error) {
 		registry: registry,
 		fullRepo: fullRepo,
 		repoTags: repoTags,
+		digest:   digest,
 		filterRE: filterRE,
-		isSecure: !regexp.MustCompile(InsecureRegistryEx).MatchString(registry),
+		isSecure: IsSecureRegistry(registry),
 		isSingle: isSingle,
 	}, nil
 }
 
+// NormalizeRef gives us a fully-qualified canonical form of the image reference passed, e.g. "docker.io/library/ubuntu:latest"
+// for "ubuntu" or "docker.io/library/ubuntu@DIGEST" for "ubuntu@DIGEST" (See Canonical)
+// NB! Only references to a single image could be normalized, i.e. not ones having many tags or a tag filter.
+func NormalizeRef(ref string) (string, error) {
+	repo, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	spec, _ := validateRef(ref)
+
+	switch spec {
+	case refWithDigest:
+		return repo.Canonical() + "@" + repo.Digest(), nil
+	case refWithSingleTag:
+		return repo.Canonical() + ":" + repo.Tags()[0], nil
+	case refWithNothing:
+		return repo.Canonical() + ":latest", nil
+	default:
+		return "", fmt.Errorf("could not normalize reference to many images: %s", ref)
+	}
+}
+
 // ParseRefs is a shorthand for ParseRef to parse multiple repository references at once
 func ParseRefs(refs []string) ([]*Repository, error) {
 	repos := make([]*Repository, len(refs))
@@ -297,3 +389,27 @@ func ParseRefs(refs []string) ([]*Repository, error) {
 
 	return repos, nil
 }
+
+// CompileGlob compiles glob matching repository paths into regexp, where "*" matches anything but "/", "**" matches anything
+// and "?" matches any single character but "/". Paths nested under the matched ones match as well, e.g. "team-*" matches "team-a/app".
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	var ex strings.Builder
+
+	ex.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			ex.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			ex.WriteString("[^/]*")
+		case glob[i] == '?':
+			ex.WriteString("[^/]")
+		default:
+			ex.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	ex.WriteString("(/.*)?$")
+
+	return regexp.Compile(ex.String())
+}
@@ -33,6 +33,13 @@ func TestParseRef(t *testing.T) {
 		"registry.org/some/repo~|^v1|":          {"", true, "", "", "", []string{}, "", "", false, false},
 		"ivanilves/lstags":                      {"registry.hub.docker.com", true, "registry.hub.docker.com/ivanilves/lstags", "ivanilves/lstags", "ivanilves/lstags", []string{}, ".*", "https://", false, true},
 		"quay.io/coreos/flannel:v0.6.1-ppc64le": {"quay.io", false, "quay.io/coreos/flannel", "quay.io/coreos/flannel", "coreos/flannel", []string{"v0.6.1-ppc64le"}, "", "https://", true, true},
+		"localhost:5000/foo":                    {"localhost:5000", false, "localhost:5000/foo", "localhost:5000/foo", "foo", []string{}, ".*", "http://", false, true},
+		"localhost:5000/foo:tag":                {"localhost:5000", false, "localhost:5000/foo", "localhost:5000/foo", "foo", []string{"tag"}, "", "http://", true, true},
+		"localhost:5000/foo:5000":               {"localhost:5000", false, "localhost:5000/foo", "localhost:5000/foo", "foo", []string{"5000"}, "", "http://", true, true},
+		"localhost:5000/foo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef": {"localhost:5000", false, "localhost:5000/foo", "localhost:5000/foo", "foo", []string{}, "", "http://", false, true},
+		"alpine@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef":             {"registry.hub.docker.com", true, "registry.hub.docker.com/alpine", "alpine", "library/alpine", []string{}, "", "https://", false, true},
+		"localhost:5000/foo@sha256:xyz": {"", true, "", "", "", []string{}, "", "", false, false},
+		"localhost:5000/foo~/^v(1/":     {"", true, "", "", "", []string{}, "", "", false, false},
 	}
 
 	assert := assert.New(t)
@@ -121,11 +128,15 @@ func TestParseRef(t *testing.T) {
 
 func TestGetRegistry(t *testing.T) {
 	testCases := map[string]string{
-		"alpine":                                  "registry.hub.docker.com",
-		"alpine:3.7":                              "registry.hub.docker.com",
-		"localhost:5000/nginx":                    "localhost:5000",
-		"registry.company.com/security/pentest":   "registry.company.com",
+		"alpine":                                "registry.hub.docker.com",
+		"alpine:3.7":                            "registry.hub.docker.com",
+		"localhost:5000/nginx":                  "localhost:5000",
+		"registry.company.com/security/pentest": "registry.company.com",
 		"dockerz.hipster.io:8443/hype/kubernetes": "dockerz.hipster.io:8443",
+		"localhost:5000/foo":                      "localhost:5000",
+		"localhost:5000/foo:tag":                  "localhost:5000",
+		"localhost:5000/foo@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef": "localhost:5000",
+		"alpine@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef":             "registry.hub.docker.com",
 	}
 
 	assert := assert.New(t)
@@ -134,6 +145,64 @@ func TestGetRegistry(t *testing.T) {
 		repo, _ := ParseRef(ref)
 
 		assert.Equal(repo.Registry(), expected)
+
+		assert.Equal(GetRegistry(ref), expected)
+	}
+}
+
+func TestNormalizeRef(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	testCases := map[string]string{
+		"ubuntu":                                  "docker.io/library/ubuntu:latest",
+		"ubuntu:18.04":                            "docker.io/library/ubuntu:18.04",
+		"library/ubuntu:18.04":                    "docker.io/library/ubuntu:18.04",
+		"docker.io/ubuntu:18.04":                  "docker.io/library/ubuntu:18.04",
+		"docker.io/library/ubuntu:latest":         "docker.io/library/ubuntu:latest",
+		"registry.hub.docker.com/library/ubuntu":  "docker.io/library/ubuntu:latest",
+		"index.docker.io/ivanilves/lstags:v1.2.0": "docker.io/ivanilves/lstags:v1.2.0",
+		"ubuntu@" + digest:                        "docker.io/library/ubuntu@" + digest,
+		"quay.io/coreos/awscli":                   "quay.io/coreos/awscli:latest",
+		"localhost:5000/foo:5000":                 "localhost:5000/foo:5000",
+		"ubuntu=18.04,20.04":                      "",
+		"ubuntu~/^18/":                            "",
+		"ub@ntu":                                  "",
+	}
+
+	assert := assert.New(t)
+
+	for ref, expected := range testCases {
+		normalized, err := NormalizeRef(ref)
+
+		if expected == "" {
+			assert.NotNil(err, "should fail to normalize reference: %s", ref)
+			continue
+		}
+
+		assert.Nil(err, "should be no error (ref: %s)", ref)
+		assert.Equal(expected, normalized, "unexpected normalized reference (ref: %s)", ref)
+	}
+}
+
+func TestRepositoryDigest(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	testCases := map[string]string{
+		"localhost:5000/foo@" + digest: digest,
+		"localhost:5000/foo:tag":       "",
+		"localhost:5000/foo":           "",
+		"alpine@" + digest:             digest,
+	}
+
+	assert := assert.New(t)
+
+	for ref, expected := range testCases {
+		repo, err := ParseRef(ref)
+
+		assert.Nil(err, "should be no error (ref: %s)", ref)
+
+		assert.Equal(expected, repo.Digest(), "unexpected digest (ref: %s)", ref)
+		assert.Equal(expected != "", repo.HasDigest(), "unexpected digest presence (ref: %s)", ref)
 	}
 }
 
@@ -234,3 +303,85 @@ func TestParseRefs(t *testing.T) {
 		assert.Equal(refs, expected.refs, "passed references should be the same as parsed ones")
 	}
 }
+
+func TestCompileGlob(t *testing.T) {
+	var testCases = []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"team-*", "team-a/app", true},
+		{"team-*", "team-b", true},
+		{"team-*", "teams/app", false},
+		{"team-*/app", "team-a/app", true},
+		{"team-*/app", "team-a/db", false},
+		{"*/app", "team-a/nested/app", false},
+		{"**/app", "team-a/nested/app", true},
+		{"team-?", "team-a", true},
+		{"team-?", "team-ab", false},
+		{"team.a", "teamxa", false},
+	}
+
+	assert := assert.New(t)
+
+	for _, testCase := range testCases {
+		re, err := CompileGlob(testCase.glob)
+
+		assert.Nil(err)
+		assert.Equal(
+			testCase.matches, re.MatchString(testCase.path),
+			"unexpected match (glob: %s, path: %s)", testCase.glob, testCase.path,
+		)
+	}
+}
+
+func TestRepositoryIsHubRegistry(t *testing.T) {
+	testCases := map[string]bool{
+		"alpine":                              true,
+		"docker.io/library/alpine:3.7":        true,
+		"index.docker.io/library/alpine":      true,
+		"registry.hub.docker.com/library/foo": true,
+		"quay.io/coreos/etcd":                 false,
+		"localhost:5000/foo":                  false,
+	}
+
+	assert := assert.New(t)
+
+	for ref, expected := range testCases {
+		repo, _ := ParseRef(ref)
+
+		assert.Equal(expected, repo.IsHubRegistry(), ref)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	DefaultRegistry = "registry.internal"
+	defer func() { DefaultRegistry = HubRegistry }()
+
+	assert := assert.New(t)
+
+	for ref, expected := range map[string]string{
+		"ubuntu":               "registry.internal/ubuntu",
+		"library/ubuntu:18.04": "registry.internal/library/ubuntu",
+		"quay.io/coreos/etcd":  "quay.io/coreos/etcd",
+	} {
+		repo, err := ParseRef(ref)
+
+		assert.Nil(err)
+		assert.Equal(expected, repo.Full(), ref)
+		assert.Equal(expected, repo.Name(), "should not cut overridden default registry off the name: "+ref)
+	}
+
+	repo, _ := ParseRef("ubuntu")
+
+	assert.Equal("registry.internal", repo.Registry())
+	assert.Equal("ubuntu", repo.Path(), "should give no 'library/' prefix to images of overridden default registry")
+	assert.False(repo.IsDefaultRegistry())
+	assert.False(repo.IsHubRegistry())
+
+	hub, _ := ParseRef("registry.hub.docker.com/ubuntu")
+
+	assert.True(hub.IsDefaultRegistry(), "should still treat DockerHub referenced explicitly as DockerHub")
+	assert.Equal("library/ubuntu", hub.Path())
+	assert.Equal("ubuntu", hub.Name())
+}
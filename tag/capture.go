@@ -0,0 +1,55 @@
+package tag
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// CompileCapturePattern compiles regex applied to tag names to capture their parts by named groups,
+// e.g. "^app-(?P<version>[^-]+)-(?P<env>.+)$" for tags named "app-<version>-<env>"
+func CompileCapturePattern(pattern string) (*regexp.Regexp, error) {
+	ex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture pattern '%s': %s", pattern, err.Error())
+	}
+
+	for _, name := range ex.SubexpNames() {
+		if name != "" {
+			return ex, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid capture pattern '%s': no named groups, e.g. (?P<env>[a-z]+)", pattern)
+}
+
+// Capture applies capture pattern (See CompileCapturePattern) to the tag name, remembering named groups captured,
+// and tells us if tag name matched the pattern at all
+func (tg *Tag) Capture(ex *regexp.Regexp) bool {
+	match := ex.FindStringSubmatch(tg.name)
+	if match == nil {
+		tg.captures = nil
+
+		return false
+	}
+
+	tg.captures = make(map[string]string)
+	for i, name := range ex.SubexpNames() {
+		if name != "" {
+			tg.captures[name] = match[i]
+		}
+	}
+
+	return true
+}
+
+// GetCaptures gets named groups captured from the tag name (nil means tag name was not captured)
+func (tg *Tag) GetCaptures() map[string]string {
+	return tg.captures
+}
+
+// GetCapture gets named group captured from the tag name, and tells us if it was captured
+func (tg *Tag) GetCapture(name string) (string, bool) {
+	value, captured := tg.captures[name]
+
+	return value, captured
+}
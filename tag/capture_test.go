@@ -0,0 +1,41 @@
+package tag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileCapturePattern(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := CompileCapturePattern("^app-(?P<version>[^-]+)-(?P<env>.+)$")
+	assert.Nil(err)
+
+	_, err = CompileCapturePattern("^app-(?P<version>[^-]+")
+	assert.NotNil(err, "should fail on invalid regex")
+
+	_, err = CompileCapturePattern("^app-([^-]+)-(.+)$")
+	assert.NotNil(err, "should fail on regex with no named groups")
+}
+
+func TestCapture(t *testing.T) {
+	assert := assert.New(t)
+
+	ex, _ := CompileCapturePattern("^app-(?P<version>[^-]+)-(?P<env>.+)$")
+
+	tg, _ := New("app-1.2.3-prod", Options{Digest: "sha256:aaa"})
+	assert.True(tg.Capture(ex))
+	assert.Equal(map[string]string{"version": "1.2.3", "env": "prod"}, tg.GetCaptures())
+
+	env, captured := tg.GetCapture("env")
+	assert.True(captured)
+	assert.Equal("prod", env)
+
+	_, captured = tg.GetCapture("arch")
+	assert.False(captured)
+
+	tg, _ = New("latest", Options{Digest: "sha256:bbb"})
+	assert.False(tg.Capture(ex))
+	assert.Nil(tg.GetCaptures())
+}
@@ -0,0 +1,171 @@
+package tag
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// semverRE matches semantic version tag names, e.g. "1.2.3", "v1.2" or "v1.2.3-rc.1"
+var semverRE = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// parseSemver gives us numeric version parts and a pre-release part of the tag name (ok is false, if it is not a semver)
+func parseSemver(name string) (version [3]int64, pre string, ok bool) {
+	m := semverRE.FindStringSubmatch(name)
+	if m == nil {
+		return version, "", false
+	}
+
+	for i := 0; i < 3; i++ {
+		if m[i+1] != "" {
+			version[i], _ = strconv.ParseInt(m[i+1], 10, 64)
+		}
+	}
+
+	return version, m[4], true
+}
+
+// comparePrerelease compares pre-release parts of the versions the semver.org way ("" is a release, it goes after any pre-release)
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	aa, bb := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(aa) && i < len(bb); i++ {
+		if aa[i] == bb[i] {
+			continue
+		}
+
+		an, aErr := strconv.ParseInt(aa[i], 10, 64)
+		bn, bErr := strconv.ParseInt(bb[i], 10, 64)
+
+		switch {
+		case aErr == nil && bErr == nil:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case aa[i] < bb[i]:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	if len(aa) < len(bb) {
+		return -1
+	}
+
+	return 1
+}
+
+// SemverLess compares tag names as semantic versions, e.g. "v1.9.0" < "v1.10.0" and "1.0.0-rc.1" < "1.0.0".
+// Tag names not being semantic versions (e.g. "latest") go before all semantic versions and are compared as strings.
+func SemverLess(a, b string) bool {
+	av, apre, aok := parseSemver(a)
+	bv, bpre, bok := parseSemver(b)
+
+	switch {
+	case !aok && !bok:
+		return a < b
+	case !aok:
+		return true
+	case !bok:
+		return false
+	}
+
+	for i := 0; i < 3; i++ {
+		if av[i] != bv[i] {
+			return av[i] < bv[i]
+		}
+	}
+
+	if c := comparePrerelease(apre, bpre); c != 0 {
+		return c < 0
+	}
+
+	return a < b
+}
+
+// MinorVersion gives us "MAJOR.MINOR" version of the tag name (e.g. "1.2" for "v1.2.3-rc.1"), or "", if it is not a semver
+func MinorVersion(name string) string {
+	version, _, ok := parseSemver(name)
+	if !ok {
+		return ""
+	}
+
+	return strconv.FormatInt(version[0], 10) + "." + strconv.FormatInt(version[1], 10)
+}
+
+// MinorSelection is what "latest N per minor version" policy selects from tag names (See LatestPerMinor)
+type MinorSelection struct {
+	// Keep are names of the newest tags per minor version (kept by the policy)
+	Keep []string
+	// Drop are names of older tags per minor version (e.g. candidates to prune)
+	Drop []string
+	// Other are names of tags not being semantic versions (e.g. "latest"), policy could not say anything about them
+	Other []string
+}
+
+// LatestPerMinor groups semver tag names by their minor version ("1.2.x", "1.3.x") and selects "limit" newest of each group
+// (as compared by SemverLess), e.g. to keep only 2 latest patches of every minor version. Names are given sorted the same way.
+// NB! Zero or negative limit means no limit at all, i.e. all semver tags are kept.
+func LatestPerMinor(names []string, limit int) MinorSelection {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Slice(sorted, func(i, j int) bool { return SemverLess(sorted[i], sorted[j]) })
+
+	selection := MinorSelection{Keep: []string{}, Drop: []string{}, Other: []string{}}
+	kept := make(map[string]int)
+
+	for i := len(sorted) - 1; i >= 0; i-- {
+		minor := MinorVersion(sorted[i])
+
+		switch {
+		case minor == "":
+			selection.Other = append([]string{sorted[i]}, selection.Other...)
+		case limit > 0 && kept[minor] >= limit:
+			selection.Drop = append([]string{sorted[i]}, selection.Drop...)
+		default:
+			selection.Keep = append([]string{sorted[i]}, selection.Keep...)
+			kept[minor]++
+		}
+	}
+
+	return selection
+}
+
+// CreatedLess gives us a function to compare tag names by creation time of tagged images (the same way tags are sorted
+// before process or display them). Tags passed are looked up by name, unknown tag names go before all known ones.
+func CreatedLess(tags map[string]*Tag) func(a, b string) bool {
+	return func(a, b string) bool {
+		at, aok := tags[a]
+		bt, bok := tags[b]
+
+		switch {
+		case !aok && !bok:
+			return a < b
+		case !aok:
+			return true
+		case !bok:
+			return false
+		case at.GetCreated() != bt.GetCreated():
+			return at.GetCreated() < bt.GetCreated()
+		}
+
+		return a < b
+	}
+}
@@ -0,0 +1,54 @@
+package tag
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemverLess(t *testing.T) {
+	names := []string{"v1.10.0", "latest", "1.0.0", "v1.9.0", "1.0.0-rc.10", "1.0.0-rc.2", "1.0.0-beta", "v2", "edge"}
+
+	sort.Slice(names, func(i, j int) bool { return SemverLess(names[i], names[j]) })
+
+	assert.Equal(
+		t,
+		[]string{"edge", "latest", "1.0.0-beta", "1.0.0-rc.2", "1.0.0-rc.10", "1.0.0", "v1.9.0", "v1.10.0", "v2"},
+		names,
+	)
+}
+
+func TestCreatedLess(t *testing.T) {
+	assert := assert.New(t)
+
+	older, _ := New("older", Options{Digest: "sha256:aaa", Created: 1000})
+	newer, _ := New("newer", Options{Digest: "sha256:bbb", Created: 2000})
+
+	less := CreatedLess(map[string]*Tag{"older": older, "newer": newer})
+
+	assert.True(less("older", "newer"))
+	assert.False(less("newer", "older"))
+	assert.True(less("unknown", "older"), "unknown tag names should go first")
+}
+
+func TestLatestPerMinor(t *testing.T) {
+	assert := assert.New(t)
+
+	names := []string{"1.2.0", "v1.2.1", "1.2.2", "1.2.3-rc.1", "1.3.0", "1.3.1", "2.0.0", "latest", "edge", "1.10.5", "1.10.6"}
+
+	selection := LatestPerMinor(names, 2)
+
+	assert.Equal([]string{"1.2.2", "1.2.3-rc.1", "1.3.0", "1.3.1", "1.10.5", "1.10.6", "2.0.0"}, selection.Keep)
+	assert.Equal([]string{"1.2.0", "v1.2.1"}, selection.Drop)
+	assert.Equal([]string{"edge", "latest"}, selection.Other, "should put non-semver tags into a separate bucket")
+
+	selection = LatestPerMinor(names, 0)
+
+	assert.Equal(7+2, len(selection.Keep), "should keep all semver tags, if there is no limit")
+	assert.Empty(selection.Drop)
+
+	assert.Equal("1.2", MinorVersion("v1.2.3-rc.1"))
+	assert.Equal("2.0", MinorVersion("v2"))
+	assert.Equal("", MinorVersion("latest"))
+}
@@ -1,13 +1,20 @@
 package local
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 
+	log "github.com/sirupsen/logrus"
+
 	dockerclient "github.com/ivanilves/lstags/docker/client"
 	"github.com/ivanilves/lstags/repository"
 	"github.com/ivanilves/lstags/tag"
 )
 
+// FetchLastPulled defines if we should inspect images to know when they were last pulled (costs us a request per image)
+var FetchLastPulled = false
+
 // FetchTags looks up Docker repo tags and IDs present on local Docker daemon
 func FetchTags(repo *repository.Repository, dc *dockerclient.DockerClient) (map[string]*tag.Tag, error) {
 	imageSummaries, err := dc.ListImagesForRepo(repo.Name())
@@ -25,12 +32,27 @@ func FetchTags(repo *repository.Repository, dc *dockerclient.DockerClient) (map[
 			repoDigest = "this.image.is.bad.it.has.no.digest.fuuu!"
 		}
 
+		var lastPulled int64
+		if FetchLastPulled && len(tagNames) != 0 {
+			lastTagTime, err := dc.LastTagTime(imageSummary.ID)
+			if err != nil {
+				log.Debugf("unable to inspect image %s: %s", imageSummary.ID, err.Error())
+			} else if !lastTagTime.IsZero() {
+				lastPulled = lastTagTime.Unix()
+			}
+		}
+
 		for _, tagName := range tagNames {
 			if !repo.MatchTag(tagName) {
 				continue
 			}
 
-			tagOptions := tag.Options{Digest: repoDigest, ImageID: imageSummary.ID, Created: imageSummary.Created}
+			tagOptions := tag.Options{
+				Digest:     repoDigest,
+				ImageID:    imageSummary.ID,
+				Created:    imageSummary.Created,
+				LastPulled: lastPulled,
+			}
 
 			tg, err := tag.New(tagName, tagOptions)
 			if err != nil {
@@ -67,3 +89,58 @@ func extractTagNames(repoTags []string, repoName string) []string {
 
 	return tagNames
 }
+
+// matchDigestPrefix finds the only digest starting with the prefix passed ("sha256:abc123" or just "abc123")
+func matchDigestPrefix(digests []string, prefix string) (string, error) {
+	if !strings.Contains(prefix, ":") {
+		prefix = "sha256:" + prefix
+	}
+
+	matched := make(map[string]bool)
+	for _, digest := range digests {
+		if strings.HasPrefix(digest, prefix) {
+			matched[digest] = true
+		}
+	}
+
+	candidates := make([]string, 0, len(matched))
+	for digest := range matched {
+		candidates = append(candidates, digest)
+	}
+	sort.Strings(candidates)
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("no image matches digest prefix: %s", prefix)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("digest prefix %s is ambiguous, it matches: %s", prefix, strings.Join(candidates, ", "))
+	}
+}
+
+// ResolveDigest resolves short digest prefix to the full digest of the local image of the repository passed
+// (like Docker does with short image IDs), failing if there is no such image or prefix matches more than one
+func ResolveDigest(repo *repository.Repository, prefix string, dc *dockerclient.DockerClient) (string, error) {
+	imageSummaries, err := dc.ListImagesForRepo(repo.Name())
+	if err != nil {
+		return "", err
+	}
+
+	digests := make([]string, 0)
+	for _, imageSummary := range imageSummaries {
+		for _, repoDigest := range imageSummary.RepoDigests {
+			digestFields := strings.SplitN(repoDigest, "@", 2)
+			if len(digestFields) == 2 {
+				digests = append(digests, digestFields[1])
+			}
+		}
+	}
+
+	digest, err := matchDigestPrefix(digests, prefix)
+	if err != nil {
+		return "", fmt.Errorf("%s (repository: %s)", err.Error(), repo.Name())
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,38 @@
+package local
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchDigestPrefix(t *testing.T) {
+	digests := []string{
+		"sha256:abc1230000000000000000000000000000000000000000000000000000000000",
+		"sha256:abc4560000000000000000000000000000000000000000000000000000000000",
+		"sha256:abc4560000000000000000000000000000000000000000000000000000000000",
+		"sha256:def0000000000000000000000000000000000000000000000000000000000000",
+	}
+
+	assert := assert.New(t)
+
+	for _, prefix := range []string{"sha256:abc123", "abc123", "abc1230000000000000000000000000000000000000000000000000000000000"} {
+		digest, err := matchDigestPrefix(digests, prefix)
+
+		assert.Nil(err, "should be no error (prefix: %s)", prefix)
+		assert.Equal(digests[0], digest, "unexpected digest (prefix: %s)", prefix)
+	}
+
+	digest, err := matchDigestPrefix(digests, "abc4")
+
+	assert.Nil(err, "should match the same digest of different images only once")
+	assert.Equal(digests[1], digest)
+
+	_, err = matchDigestPrefix(digests, "abc")
+
+	assert.NotNil(err, "should fail on ambiguous prefix")
+
+	_, err = matchDigestPrefix(digests, "sha256:fff")
+
+	assert.NotNil(err, "should fail, if nothing matches")
+}
@@ -1,9 +1,367 @@
 package manifest
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"runtime"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Media types of manifests we know how to deal with
+const (
+	MediaTypeDockerV2     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerV2List = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+
+	// Deprecated "schema1" media types, some legacy registries still serve them
+	MediaTypeDockerV1       = "application/vnd.docker.distribution.manifest.v1+json"
+	MediaTypeDockerV1Signed = "application/vnd.docker.distribution.manifest.v1+prettyjws"
+)
+
+// Media types of image configs, manifests with any other config media type are not images, but artifacts
+const (
+	MediaTypeDockerConfig = "application/vnd.docker.container.image.v1+json"
+	MediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+)
+
+// Media types of "foreign" (non-distributable) layers, they are fetched from their URLs, not from registry
+const (
+	MediaTypeDockerForeignLayer = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+	MediaTypeOCIForeignLayer    = "application/vnd.oci.image.layer.nondistributable.v1.tar"
+)
+
+// MediaTypes is a list of all manifest media types we accept from registries
+var MediaTypes = []string{MediaTypeDockerV2, MediaTypeDockerV2List, MediaTypeOCIManifest, MediaTypeOCIIndex}
+
+// Descriptor describes a content addressable object (manifest or blob) stored in registry
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+}
+
+// IsForeign tells us if descriptor references a "foreign" layer (e.g. Windows base image one) not stored in registry
+func (d Descriptor) IsForeign() bool {
+	return len(d.URLs) != 0 || d.MediaType == MediaTypeDockerForeignLayer || strings.HasPrefix(d.MediaType, MediaTypeOCIForeignLayer)
+}
+
+// Platform describes a platform image (manifest list/index child) is built for
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// DefaultPlatform gives the platform we run on (used when no explicit platform is configured)
+// NB! OS is always "linux", as Docker does: Docker Desktop runs Linux images on macOS and Windows too.
+func DefaultPlatform() Platform {
+	return hostPlatform(runtime.GOOS, runtime.GOARCH)
+}
+
+// hostPlatform gives the platform of images we run on the host with OS and architecture passed (See DefaultPlatform)
+func hostPlatform(_, arch string) Platform {
+	return Platform{OS: "linux", Architecture: arch}
+}
+
+// ParsePlatform parses platform string in "OS/ARCH[/VARIANT]" form, e.g. "linux/arm64" or "linux/arm/v7"
+// NB! Empty string gives us a default (host) platform.
+func ParsePlatform(s string) (Platform, error) {
+	if s == "" {
+		return DefaultPlatform(), nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform (should be OS/ARCH[/VARIANT]): %s", s)
+	}
+
+	p := Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+// String gives platform in "OS/ARCH[/VARIANT]" form
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+
+	return p.OS + "/" + p.Architecture
+}
+
+// Matches tells us if platform passed satisfies this one (variant is compared only if we have it set)
+func (p Platform) Matches(other *Platform) bool {
+	if other == nil || p.OS != other.OS || p.Architecture != other.Architecture {
+		return false
+	}
+
+	return p.Variant == "" || p.Variant == other.Variant
+}
+
+// Annotation is a "KEY=VALUE" annotation used to select manifest list/index child, instead of platform
+// (e.g. "org.opencontainers.image.ref.name=slim" for images marking their variants with annotations)
+type Annotation struct {
+	Key   string
+	Value string
+}
+
+// ParseAnnotation parses annotation string in "KEY=VALUE" form
+// NB! Empty string gives us nil, i.e. no annotation to select manifest by.
+func ParseAnnotation(s string) (*Annotation, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("invalid annotation (should be KEY=VALUE): %s", s)
+	}
+
+	return &Annotation{Key: parts[0], Value: parts[1]}, nil
+}
+
+// String gives annotation in "KEY=VALUE" form
+func (a Annotation) String() string {
+	return a.Key + "=" + a.Value
+}
+
+// Matches tells us if annotations passed have this annotation
+func (a Annotation) Matches(annotations map[string]string) bool {
+	value, defined := annotations[a.Key]
+
+	return defined && value == a.Value
+}
+
+// Content is a manifest document (image manifest or manifest list/index) served by registry
+type Content struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *Descriptor       `json:"config,omitempty"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+	FSLayers      []FSLayer         `json:"fsLayers,omitempty"`
+}
+
+// FSLayer is a layer reference of deprecated "schema1" manifest
+type FSLayer struct {
+	BlobSum string `json:"blobSum"`
+}
+
+// IsIndex tells us if manifest is a manifest list/index (i.e. it references other manifests)
+func (c Content) IsIndex() bool {
+	return c.MediaType == MediaTypeDockerV2List || c.MediaType == MediaTypeOCIIndex
+}
+
+// GetArtifactType gets type of the artifact (e.g. Helm chart) manifest describes, or "", if it describes an image
+func (c Content) GetArtifactType() string {
+	if c.ArtifactType != "" {
+		return c.ArtifactType
+	}
+
+	if c.Config == nil {
+		return ""
+	}
+
+	switch c.Config.MediaType {
+	case "", MediaTypeDockerConfig, MediaTypeOCIConfig:
+		return ""
+	default:
+		return c.Config.MediaType
+	}
+}
+
+// ImageSize gets total size of image config and layers referenced by the (non-index) manifest
+func (c Content) ImageSize() int64 {
+	var size int64
+
+	if c.Config != nil {
+		size += c.Config.Size
+	}
+
+	for _, l := range c.Layers {
+		size += l.Size
+	}
+
+	return size
+}
+
+// LayerCount gets number of layers referenced by the (non-index) manifest
+// NB! Deprecated "schema1" manifests list empty layers too, so their number is often bigger than the real one.
+func (c Content) LayerCount() int {
+	if c.IsSchema1() {
+		return len(c.FSLayers)
+	}
+
+	return len(c.Layers)
+}
+
+// Blobs gives sizes of image config and layers referenced by the (non-index) manifest, keyed by their digests
+// NB! Layers of the same digest could be shared by many images, so we could count every one of them once.
+func (c Content) Blobs() map[string]int64 {
+	if c.Config == nil && len(c.Layers) == 0 {
+		return nil
+	}
+
+	blobs := make(map[string]int64, len(c.Layers)+1)
+
+	if c.Config != nil {
+		blobs[c.Config.Digest] = c.Config.Size
+	}
+
+	for _, l := range c.Layers {
+		blobs[l.Digest] = l.Size
+	}
+
+	return blobs
+}
+
+// IsSchema1 tells us if manifest is of deprecated "schema1" format (no config, layers are "fsLayers")
+func (c Content) IsSchema1() bool {
+	return c.SchemaVersion == 1
+}
+
+// IsSchema1MediaType tells us if media type passed is the one of deprecated "schema1" manifest
+func IsSchema1MediaType(mediaType string) bool {
+	return mediaType == MediaTypeDockerV1 || mediaType == MediaTypeDockerV1Signed
+}
+
+// Schema1Digest calculates digest of "schema1" manifest document, which is a digest of its payload,
+// i.e. document with JWS signatures stripped (if it is signed), as registry does it.
+func Schema1Digest(data []byte) (string, error) {
+	var signed struct {
+		Signatures []struct {
+			Protected string `json:"protected"`
+		} `json:"signatures"`
+	}
+
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return "", err
+	}
+
+	payload := data
+
+	if len(signed.Signatures) != 0 {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(signed.Signatures[0].Protected, "="))
+		if err != nil {
+			return "", err
+		}
+
+		var protected struct {
+			FormatLength int    `json:"formatLength"`
+			FormatTail   string `json:"formatTail"`
+		}
+		if err := json.Unmarshal(b, &protected); err != nil {
+			return "", err
+		}
+
+		tail, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(protected.FormatTail, "="))
+		if err != nil {
+			return "", err
+		}
+
+		if protected.FormatLength <= 0 || protected.FormatLength > len(data) {
+			return "", fmt.Errorf("invalid schema1 manifest signature (format length: %d)", protected.FormatLength)
+		}
+
+		payload = append(append([]byte{}, data[:protected.FormatLength]...), tail...)
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(payload)), nil
+}
+
+// SelectManifest selects descriptor of the manifest list/index child built for the platform passed
+// (returns nil, if there is no such child)
+func (c Content) SelectManifest(p Platform) *Descriptor {
+	for i, d := range c.Manifests {
+		if p.Matches(d.Platform) {
+			return &c.Manifests[i]
+		}
+	}
+
+	return nil
+}
+
+// SelectManifestByAnnotation selects descriptor of the manifest list/index child having the annotation passed
+// (returns nil, if there is no such child)
+func (c Content) SelectManifestByAnnotation(a Annotation) *Descriptor {
+	for i, d := range c.Manifests {
+		if a.Matches(d.Annotations) {
+			return &c.Manifests[i]
+		}
+	}
+
+	return nil
+}
+
+// Architectures gives architectures ("ARCH[/VARIANT]", e.g. "arm64" or "arm/v7") of manifest list/index children,
+// each of them once. Children with "unknown" platform (e.g. build attestations) are not images, so they are not counted.
+func (c Content) Architectures() []string {
+	archs := make([]string, 0, len(c.Manifests))
+	seen := make(map[string]bool, len(c.Manifests))
+
+	for _, d := range c.Manifests {
+		if d.Platform == nil || d.Platform.Architecture == "" || d.Platform.Architecture == "unknown" {
+			continue
+		}
+
+		arch := d.Platform.Architecture
+		if d.Platform.Variant != "" {
+			arch = arch + "/" + d.Platform.Variant
+		}
+
+		if !seen[arch] {
+			seen[arch] = true
+			archs = append(archs, arch)
+		}
+	}
+
+	return archs
+}
+
+// MatchArchitecture tells us if architecture ("ARCH[/VARIANT]") is the one wanted (variant is compared only if wanted)
+func MatchArchitecture(arch, wanted string) bool {
+	return arch == wanted || (!strings.Contains(wanted, "/") && strings.HasPrefix(arch, wanted+"/"))
+}
+
+// ParseContent parses manifest document data served by registry with media type specified
+// (media type passed is used only when document does not specify it on its own)
+func ParseContent(mediaType string, data []byte) (*Content, error) {
+	var c Content
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+
+	if c.MediaType == "" {
+		c.MediaType = mediaType
+	}
+
+	if c.MediaType == "" && c.Manifests != nil {
+		c.MediaType = MediaTypeOCIIndex
+	}
+
+	if c.MediaType == "" && c.IsSchema1() {
+		c.MediaType = MediaTypeDockerV1Signed
+	}
+
+	return &c, nil
+}
+
 // Manifest is an additional tag information presented by some registries (e.g. GCR)
 type Manifest struct {
 	ID             string
@@ -14,13 +372,38 @@ type Manifest struct {
 	TimeUploaded   int64
 }
 
-// Created gets image/tag creation date
-func (m Manifest) Created() int64 {
-	if m.TimeCreated != 0 {
-		return m.TimeCreated
+// createdLayouts are timestamp layouts we could meet in "created" field of image configs, built with varied tooling
+// NB! Timestamps without time zone are taken as UTC ones.
+var createdLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ParseCreated parses image creation timestamp, tolerating its variants: RFC3339 with or without fractional seconds,
+// with or without time zone (UTC is assumed then), with space instead of "T" or in the form of Go time.Time.String()
+func ParseCreated(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > 10 && (s[10] == 't' || s[10] == 'T') {
+		s = s[:10] + "T" + strings.Replace(s[11:], "z", "Z", 1)
 	}
 
-	return m.TimeUploaded
+	for _, layout := range createdLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unsupported creation timestamp: %q", s)
+}
+
+// Created gets image creation date
+// NB! Upload date is never used here, as it is the date image was pushed (e.g. mirrored), not created.
+func (m Manifest) Created() int64 {
+	return m.TimeCreated
 }
 
 // Raw embodies raw, unprocessed manifest structure
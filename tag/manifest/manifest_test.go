@@ -0,0 +1,338 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+var indexFile = "../../fixtures/manifest/index.json"
+
+var schema1File = "../../fixtures/manifest/schema1.json"
+
+var createdFile = "../../fixtures/manifest/created.json"
+
+func TestParsePlatform(t *testing.T) {
+	examples := map[string]Platform{
+		"linux/amd64":  {OS: "linux", Architecture: "amd64"},
+		"linux/arm/v7": {OS: "linux", Architecture: "arm", Variant: "v7"},
+		"":             DefaultPlatform(),
+	}
+
+	for s, expected := range examples {
+		p, err := ParsePlatform(s)
+		if err != nil {
+			t.Fatalf("Unable to parse platform '%s': %s", s, err.Error())
+		}
+
+		if p != expected {
+			t.Fatalf("Unexpected platform parsed from '%s': %+v (expected: %+v)", s, p, expected)
+		}
+	}
+
+	for _, s := range []string{"linux", "linux/", "/amd64", "linux/arm/v7/x"} {
+		if _, err := ParsePlatform(s); err == nil {
+			t.Fatalf("Expected to fail while parsing invalid platform: %s", s)
+		}
+	}
+}
+
+func TestDefaultPlatform_NonLinuxHost(t *testing.T) {
+	examples := map[[2]string]Platform{
+		{"linux", "amd64"}:   {OS: "linux", Architecture: "amd64"},
+		{"darwin", "arm64"}:  {OS: "linux", Architecture: "arm64"},
+		{"windows", "amd64"}: {OS: "linux", Architecture: "amd64"},
+	}
+
+	for host, expected := range examples {
+		if p := hostPlatform(host[0], host[1]); p != expected {
+			t.Fatalf("Unexpected default platform for %s/%s host: %+v (expected: %+v)", host[0], host[1], p, expected)
+		}
+	}
+
+	if p := DefaultPlatform(); p.OS != "linux" {
+		t.Fatalf("Expected default platform to be a linux one, got: %+v", p)
+	}
+}
+
+func TestSelectManifest(t *testing.T) {
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf("Error while reading '%s': %s", indexFile, err.Error())
+	}
+
+	c, err := ParseContent("", data)
+	if err != nil {
+		t.Fatalf("Error while parsing '%s': %s", indexFile, err.Error())
+	}
+
+	if !c.IsIndex() {
+		t.Fatalf("Expected '%s' to be parsed as manifest index", indexFile)
+	}
+
+	examples := map[string]string{
+		"linux/amd64":    "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		"linux/arm/v7":   "sha256:3333333333333333333333333333333333333333333333333333333333333333",
+		"linux/arm":      "sha256:2222222222222222222222222222222222222222222222222222222222222222",
+		"linux/arm64":    "sha256:4444444444444444444444444444444444444444444444444444444444444444",
+		"linux/s390x":    "",
+		"windows/amd64":  "",
+		"linux/arm64/v9": "",
+	}
+
+	for s, expected := range examples {
+		p, _ := ParsePlatform(s)
+
+		digest := ""
+		if d := c.SelectManifest(p); d != nil {
+			digest = d.Digest
+		}
+
+		if digest != expected {
+			t.Fatalf("Unexpected manifest selected for platform '%s': '%s' (expected: '%s')", s, digest, expected)
+		}
+	}
+}
+
+func TestArchitectures(t *testing.T) {
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf("Error while reading '%s': %s", indexFile, err.Error())
+	}
+
+	c, err := ParseContent("", data)
+	if err != nil {
+		t.Fatalf("Error while parsing '%s': %s", indexFile, err.Error())
+	}
+
+	c.Manifests = append(c.Manifests, Descriptor{Platform: &Platform{OS: "unknown", Architecture: "unknown"}})
+
+	archs := strings.Join(c.Architectures(), ",")
+	if archs != "amd64,arm/v6,arm/v7,arm64/v8" {
+		t.Fatalf("Unexpected architectures: '%s'", archs)
+	}
+
+	examples := map[string]bool{
+		"amd64":    true,
+		"arm64":    true,
+		"arm64/v8": true,
+		"arm/v7":   true,
+		"arm":      true,
+		"arm64/v9": false,
+		"s390x":    false,
+		"amd":      false,
+	}
+
+	for wanted, expected := range examples {
+		matched := false
+		for _, arch := range c.Architectures() {
+			if MatchArchitecture(arch, wanted) {
+				matched = true
+			}
+		}
+
+		if matched != expected {
+			t.Fatalf("Unexpected match of architecture '%s': %v (expected: %v)", wanted, matched, expected)
+		}
+	}
+}
+
+func TestParseAnnotation(t *testing.T) {
+	examples := map[string]*Annotation{
+		"org.opencontainers.image.ref.name=slim": {Key: "org.opencontainers.image.ref.name", Value: "slim"},
+		"variant=a=b":                            {Key: "variant", Value: "a=b"},
+		"variant=":                               {Key: "variant", Value: ""},
+	}
+
+	for s, expected := range examples {
+		a, err := ParseAnnotation(s)
+		if err != nil {
+			t.Fatalf("Unable to parse annotation '%s': %s", s, err.Error())
+		}
+
+		if *a != *expected {
+			t.Fatalf("Unexpected annotation parsed from '%s': %+v (expected: %+v)", s, a, expected)
+		}
+	}
+
+	if a, err := ParseAnnotation(""); a != nil || err != nil {
+		t.Fatalf("Expected no annotation and no error for empty string, got: %+v / %v", a, err)
+	}
+
+	for _, s := range []string{"variant", "=slim"} {
+		if _, err := ParseAnnotation(s); err == nil {
+			t.Fatalf("Expected to fail while parsing invalid annotation: %s", s)
+		}
+	}
+}
+
+func TestSelectManifestByAnnotation(t *testing.T) {
+	data, err := ioutil.ReadFile(indexFile)
+	if err != nil {
+		t.Fatalf("Error while reading '%s': %s", indexFile, err.Error())
+	}
+
+	c, err := ParseContent("", data)
+	if err != nil {
+		t.Fatalf("Error while parsing '%s': %s", indexFile, err.Error())
+	}
+
+	examples := map[string]string{
+		"org.opencontainers.image.ref.name=armv7":   "sha256:3333333333333333333333333333333333333333333333333333333333333333",
+		"org.opencontainers.image.ref.name=arm64v8": "sha256:4444444444444444444444444444444444444444444444444444444444444444",
+		"org.opencontainers.image.ref.name=s390x":   "",
+		"variant=armv7": "",
+	}
+
+	for s, expected := range examples {
+		a, _ := ParseAnnotation(s)
+
+		digest := ""
+		if d := c.SelectManifestByAnnotation(*a); d != nil {
+			digest = d.Digest
+		}
+
+		if digest != expected {
+			t.Fatalf("Unexpected manifest selected for annotation '%s': '%s' (expected: '%s')", s, digest, expected)
+		}
+	}
+}
+
+func TestSchema1Digest(t *testing.T) {
+	const expected = "sha256:fac05af875df794db016fd83c3ad45f6605e96e096c5101ac794e7178a7b78f7"
+
+	data, err := ioutil.ReadFile(schema1File)
+	if err != nil {
+		t.Fatalf("Error while reading '%s': %s", schema1File, err.Error())
+	}
+
+	c, err := ParseContent("", data)
+	if err != nil {
+		t.Fatalf("Error while parsing '%s': %s", schema1File, err.Error())
+	}
+
+	if !c.IsSchema1() || c.Config != nil || len(c.FSLayers) != 1 {
+		t.Fatalf("Expected '%s' to be parsed as schema1 manifest with one layer: %+v", schema1File, c)
+	}
+
+	if !IsSchema1MediaType(c.MediaType) {
+		t.Fatalf("Unexpected media type for schema1 manifest: %s", c.MediaType)
+	}
+
+	digest, err := Schema1Digest(data)
+	if err != nil {
+		t.Fatalf("Unable to calculate digest of '%s': %s", schema1File, err.Error())
+	}
+
+	if digest != expected {
+		t.Fatalf("Unexpected schema1 manifest digest: %s (expected: %s)", digest, expected)
+	}
+
+	if _, err := Schema1Digest([]byte("not a manifest")); err == nil {
+		t.Fatalf("Expected to fail while calculating digest of invalid manifest")
+	}
+}
+
+func TestGetArtifactType(t *testing.T) {
+	examples := map[string]Content{
+		"": {Config: &Descriptor{MediaType: MediaTypeDockerConfig}},
+		"application/vnd.cncf.helm.config.v1+json": {Config: &Descriptor{MediaType: "application/vnd.cncf.helm.config.v1+json"}},
+		"application/vnd.wasm.config.v0+json":      {Config: &Descriptor{MediaType: "application/vnd.wasm.config.v0+json"}},
+		"application/spdx+json":                    {ArtifactType: "application/spdx+json", Config: &Descriptor{MediaType: "application/vnd.oci.empty.v1+json"}},
+	}
+
+	for expected, c := range examples {
+		if c.GetArtifactType() != expected {
+			t.Fatalf("Unexpected artifact type: %s (expected: %s)", c.GetArtifactType(), expected)
+		}
+	}
+
+	for _, c := range []Content{{}, {Config: &Descriptor{MediaType: MediaTypeOCIConfig}}, {SchemaVersion: 1}} {
+		if c.GetArtifactType() != "" {
+			t.Fatalf("Image manifest treated as an artifact: %+v", c)
+		}
+	}
+}
+
+func TestBlobs(t *testing.T) {
+	c := Content{
+		Config: &Descriptor{Digest: "sha256:config", Size: 100},
+		Layers: []Descriptor{{Digest: "sha256:base", Size: 1000}, {Digest: "sha256:app", Size: 500}},
+	}
+
+	blobs := c.Blobs()
+	if len(blobs) != 3 || blobs["sha256:config"] != 100 || blobs["sha256:base"] != 1000 || blobs["sha256:app"] != 500 {
+		t.Fatalf("Unexpected blobs: %+v", blobs)
+	}
+
+	if c.ImageSize() != 1600 {
+		t.Fatalf("Unexpected image size: %d (expected: 1600)", c.ImageSize())
+	}
+
+	if blobs := (Content{SchemaVersion: 1}).Blobs(); blobs != nil {
+		t.Fatalf("Expected no blobs for manifest with no config and layers, got: %+v", blobs)
+	}
+}
+
+func TestLayerCount(t *testing.T) {
+	examples := map[int]Content{
+		0: {},
+		2: {Layers: []Descriptor{{Digest: "sha256:base"}, {Digest: "sha256:app"}}},
+		3: {SchemaVersion: 1, FSLayers: []FSLayer{{BlobSum: "sha256:a"}, {BlobSum: "sha256:b"}, {BlobSum: "sha256:a"}}},
+	}
+
+	for expected, c := range examples {
+		if c.LayerCount() != expected {
+			t.Fatalf("Unexpected layer count: %d (expected: %d)", c.LayerCount(), expected)
+		}
+	}
+}
+
+func TestIsForeign(t *testing.T) {
+	foreign := []Descriptor{
+		{MediaType: MediaTypeDockerForeignLayer},
+		{MediaType: MediaTypeOCIForeignLayer + "+gzip"},
+		{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", URLs: []string{"https://mcr.microsoft.com/v2/blob"}},
+	}
+
+	for _, d := range foreign {
+		if !d.IsForeign() {
+			t.Fatalf("Foreign layer not detected: %+v", d)
+		}
+	}
+
+	if (Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"}).IsForeign() {
+		t.Fatalf("Regular layer detected as a foreign one")
+	}
+}
+
+func TestParseCreated(t *testing.T) {
+	data, err := ioutil.ReadFile(createdFile)
+	if err != nil {
+		t.Fatalf("Error while reading '%s': %s", createdFile, err.Error())
+	}
+
+	var examples map[string]string
+	if err := json.Unmarshal(data, &examples); err != nil {
+		t.Fatalf("Error while parsing '%s': %s", createdFile, err.Error())
+	}
+
+	for s, expected := range examples {
+		created, err := ParseCreated(s)
+		if err != nil {
+			t.Fatalf("Unable to parse creation timestamp '%s': %s", s, err.Error())
+		}
+
+		if created.Truncate(time.Second).Format(time.RFC3339) != expected {
+			t.Fatalf("Unexpected time parsed from '%s': %v (expected: %s)", s, created, expected)
+		}
+	}
+
+	for _, s := range []string{"", "yesterday", "2016-01-01", "1451606400"} {
+		if _, err := ParseCreated(s); err == nil {
+			t.Fatalf("Expected to fail while parsing unsupported creation timestamp: '%s'", s)
+		}
+	}
+}
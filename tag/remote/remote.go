@@ -1,6 +1,9 @@
 package remote
 
 import (
+	"context"
+	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -8,7 +11,10 @@ import (
 	"github.com/ivanilves/lstags/tag"
 	"github.com/ivanilves/lstags/tag/manifest"
 
+	log "github.com/sirupsen/logrus"
+
 	"github.com/ivanilves/lstags/api/v1/registry/client"
+	"github.com/ivanilves/lstags/api/v1/registry/hub"
 )
 
 // ConcurrentRequests defines maximum number of concurrent requests we could maintain against the registry
@@ -26,6 +32,36 @@ var RetryDelay = 5 * time.Second
 // TraceRequests defines if we should print out HTTP request URLs and response headers/bodies
 var TraceRequests = false
 
+// MaxTags limits number of tags we fetch per repository to the newest ones (0 means no limit)
+var MaxTags = 0
+
+// Platform is used to pick image from multi-arch tags (e.g. to get their creation dates)
+var Platform = manifest.DefaultPlatform()
+
+// Annotation is used to pick image from multi-arch tags instead of platform, if set (See manifest.Annotation)
+var Annotation *manifest.Annotation
+
+// FetchSizes defines if we should get image sizes from manifests (costs us an extra request per tag)
+var FetchSizes = false
+
+// FetchBlobs defines if we should get sizes of image blobs (config and layers) from manifests (costs us an extra request per tag)
+var FetchBlobs = false
+
+// FetchLayers defines if we should get number of image layers of multi-arch tags too (costs us an extra request per tag)
+var FetchLayers = false
+
+// MaxManifestBytes limits size of manifests and image configs we read from registry (0 means client.DefaultMaxManifestBytes)
+var MaxManifestBytes int64
+
+// UseHubAPI defines if we should list Docker Hub repositories through the Hub API (falls back to the registry API on failure)
+var UseHubAPI = false
+
+// AuthRegistries maps registries we connect to (e.g. pull-through mirrors) to registry identities used for token scopes
+var AuthRegistries = map[string]string{}
+
+// ScopedCredentials gives us credentials to request tokens of particular scopes with (See client.Config.ScopedCredentials)
+var ScopedCredentials func(ctx context.Context, registry, scope, username, password string) (string, string)
+
 func calculateBatchSteps(count, limit int) (int, int) {
 	total := count / limit
 	remain := count % limit
@@ -45,27 +81,301 @@ func calculateBatchStepSize(stepNumber, stepsTotal, remain, limit int) int {
 	return limit
 }
 
-// FetchTags looks up Docker repoPath tags present on remote Docker registry
-func FetchTags(repo *repository.Repository, username, password string) (map[string]*tag.Tag, error) {
-	cli, err := client.New(
-		repo.Registry(),
-		client.Config{
-			ConcurrentRequests: ConcurrentRequests,
-			WaitBetween:        WaitBetween,
-			RetryRequests:      RetryRequests,
-			RetryDelay:         RetryDelay,
-			TraceRequests:      TraceRequests,
-			IsInsecure:         !repo.IsSecure(),
-		},
-	)
+func getClientConfig(registry string, isSecure bool) client.Config {
+	return client.Config{
+		ConcurrentRequests: ConcurrentRequests,
+		WaitBetween:        WaitBetween,
+		RetryRequests:      RetryRequests,
+		RetryDelay:         RetryDelay,
+		TraceRequests:      TraceRequests,
+		IsInsecure:         !isSecure,
+		Platform:           Platform,
+		Annotation:         Annotation,
+		FetchSizes:         FetchSizes,
+		FetchBlobs:         FetchBlobs,
+		FetchLayers:        FetchLayers,
+		MaxManifestBytes:   MaxManifestBytes,
+		AuthRegistry:       AuthRegistries[registry],
+		ScopedCredentials:  ScopedCredentials,
+	}
+}
+
+func newClient(ctx context.Context, registry string, isSecure bool, username, password string) (*client.RegistryClient, error) {
+	cli, err := client.New(registry, getClientConfig(registry, isSecure))
 	if err != nil {
 		return nil, err
 	}
+	cli = cli.WithContext(ctx)
 
 	if err := cli.Login(username, password); err != nil {
 		return nil, err
 	}
 
+	return cli, nil
+}
+
+// selectNewestTagNames keeps only "limit" newest tag names, if registry gave us creation dates for all of them
+// along with the tag list (e.g. GCR does this), so we do not need to fetch details of older tags at all
+func selectNewestTagNames(tagNames []string, tagManifests map[string]manifest.Manifest, limit int) []string {
+	if limit <= 0 || len(tagNames) <= limit {
+		return tagNames
+	}
+
+	for _, tagName := range tagNames {
+		if tagManifests[tagName].Created() == 0 {
+			return tagNames
+		}
+	}
+
+	sortedTagNames := make([]string, len(tagNames))
+	copy(sortedTagNames, tagNames)
+
+	sort.SliceStable(sortedTagNames, func(i, j int) bool {
+		ci := tagManifests[sortedTagNames[i]].Created()
+		cj := tagManifests[sortedTagNames[j]].Created()
+
+		if ci != cj {
+			return ci < cj
+		}
+
+		return sortedTagNames[i] < sortedTagNames[j]
+	})
+
+	return sortedTagNames[len(sortedTagNames)-limit:]
+}
+
+// VerifyCredentials checks if remote Docker registry accepts credentials passed
+func VerifyCredentials(ctx context.Context, registry, username, password string) error {
+	cli, err := client.New(registry, getClientConfig(registry, repository.IsSecureRegistry(registry)))
+	if err != nil {
+		return err
+	}
+
+	return cli.WithContext(ctx).VerifyCredentials(username, password)
+}
+
+// Ping checks if remote Docker registry is reachable (does not log in)
+func Ping(ctx context.Context, registry string) error {
+	cli, err := client.New(registry, getClientConfig(registry, repository.IsSecureRegistry(registry)))
+	if err != nil {
+		return err
+	}
+
+	return cli.WithContext(ctx).Ping()
+}
+
+// Connect connects and logs in to the remote Docker registry (to work with its content directly)
+func Connect(registry, username, password string) (*client.RegistryClient, error) {
+	return newClient(context.Background(), registry, repository.IsSecureRegistry(registry), username, password)
+}
+
+// ProbeCapabilities checks which optional operations (catalog, delete, referrers) remote Docker registry supports
+func ProbeCapabilities(registry, repoPath, username, password string) (*client.Capabilities, error) {
+	cli, err := newClient(context.Background(), registry, repository.IsSecureRegistry(registry), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.ProbeCapabilities(repoPath)
+}
+
+// FetchDigest gets digest of the repository tag from the remote Docker registry (does not fetch anything else)
+func FetchDigest(ctx context.Context, repo *repository.Repository, tagName, username, password string) (string, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return "", err
+	}
+
+	return cli.ManifestDigest(repo.Path(), tagName)
+}
+
+// ResolveDigest gets digest of whatever manifest the tag references in the remote Docker registry,
+// i.e. of the manifest list/index for multi-arch tags (FetchDigest gives us digest of the image registry picks then)
+func ResolveDigest(ctx context.Context, repo *repository.Repository, tagName, username, password string) (string, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return "", err
+	}
+
+	return cli.ResolveDigest(repo.Path(), tagName)
+}
+
+// FetchSelectedImageDigest gets digest of the image we select (by annotation or platform) from the multi-arch tag,
+// or an empty string, if tag references a single image
+func FetchSelectedImageDigest(ctx context.Context, repo *repository.Repository, tagName, username, password string) (string, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return "", err
+	}
+
+	return cli.SelectedImageDigest(repo.Path(), tagName)
+}
+
+// CountTags counts tags of the repository matched by its reference, without fetching any tag details
+func CountTags(ctx context.Context, repo *repository.Repository, username, password string) (int, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return 0, err
+	}
+
+	var match func(string) bool
+	if repo.HasTags() || repo.Filter() != ".*" {
+		match = repo.MatchTag
+	}
+
+	return cli.CountTags(repo.Path(), match)
+}
+
+// FetchLabels gets labels of the image tagged in the remote Docker registry (taken from the image config)
+func FetchLabels(repo *repository.Repository, tagName, username, password string) (map[string]string, error) {
+	cli, err := newClient(context.Background(), repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.ImageLabels(repo.Path(), tagName)
+}
+
+// FetchArchitectures gets architectures ("ARCH[/VARIANT]") the tag has images for in the remote Docker registry
+func FetchArchitectures(repo *repository.Repository, tagName, username, password string) ([]string, error) {
+	cli, err := newClient(context.Background(), repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.Architectures(repo.Path(), tagName)
+}
+
+// FetchPlatforms gets images the tag has for every platform in the remote Docker registry, with their digests
+func FetchPlatforms(ctx context.Context, repo *repository.Repository, tagName, username, password string) ([]client.PlatformImage, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.Platforms(repo.Path(), tagName)
+}
+
+// FetchTagNames looks up names of the repository tags matched by its reference, without fetching any tag details
+func FetchTagNames(ctx context.Context, repo *repository.Repository, username, password string) ([]string, error) {
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	allTagNames, _, err := cli.TagData(repo.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	tagNames := make([]string, 0)
+	for _, tagName := range allTagNames {
+		if repo.MatchTag(tagName) {
+			tagNames = append(tagNames, tagName)
+		}
+	}
+
+	return tagNames, nil
+}
+
+// FetchRepositories looks up repository paths present in the remote Docker registry catalog
+func FetchRepositories(registry, username, password string) ([]string, error) {
+	cli, err := newClient(context.Background(), registry, repository.IsSecureRegistry(registry), username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return cli.Catalog()
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// getHubTagOptions gives tag options from the Docker Hub API tag, taking image of our platform, if there is one
+// NB! Docker Hub gives us no image creation dates, so we take the date image was pushed at instead.
+func getHubTagOptions(t hub.Tag) (tag.Options, error) {
+	options := tag.Options{
+		Digest:       t.Digest,
+		Created:      unixOrZero(t.LastUpdated),
+		Size:         t.FullSize,
+		LastModified: unixOrZero(t.LastUpdated),
+	}
+
+	if img := t.SelectImage(Platform); img != nil {
+		if options.Digest == "" {
+			options.Digest = img.Digest
+		}
+		if !img.LastPushed.IsZero() {
+			options.Created = img.LastPushed.Unix()
+		}
+		if img.Size != 0 {
+			options.Size = img.Size
+		}
+	}
+
+	if options.Digest == "" {
+		return options, fmt.Errorf("no digest for tag: %s", t.Name)
+	}
+
+	return options, nil
+}
+
+// fetchHubTags looks up Docker Hub repository tags through the Hub API (a single paginated listing, no requests per tag)
+func fetchHubTags(repo *repository.Repository) (map[string]*tag.Tag, error) {
+	hubTags, err := hub.FetchTags(
+		repo.Path(),
+		hub.Config{TraceRequests: TraceRequests, RetryRequests: RetryRequests, RetryDelay: RetryDelay},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]*tag.Tag)
+
+	for _, t := range hubTags {
+		if !repo.MatchTag(t.Name) {
+			continue
+		}
+
+		options, err := getHubTagOptions(t)
+		if err != nil {
+			return nil, err
+		}
+
+		tg, err := tag.New(t.Name, options)
+		if err != nil {
+			return nil, err
+		}
+
+		tags[tg.Name()] = tg
+	}
+
+	return tag.Newest(tags, MaxTags), nil
+}
+
+// FetchTags looks up Docker repoPath tags present on remote Docker registry
+// NB! Docker Hub repositories are listed through the Hub API, if we are configured to use it (see UseHubAPI),
+// unless we select images by annotation (Hub API gives us no annotations).
+func FetchTags(ctx context.Context, repo *repository.Repository, username, password string) (map[string]*tag.Tag, error) {
+	if UseHubAPI && repo.IsDefaultRegistry() && Annotation == nil {
+		tags, err := fetchHubTags(repo)
+		if err == nil {
+			return tags, nil
+		}
+
+		log.Warnf("FALLBACK to registry API for %s (Docker Hub API error: %s)", repo.Path(), err.Error())
+	}
+
+	cli, err := newClient(ctx, repo.Registry(), repo.IsSecure(), username, password)
+	if err != nil {
+		return nil, err
+	}
+
 	allTagNames, allTagManifests, err := cli.TagData(repo.Path())
 	if err != nil {
 		return nil, err
@@ -78,7 +388,10 @@ func FetchTags(repo *repository.Repository, username, password string) (map[stri
 		}
 	}
 
+	tagNames = selectNewestTagNames(tagNames, allTagManifests, MaxTags)
+
 	tags := make(map[string]*tag.Tag)
+	failed := make(map[string]error)
 
 	batchSteps, batchRemain := calculateBatchSteps(len(tagNames), ConcurrentRequests)
 
@@ -88,8 +401,9 @@ func FetchTags(repo *repository.Repository, username, password string) (map[stri
 		stepSize = calculateBatchStepSize(b, batchSteps, batchRemain, ConcurrentRequests)
 
 		type response struct {
-			Tag *tag.Tag
-			Err error
+			TagName string
+			Tag     *tag.Tag
+			Err     error
 		}
 
 		rc := make(chan response, stepSize)
@@ -103,7 +417,7 @@ func FetchTags(repo *repository.Repository, username, password string) (map[stri
 			) {
 				tg, err := cli.Tag(repo.Path(), tagName, tagManifest)
 
-				rc <- response{Tag: tg, Err: err}
+				rc <- response{TagName: tagName, Tag: tg, Err: err}
 			}(repo, tagNames[tagIndex], allTagManifests[tagNames[tagIndex]], rc)
 
 			tagIndex++
@@ -115,7 +429,9 @@ func FetchTags(repo *repository.Repository, username, password string) (map[stri
 		for r := range rc {
 			if r.Err != nil {
 				if !strings.Contains(r.Err.Error(), "404 Not Found") {
-					return nil, r.Err
+					log.Warnf("FAILED to fetch details of %s:%s: %s", repo.Path(), r.TagName, r.Err.Error())
+
+					failed[r.TagName] = r.Err
 				}
 			} else {
 				tags[r.Tag.Name()] = r.Tag
@@ -129,5 +445,16 @@ func FetchTags(repo *repository.Repository, username, password string) (map[stri
 		}
 	}
 
-	return tags, nil
+	// a single broken tag does not sink the whole repository, but repository with all tags broken is broken itself
+	if len(tags) == 0 {
+		for _, err := range failed {
+			return nil, err
+		}
+	}
+
+	for tagName, err := range failed {
+		tags[tagName] = tag.NewFailed(tagName, tag.Options{Created: allTagManifests[tagName].Created()}, err)
+	}
+
+	return tag.Newest(tags, MaxTags), nil
 }
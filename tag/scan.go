@@ -0,0 +1,29 @@
+package tag
+
+// ScanResult is a summary of the image vulnerability scan, e.g. one Trivy or Grype gives us
+type ScanResult struct {
+	// Scanner is a name (and maybe a version) of the scanner image was scanned by, e.g. "trivy 0.50.1"
+	Scanner string
+	// Severities maps severity (e.g. "CRITICAL", "HIGH", "MEDIUM") to number of vulnerabilities of it found
+	Severities map[string]int
+}
+
+// Total gives us number of vulnerabilities found (of all severities)
+func (r *ScanResult) Total() int {
+	var total int
+	for _, n := range r.Severities {
+		total += n
+	}
+
+	return total
+}
+
+// SetScanResult attaches vulnerability scan result to the tag
+func (tg *Tag) SetScanResult(r *ScanResult) {
+	tg.scan = r
+}
+
+// GetScanResult gets vulnerability scan result of the tag (nil means tag was not scanned)
+func (tg *Tag) GetScanResult() *ScanResult {
+	return tg.scan
+}
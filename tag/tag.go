@@ -14,18 +14,33 @@ import (
 
 // Tag aggregates tag-related information: tag name, image digest etc
 type Tag struct {
-	name    string
-	digest  string
-	imageID string
-	created int64
-	state   string
+	name         string
+	digest       string
+	imageID      string
+	created      int64
+	size         int64
+	layerCount   int
+	blobs        map[string]int64
+	state        string
+	artifactType string
+	lastPulled   int64
+	lastModified int64
+	captures     map[string]string
+	scan         *ScanResult
+	err          error
 }
 
 // Options holds optional parameters for Tag creation
 type Options struct {
-	Digest  string
-	ImageID string
-	Created int64
+	Digest       string
+	ImageID      string
+	Created      int64
+	Size         int64
+	LayerCount   int
+	Blobs        map[string]int64
+	ArtifactType string
+	LastPulled   int64
+	LastModified int64
 }
 
 // SortKey returns a sort key (used to sort tags before process or display them)
@@ -96,6 +111,16 @@ func (tg *Tag) GetState() string {
 	return tg.state
 }
 
+// GetArtifactType gets type of the OCI artifact (e.g. Helm chart) tag references, or "", if it references an image
+func (tg *Tag) GetArtifactType() string {
+	return tg.artifactType
+}
+
+// IsImage tells us if tag references a (runnable) image, not some other OCI artifact
+func (tg *Tag) IsImage() bool {
+	return tg.artifactType == ""
+}
+
 // NeedsPull tells us if tag/image needs pull
 func (tg *Tag) NeedsPull() bool {
 	if tg.state == "ABSENT" || tg.state == "CHANGED" {
@@ -119,6 +144,21 @@ func (tg *Tag) GetCreated() int64 {
 	return tg.created
 }
 
+// GetSize gets image size in bytes (0 means we do not know it)
+func (tg *Tag) GetSize() int64 {
+	return tg.size
+}
+
+// GetLayerCount gets number of image layers (0 means we do not know it)
+func (tg *Tag) GetLayerCount() int {
+	return tg.layerCount
+}
+
+// GetBlobs gets sizes of image config and layers by their digests (nil means we do not know them)
+func (tg *Tag) GetBlobs() map[string]int64 {
+	return tg.blobs
+}
+
 // GetCreatedKey gets image creation timestamp in a string form (for a string sort e.g.)
 func (tg *Tag) GetCreatedKey() string {
 	return strconv.FormatInt(tg.created, 10)
@@ -133,6 +173,42 @@ func (tg *Tag) GetCreatedString() string {
 	return p[0]
 }
 
+// formatOptionalTimestamp formats timestamp just like GetCreatedString does, but gives "n/a" for unknown (zero) one
+func formatOptionalTimestamp(ts int64) string {
+	if ts == 0 {
+		return "n/a"
+	}
+
+	s := time.Unix(ts, 0).Format(time.RFC3339)
+
+	return strings.Split(s, "+")[0]
+}
+
+// setLastPulled sets timestamp of the time image was last pulled to the Docker daemon
+func (tg *Tag) setLastPulled(ts int64) {
+	tg.lastPulled = ts
+}
+
+// GetLastPulled gets timestamp of the time image was last pulled to the Docker daemon (0 means we do not know it)
+func (tg *Tag) GetLastPulled() int64 {
+	return tg.lastPulled
+}
+
+// GetLastPulledString gets last pull timestamp in a human-readable string form
+func (tg *Tag) GetLastPulledString() string {
+	return formatOptionalTimestamp(tg.lastPulled)
+}
+
+// GetLastModified gets timestamp of the last tag modification reported by registry (0 means we do not know it)
+func (tg *Tag) GetLastModified() int64 {
+	return tg.lastModified
+}
+
+// GetLastModifiedString gets last modification timestamp in a human-readable string form
+func (tg *Tag) GetLastModifiedString() string {
+	return formatOptionalTimestamp(tg.lastModified)
+}
+
 // New creates a new instance of Tag
 func New(name string, options Options) (*Tag, error) {
 	if name == "" {
@@ -144,10 +220,16 @@ func New(name string, options Options) (*Tag, error) {
 	}
 
 	return &Tag{
-			name:    name,
-			digest:  options.Digest,
-			imageID: cutImageID(options.ImageID),
-			created: options.Created,
+			name:         name,
+			digest:       options.Digest,
+			imageID:      cutImageID(options.ImageID),
+			created:      options.Created,
+			size:         options.Size,
+			layerCount:   options.LayerCount,
+			blobs:        options.Blobs,
+			artifactType: options.ArtifactType,
+			lastPulled:   options.LastPulled,
+			lastModified: options.LastModified,
 		},
 		nil
 }
@@ -156,6 +238,10 @@ func calculateState(name string, remoteTags, localTags map[string]*Tag) string {
 	r, definedInRegistry := remoteTags[name]
 	l, definedLocally := localTags[name]
 
+	if (definedInRegistry && r.GetError() != nil) || (definedLocally && l.GetError() != nil) {
+		return "ERROR"
+	}
+
 	if definedInRegistry && !definedLocally {
 		return "ABSENT"
 	}
@@ -175,6 +261,24 @@ func calculateState(name string, remoteTags, localTags map[string]*Tag) string {
 	return "NOT_FOUND"
 }
 
+// NewFailed creates a new instance of Tag we failed to get details of, keeping whatever we know about it (partial data)
+// together with the error, so a single broken tag does not sink the whole repository. Unknown digest is set to "n/a".
+func NewFailed(name string, options Options, err error) *Tag {
+	if options.Digest == "" {
+		options.Digest = "n/a"
+	}
+
+	tg, _ := New(name, options)
+	tg.err = err
+
+	return tg
+}
+
+// GetError gets error we got while fetching tag details (nil means we got them all)
+func (tg *Tag) GetError() error {
+	return tg.err
+}
+
 // Join joins local tags with ones from registry, performs state processing and returns:
 // * sorted slice of sort keys
 // * joined map of [sortKey]name
@@ -198,6 +302,7 @@ func Join(
 		ltg, defined := localTags[name]
 		if defined && ltg.HasImageID() {
 			joinedTags[name].setImageID(ltg.GetImageID())
+			joinedTags[name].setLastPulled(ltg.GetLastPulled())
 		} else {
 			joinedTags[name].setImageID("n/a")
 		}
@@ -246,6 +351,35 @@ func Join(
 	return sortedKeys, tagNames, joinedTags
 }
 
+// Newest keeps only "limit" newest tags from the map passed (by image creation date, then by tag name)
+// Zero or negative limit means no limit at all, i.e. we just return all the tags passed.
+func Newest(tags map[string]*Tag, limit int) map[string]*Tag {
+	if limit <= 0 || len(tags) <= limit {
+		return tags
+	}
+
+	sortedKeys := make([]string, 0, len(tags))
+	tagNames := make(map[string]string)
+
+	for name, tg := range tags {
+		sortKey := tg.SortKey()
+
+		sortedKeys = append(sortedKeys, sortKey)
+		tagNames[sortKey] = name
+	}
+
+	sort.Strings(sortedKeys)
+
+	newest := make(map[string]*Tag)
+	for _, key := range sortedKeys[len(sortedKeys)-limit:] {
+		name := tagNames[key]
+
+		newest[name] = tags[name]
+	}
+
+	return newest
+}
+
 // Collect organizes tags structures the way they could be used by API
 func Collect(keys []string, tagNames map[string]string, tagMap map[string]*Tag) []*Tag {
 	tags := make([]*Tag, len(keys))
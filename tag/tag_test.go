@@ -3,6 +3,7 @@ package tag
 import (
 	"testing"
 
+	"errors"
 	"strconv"
 	"strings"
 	"time"
@@ -382,3 +383,94 @@ func TestCreated(t *testing.T) {
 		)
 	}
 }
+
+func TestNewest(t *testing.T) {
+	tags := make(map[string]*Tag)
+
+	for name, created := range map[string]int64{"v1": 1500000000, "v2": 1500000300, "v3": 1500000200, "latest": 1500000300} {
+		tags[name], _ = New(name, Options{Digest: "sha256:" + name, Created: created})
+	}
+
+	var testCases = map[int][]string{
+		0:  {"latest", "v1", "v2", "v3"},
+		-1: {"latest", "v1", "v2", "v3"},
+		1:  {"v2"},
+		2:  {"latest", "v2"},
+		3:  {"latest", "v2", "v3"},
+		10: {"latest", "v1", "v2", "v3"},
+	}
+
+	for limit, expected := range testCases {
+		newest := Newest(tags, limit)
+
+		if len(newest) != len(expected) {
+			t.Fatalf("Unexpected number of tags for limit %d: %d (expected %d)", limit, len(newest), len(expected))
+		}
+
+		for _, name := range expected {
+			if _, defined := newest[name]; !defined {
+				t.Fatalf("Tag '%s' should be kept for limit %d", name, limit)
+			}
+		}
+	}
+}
+
+func TestJoin_LastPulled(t *testing.T) {
+	const lastPulled = 1500000000
+
+	remoteTags := map[string]*Tag{}
+	remoteTags["latest"], _ = New("latest", Options{Digest: "sha256:latest", LastModified: lastPulled + 300})
+	remoteTags["v1"], _ = New("v1", Options{Digest: "sha256:v1"})
+
+	localTags := map[string]*Tag{}
+	localTags["latest"], _ = New("latest", Options{Digest: "sha256:latest", ImageID: "sha256:0123456789abcdef", LastPulled: lastPulled})
+
+	_, _, tags := Join(remoteTags, localTags, nil)
+
+	if tags["latest"].GetLastPulled() != lastPulled {
+		t.Fatalf("unexpected last pull timestamp: %d (expected: %d)", tags["latest"].GetLastPulled(), lastPulled)
+	}
+
+	expectedString := strings.Split(time.Unix(lastPulled, 0).Format(time.RFC3339), "+")[0]
+	if tags["latest"].GetLastPulledString() != expectedString {
+		t.Fatalf("unexpected last pull time: %s (expected: %s)", tags["latest"].GetLastPulledString(), expectedString)
+	}
+
+	if tags["latest"].GetLastModified() != lastPulled+300 {
+		t.Fatalf("unexpected last modification timestamp: %d", tags["latest"].GetLastModified())
+	}
+
+	if tags["v1"].GetLastPulledString() != "n/a" || tags["v1"].GetLastModifiedString() != "n/a" {
+		t.Fatalf("unknown timestamps should be shown as n/a")
+	}
+}
+
+func TestJoin_State_WithFailedTags(t *testing.T) {
+	remoteTags := getRemoteTags()
+	remoteTags["v1.4"] = NewFailed("v1.4", Options{Created: 1500000000}, errors.New("500 Internal Server Error"))
+	remoteTags["v1.2"] = NewFailed("v1.2", Options{}, errors.New("500 Internal Server Error"))
+
+	_, _, tags := Join(remoteTags, getLocalTags(), nil)
+
+	for _, name := range []string{"v1.4", "v1.2"} {
+		if tags[name].GetState() != "ERROR" {
+			t.Fatalf("Unexpected state [%s]: %s (expected: ERROR)", name, tags[name].GetState())
+		}
+
+		if tags[name].GetError() == nil {
+			t.Fatalf("Failed tag should carry its error: %s", name)
+		}
+
+		if tags[name].NeedsPull() || tags[name].NeedsPush(true) {
+			t.Fatalf("Failed tag should never be pulled or pushed: %s", name)
+		}
+	}
+
+	if tags["v1.4"].GetDigest() != "n/a" || tags["v1.4"].GetCreated() != 1500000000 {
+		t.Fatalf("Failed tag should keep partial data: %s / %d", tags["v1.4"].GetDigest(), tags["v1.4"].GetCreated())
+	}
+
+	if tags["v1.3.2"].GetState() != "PRESENT" || tags["v1.3.2"].GetError() != nil {
+		t.Fatalf("Failed tags should not affect other ones")
+	}
+}
@@ -0,0 +1,91 @@
+// Package health serves health and readiness probes (e.g. for Kubernetes) of a long-running (daemon mode) process
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Status keeps outcome of the last sync (poll) and checks readiness of the process on demand
+// NB! Process is not ready until it completes its first sync.
+type Status struct {
+	check   func() error
+	synced  bool
+	lastErr error
+	mux     sync.Mutex
+}
+
+// New creates a new Status, check passed (e.g. if registries are reachable) is run on every readiness probe, if not nil
+func New(check func() error) *Status {
+	return &Status{check: check}
+}
+
+// Synced records outcome of the sync just completed (failed, if error passed is not nil)
+func (s *Status) Synced(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.synced = true
+	s.lastErr = err
+}
+
+// Healthy gives us an error of the last sync, if it failed
+func (s *Status) Healthy() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.lastErr != nil {
+		return fmt.Errorf("last sync failed: %s", s.lastErr.Error())
+	}
+
+	return nil
+}
+
+// Ready gives us an error, if process did not complete its first sync yet, last sync failed or check fails
+func (s *Status) Ready() error {
+	s.mux.Lock()
+	synced := s.synced
+	s.mux.Unlock()
+
+	if !synced {
+		return fmt.Errorf("not synced yet")
+	}
+
+	if err := s.Healthy(); err != nil {
+		return err
+	}
+
+	if s.check != nil {
+		return s.check()
+	}
+
+	return nil
+}
+
+// Handler serves "/healthz" (see Healthy) and "/readyz" (see Ready) probes: "200 OK" or "503 Service Unavailable" with an error
+func (s *Status) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, s.Healthy())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		respond(w, s.Ready())
+	})
+
+	return mux
+}
+
+func respond(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err.Error())
+
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
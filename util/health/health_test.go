@@ -0,0 +1,60 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(s *Status, path string) (int, string) {
+	w := httptest.NewRecorder()
+
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+	return w.Code, w.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var checkErr error
+
+	s := New(func() error { return checkErr })
+
+	code, _ := probe(s, "/healthz")
+	assert.Equal(http.StatusOK, code, "should be healthy before the first sync")
+
+	code, body := probe(s, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code, "should NOT be ready before the first sync")
+	assert.Equal("not synced yet\n", body)
+
+	s.Synced(nil)
+
+	code, _ = probe(s, "/readyz")
+	assert.Equal(http.StatusOK, code, "should be ready after successful sync")
+
+	checkErr = errors.New("registry is not reachable")
+
+	code, body = probe(s, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code, "should NOT be ready, if check fails")
+	assert.Equal("registry is not reachable\n", body)
+
+	code, _ = probe(s, "/healthz")
+	assert.Equal(http.StatusOK, code, "should stay healthy, if only check fails")
+
+	checkErr = nil
+	s.Synced(errors.New("exit code 2"))
+
+	code, body = probe(s, "/healthz")
+	assert.Equal(http.StatusServiceUnavailable, code, "should NOT be healthy after failed sync")
+	assert.Equal("last sync failed: exit code 2\n", body)
+
+	code, _ = probe(s, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code, "should NOT be ready after failed sync")
+
+	code, _ = probe(s, "/nonexistent")
+	assert.Equal(http.StatusNotFound, code)
+}
@@ -0,0 +1,104 @@
+// Package metrics renders metrics in Prometheus text format, e.g. to be picked by node_exporter textfile collector.
+// It has no dependencies: metrics are just collected into a Set and written out at once.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Gauge is the only metric type we expose: every value is the one observed on the last run
+const Gauge = "gauge"
+
+// Set is a set of metric families, written out in the order they were added
+type Set struct {
+	families []*family
+	index    map[string]*family
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// New creates a new (empty) Set
+func New() *Set {
+	return &Set{index: make(map[string]*family)}
+}
+
+// Gauge adds a sample of the gauge, labels are passed as name and value pairs, e.g. "repo", "alpine"
+// NB! Help text is taken from the first sample of the gauge, samples with odd number of labels are not added.
+func (s *Set) Gauge(name, help string, value float64, labels ...string) {
+	if len(labels)%2 != 0 {
+		return
+	}
+
+	f, defined := s.index[name]
+	if !defined {
+		f = &family{name: name, help: help, typ: Gauge}
+		s.index[name] = f
+		s.families = append(s.families, f)
+	}
+
+	f.samples = append(f.samples, sample{labels: labels, value: value})
+}
+
+// Len gives us number of metric families in the set
+func (s *Set) Len() int {
+	return len(s.families)
+}
+
+// WriteTo writes metrics out in Prometheus text format, HELP and TYPE lines go before samples of every family
+func (s *Set) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	for _, f := range s.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.typ)
+
+		for _, smp := range f.samples {
+			b.WriteString(f.name)
+
+			if len(smp.labels) > 0 {
+				pairs := make([]string, 0, len(smp.labels)/2)
+				for i := 0; i < len(smp.labels); i += 2 {
+					pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", smp.labels[i], escapeLabel(smp.labels[i+1])))
+				}
+
+				b.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+
+			b.WriteString(" " + formatValue(smp.value) + "\n")
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+// formatValue gives us whole numbers (e.g. byte counts and timestamps) without exponent, other ones as they are
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
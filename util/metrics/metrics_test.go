@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	assert := assert.New(t)
+
+	s := New()
+	s.Gauge("lstags_tags_total", "Number of tags collected", 3, "repo", "alpine")
+	s.Gauge("lstags_bytes_total", "Size of\nimages", 1234567890123)
+	s.Gauge("lstags_tags_total", "ignored", 1, "repo", `quay.io/"odd"\repo`)
+	s.Gauge("lstags_ratio", "Some ratio", 0.25)
+	s.Gauge("lstags_broken", "Odd labels", 1, "repo")
+
+	var b bytes.Buffer
+	_, err := s.WriteTo(&b)
+
+	assert.Nil(err)
+	assert.Equal(3, s.Len())
+	assert.Equal(`# HELP lstags_tags_total Number of tags collected
+# TYPE lstags_tags_total gauge
+lstags_tags_total{repo="alpine"} 3
+lstags_tags_total{repo="quay.io/\"odd\"\\repo"} 1
+# HELP lstags_bytes_total Size of\nimages
+# TYPE lstags_bytes_total gauge
+lstags_bytes_total 1234567890123
+# HELP lstags_ratio Some ratio
+# TYPE lstags_ratio gauge
+lstags_ratio 0.25
+`, b.String())
+}
@@ -0,0 +1,113 @@
+// Package output gives us a writer for the primary output (tags, reports etc): either stdout or a file replaced atomically,
+// i.e. file is never left truncated: it either has all the output written, or is left as it was.
+package output
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ivanilves/lstags/util/fix"
+)
+
+// Output is a destination of the primary output
+type Output struct {
+	stdout bool
+	path   string
+	tmp    *os.File
+	err    error
+}
+
+// errClosed is returned, if we write output already committed or discarded
+var errClosed = errors.New("output is already committed or discarded")
+
+// Stdout gives us output written to stdout
+func Stdout() *Output {
+	return &Output{stdout: true}
+}
+
+// Open opens output: "" or "-" means stdout, anything else is a path to the file.
+// NB! Data is written to the temporary file beside the one passed, until output is committed.
+func Open(path string) (*Output, error) {
+	if path == "" || path == "-" {
+		return Stdout(), nil
+	}
+
+	path = fix.Path(path)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Output{path: path, tmp: tmp}, nil
+}
+
+// Write implements io.Writer interface (the first write error makes Commit fail)
+func (o *Output) Write(data []byte) (int, error) {
+	if o.stdout {
+		return os.Stdout.Write(data)
+	}
+
+	if o.tmp == nil {
+		return 0, errClosed
+	}
+
+	if o.err != nil {
+		return 0, o.err
+	}
+
+	n, err := o.tmp.Write(data)
+	if err != nil {
+		o.err = err
+	}
+
+	return n, err
+}
+
+// Commit makes data written visible: temporary file is synced and renamed over the output file
+// NB! Output could not be written anymore, once it is committed (or discarded).
+func (o *Output) Commit() error {
+	if o.stdout {
+		return nil
+	}
+
+	if o.tmp == nil {
+		return errClosed
+	}
+
+	tmp := o.tmp
+	o.tmp = nil
+
+	if o.err == nil {
+		o.err = tmp.Chmod(0644)
+	}
+	if o.err == nil {
+		o.err = tmp.Sync()
+	}
+	if err := tmp.Close(); err != nil && o.err == nil {
+		o.err = err
+	}
+	if o.err == nil {
+		o.err = os.Rename(tmp.Name(), o.path)
+	}
+
+	if o.err != nil {
+		os.Remove(tmp.Name())
+	}
+
+	return o.err
+}
+
+// Discard drops data written: temporary file is removed, output file (if any) is left as it was
+func (o *Output) Discard() {
+	if o.tmp == nil {
+		return
+	}
+
+	o.tmp.Close()
+	os.Remove(o.tmp.Name())
+
+	o.tmp = nil
+}
@@ -0,0 +1,88 @@
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "lstags-output")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tags.txt")
+	ioutil.WriteFile(path, []byte("previous output\n"), 0600)
+
+	o, err := Open(path)
+	assert.Nil(err)
+
+	fmt.Fprintf(o, "alpine:3.7\n")
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("previous output\n", string(data), "should not touch output file until output is committed")
+
+	assert.Nil(o.Commit())
+
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal("alpine:3.7\n", string(data))
+
+	info, _ := os.Stat(path)
+	assert.Equal(os.FileMode(0644), info.Mode().Perm())
+
+	_, err = fmt.Fprintf(o, "alpine:3.8\n")
+	assert.NotNil(err, "should not write output already committed")
+	assert.NotNil(o.Commit(), "should not commit output already committed")
+
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(1, len(entries), "should leave no temporary files behind")
+}
+
+func TestOutput_Discard(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _ := ioutil.TempDir("", "lstags-output")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tags.txt")
+	ioutil.WriteFile(path, []byte("previous output\n"), 0644)
+
+	o, err := Open(path)
+	assert.Nil(err)
+
+	fmt.Fprintf(o, "partial")
+	o.Discard()
+
+	data, _ := ioutil.ReadFile(path)
+	assert.Equal("previous output\n", string(data), "should leave output file as it was")
+
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Equal(1, len(entries), "should leave no temporary files behind")
+
+	o, _ = Open(filepath.Join(dir, "new.txt"))
+	o.Discard()
+
+	_, err = os.Stat(filepath.Join(dir, "new.txt"))
+	assert.True(os.IsNotExist(err), "should not create output file, if output is discarded")
+}
+
+func TestOutput_Stdout(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, path := range []string{"", "-"} {
+		o, err := Open(path)
+
+		assert.Nil(err)
+		assert.True(o.stdout)
+		assert.Nil(o.Commit())
+		o.Discard()
+	}
+
+	_, err := Open("/i/do/not/exist/tags.txt")
+	assert.NotNil(err, "should fail, if output directory does not exist")
+}
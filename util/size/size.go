@@ -0,0 +1,43 @@
+// Package size parses (and formats) human-friendly data sizes, e.g. "512K", "10M" or "20G"
+package size
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var multipliers = map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+
+// Parse parses size string (number of bytes) with an optional K, M, G or T suffix, e.g. "512K" or "20G"
+// NB! Empty string gives 0.
+func Parse(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	if m, defined := multipliers[s[len(s)-1:]]; defined {
+		multiplier = m
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size (should be a number of bytes, e.g. 512K or 20G): %s", s)
+	}
+
+	return n * multiplier, nil
+}
+
+// Format formats number of bytes with the biggest K, M, G or T suffix giving at least 1 of its units, e.g. "14.2G"
+func Format(n int64) string {
+	for _, suffix := range []string{"T", "G", "M", "K"} {
+		if m := multipliers[suffix]; n >= m {
+			return strconv.FormatFloat(float64(n)/float64(m), 'f', 1, 64) + suffix
+		}
+	}
+
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,50 @@
+package size
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	var testCases = map[string]int64{
+		"":     0,
+		"0":    0,
+		"100":  100,
+		"512k": 512 * 1024,
+		"20G":  20 * 1024 * 1024 * 1024,
+		" 2T ": 2 * 1024 * 1024 * 1024 * 1024,
+	}
+
+	assert := assert.New(t)
+
+	for s, expected := range testCases {
+		n, err := Parse(s)
+
+		assert.Nil(err, "should be no error (size: %s)", s)
+		assert.Equal(expected, n, "unexpected size parsed from: %s", s)
+	}
+
+	for _, s := range []string{"huge", "10X", "-1K", "G"} {
+		_, err := Parse(s)
+
+		assert.NotNil(err, "should be an error (size: %s)", s)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var testCases = map[int64]string{
+		0:                     "0",
+		100:                   "100",
+		512 * 1024:            "512.0K",
+		1536 * 1024 * 1024:    "1.5G",
+		15246931968:           "14.2G",
+		2 * 1024 * 1024 << 20: "2.0T",
+	}
+
+	assert := assert.New(t)
+
+	for n, expected := range testCases {
+		assert.Equal(expected, Format(n), "unexpected size formatted from: %d", n)
+	}
+}
@@ -0,0 +1,121 @@
+// Package throttle limits rate of data transfer (shared across all readers wrapped with the same limiter)
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ivanilves/lstags/util/size"
+)
+
+// Limiter limits data transfer rate to a number of bytes per second
+// NB! nil *Limiter is valid and does not limit anything.
+type Limiter struct {
+	rate int64
+	next time.Time
+	mux  sync.Mutex
+}
+
+// New creates a new Limiter for the rate (bytes per second) passed, or nil, if rate is not positive
+func New(rate int64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &Limiter{rate: rate}
+}
+
+// ParseRate parses rate string (bytes per second) with an optional K, M or G suffix, e.g. "512K" or "10M"
+// NB! Empty string or "0" means "no limit" and gives 0.
+func ParseRate(s string) (int64, error) {
+	rate, err := size.Parse(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate (should be a number of bytes per second, e.g. 512K or 10M): %s", s)
+	}
+
+	return rate, nil
+}
+
+// Rate gives rate (bytes per second) limited to
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.rate
+}
+
+// chunkSize is a maximum number of bytes we pass through at once (~1/10 of a second worth of data)
+func (l *Limiter) chunkSize(n int) int {
+	limit := int(l.rate / 10)
+	if limit < 1 {
+		limit = 1
+	}
+
+	if n > limit {
+		return limit
+	}
+
+	return n
+}
+
+// Wait blocks until passing n more bytes would keep us within the rate (or until context is done)
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return ctx.Err()
+	}
+
+	l.mux.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mux.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type reader struct {
+	ctx context.Context
+	l   *Limiter
+	r   io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if err := r.l.Wait(r.ctx, r.l.chunkSize(len(p))); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p[:r.l.chunkSize(len(p))])
+}
+
+// Reader wraps reader passed to limit reading rate (reading fails with context error, once context is done)
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{ctx: ctx, l: l, r: r}
+}
@@ -0,0 +1,78 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	var testCases = map[string]int64{
+		"":     0,
+		"0":    0,
+		"100":  100,
+		"512K": 512 * 1024,
+		"10m":  10 * 1024 * 1024,
+		"1G":   1024 * 1024 * 1024,
+	}
+
+	assert := assert.New(t)
+
+	for s, expected := range testCases {
+		rate, err := ParseRate(s)
+
+		assert.Nil(err, "should be no error (rate: %s)", s)
+		assert.Equal(expected, rate, "unexpected rate parsed from: %s", s)
+	}
+
+	for _, s := range []string{"fast", "10X", "-1K", "K"} {
+		_, err := ParseRate(s)
+
+		assert.NotNil(err, "should be an error (rate: %s)", s)
+	}
+}
+
+func TestReader(t *testing.T) {
+	assert := assert.New(t)
+
+	l := New(10 * 1024)
+	data := bytes.Repeat([]byte("x"), 4*1024)
+
+	start := time.Now()
+	read, err := ioutil.ReadAll(l.Reader(context.Background(), bytes.NewReader(data)))
+
+	assert.Nil(err)
+	assert.Equal(data, read)
+	assert.True(time.Since(start) >= 300*time.Millisecond, "should read 4KB at 10KB/s no faster than in ~0.4s")
+}
+
+func TestReader_Cancel(t *testing.T) {
+	l := New(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := l.Reader(ctx, bytes.NewReader(bytes.Repeat([]byte("x"), 100)))
+
+	io.ReadFull(r, make([]byte, 1))
+	cancel()
+
+	_, err := ioutil.ReadAll(r)
+
+	assert.Equal(t, context.Canceled, err, "should stop reading once context is cancelled")
+}
+
+func TestNil(t *testing.T) {
+	var l *Limiter
+
+	assert := assert.New(t)
+
+	r := bytes.NewReader([]byte("data"))
+
+	assert.Nil(New(0))
+	assert.Equal(int64(0), l.Rate())
+	assert.Equal(r, l.Reader(context.Background(), r), "nil limiter should not wrap anything")
+}
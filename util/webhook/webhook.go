@@ -0,0 +1,112 @@
+// Package webhook notifies external systems (e.g. Slack or CI) by POSTing a payload to the webhook URL
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// Timeout is how long we wait for the webhook to respond
+var Timeout = 30 * time.Second
+
+// Webhook POSTs payloads to the URL, either as JSON or rendered with a template
+type Webhook struct {
+	url      string
+	tpl      *template.Template
+	headers  http.Header
+	username string
+	password string
+}
+
+// New creates a new Webhook. Payload template (if not empty) is a go template, sprig functions are supported
+// (e.g. '{"text":"{{ .Status }}"}'), headers are "Name: value" strings, basic auth (if not empty) is a "username:password" pair.
+func New(url, payloadTemplate string, headers []string, basicAuth string) (*Webhook, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("invalid webhook URL (should be http:// or https:// one): %s", url)
+	}
+
+	w := &Webhook{url: url, headers: http.Header{"Content-Type": []string{"application/json"}}}
+
+	if payloadTemplate != "" {
+		tpl, err := template.New("webhook-template").Funcs(sprig.TxtFuncMap()).Parse(payloadTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		w.tpl = tpl
+	}
+
+	for _, header := range headers {
+		nv := strings.SplitN(header, ":", 2)
+		if len(nv) != 2 || strings.TrimSpace(nv[0]) == "" {
+			return nil, fmt.Errorf("invalid webhook header (should be 'Name: value'): %s", header)
+		}
+
+		w.headers.Set(strings.TrimSpace(nv[0]), strings.TrimSpace(nv[1]))
+	}
+
+	if basicAuth != "" {
+		up := strings.SplitN(basicAuth, ":", 2)
+		if len(up) != 2 || up[0] == "" {
+			return nil, fmt.Errorf("invalid webhook basic auth (should be 'username:password')")
+		}
+
+		w.username, w.password = up[0], up[1]
+	}
+
+	return w, nil
+}
+
+// Render gives us the payload data passed rendered with the template, or encoded as JSON, if there is no template
+func (w *Webhook) Render(data interface{}) ([]byte, error) {
+	if w.tpl == nil {
+		return json.Marshal(data)
+	}
+
+	var buf bytes.Buffer
+	if err := w.tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Send POSTs payload data passed (rendered, see Render) to the webhook, non-2xx response is an error
+func (w *Webhook) Send(data interface{}) error {
+	payload, err := w.Render(data)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	for name, values := range w.headers {
+		req.Header[name] = values
+	}
+
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := (&http.Client{Timeout: Timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+
+	return nil
+}
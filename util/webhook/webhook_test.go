@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type payload struct {
+	Status string `json:"status"`
+	Failed int    `json:"failed"`
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = ioutil.ReadAll(r.Body)
+
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	assert := assert.New(t)
+
+	w, err := New(server.URL, "", []string{"X-Token: secret"}, "user:pass")
+	assert.Nil(err)
+
+	assert.Nil(w.Send(payload{Status: "failure", Failed: 2}))
+	assert.Equal("POST", got.Method)
+	assert.Equal(`{"status":"failure","failed":2}`, string(body), "should send payload as JSON")
+	assert.Equal("application/json", got.Header.Get("Content-Type"))
+	assert.Equal("secret", got.Header.Get("X-Token"))
+
+	username, password, defined := got.BasicAuth()
+	assert.True(defined)
+	assert.Equal("user", username)
+	assert.Equal("pass", password)
+
+	w, err = New(server.URL, `{"text":"{{ .Status | upper }}: {{ .Failed }} failed"}`, nil, "")
+	assert.Nil(err)
+
+	assert.Nil(w.Send(payload{Status: "failure", Failed: 2}))
+	assert.Equal(`{"text":"FAILURE: 2 failed"}`, string(body), "should render payload with template")
+
+	w, _ = New(server.URL+"/fail", "", nil, "")
+
+	assert.NotNil(w.Send(payload{}), "should fail on non-2xx response")
+}
+
+func TestNew_Invalid(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, args := range [][]string{
+		{"ftp://hooks.company.io", "", "", ""},
+		{"https://hooks.company.io", "{{ .Status", "", ""},
+		{"https://hooks.company.io", "", "X-Token", ""},
+		{"https://hooks.company.io", "", "X-Token: secret", "user"},
+	} {
+		var headers []string
+		if args[2] != "" {
+			headers = []string{args[2]}
+		}
+
+		_, err := New(args[0], args[1], headers, args[3])
+
+		assert.NotNil(err, "should fail on invalid arguments: %+v", args)
+	}
+}